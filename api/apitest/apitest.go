@@ -0,0 +1,71 @@
+// Package apitest provides a fake Pangolin API server for the tests of the
+// packages that talk to one.
+package apitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Server is a Pangolin API on a local port
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+// NewServer starts a server that answers the health check, serves info as
+// the discovery document unless it is nil, and passes API requests to
+// handlers. Handlers are keyed by method and path, like the patterns of
+// http.ServeMux, relative to /api/v1. The server is closed when the test
+// ends.
+func NewServer[T any](t testing.TB, info *T, handlers map[string]http.HandlerFunc) *Server {
+	s := &Server{requests: make(map[string]int)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"Healthy"}`))
+	})
+	mux.HandleFunc("GET /.well-known/pangolin", func(w http.ResponseWriter, r *http.Request) {
+		if info == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	})
+	for pattern, handler := range handlers {
+		method, path, _ := strings.Cut(pattern, " ")
+		mux.HandleFunc(method+" /api/v1"+path, func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			s.requests[pattern]++
+			s.mu.Unlock()
+			handler(w, r)
+		})
+	}
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Count returns the number of requests to pattern
+func (s *Server) Count(pattern string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[pattern]
+}
+
+// Respond writes data in the response envelope of the API
+func Respond(w http.ResponseWriter, status int, data any) {
+	success := status < 300
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Success bool `json:"success"`
+		Status  int  `json:"status"`
+		Data    any  `json:"data,omitempty"`
+	}{success, status, data})
+}
@@ -0,0 +1,125 @@
+//go:build windows
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/fosrl/windows/version"
+)
+
+// Capability is an optional part of the API that a server advertises in its
+// discovery document
+type Capability string
+
+const (
+	// CapabilityMyDevice is GetMyDevice
+	CapabilityMyDevice Capability = "my-device"
+	// CapabilitySiteResources is ListOrgSiteResources
+	CapabilitySiteResources Capability = "site-resources"
+)
+
+// Supports reports whether the server supports c. Servers that advertise no
+// capabilities predate them and support everything this client uses.
+func (info ServerInfo) Supports(c Capability) bool {
+	return info.Capabilities == nil || slices.Contains(info.Capabilities, c)
+}
+
+// ClientTooOldError is the server refusing this version of the client
+type ClientTooOldError struct {
+	// MinVersion is the oldest version the server accepts, if it said
+	MinVersion string
+}
+
+func (e *ClientTooOldError) Error() string {
+	if e.MinVersion == "" {
+		return "the server requires a newer version of Pangolin"
+	}
+	return fmt.Sprintf("the server requires Pangolin %s or later", e.MinVersion)
+}
+
+// IsUnsupported reports whether err is a call the server does not support
+func IsUnsupported(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Type == ErrorTypeUnsupported
+}
+
+// IsClientTooOld reports whether err is the server refusing this version of
+// the client, and returns the version it requires if it said
+func IsClientTooOld(err error) (string, bool) {
+	var tooOld *ClientTooOldError
+	if !errors.As(err, &tooOld) {
+		return "", false
+	}
+	return tooOld.MinVersion, true
+}
+
+// ServerInfo returns the discovery document of the server, reading it the
+// first time. Servers without one have an empty ServerInfo. It is read again
+// after a failure to reach the server.
+func (c *APIClient) ServerInfo() (ServerInfo, error) {
+	c.serverMu.Lock()
+	defer c.serverMu.Unlock()
+	if c.serverInfo != nil {
+		return *c.serverInfo, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	resp, body, _, err := discoveryGet(ctx, c.baseURL, discoveryPath)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	var info ServerInfo
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &info) != nil {
+		info = ServerInfo{}
+	}
+	logger.Info("Server %s: version %q, API version %d, capabilities %v", c.baseURL, info.Version, info.APIVersion, info.Capabilities)
+	c.serverInfo = &info
+	return info, nil
+}
+
+// Supports reports whether the server supports c. It is assumed to if its
+// discovery document cannot be read.
+func (c *APIClient) Supports(capability Capability) bool {
+	info, err := c.ServerInfo()
+	return err != nil || info.Supports(capability)
+}
+
+// requireCapability returns an error if the server does not support
+// capability or does not accept this client. If the discovery document
+// cannot be read, the call is made anyway and reports its own error.
+func (c *APIClient) requireCapability(capability Capability) error {
+	info, err := c.ServerInfo()
+	if err != nil {
+		return nil
+	}
+	if CheckCompatibility(version.Number, info) == ClientTooOld {
+		return c.clientTooOld()
+	}
+	if !info.Supports(capability) {
+		return &APIError{
+			Type:    ErrorTypeUnsupported,
+			Message: fmt.Sprintf("The server at %s does not support %s", c.baseURL, capability),
+		}
+	}
+	return nil
+}
+
+// clientTooOld returns the error for the server refusing this client, with
+// the version it requires if its discovery document says
+func (c *APIClient) clientTooOld() error {
+	info, _ := c.ServerInfo()
+	tooOld := &ClientTooOldError{MinVersion: info.MinClientVersion}
+	logger.Warn("Server %s refuses Pangolin %s: %v", c.baseURL, version.Number, tooOld)
+	return &APIError{
+		Type:    ErrorTypeClientTooOld,
+		Message: fmt.Sprintf("The server at %s requires a newer version of Pangolin. Please update.", c.baseURL),
+		Err:     tooOld,
+	}
+}
@@ -9,10 +9,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/version"
 )
 
 // APIError represents an error from the API client
@@ -21,6 +25,9 @@ type APIError struct {
 	Status  int
 	Message string
 	Err     error
+	// RetryAfter is how long the server asked to wait before retrying, from
+	// the Retry-After header of an HTTP error
+	RetryAfter time.Duration
 }
 
 type ErrorType int
@@ -31,6 +38,14 @@ const (
 	ErrorTypeHTTPError
 	ErrorTypeNetworkError
 	ErrorTypeDecodingError
+	// ErrorTypeTLSError is a certificate the server profile or the system
+	// does not trust, or a server profile that cannot be used
+	ErrorTypeTLSError
+	// ErrorTypeUnsupported is a call the server does not advertise support
+	// for
+	ErrorTypeUnsupported
+	// ErrorTypeClientTooOld is the server refusing this version of the client
+	ErrorTypeClientTooOld
 )
 
 func (e *APIError) Error() string {
@@ -57,6 +72,15 @@ func (e *APIError) Error() string {
 			return fmt.Sprintf("Failed to decode response: %v", e.Err)
 		}
 		return "Failed to decode response"
+	case ErrorTypeTLSError:
+		if e.Err != nil {
+			return e.Err.Error()
+		}
+		return "TLS error"
+	case ErrorTypeUnsupported:
+		return "Not supported by the server"
+	case ErrorTypeClientTooOld:
+		return "The server requires a newer version of Pangolin. Please update."
 	default:
 		return "Unknown error"
 	}
@@ -66,6 +90,10 @@ func (e *APIError) Unwrap() error {
 	return e.Err
 }
 
+// agentName is the User-Agent of the requests to the Pangolin API, which
+// tells the server the version of the client
+var agentName = fmt.Sprintf("pangolin-windows/%s (%s; %s)", version.Number, version.OsName(), version.Arch())
+
 // APIClient handles HTTP requests to the Pangolin API
 type APIClient struct {
 	baseURL           string
@@ -74,11 +102,19 @@ type APIClient struct {
 	csrfToken         string
 	agentName         string
 	client            *http.Client
+	// profileErr is why the TLS profile of the server cannot be used
+	profileErr error
+
+	// serverInfo is the discovery document of the server at baseURL, read
+	// the first time a capability is checked
+	serverMu   sync.Mutex
+	serverInfo *ServerInfo
 }
 
 // NewAPIClient creates a new API client instance
 func NewAPIClient(baseURL string, sessionToken string) *APIClient {
 	normalizedURL := normalizeBaseURL(baseURL)
+	logging.RegisterSecret(sessionToken)
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
@@ -89,9 +125,10 @@ func NewAPIClient(baseURL string, sessionToken string) *APIClient {
 		sessionToken:      sessionToken,
 		sessionCookieName: "p_session_token",
 		csrfToken:         "x-csrf-protection",
-		agentName:         "pangolin-windows",
+		agentName:         agentName,
 		client:            client,
 	}
+	apiClient.applyServerProfile()
 
 	logger.Info("APIClient initialized with baseURL: %s", apiClient.baseURL)
 	return apiClient
@@ -100,10 +137,15 @@ func NewAPIClient(baseURL string, sessionToken string) *APIClient {
 // UpdateBaseURL updates the base URL for the API client
 func (c *APIClient) UpdateBaseURL(newBaseURL string) {
 	c.baseURL = normalizeBaseURL(newBaseURL)
+	c.applyServerProfile()
+	c.serverMu.Lock()
+	c.serverInfo = nil
+	c.serverMu.Unlock()
 }
 
 // UpdateSessionToken updates the session token
 func (c *APIClient) UpdateSessionToken(token string) {
+	logging.RegisterSecret(token)
 	c.sessionToken = token
 }
 
@@ -161,6 +203,9 @@ func (c *APIClient) makeRequest(method, path string, body []byte) ([]byte, *http
 	if err != nil {
 		return nil, nil, err
 	}
+	if c.profileErr != nil {
+		return nil, nil, &APIError{Type: ErrorTypeTLSError, Err: c.profileErr}
+	}
 
 	var bodyReader io.Reader
 	if body != nil {
@@ -183,10 +228,21 @@ func (c *APIClient) makeRequest(method, path string, body []byte) ([]byte, *http
 		req.Header.Set("Cookie", fmt.Sprintf("%s=%s", c.sessionCookieName, c.sessionToken))
 	}
 
-	logger.Info("Making request to: %s", fullURL)
+	logger.Info("Making request to: %s %s", method, logging.RedactURL(fullURL))
 
 	resp, err := c.client.Do(req)
 	if err != nil {
+		// Certificate errors are not transient, so they are not network errors
+		if msg, ok := tlsErrorMessage(err, c.baseURL); ok {
+			logger.Error("%s", msg)
+			return nil, nil, &APIError{Type: ErrorTypeTLSError, Message: msg, Err: err}
+		}
+
+		if proxy.IsAuthenticationError(err) {
+			logger.Error("Proxy authentication failed: %v", err)
+			return nil, nil, &APIError{Type: ErrorTypeNetworkError, Message: proxy.ErrAuthenticationRequired.Error(), Err: err}
+		}
+
 		// Handle network errors with more specific messages
 		if urlErr, ok := err.(*url.Error); ok {
 			if urlErr.Timeout() {
@@ -220,6 +276,9 @@ func (c *APIClient) makeRequest(method, path string, body []byte) ([]byte, *http
 // parseResponse parses the API response and returns the data
 func (c *APIClient) parseResponse(data []byte, resp *http.Response, result interface{}) error {
 	// Check HTTP status first
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		return c.clientTooOld()
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		// Try to parse error message from response
 		var errorResponse APIResponse[EmptyResponse]
@@ -229,17 +288,19 @@ func (c *APIClient) parseResponse(data []byte, resp *http.Response, result inter
 				message = getDefaultHTTPErrorMessage(resp.StatusCode)
 			}
 			return &APIError{
-				Type:    ErrorTypeHTTPError,
-				Status:  resp.StatusCode,
-				Message: message,
+				Type:       ErrorTypeHTTPError,
+				Status:     resp.StatusCode,
+				Message:    message,
+				RetryAfter: retryAfter(resp),
 			}
 		}
 
 		// Fallback to default error message
 		return &APIError{
-			Type:    ErrorTypeHTTPError,
-			Status:  resp.StatusCode,
-			Message: getDefaultHTTPErrorMessage(resp.StatusCode),
+			Type:       ErrorTypeHTTPError,
+			Status:     resp.StatusCode,
+			Message:    getDefaultHTTPErrorMessage(resp.StatusCode),
+			RetryAfter: retryAfter(resp),
 		}
 	}
 
@@ -311,6 +372,21 @@ func (c *APIClient) parseResponse(data []byte, resp *http.Response, result inter
 	return nil
 }
 
+// retryAfter parses the Retry-After header, in seconds or as a date
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
 // getDefaultHTTPErrorMessage returns a default error message for HTTP status codes
 func getDefaultHTTPErrorMessage(statusCode int) string {
 	switch statusCode {
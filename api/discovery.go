@@ -0,0 +1,355 @@
+//go:build windows
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fosrl/windows/version"
+)
+
+const (
+	// healthPath is the health check of the API, which every Pangolin
+	// server answers with {"message":"Healthy"}
+	healthPath = "/api/v1/"
+	// discoveryPath is the optional discovery document of a Pangolin server,
+	// with its version and capabilities
+	discoveryPath = "/.well-known/pangolin"
+	// maxDiscoveryRedirects bounds the redirects followed while discovering
+	maxDiscoveryRedirects = 5
+	// discoveryTimeout bounds each request while discovering
+	discoveryTimeout = 10 * time.Second
+)
+
+// MinServerVersion is the oldest server version this client is known to
+// work with
+const MinServerVersion = "1.0.0"
+
+// Compatibility is whether the client and a server can work together
+type Compatibility int
+
+const (
+	// Compatible means both versions are supported
+	Compatible Compatibility = iota
+	// CompatibilityUnknown means the server did not say its version
+	CompatibilityUnknown
+	// ClientTooOld means the server requires a newer client
+	ClientTooOld
+	// ServerTooOld means the server is older than MinServerVersion
+	ServerTooOld
+)
+
+func (c Compatibility) String() string {
+	switch c {
+	case Compatible:
+		return "compatible"
+	case CompatibilityUnknown:
+		return "unknown"
+	case ClientTooOld:
+		return "client-too-old"
+	case ServerTooOld:
+		return "server-too-old"
+	default:
+		return fmt.Sprintf("Compatibility(%d)", int(c))
+	}
+}
+
+// Discovery is what discovering a server found out
+type Discovery struct {
+	// BaseURL is the URL of the server after following permanent redirects
+	BaseURL string
+	// Info has no version on servers without a discovery document
+	Info          ServerInfo
+	Compatibility Compatibility
+	// Warning is set when the server did not answer its health check like a
+	// Pangolin server. Signing in may still work, behind a gateway that
+	// rewrites the answer for instance.
+	Warning string
+}
+
+// Redirected reports whether the server moved from the URL that was entered
+func (d *Discovery) Redirected(entered string) bool {
+	normalized, err := ParseServerURL(entered)
+	return err == nil && normalized != d.BaseURL
+}
+
+// Describe returns the server version and edition for display
+func (d *Discovery) Describe() string {
+	if d.Info.Version == "" {
+		return "Pangolin (version unknown)"
+	}
+	if d.Info.Edition == "" {
+		return "Pangolin " + d.Info.Version
+	}
+	edition := d.Info.Edition
+	return fmt.Sprintf("Pangolin %s (%s%s)", d.Info.Version, strings.ToUpper(edition[:1]), edition[1:])
+}
+
+// ParseServerURL checks a server address as entered and returns it
+// normalized like the base URL of a client
+func ParseServerURL(server string) (string, error) {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return "", errors.New("enter the address of the server")
+	}
+	if strings.ContainsAny(server, " \t") {
+		return "", fmt.Errorf("the server address %q contains spaces", server)
+	}
+	if scheme, _, ok := strings.Cut(server, "://"); ok && scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("the server address must start with https://, not %s://", scheme)
+	}
+	normalized := normalizeBaseURL(server)
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", fmt.Errorf("the server address %q is not a valid URL", server)
+	}
+	if u.User != nil {
+		return "", errors.New("the server address must not contain a user name or password")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.New("the server address must not contain a query or fragment")
+	}
+	if !validHost(u.Hostname()) {
+		return "", fmt.Errorf("%q is not a valid host name", u.Hostname())
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%q is not a valid port", port)
+		}
+	}
+	return normalized, nil
+}
+
+// validHost reports whether host is an IP address or a host name
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// DiscoverServer checks that server answers like a Pangolin server before
+// signing in to it, and finds out its version and edition from its discovery
+// document if it has one. Permanent redirects move the server to their
+// target. Temporary redirects are followed without. A server that answers,
+// but not like a Pangolin server, is reported in Discovery.Warning rather
+// than as an error.
+func DiscoverServer(ctx context.Context, server string) (*Discovery, error) {
+	baseURL, err := ParseServerURL(server)
+	if err != nil {
+		return nil, &APIError{Type: ErrorTypeInvalidURL, Message: err.Error(), Err: err}
+	}
+
+	resp, body, baseURL, err := discoveryGet(ctx, baseURL, healthPath)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &Discovery{BaseURL: baseURL, Compatibility: CompatibilityUnknown}
+	if !healthy(resp, body) {
+		logger.Warn("%s did not answer its health check like a Pangolin server: HTTP %d from %s", baseURL, resp.StatusCode, healthPath)
+		discovery.Warning = fmt.Sprintf("%s did not answer like a Pangolin server (HTTP %d). Check the server address if signing in fails.", baseURL, resp.StatusCode)
+	}
+
+	// Servers without a discovery document only have no version to show
+	resp, body, _, err = discoveryGet(ctx, baseURL, discoveryPath)
+	var info ServerInfo
+	if err == nil && resp.StatusCode == http.StatusOK && json.Unmarshal(body, &info) == nil && info.Version != "" {
+		discovery.Info = info
+		discovery.Compatibility = CheckCompatibility(version.Number, info)
+	}
+	logger.Info("Discovered %s at %s (%s)", discovery.Describe(), baseURL, discovery.Compatibility)
+	return discovery, nil
+}
+
+// healthy reports whether a response to the health check is the one of a
+// Pangolin server: {"message":"Healthy"}, or the response envelope of the
+// API
+func healthy(resp *http.Response, body []byte) bool {
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	var envelope APIResponse[json.RawMessage]
+	if json.Unmarshal(body, &envelope) != nil {
+		return false
+	}
+	return strings.EqualFold(envelope.Message, "Healthy") || envelope.Success != nil || envelope.Error != nil
+}
+
+// discoveryGet requests path of the server, following redirects. It returns
+// the base URL, moved by the permanent redirects that kept path.
+func discoveryGet(ctx context.Context, baseURL, path string) (*http.Response, []byte, string, error) {
+	target := baseURL + path
+	// Once a temporary redirect was followed, later ones do not move the
+	// server
+	permanent := true
+	for range maxDiscoveryRedirects + 1 {
+		transport, err := transportFor(target)
+		if err != nil {
+			return nil, nil, baseURL, &APIError{Type: ErrorTypeTLSError, Err: err}
+		}
+		client := &http.Client{
+			Transport: transport,
+			Timeout:   discoveryTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, nil, baseURL, &APIError{Type: ErrorTypeInvalidURL, Err: err}
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", agentName)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if msg, ok := tlsErrorMessage(err, baseURL); ok {
+				return nil, nil, baseURL, &APIError{Type: ErrorTypeTLSError, Message: msg, Err: err}
+			}
+			return nil, nil, baseURL, &APIError{
+				Type:    ErrorTypeNetworkError,
+				Message: fmt.Sprintf("Could not reach %s: %v", baseURL, err),
+				Err:     err,
+			}
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, baseURL, &APIError{Type: ErrorTypeInvalidResponse, Err: err}
+		}
+
+		switch resp.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect,
+			http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect:
+		default:
+			return resp, body, baseURL, nil
+		}
+
+		location, err := resp.Location()
+		if err != nil {
+			return nil, nil, baseURL, &APIError{Type: ErrorTypeInvalidResponse, Message: fmt.Sprintf("%s redirected without a location", baseURL), Err: err}
+		}
+		if req.URL.Scheme == "https" && location.Scheme != "https" {
+			return nil, nil, baseURL, &APIError{
+				Type:    ErrorTypeInvalidResponse,
+				Message: fmt.Sprintf("%s redirected to an insecure address (%s)", baseURL, location.Redacted()),
+			}
+		}
+		if resp.StatusCode != http.StatusMovedPermanently && resp.StatusCode != http.StatusPermanentRedirect {
+			permanent = false
+		}
+		if permanent && strings.HasSuffix(location.Path, path) {
+			moved := *location
+			moved.Path = strings.TrimSuffix(location.Path, path)
+			moved.RawPath, moved.RawQuery, moved.Fragment = "", "", ""
+			logger.Info("Server %s moved permanently to %s", baseURL, moved.String())
+			baseURL = normalizeBaseURL(moved.String())
+		}
+		target = location.String()
+	}
+	return nil, nil, baseURL, &APIError{
+		Type:    ErrorTypeInvalidResponse,
+		Message: fmt.Sprintf("%s redirected too many times", baseURL),
+	}
+}
+
+// CheckCompatibility tells whether a client of clientVersion works with a
+// server. Versions that cannot be compared are assumed to work.
+func CheckCompatibility(clientVersion string, info ServerInfo) Compatibility {
+	if info.MinClientVersion != "" {
+		if c, err := compareVersions(clientVersion, info.MinClientVersion); err == nil && c < 0 {
+			return ClientTooOld
+		}
+	}
+	if info.Version == "" {
+		return CompatibilityUnknown
+	}
+	if c, err := compareVersions(info.Version, MinServerVersion); err == nil && c < 0 {
+		return ServerTooOld
+	}
+	return Compatible
+}
+
+// compareVersions compares two dotted versions such as "1.12.3" or
+// "v1.12.3-rc.1" and returns -1, 0 or 1. A pre-release sorts before its
+// release.
+func compareVersions(a, b string) (int, error) {
+	aParts, aPre, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, bPre, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range max(len(aParts), len(bParts)) {
+		var x, y uint64
+		if i < len(aParts) {
+			x = aParts[i]
+		}
+		if i < len(bParts) {
+			y = bParts[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0, nil
+	case aPre:
+		return -1, nil
+	default:
+		return 1, nil
+	}
+}
+
+// parseVersion returns the numbers of a version and whether it is a
+// pre-release
+func parseVersion(v string) ([]uint64, bool, error) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, isPre := strings.Cut(v, "-")
+	if v == "" || (isPre && pre == "") {
+		return nil, false, fmt.Errorf("invalid version %q", v)
+	}
+	fields := strings.Split(v, ".")
+	parts := make([]uint64, len(fields))
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid version %q", v)
+		}
+		parts[i] = n
+	}
+	return parts, isPre, nil
+}
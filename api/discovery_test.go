@@ -0,0 +1,155 @@
+//go:build windows
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pangolin serves the health check of a Pangolin server, and info as its
+// discovery document if it is set
+func pangolin(info *ServerInfo) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"Healthy"}`))
+	})
+	if info != nil {
+		mux.HandleFunc("GET /.well-known/pangolin", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(info)
+		})
+	}
+	return mux
+}
+
+func serve(t *testing.T, handler http.Handler) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDiscoverServer(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		handler       http.Handler
+		compatibility Compatibility
+		version       string
+		warning       bool
+	}{
+		{"without discovery document", pangolin(nil), CompatibilityUnknown, "", false},
+		{"with discovery document", pangolin(&ServerInfo{Version: "1.12.0"}), Compatible, "1.12.0", false},
+		{"old server", pangolin(&ServerInfo{Version: "0.9.0"}), ServerTooOld, "0.9.0", false},
+		{"client too old", pangolin(&ServerInfo{Version: "1.12.0", MinClientVersion: "999.0.0"}), ClientTooOld, "1.12.0", false},
+		{"health check in the response envelope", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != healthPath {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"success":true,"status":200,"data":null}`))
+		}), CompatibilityUnknown, "", false},
+		{"web page", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>Welcome</html>"))
+		}), CompatibilityUnknown, "", true},
+		{"other JSON", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"message":"Hello"}`))
+		}), CompatibilityUnknown, "", true},
+		{"not found", http.NotFoundHandler(), CompatibilityUnknown, "", true},
+		{"server error", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}), CompatibilityUnknown, "", true},
+	} {
+		server := serve(t, tt.handler)
+		discovery, err := DiscoverServer(context.Background(), server.URL)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if discovery.BaseURL != server.URL || discovery.Compatibility != tt.compatibility || discovery.Info.Version != tt.version {
+			t.Errorf("%s: discovered %+v, want %s with version %q at %s", tt.name, discovery, tt.compatibility, tt.version, server.URL)
+		}
+		if (discovery.Warning != "") != tt.warning {
+			t.Errorf("%s: warning %q, want one: %v", tt.name, discovery.Warning, tt.warning)
+		}
+	}
+}
+
+func TestDiscoverServerRedirects(t *testing.T) {
+	target := serve(t, pangolin(nil))
+	for _, tt := range []struct {
+		status int
+		moved  bool
+	}{
+		{http.StatusMovedPermanently, true},
+		{http.StatusPermanentRedirect, true},
+		{http.StatusFound, false},
+		{http.StatusTemporaryRedirect, false},
+	} {
+		old := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target.URL+r.URL.Path, tt.status)
+		}))
+		discovery, err := DiscoverServer(context.Background(), old.URL)
+		if err != nil {
+			t.Errorf("HTTP %d: %v", tt.status, err)
+			continue
+		}
+		want := old.URL
+		if tt.moved {
+			want = target.URL
+		}
+		if discovery.BaseURL != want || discovery.Warning != "" {
+			t.Errorf("HTTP %d: discovered %s (warning %q), want %s", tt.status, discovery.BaseURL, discovery.Warning, want)
+		}
+		if discovery.Redirected(old.URL) != tt.moved {
+			t.Errorf("HTTP %d: Redirected() = %v", tt.status, !tt.moved)
+		}
+	}
+
+	loop := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+	}))
+	if _, err := DiscoverServer(context.Background(), loop.URL); err == nil {
+		t.Error("endless redirects were discovered")
+	}
+}
+
+func TestDiscoverServerErrors(t *testing.T) {
+	var apiErr *APIError
+	if _, err := DiscoverServer(context.Background(), "ftp://pangolin.example.com"); !errors.As(err, &apiErr) || apiErr.Type != ErrorTypeInvalidURL {
+		t.Errorf("invalid address: %v, want an invalid URL", err)
+	}
+
+	closed := httptest.NewServer(pangolin(nil))
+	closed.Close()
+	if _, err := DiscoverServer(context.Background(), closed.URL); !errors.As(err, &apiErr) || apiErr.Type != ErrorTypeNetworkError {
+		t.Errorf("unreachable server: %v, want a network error", err)
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		handler http.Handler
+		closed  bool
+		ok      bool
+	}{
+		{"Pangolin server", pangolin(nil), false, true},
+		// Only logged, since signing in may still work
+		{"unknown answer", http.NotFoundHandler(), false, true},
+		{"unreachable", pangolin(nil), true, false},
+	} {
+		server := httptest.NewServer(tt.handler)
+		if tt.closed {
+			server.Close()
+		}
+		ok, err := NewAPIClient(server.URL, "").TestConnection()
+		if ok != tt.ok || err != nil {
+			t.Errorf("%s: TestConnection() = %v, %v, want %v", tt.name, ok, err, tt.ok)
+		}
+		server.Close()
+	}
+}
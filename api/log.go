@@ -0,0 +1,9 @@
+//go:build windows
+
+package api
+
+import "github.com/fosrl/windows/logging"
+
+// logger is the api component logger; it shadows the newt logger package so
+// that every message from this package is attributed to the component.
+var logger = logging.Component(logging.ComponentAPI)
@@ -3,14 +3,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
-	"time"
+
+	"github.com/fosrl/windows/logging"
 )
 
-// Login authenticates a user with email and password
+// Login authenticates a user with email and password. If the response
+// requests a two-factor code there is no session yet, and the returned token
+// is empty.
 func (c *APIClient) Login(email, password string, code *string) (*LoginResponse, string, error) {
 	requestBody := LoginRequest{
 		Email:    email,
@@ -40,12 +44,89 @@ func (c *APIClient) Login(email, password string, code *string) (*LoginResponse,
 	}
 
 	if sessionToken == "" {
+		if loginResponse.CodeRequested != nil && *loginResponse.CodeRequested {
+			return &loginResponse, "", nil
+		}
 		return nil, "", &APIError{Type: ErrorTypeInvalidResponse, Message: "No session token in response"}
 	}
+	logging.RegisterSecret(sessionToken)
 
 	return &loginResponse, sessionToken, nil
 }
 
+// ListLoginIdps lists the identity providers users can sign in with. With an
+// organization ID it lists the ones of that organization, otherwise the ones
+// of the server.
+func (c *APIClient) ListLoginIdps(orgId string) (*ListIdpsResponse, error) {
+	path := "/idp"
+	if orgId != "" {
+		path = fmt.Sprintf("/org/%s/idp", url.PathEscape(orgId))
+	}
+
+	data, resp, err := c.makeRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response ListIdpsResponse
+	if err := c.parseResponse(data, resp, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// GenerateOidcURL returns the URL of the authorization page of an identity
+// provider, which redirects to the redirect URL of the request
+func (c *APIClient) GenerateOidcURL(idpId int, request GenerateOidcURLRequest) (*GenerateOidcURLResponse, error) {
+	bodyData, err := json.Marshal(request)
+	if err != nil {
+		return nil, &APIError{Type: ErrorTypeDecodingError, Err: err}
+	}
+
+	data, resp, err := c.makeRequest("POST", fmt.Sprintf("/auth/idp/%d/oidc/generate-url", idpId), bodyData)
+	if err != nil {
+		return nil, err
+	}
+
+	var response GenerateOidcURLResponse
+	if err := c.parseResponse(data, resp, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// ValidateOidcCallback exchanges the authorization code an identity provider
+// redirected with for a session, and returns its token
+func (c *APIClient) ValidateOidcCallback(idpId int, request ValidateOidcCallbackRequest) (string, error) {
+	bodyData, err := json.Marshal(request)
+	if err != nil {
+		return "", &APIError{Type: ErrorTypeDecodingError, Err: err}
+	}
+
+	data, resp, err := c.makeRequest("POST", fmt.Sprintf("/auth/idp/%d/oidc/validate-callback", idpId), bodyData)
+	if err != nil {
+		return "", err
+	}
+
+	var emptyResponse EmptyResponse
+	if err := c.parseResponse(data, resp, &emptyResponse); err != nil {
+		return "", err
+	}
+
+	sessionToken := extractCookie(resp, c.sessionCookieName)
+	if sessionToken == "" {
+		sessionToken = extractCookie(resp, "p_session")
+	}
+	if sessionToken == "" {
+		return "", &APIError{Type: ErrorTypeInvalidResponse, Message: "No session token in response"}
+	}
+	logging.RegisterSecret(sessionToken)
+
+	return sessionToken, nil
+}
+
 // StartDeviceAuth starts a device authentication flow
 func (c *APIClient) StartDeviceAuth(applicationName string, deviceName *string) (*DeviceAuthStartResponse, error) {
 	requestBody := DeviceAuthStartRequest{
@@ -96,9 +177,46 @@ func (c *APIClient) PollDeviceAuth(code string) (*DeviceAuthPollResponse, *strin
 		}
 	}
 
+	if sessionToken != nil {
+		logging.RegisterSecret(*sessionToken)
+	}
+
 	return &pollResponse, sessionToken, nil
 }
 
+// VerifyEmail verifies the email address of the current user with the code
+// that was sent to it
+func (c *APIClient) VerifyEmail(code string) (*VerifyEmailResponse, error) {
+	bodyData, err := json.Marshal(VerifyEmailRequest{Code: code})
+	if err != nil {
+		return nil, &APIError{Type: ErrorTypeDecodingError, Err: err}
+	}
+
+	data, resp, err := c.makeRequest("POST", "/auth/verify-email", bodyData)
+	if err != nil {
+		return nil, err
+	}
+
+	var response VerifyEmailResponse
+	if err := c.parseResponse(data, resp, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// RequestEmailVerificationCode sends a new verification code to the email
+// address of the current user
+func (c *APIClient) RequestEmailVerificationCode() error {
+	data, resp, err := c.makeRequest("POST", "/auth/verify-email/request", []byte("{}"))
+	if err != nil {
+		return err
+	}
+
+	var emptyResponse EmptyResponse
+	return c.parseResponse(data, resp, &emptyResponse)
+}
+
 // Logout logs out the current user
 func (c *APIClient) Logout() error {
 	data, resp, err := c.makeRequest("POST", "/auth/logout", []byte("{}"))
@@ -162,6 +280,7 @@ func (c *APIClient) CreateOlm(userId, name string) (*CreateOlmResponse, error) {
 	if err := c.parseResponse(data, resp, &response); err != nil {
 		return nil, err
 	}
+	logging.RegisterSecret(response.Secret)
 
 	return &response, nil
 }
@@ -232,6 +351,10 @@ func (c *APIClient) GetClient(clientId int) (*GetClientResponse, error) {
 
 // GetMyDevice gets the current device information including user, organizations, and OLM
 func (c *APIClient) GetMyDevice(olmId string) (*MyDeviceResponse, error) {
+	if err := c.requireCapability(CapabilityMyDevice); err != nil {
+		return nil, err
+	}
+
 	// Build query parameters
 	params := url.Values{}
 	params.Set("olmId", olmId)
@@ -250,28 +373,51 @@ func (c *APIClient) GetMyDevice(olmId string) (*MyDeviceResponse, error) {
 	return &response, nil
 }
 
-// TestConnection tests the connection to the API server
-func (c *APIClient) TestConnection() (bool, error) {
-	// Create a temporary client with shorter timeout for connection test
-	testClient := &http.Client{
-		Timeout: 10 * time.Second,
+// ListOrgSites lists the sites of an organization
+func (c *APIClient) ListOrgSites(orgId string) (*ListSitesResponse, error) {
+	path := fmt.Sprintf("/org/%s/sites", url.PathEscape(orgId))
+	data, resp, err := c.makeRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	// Use HEAD request to test connection
-	fullURL := c.baseURL
-	req, err := http.NewRequest("HEAD", fullURL, nil)
-	if err != nil {
-		return false, &APIError{Type: ErrorTypeInvalidURL, Err: err}
+	var response ListSitesResponse
+	if err := c.parseResponse(data, resp, &response); err != nil {
+		return nil, err
 	}
 
-	req.Header.Set("User-Agent", c.agentName)
+	return &response, nil
+}
 
-	resp, err := testClient.Do(req)
+// ListOrgSiteResources lists the resources clients can reach in an organization
+func (c *APIClient) ListOrgSiteResources(orgId string) (*ListSiteResourcesResponse, error) {
+	if err := c.requireCapability(CapabilitySiteResources); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/org/%s/site-resources", url.PathEscape(orgId))
+	data, resp, err := c.makeRequest("GET", path, nil)
 	if err != nil {
-		return false, nil // Return false (not an error) if connection fails
+		return nil, err
+	}
+
+	var response ListSiteResourcesResponse
+	if err := c.parseResponse(data, resp, &response); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Consider 200-299 and 404 as successful connection
-	return (resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == 404, nil
+	return &response, nil
+}
+
+// TestConnection tests the connection to the API server. It returns false
+// if the server cannot be reached, and an error if it cannot be used, such
+// as when its certificate is rejected. A server that answers, but not like a
+// Pangolin server, is only logged.
+func (c *APIClient) TestConnection() (bool, error) {
+	_, err := DiscoverServer(context.Background(), c.baseURL)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Type == ErrorTypeNetworkError {
+		return false, nil
+	}
+	return err == nil, err
 }
@@ -0,0 +1,122 @@
+//go:build windows
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fosrl/windows/api/apitest"
+)
+
+// newFakeServer starts a Pangolin API with info as its discovery document,
+// see apitest.NewServer. Every API request must carry the session token.
+func newFakeServer(t *testing.T, info *ServerInfo, handlers map[string]http.HandlerFunc) *apitest.Server {
+	checked := make(map[string]http.HandlerFunc, len(handlers))
+	for pattern, handler := range handlers {
+		checked[pattern] = func(w http.ResponseWriter, r *http.Request) {
+			if cookie, err := r.Cookie("p_session_token"); err != nil || cookie.Value != "token" {
+				t.Errorf("%s: session cookie %v, want token", pattern, cookie)
+			}
+			handler(w, r)
+		}
+	}
+	return apitest.NewServer(t, info, checked)
+}
+
+func TestListOrgSites(t *testing.T) {
+	subnet := "100.90.128.0/24"
+	fs := newFakeServer(t, nil, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			if org := r.PathValue("org"); org != "org a" {
+				t.Errorf("organization %q, want %q", org, "org a")
+			}
+			apitest.Respond(w, http.StatusOK, ListSitesResponse{Sites: []Site{
+				{SiteId: 1, NiceId: "office", Name: "Office", Online: true, Type: "newt", Subnet: &subnet},
+				{SiteId: 2, NiceId: "lab", Name: "Lab", Type: "wireguard"},
+			}})
+		},
+	})
+
+	response, err := NewAPIClient(fs.URL, "token").ListOrgSites("org a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Sites) != 2 {
+		t.Fatalf("%d sites, want 2", len(response.Sites))
+	}
+	office := response.Sites[0]
+	if office.Name != "Office" || !office.Online || office.Subnet == nil || *office.Subnet != subnet {
+		t.Errorf("first site %+v", office)
+	}
+	if lab := response.Sites[1]; lab.Online || lab.Subnet != nil {
+		t.Errorf("second site %+v", lab)
+	}
+}
+
+func TestListOrgSitesHTTPError(t *testing.T) {
+	fs := newFakeServer(t, nil, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			apitest.Respond(w, http.StatusTooManyRequests, nil)
+		},
+	})
+
+	_, err := NewAPIClient(fs.URL, "token").ListOrgSites("org")
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("error %v, want an APIError", err)
+	}
+	if apiErr.Type != ErrorTypeHTTPError || apiErr.Status != http.StatusTooManyRequests || apiErr.RetryAfter.Seconds() != 30 {
+		t.Errorf("error %+v, want HTTP 429 retrying after 30s", apiErr)
+	}
+}
+
+func TestListOrgSiteResources(t *testing.T) {
+	port := 5432
+	alias := "db.internal"
+	handlers := map[string]http.HandlerFunc{
+		"GET /org/{org}/site-resources": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, ListSiteResourcesResponse{SiteResources: []SiteResource{
+				{Id: 7, SiteId: 1, SiteName: "Office", Name: "Database", Mode: "host", Protocol: "tcp", Destination: "10.0.0.5", DestinationPort: &port, Alias: &alias},
+				{Id: 8, SiteId: 1, SiteName: "Office", Name: "LAN", Mode: "cidr", Destination: "10.0.0.0/24"},
+			}})
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		info *ServerInfo
+		// unsupported is set if the call must fail without a request
+		unsupported bool
+	}{
+		{name: "without a discovery document"},
+		{name: "without capabilities", info: &ServerInfo{Version: "1.10.0"}},
+		{name: "advertised", info: &ServerInfo{Version: "1.12.0", Capabilities: []Capability{CapabilitySiteResources}}},
+		{name: "not advertised", info: &ServerInfo{Version: "1.12.0", Capabilities: []Capability{CapabilityMyDevice}}, unsupported: true},
+	} {
+		fs := newFakeServer(t, tt.info, handlers)
+		response, err := NewAPIClient(fs.URL, "token").ListOrgSiteResources("org")
+		requests := fs.Count("GET /org/{org}/site-resources")
+		if tt.unsupported {
+			if !IsUnsupported(err) || requests != 0 {
+				t.Errorf("%s: error %v after %d requests, want unsupported without one", tt.name, err, requests)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(response.SiteResources) != 2 {
+			t.Errorf("%s: %d resources, want 2", tt.name, len(response.SiteResources))
+			continue
+		}
+		if database := response.SiteResources[0]; database.Address() != alias || database.DestinationPort == nil || *database.DestinationPort != port {
+			t.Errorf("%s: first resource %+v", tt.name, database)
+		}
+		if lan := response.SiteResources[1]; lan.Address() != "10.0.0.0/24" || lan.Mode != "cidr" {
+			t.Errorf("%s: second resource %+v", tt.name, lan)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+//go:build windows
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/tlsprofile"
+)
+
+var (
+	serverProfilesMu sync.RWMutex
+	serverProfiles   func(server string) (tlsprofile.Profile, bool)
+
+	proxyMu   sync.RWMutex
+	proxyFunc = proxy.FromSystem
+
+	// sharedTransport is used by the clients of servers without a profile
+	sharedTransport = newTransport(nil)
+)
+
+// SetProxy sets the outbound proxy of all clients. It applies to the next
+// request of clients that already exist.
+func SetProxy(cfg proxy.Config) error {
+	f, err := cfg.Func()
+	if err != nil {
+		return err
+	}
+	proxyMu.Lock()
+	proxyFunc = f
+	proxyMu.Unlock()
+	logger.Info("API proxy set to %s", cfg)
+	return nil
+}
+
+// currentProxy picks the proxy of a request with the current configuration
+func currentProxy(req *http.Request) (*url.URL, error) {
+	proxyMu.RLock()
+	f := proxyFunc
+	proxyMu.RUnlock()
+	if f == nil {
+		return nil, nil
+	}
+	return f(req)
+}
+
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = currentProxy
+	transport.TLSClientConfig = tlsConfig
+	return transport
+}
+
+// SetServerProfiles sets how clients look up the TLS profile of the server
+// they talk to. Clients look it up when they are created and when their base
+// URL changes.
+func SetServerProfiles(lookup func(server string) (tlsprofile.Profile, bool)) {
+	serverProfilesMu.Lock()
+	defer serverProfilesMu.Unlock()
+	serverProfiles = lookup
+}
+
+// transportFor returns the transport for a server, the shared one if it has
+// no profile
+func transportFor(baseURL string) (http.RoundTripper, error) {
+	serverProfilesMu.RLock()
+	lookup := serverProfiles
+	serverProfilesMu.RUnlock()
+	if lookup == nil {
+		return sharedTransport, nil
+	}
+
+	profile, ok := lookup(baseURL)
+	if !ok || profile.IsZero() {
+		return sharedTransport, nil
+	}
+	tlsConfig, err := profile.TLSConfig()
+	if err != nil {
+		return sharedTransport, fmt.Errorf("the server profile of %s cannot be used: %w", tlsprofile.HostKey(baseURL), err)
+	}
+	return newTransport(tlsConfig), nil
+}
+
+// applyServerProfile sets up the client for the TLS profile of its server.
+// A profile that cannot be used fails every request rather than falling back
+// to the system roots.
+func (c *APIClient) applyServerProfile() {
+	transport, err := transportFor(c.baseURL)
+	if err != nil {
+		logger.Error("%v", err)
+	}
+	c.profileErr = err
+	c.client.Transport = transport
+}
+
+// tlsErrorMessage returns a message for an error of the TLS handshake, or
+// false if err is not one
+func tlsErrorMessage(err error, baseURL string) (string, bool) {
+	var pinErr *tlsprofile.PinMismatchError
+	if errors.As(err, &pinErr) {
+		return pinErr.Error(), true
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		return fmt.Sprintf("The certificate of %s is not issued by a trusted authority. If the server uses a private CA, add its certificate to the server profile.", baseURL), true
+	}
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return fmt.Sprintf("The certificate of %s is not valid for its hostname: %v", baseURL, hostnameErr), true
+	}
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) {
+		return fmt.Sprintf("The certificate of %s is not valid: %v", baseURL, invalidErr), true
+	}
+	var verificationErr *tls.CertificateVerificationError
+	if errors.As(err, &verificationErr) {
+		return fmt.Sprintf("The certificate of %s could not be verified: %v", baseURL, verificationErr.Err), true
+	}
+	return "", false
+}
@@ -2,6 +2,13 @@
 
 package api
 
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/fosrl/windows/logging"
+)
+
 // APIResponse is the wrapper structure for all API responses
 type APIResponse[T any] struct {
 	Success *bool  `json:"success,omitempty"`
@@ -31,6 +38,52 @@ type LoginResponse struct {
 	EmailVerificationRequired *bool   `json:"emailVerificationRequired,omitempty"`
 }
 
+// VerifyEmailRequest represents a request to verify an email address
+type VerifyEmailRequest struct {
+	Code string `json:"code"`
+}
+
+// VerifyEmailResponse represents the response for verifying an email address
+type VerifyEmailResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// ListIdpsResponse represents the response for listing identity providers
+type ListIdpsResponse struct {
+	Idps []Idp `json:"idps"`
+}
+
+// Idp represents an external identity provider users can sign in with
+type Idp struct {
+	IdpId int    `json:"idpId"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+}
+
+// GenerateOidcURLRequest represents a request for the authorization URL of an
+// identity provider
+type GenerateOidcURLRequest struct {
+	RedirectUrl         string `json:"redirectUrl"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"codeChallenge"`
+	CodeChallengeMethod string `json:"codeChallengeMethod"`
+}
+
+// GenerateOidcURLResponse represents the response with the authorization URL
+// of an identity provider
+type GenerateOidcURLResponse struct {
+	RedirectUrl string `json:"redirectUrl"`
+}
+
+// ValidateOidcCallbackRequest represents a request to exchange an
+// authorization code for a session
+type ValidateOidcCallbackRequest struct {
+	Code         string `json:"code"`
+	State        string `json:"state"`
+	CodeVerifier string `json:"codeVerifier"`
+	RedirectUrl  string `json:"redirectUrl"`
+}
+
 // DeviceAuthStartRequest represents a device auth start request
 type DeviceAuthStartRequest struct {
 	ApplicationName string  `json:"applicationName"`
@@ -41,13 +94,26 @@ type DeviceAuthStartRequest struct {
 type DeviceAuthStartResponse struct {
 	Code             string `json:"code"`
 	ExpiresInSeconds int64  `json:"expiresInSeconds"`
+	// IntervalSeconds is how often the server wants to be polled, if it says
+	IntervalSeconds int64 `json:"intervalSeconds,omitempty"`
 }
 
+// Device auth poll statuses, for servers that report one
+const (
+	DeviceAuthStatusPending  = "pending"
+	DeviceAuthStatusSlowDown = "slow_down"
+	DeviceAuthStatusDenied   = "denied"
+	DeviceAuthStatusExpired  = "expired"
+)
+
 // DeviceAuthPollResponse represents a device auth poll response
 type DeviceAuthPollResponse struct {
 	Verified bool    `json:"verified"`
 	Token    *string `json:"token,omitempty"`
 	Message  *string `json:"message,omitempty"`
+	Status   *string `json:"status,omitempty"`
+	// IntervalSeconds replaces the polling interval, if set
+	IntervalSeconds int64 `json:"intervalSeconds,omitempty"`
 }
 
 // User represents a user
@@ -159,3 +225,152 @@ type MyDeviceResponse struct {
 	Orgs []ResponseOrg `json:"orgs"`
 	Olm  *Olm          `json:"olm,omitempty"`
 }
+
+// ListSitesResponse represents the response for listing the sites of an organization
+type ListSitesResponse struct {
+	Sites []Site `json:"sites"`
+}
+
+// Site represents a site of an organization
+type Site struct {
+	SiteId  int     `json:"siteId"`
+	NiceId  string  `json:"niceId"`
+	Name    string  `json:"name"`
+	Online  bool    `json:"online"`
+	Type    string  `json:"type"`
+	Address *string `json:"address,omitempty"`
+	Subnet  *string `json:"subnet,omitempty"`
+}
+
+// ListSiteResourcesResponse represents the response for listing the resources
+// clients can reach in an organization
+type ListSiteResourcesResponse struct {
+	SiteResources []SiteResource `json:"siteResources"`
+}
+
+// SiteResource represents a resource clients can reach through a site
+type SiteResource struct {
+	Id              int     `json:"siteResourceId"`
+	SiteId          int     `json:"siteId"`
+	SiteName        string  `json:"siteName"`
+	Name            string  `json:"name"`
+	Mode            string  `json:"mode"` // "host" or "cidr"
+	Protocol        string  `json:"protocol,omitempty"`
+	Destination     string  `json:"destination"`
+	DestinationPort *int    `json:"destinationPort,omitempty"`
+	Alias           *string `json:"alias,omitempty"`
+	Enabled         *bool   `json:"enabled,omitempty"`
+}
+
+// Address returns the name clients use to reach the resource: its alias if
+// it has one, its destination otherwise
+func (r SiteResource) Address() string {
+	if r.Alias != nil && *r.Alias != "" {
+		return *r.Alias
+	}
+	return r.Destination
+}
+
+// Port returns the port of the resource, or 0 if it has none
+func (r SiteResource) Port() int {
+	if r.DestinationPort == nil {
+		return 0
+	}
+	return *r.DestinationPort
+}
+
+// ServerInfo describes a Pangolin server, as published in its discovery
+// document
+type ServerInfo struct {
+	Version string `json:"version"`
+	// Edition is "community", "enterprise" or "cloud"
+	Edition string `json:"edition,omitempty"`
+	// MinClientVersion is the oldest client version the server accepts
+	MinClientVersion string `json:"minClientVersion,omitempty"`
+	// APIVersion is the version of the client API, 0 if not advertised
+	APIVersion int `json:"apiVersion,omitempty"`
+	// Capabilities lists the optional calls the server supports. Servers
+	// that do not advertise any are assumed to support them all.
+	Capabilities []Capability `json:"capabilities,omitempty"`
+}
+
+// String implements fmt.Stringer without the password
+func (r LoginRequest) String() string {
+	return fmt.Sprintf("{Email:%s Password:%s Code:%s}", r.Email, logging.SecretString(r.Password), logging.SecretString(derefString(r.Code)))
+}
+
+// LogValue implements slog.LogValuer without the password
+func (r LoginRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("email", r.Email),
+		slog.String("password", logging.SecretString(r.Password)),
+		slog.String("code", logging.SecretString(derefString(r.Code))),
+	)
+}
+
+// String implements fmt.Stringer without the code and verifier
+func (r ValidateOidcCallbackRequest) String() string {
+	return fmt.Sprintf("{Code:%s State:%s CodeVerifier:%s RedirectUrl:%s}", logging.SecretString(r.Code), r.State, logging.SecretString(r.CodeVerifier), r.RedirectUrl)
+}
+
+// LogValue implements slog.LogValuer without the code and verifier
+func (r ValidateOidcCallbackRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("code", logging.SecretString(r.Code)),
+		slog.String("state", r.State),
+		slog.String("codeVerifier", logging.SecretString(r.CodeVerifier)),
+		slog.String("redirectUrl", r.RedirectUrl),
+	)
+}
+
+// String implements fmt.Stringer without the session token
+func (r DeviceAuthPollResponse) String() string {
+	return fmt.Sprintf("{Verified:%v Token:%s Message:%s Status:%s}", r.Verified, logging.SecretString(derefString(r.Token)), derefString(r.Message), derefString(r.Status))
+}
+
+// LogValue implements slog.LogValuer without the session token
+func (r DeviceAuthPollResponse) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Bool("verified", r.Verified),
+		slog.String("token", logging.SecretString(derefString(r.Token))),
+		slog.String("message", derefString(r.Message)),
+		slog.String("status", derefString(r.Status)),
+	)
+}
+
+// String implements fmt.Stringer without the OLM secret
+func (r CreateOlmResponse) String() string {
+	return fmt.Sprintf("{Id:%s OlmId:%s Secret:%s Name:%s}", r.Id, r.OlmId, logging.SecretString(r.Secret), r.Name)
+}
+
+// LogValue implements slog.LogValuer without the OLM secret
+func (r CreateOlmResponse) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", r.Id),
+		slog.String("olmId", r.OlmId),
+		slog.String("secret", logging.SecretString(r.Secret)),
+		slog.String("name", r.Name),
+	)
+}
+
+// String implements fmt.Stringer without the OLM secret
+func (o Olm) String() string {
+	return fmt.Sprintf("{OlmId:%s UserId:%s Name:%s Secret:%s}", o.OlmId, o.UserId, derefString(o.Name), logging.SecretString(derefString(o.Secret)))
+}
+
+// LogValue implements slog.LogValuer without the OLM secret
+func (o Olm) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("olmId", o.OlmId),
+		slog.String("userId", o.UserId),
+		slog.String("name", derefString(o.Name)),
+		slog.String("secret", logging.SecretString(derefString(o.Secret))),
+	)
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,214 @@
+//go:build windows
+
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/config"
+)
+
+// ErrAccountNotFound is returned for a user ID that has no account
+var ErrAccountNotFound = errors.New("account does not exist")
+
+// AccountStore keeps the accounts signed in on this machine and which one
+// is active. It is implemented by config.AccountManager.
+type AccountStore interface {
+	ActiveAccount() (*config.Account, error)
+	Account(userID string) (config.Account, bool)
+	AddAccount(account config.Account) error
+	RemoveAccount(userID string) error
+	SetActiveUser(userID string) error
+	SetUserOrganization(userID string, orgID string) error
+	SetLabel(userID string, label string) error
+}
+
+// SecretStore keeps the session tokens and OLM credentials of the accounts.
+// It is implemented by secrets.SecretManager.
+type SecretStore interface {
+	GetSessionToken(userId string) (string, bool)
+	SaveSessionToken(userId string, token string) bool
+	DeleteSessionToken(userId string) bool
+	GetOlmId(userId string) (string, bool)
+	HasOlmCredentials(userId string) bool
+	SaveOlmCredentials(userId, olmId, secret string) bool
+	DeleteOlmCredentials(userId string) bool
+}
+
+// NeedsReauthentication reports whether an account has no session, because
+// it expired or was rejected, so that the user has to sign in to it again
+func (am *AuthManager) NeedsReauthentication(userID string) bool {
+	token, found := am.secretManager.GetSessionToken(userID)
+	return !found || token == ""
+}
+
+// SwitchAccount makes another account the active one. Its session is checked
+// first with a client of its own, so that nothing changes if the switch
+// fails. If the session expired, it returns an AuthError of type
+// AuthErrorSessionExpired and the user signs in to the account again. If the
+// server cannot be reached, the account's cached state is used until it can.
+func (am *AuthManager) SwitchAccount(userID string) error {
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+
+	account, exists := am.accountManager.Account(userID)
+	if !exists {
+		return ErrAccountNotFound
+	}
+
+	token, found := am.secretManager.GetSessionToken(userID)
+	if !found || token == "" {
+		return &AuthError{Type: AuthErrorSessionExpired}
+	}
+
+	// Always fetch the latest user info to verify the user exists and update stored info
+	user, err := api.NewAPIClient(account.Hostname, token).GetUser()
+	switch {
+	case err == nil:
+	case IsUnauthorized(err):
+		logger.Info("Session of the account to switch to has expired")
+		_ = am.secretManager.DeleteSessionToken(userID)
+		if am.cacheManager != nil {
+			_ = am.cacheManager.Remove(userID)
+		}
+		return &AuthError{Type: AuthErrorSessionExpired}
+	case isUnreachable(err):
+		logger.Error("Failed to fetch user while switching accounts: %v", err)
+		user = nil
+	default:
+		return err
+	}
+
+	am.generation++
+	am.apiClient.UpdateBaseURL(account.Hostname)
+	am.apiClient.UpdateSessionToken(token)
+	// Nothing of the previous account carries over, even if the
+	// organizations of this one cannot be fetched
+	am.mu.Lock()
+	am.updateRequired = nil
+	am.currentOrg = nil
+	am.organizations = nil
+	am.resources = Resources{}
+	am.mu.Unlock()
+	if err := am.accountManager.SetActiveUser(userID); err != nil {
+		logger.Warn("failed to set active user in accounts store: %v", err)
+	}
+
+	// Publish once the switch is complete, not the intermediate states
+	defer am.publishState()
+
+	if user == nil {
+		// Switch to the cached state of the account and check it again
+		// once the server can be reached
+		am.restoreCached(&account)
+		am.mu.Lock()
+		am.offline = true
+		am.mu.Unlock()
+		return nil
+	}
+
+	if user.UserId == "" {
+		user.UserId = user.Id
+	}
+	am.mu.Lock()
+	am.currentUser = user
+	am.offline = false
+	am.mu.Unlock()
+	am.updateCache(userID, func(cached *config.CachedAccount) {
+		cached.User = user
+		cached.UserFetchedAt = time.Now()
+	})
+
+	// Without any organization, the one of the account is kept for when
+	// they can be fetched
+	if selectedOrgID := am.ensureOrgIsSelected(account.OrgID); selectedOrgID != "" {
+		if err := am.accountManager.SetUserOrganization(userID, selectedOrgID); err != nil {
+			logger.Warn("failed to set user's org ID in accounts store: %v", err)
+		}
+	}
+
+	am.mu.Lock()
+	am.isAuthenticated = true
+	am.mu.Unlock()
+	return nil
+}
+
+// RemoveAccount signs out of an account on its server and removes it with
+// its session, OLM credentials and cached state. Removing the active account
+// leaves no account active.
+func (am *AuthManager) RemoveAccount(userID string) error {
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+
+	account, exists := am.accountManager.Account(userID)
+	if !exists {
+		return ErrAccountNotFound
+	}
+
+	// Try to call logout endpoint (ignore errors)
+	if token, found := am.secretManager.GetSessionToken(userID); found && token != "" {
+		if err := api.NewAPIClient(account.Hostname, token).Logout(); err != nil {
+			logger.Warn("Failed to sign out of %s on the server: %v", account.Hostname, err)
+		}
+	}
+
+	active, _ := am.accountManager.ActiveAccount()
+	if active != nil && active.UserID == userID {
+		am.generation++
+		am.clearSession()
+	}
+
+	_ = am.secretManager.DeleteSessionToken(userID)
+	_ = am.secretManager.DeleteOlmCredentials(userID)
+	if am.cacheManager != nil {
+		_ = am.cacheManager.Remove(userID)
+	}
+
+	return am.accountManager.RemoveAccount(userID)
+}
+
+// Logout logs out the current user and removes their account
+func (am *AuthManager) Logout() error {
+	active, err := am.accountManager.ActiveAccount()
+	if err != nil {
+		// Nothing to remove, but make sure nothing is left signed in
+		am.switchMu.Lock()
+		defer am.switchMu.Unlock()
+		am.generation++
+		am.clearSession()
+		return nil
+	}
+	return am.RemoveAccount(active.UserID)
+}
+
+// RenameAccount gives an account a label shown instead of its email
+// address. An empty label removes it.
+func (am *AuthManager) RenameAccount(userID string, label string) error {
+	if _, exists := am.accountManager.Account(userID); !exists {
+		return ErrAccountNotFound
+	}
+	return am.accountManager.SetLabel(userID, label)
+}
+
+// clearSession forgets the signed in user. Callers hold am.switchMu.
+func (am *AuthManager) clearSession() {
+	am.apiClient.UpdateSessionToken("")
+
+	am.mu.Lock()
+	am.isAuthenticated = false
+	am.currentUser = nil
+	am.currentOrg = nil
+	am.organizations = []api.Org{}
+	am.offline = false
+	am.updateRequired = nil
+	am.errorMessage = nil
+	am.deviceAuthCode = nil
+	am.deviceAuthLoginURL = nil
+	am.pendingLogin = nil
+	am.resources = Resources{}
+	am.mu.Unlock()
+	am.publishState()
+	am.resourceEvents.Publish(Resources{})
+}
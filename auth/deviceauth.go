@@ -0,0 +1,309 @@
+//go:build windows
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/qrcode"
+)
+
+const (
+	// defaultDevicePollInterval is how often the device auth status is polled
+	// if the server does not say
+	defaultDevicePollInterval = 3 * time.Second
+	// minDevicePollInterval and maxDevicePollInterval bound the interval
+	// whatever the server says and however long the backoff grows
+	minDevicePollInterval = time.Second
+	maxDevicePollInterval = time.Minute
+	// slowDownStep is how much longer the interval gets when the server asks
+	// to slow down without saying by how much, as in RFC 8628
+	slowDownStep = 5 * time.Second
+	// defaultDeviceCodeLifetime is used if the server does not say when the
+	// code expires
+	defaultDeviceCodeLifetime = 10 * time.Minute
+)
+
+// DeviceAuthStatus is what the device auth flow is doing while waiting
+type DeviceAuthStatus int
+
+const (
+	// DeviceAuthWaiting is waiting for the user to enter the code
+	DeviceAuthWaiting DeviceAuthStatus = iota
+	// DeviceAuthSlowedDown is waiting after the server asked to poll less
+	// often
+	DeviceAuthSlowedDown
+	// DeviceAuthRetrying is waiting to retry after the last poll failed
+	DeviceAuthRetrying
+)
+
+// DeviceAuthProgress is reported while the device auth flow waits for the
+// user
+type DeviceAuthProgress struct {
+	Code string
+	// VerificationURL is the page the user enters the code on
+	VerificationURL string
+	// VerificationURLComplete is VerificationURL with the code filled in
+	VerificationURLComplete string
+	ExpiresAt               time.Time
+	Remaining               time.Duration
+	PollInterval            time.Duration
+	Status                  DeviceAuthStatus
+	// LastError is the error of the last poll while Retrying
+	LastError error
+}
+
+// QRCode returns VerificationURLComplete as a QR code, for signing in from a
+// phone
+func (p DeviceAuthProgress) QRCode() (*qrcode.Code, error) {
+	return qrcode.Encode(p.VerificationURLComplete)
+}
+
+// verificationURLComplete returns the verification page with the code filled
+// in. The page takes the code without its hyphen.
+func verificationURLComplete(verificationURL, code string) string {
+	return fmt.Sprintf("%s?code=%s", verificationURL, url.QueryEscape(strings.ReplaceAll(code, "-", "")))
+}
+
+// pollOutcome is what a device auth poll means for the flow
+type pollOutcome int
+
+const (
+	pollPending pollOutcome = iota
+	pollVerified
+	pollSlowDown
+	pollDenied
+	pollExpired
+	// pollTransient is a failure that is retried with backoff
+	pollTransient
+	// pollFailed is a failure that ends the flow
+	pollFailed
+)
+
+// classifyPoll decides what a poll response or error means, from the status
+// the server reports and the HTTP status of errors
+func classifyPoll(response *api.DeviceAuthPollResponse, err error) pollOutcome {
+	if err != nil {
+		var apiErr *api.APIError
+		if !errors.As(err, &apiErr) {
+			return pollTransient
+		}
+		switch {
+		case apiErr.Type == api.ErrorTypeNetworkError:
+			return pollTransient
+		case apiErr.Type != api.ErrorTypeHTTPError:
+			return pollFailed
+		case apiErr.Status == 0 || apiErr.Status == 408 || apiErr.Status >= 500:
+			return pollTransient
+		case apiErr.Status == 429:
+			return pollSlowDown
+		case apiErr.Status == 403:
+			return pollDenied
+		case apiErr.Status == 404 || apiErr.Status == 410:
+			return pollExpired
+		default:
+			return pollFailed
+		}
+	}
+
+	if response.Verified {
+		return pollVerified
+	}
+	if response.Status == nil {
+		return pollPending
+	}
+	switch *response.Status {
+	case api.DeviceAuthStatusSlowDown:
+		return pollSlowDown
+	case api.DeviceAuthStatusDenied, "access_denied":
+		return pollDenied
+	case api.DeviceAuthStatusExpired, "expired_token":
+		return pollExpired
+	default:
+		return pollPending
+	}
+}
+
+// clampPollInterval keeps an interval within the bounds
+func clampPollInterval(interval time.Duration) time.Duration {
+	return min(max(interval, minDevicePollInterval), maxDevicePollInterval)
+}
+
+// pollSchedule decides how long to wait before the next device auth poll
+type pollSchedule struct {
+	// interval is how often to poll while nothing goes wrong
+	interval time.Duration
+	// failures counts consecutive transient failures for the backoff
+	failures int
+}
+
+// next updates the schedule after a poll with outcome and returns how long
+// to wait before the next one. Slowing down keeps the longer interval for
+// the polls after it; the backoff of transient failures does not.
+func (s *pollSchedule) next(outcome pollOutcome, response *api.DeviceAuthPollResponse, err error) time.Duration {
+	switch outcome {
+	case pollSlowDown:
+		var apiErr *api.APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			s.interval = clampPollInterval(max(s.interval, apiErr.RetryAfter))
+		} else {
+			s.interval = clampPollInterval(s.interval + slowDownStep)
+		}
+		s.failures = 0
+		return s.interval
+	case pollTransient:
+		s.failures++
+		return clampPollInterval(s.interval << min(s.failures, 5))
+	case pollPending:
+		if response != nil && response.IntervalSeconds > 0 {
+			s.interval = clampPollInterval(time.Duration(response.IntervalSeconds) * time.Second)
+		}
+		s.failures = 0
+		return s.interval
+	default:
+		return s.interval
+	}
+}
+
+// LoginWithDeviceAuth authenticates using device authentication flow.
+// It polls at the interval the server asks for, slows down when the server
+// says so and retries failed polls with backoff until the code expires.
+// Denied and expired codes end the flow at once. onProgress, if not nil, is
+// called with the remaining time every second and whenever the polling
+// changes. The context can be used to cancel the polling operation.
+func (am *AuthManager) LoginWithDeviceAuth(ctx context.Context, hostnameOverride *string, onProgress func(DeviceAuthProgress)) error {
+	loginClient := am.loginClient(hostnameOverride)
+
+	// Get friendly device name (e.g., "Windows Laptop" or "Windows Desktop")
+	deviceName := config.GetFriendlyDeviceName()
+
+	// Start device auth
+	startResponse, err := loginClient.StartDeviceAuth("Pangolin Windows Client", &deviceName)
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+
+	// Store code and URL for UI display
+	code := startResponse.Code
+	loginURL := fmt.Sprintf("%s/auth/login/device", loginClient.CurrentBaseURL())
+
+	am.mu.Lock()
+	am.deviceAuthCode = &code
+	am.deviceAuthLoginURL = &loginURL
+	am.mu.Unlock()
+	defer am.ClearDeviceAuth()
+
+	lifetime := time.Duration(startResponse.ExpiresInSeconds) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultDeviceCodeLifetime
+	}
+	interval := defaultDevicePollInterval
+	if startResponse.IntervalSeconds > 0 {
+		interval = clampPollInterval(time.Duration(startResponse.IntervalSeconds) * time.Second)
+	}
+
+	progress := DeviceAuthProgress{
+		Code:                    code,
+		VerificationURL:         loginURL,
+		VerificationURLComplete: verificationURLComplete(loginURL, code),
+		ExpiresAt:               time.Now().Add(lifetime),
+		PollInterval:            interval,
+		Status:                  DeviceAuthWaiting,
+	}
+	report := func() {
+		if onProgress == nil {
+			return
+		}
+		progress.Remaining = max(time.Until(progress.ExpiresAt), 0)
+		onProgress(progress)
+	}
+	report()
+
+	expired := time.NewTimer(lifetime)
+	defer expired.Stop()
+	countdown := time.NewTicker(time.Second)
+	defer countdown.Stop()
+	next := time.NewTimer(interval)
+	defer next.Stop()
+
+	schedule := pollSchedule{interval: interval}
+	var sessionToken *string
+	for sessionToken == nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired.C:
+			return &AuthError{Type: AuthErrorDeviceCodeExpired}
+		case <-countdown.C:
+			report()
+			continue
+		case <-next.C:
+		}
+
+		pollResponse, token, err := loginClient.PollDeviceAuth(code)
+		outcome := classifyPoll(pollResponse, err)
+		switch outcome {
+		case pollVerified:
+			if token == nil {
+				return &AuthError{Type: AuthErrorInvalidToken}
+			}
+			sessionToken = token
+			continue
+		case pollDenied:
+			logger.Info("Device auth was denied")
+			return &AuthError{Type: AuthErrorDeviceAuthDenied}
+		case pollExpired:
+			return &AuthError{Type: AuthErrorDeviceCodeExpired}
+		case pollFailed:
+			logger.Error("Device auth poll failed: %v", err)
+			am.setErrorMessage(err)
+			return err
+		}
+
+		wait := schedule.next(outcome, pollResponse, err)
+		switch outcome {
+		case pollSlowDown:
+			logger.Info("Server asked to slow down device auth polling, polling every %v", wait)
+			progress.Status = DeviceAuthSlowedDown
+			progress.LastError = nil
+		case pollTransient:
+			logger.Warn("Device auth poll failed, retrying in %v: %v", wait, err)
+			progress.Status = DeviceAuthRetrying
+			progress.LastError = err
+		default:
+			if progress.Status == DeviceAuthRetrying {
+				progress.Status = DeviceAuthWaiting
+			}
+			progress.LastError = nil
+		}
+
+		progress.PollInterval = wait
+		report()
+		next.Reset(wait)
+	}
+
+	// If hostname override was provided, update main API client's base URL
+	if hostnameOverride != nil && *hostnameOverride != "" {
+		am.apiClient.UpdateBaseURL(*hostnameOverride)
+	}
+
+	// Save token
+	am.apiClient.UpdateSessionToken(*sessionToken)
+
+	// Get user info using main API client (now with updated base URL if override was provided)
+	user, err := am.apiClient.GetUser()
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+
+	return am.handleSuccessfulAuth(user, loginClient.CurrentBaseURL(), *sessionToken)
+}
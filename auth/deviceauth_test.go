@@ -0,0 +1,222 @@
+//go:build windows
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/api/apitest"
+)
+
+func TestClassifyPoll(t *testing.T) {
+	status := func(s string) *api.DeviceAuthPollResponse {
+		return &api.DeviceAuthPollResponse{Status: &s}
+	}
+	httpError := func(code int) error {
+		return &api.APIError{Type: api.ErrorTypeHTTPError, Status: code}
+	}
+	tests := []struct {
+		name     string
+		response *api.DeviceAuthPollResponse
+		err      error
+		want     pollOutcome
+	}{
+		{"no status", &api.DeviceAuthPollResponse{}, nil, pollPending},
+		{"pending", status(api.DeviceAuthStatusPending), nil, pollPending},
+		{"unknown status", status("thinking"), nil, pollPending},
+		{"verified", &api.DeviceAuthPollResponse{Verified: true}, nil, pollVerified},
+		{"verified wins over status", &api.DeviceAuthPollResponse{Verified: true, Status: status("denied").Status}, nil, pollVerified},
+		{"slow down", status(api.DeviceAuthStatusSlowDown), nil, pollSlowDown},
+		{"denied", status(api.DeviceAuthStatusDenied), nil, pollDenied},
+		{"access denied", status("access_denied"), nil, pollDenied},
+		{"expired", status(api.DeviceAuthStatusExpired), nil, pollExpired},
+		{"expired token", status("expired_token"), nil, pollExpired},
+		{"network error", nil, &api.APIError{Type: api.ErrorTypeNetworkError}, pollTransient},
+		{"other error", nil, errors.New("connection reset"), pollTransient},
+		{"decoding error", nil, &api.APIError{Type: api.ErrorTypeDecodingError}, pollFailed},
+		{"no status code", nil, httpError(0), pollTransient},
+		{"408", nil, httpError(http.StatusRequestTimeout), pollTransient},
+		{"500", nil, httpError(http.StatusInternalServerError), pollTransient},
+		{"503", nil, httpError(http.StatusServiceUnavailable), pollTransient},
+		{"429", nil, httpError(http.StatusTooManyRequests), pollSlowDown},
+		{"403", nil, httpError(http.StatusForbidden), pollDenied},
+		{"404", nil, httpError(http.StatusNotFound), pollExpired},
+		{"410", nil, httpError(http.StatusGone), pollExpired},
+		{"400", nil, httpError(http.StatusBadRequest), pollFailed},
+		{"401", nil, httpError(http.StatusUnauthorized), pollFailed},
+	}
+	for _, tt := range tests {
+		if got := classifyPoll(tt.response, tt.err); got != tt.want {
+			t.Errorf("%s: classifyPoll = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPollSchedule(t *testing.T) {
+	type poll struct {
+		outcome  pollOutcome
+		response *api.DeviceAuthPollResponse
+		err      error
+		wait     time.Duration
+	}
+	pending := func(wait time.Duration) poll { return poll{pollPending, &api.DeviceAuthPollResponse{}, nil, wait} }
+	transient := func(wait time.Duration) poll { return poll{outcome: pollTransient, wait: wait} }
+	tooMany := func(retryAfter, wait time.Duration) poll {
+		return poll{pollSlowDown, nil, &api.APIError{Type: api.ErrorTypeHTTPError, Status: http.StatusTooManyRequests, RetryAfter: retryAfter}, wait}
+	}
+	slowDown := func(wait time.Duration) poll {
+		s := api.DeviceAuthStatusSlowDown
+		return poll{pollSlowDown, &api.DeviceAuthPollResponse{Status: &s}, nil, wait}
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		polls    []poll
+	}{
+		{
+			"pending keeps the interval",
+			3 * time.Second,
+			[]poll{pending(3 * time.Second), pending(3 * time.Second)},
+		},
+		{
+			"server changes the interval",
+			3 * time.Second,
+			[]poll{
+				{pollPending, &api.DeviceAuthPollResponse{IntervalSeconds: 10}, nil, 10 * time.Second},
+				pending(10 * time.Second),
+				{pollPending, &api.DeviceAuthPollResponse{IntervalSeconds: 600}, nil, time.Minute},
+			},
+		},
+		{
+			"slow_down adds five seconds each time",
+			3 * time.Second,
+			[]poll{slowDown(8 * time.Second), pending(8 * time.Second), slowDown(13 * time.Second)},
+		},
+		{
+			"429 waits as long as Retry-After",
+			3 * time.Second,
+			[]poll{tooMany(20*time.Second, 20*time.Second), pending(20 * time.Second)},
+		},
+		{
+			"429 never shortens the interval",
+			10 * time.Second,
+			[]poll{tooMany(2*time.Second, 10*time.Second)},
+		},
+		{
+			"429 Retry-After is capped",
+			3 * time.Second,
+			[]poll{tooMany(time.Hour, time.Minute)},
+		},
+		{
+			"429 without Retry-After slows down",
+			3 * time.Second,
+			[]poll{tooMany(0, 8*time.Second)},
+		},
+		{
+			"5xx backoff doubles up to the cap",
+			time.Second,
+			[]poll{
+				transient(2 * time.Second),
+				transient(4 * time.Second),
+				transient(8 * time.Second),
+				transient(16 * time.Second),
+				transient(32 * time.Second),
+				transient(32 * time.Second),
+				transient(32 * time.Second),
+			},
+		},
+		{
+			"5xx backoff never waits more than a minute",
+			3 * time.Second,
+			[]poll{transient(6 * time.Second), transient(12 * time.Second), transient(24 * time.Second), transient(48 * time.Second), transient(time.Minute), transient(time.Minute)},
+		},
+		{
+			"success after failures resets the backoff",
+			3 * time.Second,
+			[]poll{transient(6 * time.Second), transient(12 * time.Second), pending(3 * time.Second), transient(6 * time.Second)},
+		},
+		{
+			"slowing down resets the backoff",
+			3 * time.Second,
+			[]poll{transient(6 * time.Second), transient(12 * time.Second), slowDown(8 * time.Second), transient(16 * time.Second)},
+		},
+	}
+	for _, tt := range tests {
+		schedule := pollSchedule{interval: tt.interval}
+		for i, p := range tt.polls {
+			if got := schedule.next(p.outcome, p.response, p.err); got != p.wait {
+				t.Errorf("%s: poll %d: wait %v, want %v", tt.name, i, got, p.wait)
+			}
+		}
+	}
+}
+
+func TestLoginWithDeviceAuthEnds(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter)
+		want    AuthErrorType
+	}{
+		{
+			"denied status",
+			func(w http.ResponseWriter) {
+				s := api.DeviceAuthStatusDenied
+				apitest.Respond(w, http.StatusOK, api.DeviceAuthPollResponse{Status: &s})
+			},
+			AuthErrorDeviceAuthDenied,
+		},
+		{
+			"403",
+			func(w http.ResponseWriter) { apitest.Respond(w, http.StatusForbidden, nil) },
+			AuthErrorDeviceAuthDenied,
+		},
+		{
+			"expired status",
+			func(w http.ResponseWriter) {
+				s := api.DeviceAuthStatusExpired
+				apitest.Respond(w, http.StatusOK, api.DeviceAuthPollResponse{Status: &s})
+			},
+			AuthErrorDeviceCodeExpired,
+		},
+		{
+			"410",
+			func(w http.ResponseWriter) { apitest.Respond(w, http.StatusGone, nil) },
+			AuthErrorDeviceCodeExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fa := newFakeAPI(t, nil, map[string]http.HandlerFunc{
+				"POST /auth/device-web-auth/start": func(w http.ResponseWriter, r *http.Request) {
+					apitest.Respond(w, http.StatusOK, api.DeviceAuthStartResponse{Code: "WDJB-MJHT", ExpiresInSeconds: 600, IntervalSeconds: 1})
+				},
+				"GET /auth/device-web-auth/poll/{code}": func(w http.ResponseWriter, r *http.Request) {
+					tt.respond(w)
+				},
+			})
+			am := NewAuthManager(api.NewAPIClient(fa.URL, ""), nil, newFakeAccounts(), nil, newFakeSecrets())
+
+			// The flow ends at the first poll rather than when the code expires
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := am.LoginWithDeviceAuth(ctx, nil, nil)
+			var authErr *AuthError
+			if !errors.As(err, &authErr) || authErr.Type != tt.want {
+				t.Fatalf("LoginWithDeviceAuth = %v, want %v", err, &AuthError{Type: tt.want})
+			}
+			if n := fa.Count("GET /auth/device-web-auth/poll/{code}"); n != 1 {
+				t.Errorf("%d polls, want 1", n)
+			}
+			if code := am.DeviceAuthCode(); code != nil {
+				t.Errorf("device code %q still shown", *code)
+			}
+		})
+	}
+}
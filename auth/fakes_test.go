@@ -0,0 +1,172 @@
+//go:build windows
+
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/api/apitest"
+	"github.com/fosrl/windows/config"
+)
+
+// newFakeAPI starts a Pangolin API with info as its discovery document, see
+// apitest.NewServer
+func newFakeAPI(t *testing.T, info *api.ServerInfo, handlers map[string]http.HandlerFunc) *apitest.Server {
+	return apitest.NewServer(t, info, handlers)
+}
+
+// signedIn returns a manager signed in to fa with org selected
+func signedIn(fa *apitest.Server, org string) *AuthManager {
+	am := NewAuthManager(api.NewAPIClient(fa.URL, "token"), nil, newFakeAccounts(), nil, newFakeSecrets())
+	am.isAuthenticated = true
+	am.isInitializing = false
+	am.currentUser = &api.User{UserId: "user"}
+	am.currentOrg = &api.Org{Id: org, Name: org}
+	am.organizations = []api.Org{*am.currentOrg}
+	return am
+}
+
+// fakeAccounts is an AccountStore in memory
+type fakeAccounts struct {
+	mu       sync.Mutex
+	accounts map[string]config.Account
+	active   string
+}
+
+func newFakeAccounts(accounts ...config.Account) *fakeAccounts {
+	store := &fakeAccounts{accounts: make(map[string]config.Account)}
+	for _, account := range accounts {
+		store.accounts[account.UserID] = account
+	}
+	return store
+}
+
+func (store *fakeAccounts) ActiveAccount() (*config.Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	account, ok := store.accounts[store.active]
+	if !ok {
+		return nil, nil
+	}
+	return &account, nil
+}
+
+func (store *fakeAccounts) Account(userID string) (config.Account, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	account, ok := store.accounts[userID]
+	return account, ok
+}
+
+func (store *fakeAccounts) AddAccount(account config.Account) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.accounts[account.UserID] = account
+	return nil
+}
+
+func (store *fakeAccounts) RemoveAccount(userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.accounts, userID)
+	if store.active == userID {
+		store.active = ""
+	}
+	return nil
+}
+
+func (store *fakeAccounts) SetActiveUser(userID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.active = userID
+	return nil
+}
+
+func (store *fakeAccounts) SetUserOrganization(userID string, orgID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	account := store.accounts[userID]
+	account.UserID = userID
+	account.OrgID = orgID
+	store.accounts[userID] = account
+	return nil
+}
+
+func (store *fakeAccounts) SetLabel(userID string, label string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	account := store.accounts[userID]
+	account.Label = label
+	store.accounts[userID] = account
+	return nil
+}
+
+// fakeSecrets is a SecretStore in memory
+type fakeSecrets struct {
+	mu         sync.Mutex
+	tokens     map[string]string
+	olmIDs     map[string]string
+	olmSecrets map[string]string
+}
+
+func newFakeSecrets() *fakeSecrets {
+	return &fakeSecrets{
+		tokens:     make(map[string]string),
+		olmIDs:     make(map[string]string),
+		olmSecrets: make(map[string]string),
+	}
+}
+
+func (store *fakeSecrets) GetSessionToken(userId string) (string, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	token, ok := store.tokens[userId]
+	return token, ok
+}
+
+func (store *fakeSecrets) SaveSessionToken(userId string, token string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.tokens[userId] = token
+	return true
+}
+
+func (store *fakeSecrets) DeleteSessionToken(userId string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.tokens, userId)
+	return true
+}
+
+func (store *fakeSecrets) GetOlmId(userId string) (string, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	olmID, ok := store.olmIDs[userId]
+	return olmID, ok
+}
+
+func (store *fakeSecrets) HasOlmCredentials(userId string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	_, ok := store.olmSecrets[userId]
+	return ok
+}
+
+func (store *fakeSecrets) SaveOlmCredentials(userId, olmId, secret string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.olmIDs[userId] = olmId
+	store.olmSecrets[userId] = secret
+	return true
+}
+
+func (store *fakeSecrets) DeleteOlmCredentials(userId string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.olmIDs, userId)
+	delete(store.olmSecrets, userId)
+	return true
+}
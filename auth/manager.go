@@ -3,18 +3,14 @@
 package auth
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/fosrl/windows/api"
 	"github.com/fosrl/windows/config"
-	"github.com/fosrl/windows/secrets"
-
-	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/events"
 )
 
 // AuthError represents authentication-specific errors
@@ -29,6 +25,8 @@ const (
 	AuthErrorEmailVerificationRequired
 	AuthErrorDeviceCodeExpired
 	AuthErrorInvalidToken
+	AuthErrorDeviceAuthDenied
+	AuthErrorSessionExpired
 )
 
 func (e *AuthError) Error() string {
@@ -41,17 +39,38 @@ func (e *AuthError) Error() string {
 		return "Device code expired. Please try again."
 	case AuthErrorInvalidToken:
 		return "Invalid session token"
+	case AuthErrorDeviceAuthDenied:
+		return "The sign-in request was denied. Please try again."
+	case AuthErrorSessionExpired:
+		return "The session of this account has expired. Please sign in again."
 	default:
 		return "Authentication error"
 	}
 }
 
+// State is a snapshot of the authentication state, published whenever it
+// changes
+type State struct {
+	Authenticated bool
+	Initializing  bool
+	UserID        string
+	OrgID         string
+	// Offline is set while the server cannot be reached and the user and
+	// organizations are the cached ones
+	Offline bool
+	// UpdateRequired is set when the server refused this version of the
+	// client. RequiredVersion is the version it asked for, if it said.
+	UpdateRequired  bool
+	RequiredVersion string
+}
+
 // AuthManager manages authentication state and operations
 type AuthManager struct {
 	apiClient      *api.APIClient
 	configManager  *config.ConfigManager
-	accountManager *config.AccountManager
-	secretManager  *secrets.SecretManager
+	accountManager AccountStore
+	cacheManager   *config.CacheManager
+	secretManager  SecretStore
 
 	// State
 	mu                 sync.RWMutex
@@ -60,37 +79,100 @@ type AuthManager struct {
 	currentOrg         *api.Org
 	organizations      []api.Org
 	isInitializing     bool
+	offline            bool
+	updateRequired     *string
 	errorMessage       *string
 	deviceAuthCode     *string
 	deviceAuthLoginURL *string
+	pendingLogin       *pendingLogin
+	ssoLoginURL        *string
+
+	stateEvents *events.Topic[State]
+	publishMu   sync.Mutex
+	orgEvents   *events.Topic[OrgChange]
+
+	resources      Resources
+	resourceEvents *events.Topic[Resources]
+
+	// switchMu serializes changes of the active account, and generation
+	// counts them so that background work for a previous account can tell
+	switchMu   sync.Mutex
+	generation uint64
 }
 
 // NewAuthManager creates a new AuthManager instance
 func NewAuthManager(
 	apiClient *api.APIClient,
 	configManager *config.ConfigManager,
-	accountManager *config.AccountManager,
-	secretManager *secrets.SecretManager,
+	accountManager AccountStore,
+	cacheManager *config.CacheManager,
+	secretManager SecretStore,
 ) *AuthManager {
-	return &AuthManager{
+	am := &AuthManager{
 		apiClient:      apiClient,
 		configManager:  configManager,
 		accountManager: accountManager,
+		cacheManager:   cacheManager,
 		secretManager:  secretManager,
 		isInitializing: true,
+		stateEvents:    events.NewTopic[State]("auth.state", true),
+		orgEvents:      events.NewTopic[OrgChange]("auth.orgs", false),
+		resourceEvents: events.NewTopic[Resources]("auth.resources", true),
+	}
+	am.publishState()
+	return am
+}
+
+// StateEvents returns the topic of authentication state changes. Late
+// subscribers receive the current state first.
+func (am *AuthManager) StateEvents() *events.Topic[State] {
+	return am.stateEvents
+}
+
+// publishState publishes the current state if it changed since it was last
+// published. Callers must not hold am.mu.
+func (am *AuthManager) publishState() {
+	am.publishMu.Lock()
+	defer am.publishMu.Unlock()
+
+	am.mu.RLock()
+	state := State{
+		Authenticated: am.isAuthenticated,
+		Initializing:  am.isInitializing,
+		Offline:       am.offline,
+	}
+	if am.updateRequired != nil {
+		state.UpdateRequired = true
+		state.RequiredVersion = *am.updateRequired
+	}
+	if am.currentUser != nil {
+		state.UserID = am.currentUser.UserId
+	}
+	if am.currentOrg != nil {
+		state.OrgID = am.currentOrg.Id
 	}
+	am.mu.RUnlock()
+
+	if latest, ok := am.stateEvents.Latest(); ok && latest == state {
+		return
+	}
+	am.stateEvents.Publish(state)
 }
 
-// Initialize loads session token from secrets and verifies authentication
+// Initialize loads session token from secrets and restores the cached state
+// of the active account, so that the client starts without waiting for the
+// server. The session is verified in the background.
 func (am *AuthManager) Initialize() error {
 	am.mu.Lock()
 	am.isInitializing = true
 	am.mu.Unlock()
+	am.publishState()
 
 	defer func() {
 		am.mu.Lock()
 		am.isInitializing = false
 		am.mu.Unlock()
+		am.publishState()
 	}()
 
 	activeAccount, _ := am.accountManager.ActiveAccount()
@@ -98,20 +180,18 @@ func (am *AuthManager) Initialize() error {
 		// Load session token from Keychain
 		token, found := am.secretManager.GetSessionToken(activeAccount.UserID)
 		if found && token != "" {
+			am.apiClient.UpdateBaseURL(activeAccount.Hostname)
 			am.apiClient.UpdateSessionToken(token)
 
-			// Always fetch the latest user info to verify the user exists and update stored info
-			user, err := am.apiClient.GetUser()
-			if err != nil {
-				// Token is invalid or user doesn't exist, clear it
-				am.mu.Lock()
-				am.isAuthenticated = false
-				am.mu.Unlock()
-				return nil // Not an error, just not authenticated
-			}
+			am.restoreCached(activeAccount)
 
-			// Update stored config with latest user info
-			return am.handleSuccessfulAuth(user, activeAccount.Hostname, token)
+			// Fetch the latest user info to verify the session and update
+			// stored info. Only the server rejecting the session logs out.
+			am.switchMu.Lock()
+			generation := am.generation
+			am.switchMu.Unlock()
+			go am.validateSession(generation, activeAccount.Hostname, token)
+			return nil
 		}
 	}
 
@@ -121,176 +201,70 @@ func (am *AuthManager) Initialize() error {
 	return nil
 }
 
-// LoginWithDeviceAuth authenticates using device authentication flow
-// The context can be used to cancel the polling operation
-func (am *AuthManager) LoginWithDeviceAuth(ctx context.Context, hostnameOverride *string) error {
-	// Use temporary API client if hostname override is provided
-	var loginClient *api.APIClient
-	if hostnameOverride != nil && *hostnameOverride != "" {
-		// Create temporary client with override hostname
-		loginClient = api.NewAPIClient(*hostnameOverride, "")
-	} else {
-		// Use main API client
-		loginClient = am.apiClient
-	}
-
-	// Get friendly device name (e.g., "Windows Laptop" or "Windows Desktop")
-	deviceName := config.GetFriendlyDeviceName()
-
-	// Start device auth
-	startResponse, err := loginClient.StartDeviceAuth("Pangolin Windows Client", &deviceName)
-	if err != nil {
-		am.mu.Lock()
-		if apiErr, ok := err.(*api.APIError); ok {
-			msg := apiErr.Error()
-			am.errorMessage = &msg
-		} else {
-			msg := err.Error()
-			am.errorMessage = &msg
-		}
-		am.mu.Unlock()
-		return err
-	}
-
-	// Store code and URL for UI display
-	code := startResponse.Code
-	loginURL := fmt.Sprintf("%s/auth/login/device", loginClient.CurrentBaseURL())
-
-	am.mu.Lock()
-	am.deviceAuthCode = &code
-	am.deviceAuthLoginURL = &loginURL
-	am.mu.Unlock()
-
-	// Poll for verification
-	expiresAt := time.Now().Add(time.Duration(startResponse.ExpiresInSeconds) * time.Second)
-	verified := false
-	var sessionToken *string
-
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-
-	for !verified && time.Now().Before(expiresAt) {
-		select {
-		case <-ctx.Done():
-			// Context canceled, clear state and return
-			am.mu.Lock()
-			am.deviceAuthCode = nil
-			am.deviceAuthLoginURL = nil
-			am.mu.Unlock()
-			return ctx.Err()
-		case <-ticker.C:
-			pollResponse, token, err := loginClient.PollDeviceAuth(code)
-			if err != nil {
-				// Continue polling on error
-				continue
-			}
-
-			if pollResponse.Verified {
-				verified = true
-				if token != nil {
-					sessionToken = token
-				}
-			} else if pollResponse.Message != nil {
-				message := *pollResponse.Message
-				if contains(message, "expired") || contains(message, "not found") {
-					am.mu.Lock()
-					am.deviceAuthCode = nil
-					am.deviceAuthLoginURL = nil
-					am.mu.Unlock()
-					return &AuthError{Type: AuthErrorDeviceCodeExpired}
-				}
-			}
-		}
-	}
-
-	if !verified {
-		am.mu.Lock()
-		am.deviceAuthCode = nil
-		am.deviceAuthLoginURL = nil
-		am.mu.Unlock()
-		return &AuthError{Type: AuthErrorDeviceCodeExpired}
-	}
-
-	if sessionToken == nil {
-		return &AuthError{Type: AuthErrorInvalidToken}
-	}
-
-	// If hostname override was provided, update main API client's base URL
-	if hostnameOverride != nil && *hostnameOverride != "" {
-		am.apiClient.UpdateBaseURL(*hostnameOverride)
-	}
-
-	// Save token
-	am.apiClient.UpdateSessionToken(*sessionToken)
-
-	// Get user info using main API client (now with updated base URL if override was provided)
-	user, err := am.apiClient.GetUser()
-	if err != nil {
-		am.mu.Lock()
-		msg := err.Error()
-		am.errorMessage = &msg
-		am.mu.Unlock()
-		return err
-	}
-
-	// Clear device auth UI state after successful auth
-	am.mu.Lock()
-	am.deviceAuthCode = nil
-	am.deviceAuthLoginURL = nil
-	am.mu.Unlock()
-
-	return am.handleSuccessfulAuth(user, loginClient.CurrentBaseURL(), *sessionToken)
-}
-
 // Select an organization if there isn't one already. This happens
 // only for account login and when switching accounts.
-// Returns the selected organization's ID.
+// The account's last organization, preferredOrgID, is restored if the
+// user still belongs to it; otherwise the first one is selected. If the
+// organizations cannot be fetched, the cached ones are used.
+// Returns the selected organization's ID, empty if there is none.
 // This does NOT get persisted to the account store; callers
 // persist it to the account store themselves.
-func (am *AuthManager) ensureOrgIsSelected() string {
-	var selectedOrgID string
-
+func (am *AuthManager) ensureOrgIsSelected(preferredOrgID string) string {
 	am.mu.RLock()
 	userID := am.currentUser.UserId
 	am.mu.RUnlock()
 
+	var orgs []api.Org
 	orgsResponse, err := am.apiClient.ListUserOrgs(userID)
 	if err != nil {
-		// Non-fatal error, continue without org
+		// Non-fatal error, continue with the cached organizations
 		logger.Error("Failed to load organizations: %v", err)
-		am.mu.Lock()
-		am.organizations = []api.Org{}
-		am.mu.Unlock()
+		orgs = am.cachedOrgs(userID)
+		am.handleRequestError(err)
 	} else {
-		am.mu.Lock()
-		am.organizations = orgsResponse.Orgs
-		am.mu.Unlock()
+		orgs = orgsResponse.Orgs
+	}
 
-		// Restore last selected org from config,
-		// or auto-select a random one.
-		if activeAccount, _ := am.accountManager.ActiveAccount(); activeAccount != nil {
-			for _, org := range orgsResponse.Orgs {
-				if org.Id == activeAccount.OrgID {
-					am.mu.Lock()
-					am.currentOrg = &org
-					selectedOrgID = am.currentOrg.Id
-					am.mu.Unlock()
-					break
-				}
-			}
-		} else if len(orgsResponse.Orgs) > 0 {
-			am.mu.Lock()
-			am.currentOrg = &orgsResponse.Orgs[0]
-			selectedOrgID = am.currentOrg.Id
-			am.mu.Unlock()
+	var selectedOrgID string
+	am.mu.Lock()
+	am.organizations = orgs
+	am.currentOrg = nil
+
+	// Restore last selected org of the account,
+	// or auto-select the first one.
+	for _, org := range orgs {
+		if org.Id == preferredOrgID {
+			am.currentOrg = &org
+			break
 		}
 	}
+	if am.currentOrg == nil && len(orgs) > 0 {
+		am.currentOrg = &orgs[0]
+	}
+	if am.currentOrg != nil {
+		selectedOrgID = am.currentOrg.Id
+	}
+	am.mu.Unlock()
 
+	if err == nil {
+		am.cacheOrgs(userID)
+	}
 	return selectedOrgID
 }
 
-// handleSuccessfulAuth handles successful authentication
+// handleSuccessfulAuth handles successful authentication. The user's
+// account becomes the active one; signing in again to an existing account
+// replaces its session in place.
 func (am *AuthManager) handleSuccessfulAuth(user *api.User, hostname string, token string) error {
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+	am.generation++
+	return am.applySession(user, hostname, token)
+}
+
+// applySession makes user, signed in to hostname with token, the active
+// account. Callers hold am.switchMu.
+func (am *AuthManager) applySession(user *api.User, hostname string, token string) error {
 	am.apiClient.UpdateBaseURL(hostname)
 	am.apiClient.UpdateSessionToken(token)
 
@@ -299,9 +273,18 @@ func (am *AuthManager) handleSuccessfulAuth(user *api.User, hostname string, tok
 		user.UserId = user.Id
 	}
 
-	am.UpdateCurrentUser(user)
+	am.setCurrentUser(user)
+	am.updateCache(user.UserId, func(cached *config.CachedAccount) {
+		cached.User = user
+		cached.UserFetchedAt = time.Now()
+	})
 
-	selectedOrgID := am.ensureOrgIsSelected()
+	existing, exists := am.accountManager.Account(user.UserId)
+	selectedOrgID := am.ensureOrgIsSelected(existing.OrgID)
+	if selectedOrgID == "" {
+		// Keep the organization of the account for when it can be fetched
+		selectedOrgID = existing.OrgID
+	}
 
 	_ = am.secretManager.SaveSessionToken(user.UserId, token)
 
@@ -329,18 +312,33 @@ func (am *AuthManager) handleSuccessfulAuth(user *api.User, hostname string, tok
 		Name:     name,
 		Hostname: am.apiClient.CurrentBaseURL(),
 	}
+	if exists {
+		newAccount.Label = existing.Label
+	}
 
 	_ = am.accountManager.AddAccount(newAccount)
 	_ = am.accountManager.SetActiveUser(user.UserId)
 
 	am.mu.Lock()
 	am.isAuthenticated = true
+	am.offline = false
 	am.mu.Unlock()
+	am.publishState()
 	return nil
 }
 
-// RefreshOrganizations refreshes the list of organizations
+// currentGeneration returns the count of changes of the active account, to
+// be compared once background work for it completes
+func (am *AuthManager) currentGeneration() uint64 {
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+	return am.generation
+}
+
+// RefreshOrganizations refreshes the list of organizations. The result is
+// dropped if the active account changed meanwhile.
 func (am *AuthManager) RefreshOrganizations() error {
+	generation := am.currentGeneration()
 	am.mu.RLock()
 	authenticated := am.isAuthenticated
 	userId := ""
@@ -355,48 +353,39 @@ func (am *AuthManager) RefreshOrganizations() error {
 	}
 
 	orgsResponse, err := am.apiClient.ListUserOrgs(userId)
+
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+	if am.generation != generation {
+		logger.Info("Active account changed while refreshing organizations, ignoring the result")
+		return nil
+	}
+
 	if err != nil {
 		logger.Error("Failed to refresh organizations in background: %v", err)
+		am.handleRequestError(err)
 		return err
 	}
 
 	am.mu.Lock()
+	am.updateRequired = nil
 	newOrgs := orgsResponse.Orgs
-	currentOrgId := ""
-	if am.currentOrg != nil {
-		currentOrgId = am.currentOrg.Id
-	}
-
 	// Preserve current org selection if it still exists in the new list
-	if currentOrgId != "" {
-		found := false
-		for _, org := range newOrgs {
-			if org.Id == currentOrgId {
-				am.currentOrg = &org
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			// Current org no longer exists, clear selection
-			am.currentOrg = nil
-			if activeAccount, _ := am.accountManager.ActiveAccount(); activeAccount != nil {
-				_ = am.accountManager.SetUserOrganization(activeAccount.UserID, "")
-			}
-		}
-	}
-
-	// Update organizations list
-	am.organizations = newOrgs
+	change := am.setOrganizationsLocked(newOrgs)
 	am.mu.Unlock()
+	am.cacheOrgs(userId)
+	am.setOffline(false)
+	am.publishState()
+	am.publishOrgChange(change)
 
 	logger.Info("Organizations refreshed successfully: %d orgs", len(newOrgs))
 	return nil
 }
 
-// RefreshFromMyDevice refreshes user info, organizations, and authentication status from MyDevice API
+// RefreshFromMyDevice refreshes user info, organizations, and authentication status from MyDevice API.
+// The result is dropped if the active account changed meanwhile.
 func (am *AuthManager) RefreshFromMyDevice(olmId string) error {
+	generation := am.currentGeneration()
 	am.mu.RLock()
 	authenticated := am.isAuthenticated
 	userId := ""
@@ -412,18 +401,25 @@ func (am *AuthManager) RefreshFromMyDevice(olmId string) error {
 
 	// Get MyDevice data
 	myDevice, err := am.apiClient.GetMyDevice(olmId)
+
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+	if am.generation != generation {
+		logger.Info("Active account changed while refreshing from MyDevice, ignoring the result")
+		return nil
+	}
+
 	if err != nil {
 		logger.Error("Failed to refresh from MyDevice: %v", err)
 		// If we get an unauthorized error, user might be logged out
-		if apiErr, ok := err.(*api.APIError); ok && apiErr.Status == 401 {
-			logger.Info("Session expired, clearing authentication")
-			am.mu.Lock()
-			am.isAuthenticated = false
-			am.mu.Unlock()
-		}
+		am.handleRequestError(err)
 		return err
 	}
 
+	var change OrgChange
+	defer func() { am.publishOrgChange(change) }()
+	defer am.publishState()
+	defer am.cacheMyDevice(userId, myDevice)
 	am.mu.Lock()
 	defer am.mu.Unlock()
 
@@ -439,35 +435,20 @@ func (am *AuthManager) RefreshFromMyDevice(olmId string) error {
 
 	// Convert ResponseOrg to Org and update organizations
 	newOrgs := make([]api.Org, 0, len(myDevice.Orgs))
-	currentOrgId := ""
-	if am.currentOrg != nil {
-		currentOrgId = am.currentOrg.Id
-	}
-
 	for _, responseOrg := range myDevice.Orgs {
-		org := api.Org{
+		newOrgs = append(newOrgs, api.Org{
 			Id:   responseOrg.OrgId,
 			Name: responseOrg.OrgName,
-		}
-		newOrgs = append(newOrgs, org)
-
-		// Preserve current org selection if it still exists
-		if currentOrgId != "" && org.Id == currentOrgId {
-			am.currentOrg = &org
-		}
-	}
-
-	// If current org no longer exists, clear selection
-	if currentOrgId != "" && am.currentOrg != nil && am.currentOrg.Id != currentOrgId {
-		am.currentOrg = nil
-		_ = am.accountManager.SetUserOrganization(am.currentUser.UserId, "")
+		})
 	}
 
-	// Update organizations list
-	am.organizations = newOrgs
+	// Preserve current org selection if it still exists
+	change = am.setOrganizationsLocked(newOrgs)
 
 	// Ensure authentication is still set (should be true if we got here)
 	am.isAuthenticated = true
+	am.offline = false
+	am.updateRequired = nil
 
 	logger.Info("Refreshed from MyDevice")
 	return nil
@@ -555,25 +536,42 @@ func (am *AuthManager) CheckOrgAccess(orgId string) (bool, error) {
 func (am *AuthManager) SelectOrganization(org *api.Org) error {
 	// First check org access
 	hasAccess, err := am.CheckOrgAccess(org.Id)
-	if err != nil || !hasAccess {
+	if err != nil {
 		return err
 	}
+	if !hasAccess {
+		return errors.New("unauthorized access to this org. Contact your admin")
+	}
 
 	// If access is granted, proceed with selecting the org
+	am.SetCurrentOrganization(org)
+	return nil
+}
+
+// SetCurrentOrganization selects org, or clears the selection if it is nil,
+// without checking access, such as to undo a selection
+func (am *AuthManager) SetCurrentOrganization(org *api.Org) {
+	orgID := ""
+	if org != nil {
+		orgID = org.Id
+	}
+
 	am.mu.Lock()
 	am.currentOrg = org
+	userID := ""
+	if am.currentUser != nil {
+		userID = am.currentUser.UserId
+	}
 	am.mu.Unlock()
+	am.publishState()
 
 	// Save selected org to accounts store
-	am.mu.RLock()
-	userID := am.currentUser.UserId
-	am.mu.RUnlock()
-
-	if err := am.accountManager.SetUserOrganization(userID, org.Id); err != nil {
+	if err := am.accountManager.SetUserOrganization(userID, orgID); err != nil {
 		logger.Warn("failed to persist selected account to store: %v", err)
 	}
-
-	return nil
+	am.updateCache(userID, func(cached *config.CachedAccount) {
+		cached.SelectedOrgID = orgID
+	})
 }
 
 // EnsureOlmCredentials ensures OLM credentials exist for the user
@@ -623,86 +621,6 @@ func (am *AuthManager) EnsureOlmCredentials(userId string) error {
 	return nil
 }
 
-func (am *AuthManager) SwitchAccount(userID string) error {
-	am.mu.Lock()
-	am.isAuthenticated = false
-	am.mu.Unlock()
-
-	defer func() {
-		am.mu.Lock()
-		am.isAuthenticated = true
-		am.mu.Unlock()
-	}()
-
-	accountToSwitchTo, exists := am.accountManager.Accounts[userID]
-	if !exists {
-		return errors.New("account does not exist")
-	}
-
-	token, found := am.secretManager.GetSessionToken(accountToSwitchTo.UserID)
-	if found && token != "" {
-		am.apiClient.UpdateBaseURL(accountToSwitchTo.Hostname)
-		am.apiClient.UpdateSessionToken(token)
-
-		// Always fetch the latest user info to verify the user exists and update stored info
-		var err error
-		user, err := am.apiClient.GetUser()
-		if err != nil {
-			// This should never happen, but if it does, silently
-			// fail and switch to an unauthenticated state to prevent
-			// any more unreachable situations from happening.
-			am.mu.Lock()
-			am.isAuthenticated = false
-			am.mu.Unlock()
-			return nil
-		}
-
-		am.UpdateCurrentUser(user)
-	} else {
-		return errors.New("session token does not exist for this user")
-	}
-
-	selectedOrgID := am.ensureOrgIsSelected()
-
-	err := am.accountManager.SetUserOrganization(userID, selectedOrgID)
-	if err != nil {
-		logger.Warn("failed to set user's org ID in accounts store: %v", err)
-	}
-
-	err = am.accountManager.SetActiveUser(userID)
-	if err != nil {
-		logger.Warn("failed to set active user in accounts store: %v", err)
-	}
-
-	return nil
-}
-
-// Logout logs out the current user
-func (am *AuthManager) Logout() error {
-	// Try to call logout endpoint (ignore errors)
-	_ = am.apiClient.Logout()
-
-	userID := am.accountManager.ActiveUserID
-
-	// Clear local data
-	am.apiClient.UpdateSessionToken("")
-
-	am.mu.Lock()
-	am.isAuthenticated = false
-	am.currentOrg = nil
-	am.organizations = []api.Org{}
-	am.errorMessage = nil
-	am.deviceAuthCode = nil
-	am.deviceAuthLoginURL = nil
-	am.mu.Unlock()
-
-	_ = am.secretManager.DeleteSessionToken(userID)
-
-	_ = am.accountManager.RemoveAccount(userID)
-
-	return nil
-}
-
 // Getters for state (thread-safe)
 
 func (am *AuthManager) IsAuthenticated() bool {
@@ -723,6 +641,11 @@ func (am *AuthManager) CurrentOrg() *api.Org {
 	return am.currentOrg
 }
 
+// ServerURL returns the URL of the server of the active account
+func (am *AuthManager) ServerURL() string {
+	return am.apiClient.CurrentBaseURL()
+}
+
 func (am *AuthManager) Organizations() []api.Org {
 	am.mu.RLock()
 	defer am.mu.RUnlock()
@@ -763,14 +686,16 @@ func (am *AuthManager) ClearDeviceAuth() {
 
 // UpdateCurrentUser updates the current user (used for session verification)
 func (am *AuthManager) UpdateCurrentUser(user *api.User) {
+	am.setCurrentUser(user)
+	am.updateCache(user.UserId, func(cached *config.CachedAccount) {
+		cached.User = user
+		cached.UserFetchedAt = time.Now()
+	})
+	am.publishState()
+}
+
+func (am *AuthManager) setCurrentUser(user *api.User) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
 	am.currentUser = user
 }
-
-// Helper function
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr ||
-		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
-			strings.Contains(s, substr))))
-}
@@ -0,0 +1,208 @@
+//go:build windows
+
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/api/apitest"
+	"github.com/fosrl/windows/config"
+)
+
+// twoAccounts serves the accounts "user", signed in with the session
+// "token", and "other", with "other-token". The organizations of "other"
+// are answered with otherOrgsStatus.
+func twoAccounts(t *testing.T, otherOrgsStatus int, handlers map[string]http.HandlerFunc) *apitest.Server {
+	userOf := map[string]string{"token": "user", "other-token": "other"}
+	all := map[string]http.HandlerFunc{
+		"GET /user": func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("p_session_token")
+			if err != nil || userOf[cookie.Value] == "" {
+				apitest.Respond(w, http.StatusUnauthorized, nil)
+				return
+			}
+			apitest.Respond(w, http.StatusOK, api.User{UserId: userOf[cookie.Value]})
+		},
+		"GET /user/{user}/orgs": func(w http.ResponseWriter, r *http.Request) {
+			if r.PathValue("user") == "other" {
+				apitest.Respond(w, otherOrgsStatus, api.ListUserOrgsResponse{Orgs: []api.Org{{Id: "o1"}, {Id: "o2"}}})
+				return
+			}
+			apitest.Respond(w, http.StatusOK, api.ListUserOrgsResponse{Orgs: []api.Org{{Id: "u1"}, {Id: "u2"}}})
+		},
+	}
+	for pattern, handler := range handlers {
+		all[pattern] = handler
+	}
+	return newFakeAPI(t, nil, all)
+}
+
+// withAccounts returns a manager signed in to fa as "user" with u1 selected,
+// and "other" stored with o2 selected, caching to a temporary directory
+func withAccounts(t *testing.T, fa *apitest.Server) *AuthManager {
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+	am := signedIn(fa, "u1")
+	am.cacheManager = config.NewCacheManager()
+	am.organizations = []api.Org{{Id: "u1"}, {Id: "u2"}}
+	am.accountManager = newFakeAccounts(
+		config.Account{UserID: "user", OrgID: "u1", Hostname: fa.URL},
+		config.Account{UserID: "other", OrgID: "o2", Hostname: fa.URL},
+	)
+	am.accountManager.SetActiveUser("user")
+	secrets := am.secretManager.(*fakeSecrets)
+	secrets.SaveSessionToken("user", "token")
+	secrets.SaveSessionToken("other", "other-token")
+	return am
+}
+
+func orgIDs(orgs []api.Org) []string {
+	ids := []string{}
+	for _, org := range orgs {
+		ids = append(ids, org.Id)
+	}
+	return ids
+}
+
+func TestRefreshDroppedAfterAccountSwitch(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		pattern string
+		refresh func(am *AuthManager) error
+	}{
+		{"organizations", "GET /user/{user}/orgs", (*AuthManager).RefreshOrganizations},
+		{"MyDevice", "GET /my-device", func(am *AuthManager) error { return am.RefreshFromMyDevice("olm") }},
+	} {
+		var am *AuthManager
+		switched := false
+		// The account is switched while the refresh of the previous one
+		// is in flight, and its response arrives afterwards
+		switchFirst := func(w http.ResponseWriter, r *http.Request) bool {
+			if switched {
+				return false
+			}
+			switched = true
+			if err := am.SwitchAccount("other"); err != nil {
+				t.Errorf("%s: SwitchAccount: %v", tt.name, err)
+			}
+			return true
+		}
+		userOrgs := []api.Org{{Id: "u1"}, {Id: "stale"}}
+		fa := twoAccounts(t, http.StatusOK, map[string]http.HandlerFunc{
+			"GET /user/{user}/orgs": func(w http.ResponseWriter, r *http.Request) {
+				if r.PathValue("user") == "user" && tt.name == "organizations" && switchFirst(w, r) {
+					apitest.Respond(w, http.StatusOK, api.ListUserOrgsResponse{Orgs: userOrgs})
+					return
+				}
+				if r.PathValue("user") == "other" {
+					apitest.Respond(w, http.StatusOK, api.ListUserOrgsResponse{Orgs: []api.Org{{Id: "o1"}, {Id: "o2"}}})
+					return
+				}
+				apitest.Respond(w, http.StatusOK, api.ListUserOrgsResponse{Orgs: userOrgs})
+			},
+			"GET /my-device": func(w http.ResponseWriter, r *http.Request) {
+				switchFirst(w, r)
+				apitest.Respond(w, http.StatusOK, api.MyDeviceResponse{
+					User: api.MyDeviceUser{UserId: "user", Email: "user@example.com"},
+					Orgs: []api.ResponseOrg{{OrgId: "u1"}, {OrgId: "stale"}},
+				})
+			},
+		})
+		am = withAccounts(t, fa)
+
+		if err := tt.refresh(am); err != nil {
+			t.Errorf("%s: refresh: %v", tt.name, err)
+		}
+		if !switched {
+			t.Fatalf("%s: the account was not switched during the refresh", tt.name)
+		}
+		if user := am.CurrentUser(); user == nil || user.UserId != "other" {
+			t.Errorf("%s: current user %v, want other", tt.name, user)
+		}
+		if got := orgIDs(am.Organizations()); !slices.Equal(got, []string{"o1", "o2"}) {
+			t.Errorf("%s: organizations %v, want those of other", tt.name, got)
+		}
+		if org := am.CurrentOrg(); org == nil || org.Id != "o2" {
+			t.Errorf("%s: selected %v, want o2", tt.name, org)
+		}
+		cached, _ := am.cacheManager.Get("other")
+		if got := orgIDs(cached.Orgs); !slices.Equal(got, []string{"o1", "o2"}) || cached.MyDevice != nil {
+			t.Errorf("%s: cache of other has organizations %v and device %v, want only its own", tt.name, got, cached.MyDevice)
+		}
+		if cached, _ := am.cacheManager.Get("user"); slices.Contains(orgIDs(cached.Orgs), "stale") {
+			t.Errorf("%s: the dropped refresh was cached for user", tt.name)
+		}
+	}
+}
+
+func TestSwitchAccountWithoutOrganizations(t *testing.T) {
+	fa := twoAccounts(t, http.StatusInternalServerError, nil)
+	am := withAccounts(t, fa)
+
+	if err := am.SwitchAccount("other"); err != nil {
+		t.Fatal(err)
+	}
+	if user := am.CurrentUser(); user == nil || user.UserId != "other" {
+		t.Fatalf("current user %v, want other", user)
+	}
+	if org := am.CurrentOrg(); org != nil {
+		t.Errorf("selected %s of the previous account", org.Id)
+	}
+	if orgs := am.Organizations(); len(orgs) != 0 {
+		t.Errorf("organizations %v of the previous account", orgIDs(orgs))
+	}
+	if account, _ := am.accountManager.Account("other"); account.OrgID != "o2" {
+		t.Errorf("stored organization of other is %q, want o2 kept", account.OrgID)
+	}
+	if account, _ := am.accountManager.Account("user"); account.OrgID != "u1" {
+		t.Errorf("stored organization of user is %q, want u1", account.OrgID)
+	}
+}
+
+func TestSwitchAccountWithCachedOrganizations(t *testing.T) {
+	fa := twoAccounts(t, http.StatusInternalServerError, nil)
+	am := withAccounts(t, fa)
+	am.cacheManager.Update("other", func(cached *config.CachedAccount) {
+		cached.Orgs = []api.Org{{Id: "o1"}, {Id: "o2"}}
+	})
+
+	if err := am.SwitchAccount("other"); err != nil {
+		t.Fatal(err)
+	}
+	if org := am.CurrentOrg(); org == nil || org.Id != "o2" {
+		t.Errorf("selected %v, want o2 from the cache", org)
+	}
+	if got := orgIDs(am.Organizations()); !slices.Equal(got, []string{"o1", "o2"}) {
+		t.Errorf("organizations %v, want the cached ones", got)
+	}
+}
+
+func TestSwitchAccountAndBack(t *testing.T) {
+	fa := twoAccounts(t, http.StatusOK, nil)
+	am := withAccounts(t, fa)
+
+	if err := am.SwitchAccount("other"); err != nil {
+		t.Fatal(err)
+	}
+	if org := am.CurrentOrg(); org == nil || org.Id != "o2" {
+		t.Errorf("selected %v, want o2", org)
+	}
+	am.SetCurrentOrganization(&api.Org{Id: "o1"})
+
+	if err := am.SwitchAccount("user"); err != nil {
+		t.Fatal(err)
+	}
+	if org := am.CurrentOrg(); org == nil || org.Id != "u1" {
+		t.Errorf("selected %v, want u1", org)
+	}
+	if account, _ := am.accountManager.Account("other"); account.OrgID != "o1" {
+		t.Errorf("stored organization of other is %q, want o1", account.OrgID)
+	}
+	for userID, want := range map[string]string{"user": "u1", "other": "o1"} {
+		if cached, _ := am.cacheManager.Get(userID); cached.SelectedOrgID != want {
+			t.Errorf("cached selection of %s is %q, want %q", userID, cached.SelectedOrgID, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+//go:build windows
+
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/config"
+)
+
+// IsUnauthorized reports whether err is the server rejecting the session.
+// It is the only error that logs the user out; the others may be the
+// network.
+func IsUnauthorized(err error) bool {
+	var apiErr *api.APIError
+	return errors.As(err, &apiErr) && apiErr.Type == api.ErrorTypeHTTPError && apiErr.Status == 401
+}
+
+// isUnreachable reports whether err means the server could not be reached
+// or could not answer, as opposed to answering with an error
+func isUnreachable(err error) bool {
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Type {
+	case api.ErrorTypeNetworkError:
+		return true
+	case api.ErrorTypeHTTPError:
+		// Timeouts have no status
+		return apiErr.Status == 0 || apiErr.Status >= 500
+	}
+	return false
+}
+
+// IsOffline reports whether the last attempt to reach the server failed, so
+// that the user and organizations shown are the cached ones
+func (am *AuthManager) IsOffline() bool {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.offline
+}
+
+func (am *AuthManager) setOffline(offline bool) {
+	am.mu.Lock()
+	changed := am.offline != offline
+	am.offline = offline
+	am.mu.Unlock()
+	if changed {
+		if offline {
+			logger.Warn("Server unreachable, using cached account data")
+		} else {
+			logger.Info("Server reachable again")
+		}
+		am.publishState()
+	}
+}
+
+// handleRequestError updates the state after a request on behalf of the
+// current user failed: a rejected session logs out, an unreachable server
+// marks the state offline
+func (am *AuthManager) handleRequestError(err error) {
+	switch {
+	case IsUnauthorized(err):
+		am.expireSession()
+	case isUnreachable(err):
+		am.setOffline(true)
+	default:
+		if required, ok := api.IsClientTooOld(err); ok {
+			am.setUpdateRequired(required)
+		}
+	}
+}
+
+// setUpdateRequired records that the server refused this version of the
+// client, so that the user is asked to update
+func (am *AuthManager) setUpdateRequired(required string) {
+	am.mu.Lock()
+	changed := am.updateRequired == nil || *am.updateRequired != required
+	am.updateRequired = &required
+	am.mu.Unlock()
+	if changed {
+		logger.Warn("The server requires a newer client (%q)", required)
+		am.publishState()
+	}
+}
+
+// expireSession clears the authentication after the server rejected the
+// session token
+func (am *AuthManager) expireSession() {
+	logger.Info("Session expired, clearing authentication")
+	am.mu.Lock()
+	userID := ""
+	if am.currentUser != nil {
+		userID = am.currentUser.UserId
+	}
+	am.isAuthenticated = false
+	am.offline = false
+	am.mu.Unlock()
+	am.publishState()
+
+	if userID == "" {
+		return
+	}
+	// The account stays, to be signed in to again
+	_ = am.secretManager.DeleteSessionToken(userID)
+	if am.cacheManager != nil {
+		_ = am.cacheManager.Remove(userID)
+	}
+}
+
+// restoreCached shows the cached state of account until the server confirms
+// it. Accounts cached by older versions only have what the account store
+// knows about them.
+func (am *AuthManager) restoreCached(account *config.Account) {
+	var cached config.CachedAccount
+	if am.cacheManager != nil {
+		cached, _ = am.cacheManager.Get(account.UserID)
+	}
+
+	user := cached.User
+	if user == nil {
+		user = &api.User{
+			Id:     account.UserID,
+			UserId: account.UserID,
+			Email:  account.Email,
+		}
+		if account.Username != "" {
+			username := account.Username
+			user.Username = &username
+		}
+		if account.Name != "" {
+			name := account.Name
+			user.Name = &name
+		}
+	}
+
+	orgID := cached.SelectedOrgID
+	if orgID == "" {
+		orgID = account.OrgID
+	}
+
+	am.mu.Lock()
+	am.currentUser = user
+	am.organizations = cached.Orgs
+	am.currentOrg = nil
+	for _, org := range cached.Orgs {
+		if org.Id == orgID {
+			am.currentOrg = &org
+			break
+		}
+	}
+	am.isAuthenticated = true
+	am.mu.Unlock()
+}
+
+// cachedOrgs returns the cached organizations of a user, or none
+func (am *AuthManager) cachedOrgs(userID string) []api.Org {
+	if am.cacheManager == nil {
+		return []api.Org{}
+	}
+	cached, ok := am.cacheManager.Get(userID)
+	if !ok || cached.Orgs == nil {
+		return []api.Org{}
+	}
+	return cached.Orgs
+}
+
+// updateCache changes the cached state of userID with fn. The user is
+// passed by the caller rather than read, so that work for an account that is
+// no longer active does not land in the cache of the one that is.
+func (am *AuthManager) updateCache(userID string, fn func(cached *config.CachedAccount)) {
+	if am.cacheManager == nil || userID == "" {
+		return
+	}
+
+	if err := am.cacheManager.Update(userID, fn); err != nil {
+		logger.Warn("Failed to save account cache: %v", err)
+	}
+}
+
+// cacheOrgs stores the organizations and selected organization of userID,
+// if it is still the current user
+func (am *AuthManager) cacheOrgs(userID string) {
+	am.mu.RLock()
+	if am.currentUser == nil || am.currentUser.UserId != userID {
+		am.mu.RUnlock()
+		return
+	}
+	orgs := append([]api.Org(nil), am.organizations...)
+	selectedOrgID := ""
+	if am.currentOrg != nil {
+		selectedOrgID = am.currentOrg.Id
+	}
+	am.mu.RUnlock()
+
+	am.updateCache(userID, func(cached *config.CachedAccount) {
+		cached.Orgs = orgs
+		cached.OrgsFetchedAt = time.Now()
+		cached.SelectedOrgID = selectedOrgID
+	})
+}
+
+// cacheMyDevice stores a MyDevice response of userID along with the user and
+// organizations it updated. The secret of the OLM stays in the secret store
+// and is not written to the cache file.
+func (am *AuthManager) cacheMyDevice(userID string, myDevice *api.MyDeviceResponse) {
+	cachedDevice := *myDevice
+	if myDevice.Olm != nil {
+		olm := *myDevice.Olm
+		olm.Secret = nil
+		cachedDevice.Olm = &olm
+	}
+
+	am.mu.RLock()
+	var user *api.User
+	if am.currentUser != nil && am.currentUser.UserId == userID {
+		userCopy := *am.currentUser
+		user = &userCopy
+	}
+	am.mu.RUnlock()
+
+	am.updateCache(userID, func(cached *config.CachedAccount) {
+		now := time.Now()
+		cached.MyDevice = &cachedDevice
+		cached.MyDeviceFetchedAt = now
+		if user != nil {
+			cached.User = user
+			cached.UserFetchedAt = now
+		}
+	})
+	am.cacheOrgs(userID)
+}
+
+// validateSession checks a restored session against the server. Only a 401
+// logs out; if the server cannot be reached the cached state stays. The
+// result is dropped if the active account changed since generation.
+func (am *AuthManager) validateSession(generation uint64, hostname string, token string) {
+	user, err := api.NewAPIClient(hostname, token).GetUser()
+
+	am.switchMu.Lock()
+	defer am.switchMu.Unlock()
+	if am.generation != generation {
+		logger.Info("Active account changed while validating the session, ignoring the result")
+		return
+	}
+
+	if err != nil {
+		logger.Error("Failed to validate session: %v", err)
+		am.handleRequestError(err)
+		return
+	}
+
+	if err := am.applySession(user, hostname, token); err != nil {
+		logger.Error("Failed to update account after validating session: %v", err)
+	}
+}
+
+// Revalidate fetches the current user to check that the session is still
+// valid. It returns an error for which IsUnauthorized is true if the server
+// rejected the session, in which case the user is logged out.
+func (am *AuthManager) Revalidate() error {
+	user, err := am.apiClient.GetUser()
+	if err != nil {
+		am.handleRequestError(err)
+		return err
+	}
+
+	if user.UserId == "" {
+		user.UserId = user.Id
+	}
+	am.mu.Lock()
+	am.isAuthenticated = true
+	am.mu.Unlock()
+	am.setOffline(false)
+	am.UpdateCurrentUser(user)
+	return nil
+}
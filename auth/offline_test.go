@@ -0,0 +1,68 @@
+//go:build windows
+
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/config"
+)
+
+func TestCacheMyDeviceLeavesOutSecret(t *testing.T) {
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+	cache := config.NewCacheManager()
+	am := NewAuthManager(nil, nil, nil, cache, nil)
+	am.currentUser = &api.User{UserId: "user"}
+
+	secret := "olm-secret-value"
+	myDevice := &api.MyDeviceResponse{Olm: &api.Olm{OlmId: "olm", UserId: "user", Secret: &secret}}
+	am.cacheMyDevice("user", myDevice)
+
+	if myDevice.Olm.Secret == nil || *myDevice.Olm.Secret != secret {
+		t.Error("caching cleared the secret of the response")
+	}
+	cached, ok := cache.Get("user")
+	if !ok || cached.MyDevice == nil || cached.MyDevice.Olm == nil || cached.MyDevice.Olm.OlmId != "olm" {
+		t.Fatalf("cached %+v, want the device", cached)
+	}
+	if cached.MyDevice.Olm.Secret != nil {
+		t.Error("the secret of the OLM was cached")
+	}
+	data, err := os.ReadFile(cache.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("the secret of the OLM was written to the cache file")
+	}
+}
+
+func TestCacheManagerRemovesCachedSecret(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("LOCALAPPDATA", dir)
+	path := filepath.Join(dir, config.AppName, config.CacheFileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	written := `{"accounts":{"user":{"myDevice":{"user":{},"orgs":[],"olm":{"olmId":"olm","userId":"user","secret":"olm-secret-value"}}}}}`
+	if err := os.WriteFile(path, []byte(written), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := config.NewCacheManager()
+	cached, _ := cache.Get("user")
+	if cached.MyDevice == nil || cached.MyDevice.Olm == nil || cached.MyDevice.Olm.Secret != nil {
+		t.Errorf("cached device %+v, want it without the secret", cached.MyDevice)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "olm-secret-value") {
+		t.Error("the secret of the OLM is still in the cache file")
+	}
+}
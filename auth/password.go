@@ -0,0 +1,138 @@
+//go:build windows
+
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fosrl/windows/api"
+)
+
+// pendingLogin is a password login that is waiting for the user to verify
+// their email address. Its requests are made with a client of its own, as
+// the shared one carries the session of the active account.
+type pendingLogin struct {
+	hostname string
+	token    string
+}
+
+// client returns a client for the server of the login with its session
+func (p *pendingLogin) client() *api.APIClient {
+	return api.NewAPIClient(p.hostname, p.token)
+}
+
+// LoginWithPassword authenticates with an email address and password, for
+// machines without a browser to complete device authentication.
+//
+// If the account uses two-factor authentication, the server asks for a code:
+// LoginWithPassword returns an AuthError of type AuthErrorTwoFactorRequired
+// and the caller calls it again with the code. If the email address is not
+// verified yet, it returns AuthErrorEmailVerificationRequired and the caller
+// completes the login with VerifyEmail.
+func (am *AuthManager) LoginWithPassword(hostnameOverride *string, email, password string, code *string) error {
+	loginClient := am.loginClient(hostnameOverride)
+
+	am.mu.Lock()
+	am.pendingLogin = nil
+	am.errorMessage = nil
+	am.mu.Unlock()
+
+	email = strings.TrimSpace(email)
+	if code != nil {
+		trimmed := strings.TrimSpace(*code)
+		code = &trimmed
+	}
+
+	response, token, err := loginClient.Login(email, password, code)
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+
+	if response.CodeRequested != nil && *response.CodeRequested {
+		return &AuthError{Type: AuthErrorTwoFactorRequired}
+	}
+
+	if response.EmailVerificationRequired != nil && *response.EmailVerificationRequired {
+		am.mu.Lock()
+		am.pendingLogin = &pendingLogin{hostname: loginClient.CurrentBaseURL(), token: token}
+		am.mu.Unlock()
+		return &AuthError{Type: AuthErrorEmailVerificationRequired}
+	}
+
+	return am.completeLogin(loginClient.CurrentBaseURL(), token)
+}
+
+// VerifyEmail completes a password login that returned
+// AuthErrorEmailVerificationRequired with the code sent to the user's email
+// address
+func (am *AuthManager) VerifyEmail(code string) error {
+	am.mu.RLock()
+	pending := am.pendingLogin
+	am.mu.RUnlock()
+	if pending == nil {
+		return errors.New("no login is waiting for email verification")
+	}
+
+	response, err := pending.client().VerifyEmail(strings.TrimSpace(code))
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+	if !response.Valid {
+		err := errors.New("the verification code is invalid or has expired")
+		am.setErrorMessage(err)
+		return err
+	}
+
+	am.mu.Lock()
+	am.pendingLogin = nil
+	am.mu.Unlock()
+
+	return am.completeLogin(pending.hostname, pending.token)
+}
+
+// ResendEmailVerification sends a new code for the login waiting for email
+// verification
+func (am *AuthManager) ResendEmailVerification() error {
+	am.mu.RLock()
+	pending := am.pendingLogin
+	am.mu.RUnlock()
+	if pending == nil {
+		return errors.New("no login is waiting for email verification")
+	}
+	return pending.client().RequestEmailVerificationCode()
+}
+
+// CancelPasswordLogin forgets a login waiting for email verification
+func (am *AuthManager) CancelPasswordLogin() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.pendingLogin = nil
+}
+
+// completeLogin makes the session of a successful password login to hostname
+// the current one. The shared client keeps the session of the active account
+// until the new one is confirmed.
+func (am *AuthManager) completeLogin(hostname, token string) error {
+	if token == "" {
+		return &AuthError{Type: AuthErrorInvalidToken}
+	}
+
+	// Get user info with the new session
+	user, err := api.NewAPIClient(hostname, token).GetUser()
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+
+	return am.handleSuccessfulAuth(user, hostname, token)
+}
+
+func (am *AuthManager) setErrorMessage(err error) {
+	msg := err.Error()
+	am.mu.Lock()
+	am.errorMessage = &msg
+	am.mu.Unlock()
+}
@@ -0,0 +1,200 @@
+//go:build windows
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/api/apitest"
+)
+
+// passwordAPI serves a password login of the user "new" that must verify
+// their email address, to a manager signed in as "user" with the session
+// "token"
+func passwordAPI(t *testing.T, newUserStatus int) *apitest.Server {
+	session := func(r *http.Request) string {
+		cookie, err := r.Cookie("p_session_token")
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+	requireNewSession := func(w http.ResponseWriter, r *http.Request) bool {
+		if got := session(r); got != "new-token" {
+			t.Errorf("%s %s with session %q, want the one of the pending login", r.Method, r.URL.Path, got)
+			apitest.Respond(w, http.StatusUnauthorized, nil)
+			return false
+		}
+		return true
+	}
+	verified := true
+	return newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"POST /auth/login": func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "p_session_token", Value: "new-token"})
+			apitest.Respond(w, http.StatusOK, api.LoginResponse{UserId: "new", EmailVerificationRequired: &verified})
+		},
+		"POST /auth/verify-email": func(w http.ResponseWriter, r *http.Request) {
+			if !requireNewSession(w, r) {
+				return
+			}
+			var request api.VerifyEmailRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			apitest.Respond(w, http.StatusOK, api.VerifyEmailResponse{Valid: request.Code == "123456"})
+		},
+		"POST /auth/verify-email/request": func(w http.ResponseWriter, r *http.Request) {
+			if requireNewSession(w, r) {
+				apitest.Respond(w, http.StatusOK, nil)
+			}
+		},
+		"GET /user": func(w http.ResponseWriter, r *http.Request) {
+			switch session(r) {
+			case "token":
+				apitest.Respond(w, http.StatusOK, api.User{UserId: "user"})
+			case "new-token":
+				apitest.Respond(w, newUserStatus, api.User{UserId: "new", Email: "new@example.com"})
+			default:
+				apitest.Respond(w, http.StatusUnauthorized, nil)
+			}
+		},
+		"GET /user/{user}/orgs": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListUserOrgsResponse{Orgs: []api.Org{{Id: "org"}}})
+		},
+	})
+}
+
+func TestPasswordLoginWithEmailVerification(t *testing.T) {
+	fa := passwordAPI(t, http.StatusOK)
+	am := signedIn(fa, "org")
+
+	err := am.LoginWithPassword(nil, "new@example.com", "password", nil)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.Type != AuthErrorEmailVerificationRequired {
+		t.Fatalf("LoginWithPassword: %v, want email verification required", err)
+	}
+	if err := am.ResendEmailVerification(); err != nil {
+		t.Errorf("ResendEmailVerification: %v", err)
+	}
+	if err := am.VerifyEmail("000000"); err == nil {
+		t.Error("VerifyEmail accepted an invalid code")
+	}
+	if user := am.CurrentUser(); user.UserId != "user" {
+		t.Errorf("signed in as %s before the email was verified", user.UserId)
+	}
+
+	if err := am.VerifyEmail(" 123456 "); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if user := am.CurrentUser(); user == nil || user.UserId != "new" {
+		t.Errorf("signed in as %v, want new", user)
+	}
+	if token, _ := am.secretManager.GetSessionToken("new"); token != "new-token" {
+		t.Errorf("saved session %q, want new-token", token)
+	}
+	if account, err := am.accountManager.ActiveAccount(); err != nil || account == nil || account.UserID != "new" {
+		t.Errorf("active account %v, want new", account)
+	}
+	if err := am.VerifyEmail("123456"); err == nil {
+		t.Error("VerifyEmail succeeded again without a pending login")
+	}
+}
+
+func TestPasswordLoginKeepsSessionUntilConfirmed(t *testing.T) {
+	fa := passwordAPI(t, http.StatusInternalServerError)
+	am := signedIn(fa, "org")
+
+	if err := am.LoginWithPassword(nil, "new@example.com", "password", nil); err == nil {
+		t.Fatal("LoginWithPassword succeeded")
+	}
+	if err := am.VerifyEmail("123456"); err == nil {
+		t.Fatal("VerifyEmail succeeded without the user")
+	}
+
+	// The shared client still carries the session of the active account
+	user, err := am.apiClient.GetUser()
+	if err != nil || user.UserId != "user" {
+		t.Errorf("shared client is signed in as %v (%v), want user", user, err)
+	}
+	if current := am.CurrentUser(); current.UserId != "user" {
+		t.Errorf("signed in as %s after the login failed", current.UserId)
+	}
+	if _, ok := am.secretManager.GetSessionToken("new"); ok {
+		t.Error("the session of the failed login was saved")
+	}
+}
+
+func TestPasswordLoginWithTwoFactorCode(t *testing.T) {
+	fa := newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"POST /auth/login": func(w http.ResponseWriter, r *http.Request) {
+			var request api.LoginRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			if request.Email != "new@example.com" || request.Password != "password" {
+				t.Errorf("login as %q with %q", request.Email, request.Password)
+			}
+			switch {
+			case request.Code == nil:
+				requested := true
+				apitest.Respond(w, http.StatusOK, api.LoginResponse{CodeRequested: &requested})
+			case *request.Code == "654321":
+				http.SetCookie(w, &http.Cookie{Name: "p_session_token", Value: "new-token"})
+				apitest.Respond(w, http.StatusOK, api.LoginResponse{UserId: "new"})
+			default:
+				apitest.Respond(w, http.StatusUnauthorized, nil)
+			}
+		},
+		"GET /user": func(w http.ResponseWriter, r *http.Request) {
+			if cookie, err := r.Cookie("p_session_token"); err == nil && cookie.Value == "new-token" {
+				apitest.Respond(w, http.StatusOK, api.User{UserId: "new", Email: "new@example.com"})
+				return
+			}
+			apitest.Respond(w, http.StatusOK, api.User{UserId: "user"})
+		},
+		"GET /user/{user}/orgs": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListUserOrgsResponse{Orgs: []api.Org{{Id: "org"}}})
+		},
+	})
+	am := signedIn(fa, "org")
+	stillSignedIn := func(step string) {
+		t.Helper()
+		if user := am.CurrentUser(); user == nil || user.UserId != "user" {
+			t.Errorf("%s: signed in as %v, want user", step, user)
+		}
+		if _, ok := am.secretManager.GetSessionToken("new"); ok {
+			t.Errorf("%s: the session of the login was saved", step)
+		}
+	}
+
+	err := am.LoginWithPassword(nil, "new@example.com", "password", nil)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.Type != AuthErrorTwoFactorRequired {
+		t.Fatalf("LoginWithPassword without a code: %v, want two-factor code required", err)
+	}
+	stillSignedIn("code requested")
+
+	wrong := "000000"
+	err = am.LoginWithPassword(nil, "new@example.com", "password", &wrong)
+	if err == nil || errors.As(err, &authErr) && authErr.Type == AuthErrorTwoFactorRequired {
+		t.Fatalf("LoginWithPassword with a wrong code: %v, want an error", err)
+	}
+	stillSignedIn("wrong code")
+
+	code := " 654321 "
+	if err := am.LoginWithPassword(nil, "new@example.com", "password", &code); err != nil {
+		t.Fatalf("LoginWithPassword with the code: %v", err)
+	}
+	if user := am.CurrentUser(); user == nil || user.UserId != "new" {
+		t.Errorf("signed in as %v, want new", user)
+	}
+	if token, _ := am.secretManager.GetSessionToken("new"); token != "new-token" {
+		t.Errorf("saved session %q, want new-token", token)
+	}
+	if account, err := am.accountManager.ActiveAccount(); err != nil || account == nil || account.UserID != "new" {
+		t.Errorf("active account %v, want new", account)
+	}
+	if n := fa.Count("POST /auth/login"); n != 3 {
+		t.Errorf("%d login requests, want 3", n)
+	}
+}
@@ -0,0 +1,248 @@
+//go:build windows
+
+package auth
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/events"
+)
+
+const (
+	// DefaultRefreshInterval is how often the scheduler refreshes the
+	// organizations and device info
+	DefaultRefreshInterval = 3 * time.Minute
+	// DefaultRefreshJitter is the most the interval is randomly shortened or
+	// lengthened by, so that clients do not refresh in lockstep
+	DefaultRefreshJitter = 15 * time.Second
+	// minTriggeredRefreshSpacing is how long after a refresh another one that
+	// was triggered is skipped, since a network change is often several
+	minTriggeredRefreshSpacing = 10 * time.Second
+)
+
+// OrgChange is a change of the organizations the user belongs to, found by a
+// refresh
+type OrgChange struct {
+	Added   []api.Org
+	Removed []api.Org
+	// Revoked is the selected organization if the user no longer belongs to
+	// it. It is cleared from the selection and also in Removed.
+	Revoked *api.Org
+}
+
+// Empty reports whether nothing changed
+func (c OrgChange) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && c.Revoked == nil
+}
+
+// OrgEvents returns the topic of changes of the user's organizations
+func (am *AuthManager) OrgEvents() *events.Topic[OrgChange] {
+	return am.orgEvents
+}
+
+// setOrganizationsLocked replaces the organizations with the ones fetched
+// from the server, keeping the selection if the user still belongs to it.
+// Callers hold am.mu for writing and publish the returned change after
+// unlocking.
+func (am *AuthManager) setOrganizationsLocked(orgs []api.Org) OrgChange {
+	var change OrgChange
+	// Nothing was known before, so nothing changed
+	if am.organizations != nil {
+		change.Added = diffOrgs(orgs, am.organizations)
+		change.Removed = diffOrgs(am.organizations, orgs)
+	}
+
+	if current := am.currentOrg; current != nil {
+		am.currentOrg = nil
+		for _, org := range orgs {
+			if org.Id == current.Id {
+				am.currentOrg = &org
+				break
+			}
+		}
+		if am.currentOrg == nil {
+			// Current org no longer exists, clear selection
+			change.Revoked = current
+			if am.currentUser != nil {
+				_ = am.accountManager.SetUserOrganization(am.currentUser.UserId, "")
+			}
+		}
+	}
+
+	am.organizations = orgs
+	return change
+}
+
+// publishOrgChange publishes change unless nothing changed
+func (am *AuthManager) publishOrgChange(change OrgChange) {
+	if change.Empty() {
+		return
+	}
+	if change.Revoked != nil {
+		logger.Warn("No longer a member of the selected organization %s", change.Revoked.Name)
+	}
+	logger.Info("Organizations changed: %d added, %d removed", len(change.Added), len(change.Removed))
+	am.orgEvents.Publish(change)
+}
+
+// diffOrgs returns the organizations in a that are not in b
+func diffOrgs(a, b []api.Org) []api.Org {
+	ids := make(map[string]struct{}, len(b))
+	for _, org := range b {
+		ids[org.Id] = struct{}{}
+	}
+	var diff []api.Org
+	for _, org := range a {
+		if _, ok := ids[org.Id]; !ok {
+			diff = append(diff, org)
+		}
+	}
+	return diff
+}
+
+// Clock is the time source of a RefreshScheduler, replaced in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RefreshScheduler refreshes the organizations and device info of the signed
+// in user on an interval with jitter and when triggered, such as after a
+// network change. Refreshes never overlap: callers that ask for one while
+// another is running wait for it and share its result.
+type RefreshScheduler struct {
+	am       *AuthManager
+	clock    Clock
+	interval time.Duration
+	jitter   time.Duration
+
+	triggers chan string
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu          sync.Mutex
+	inflight    *refreshCall
+	lastRefresh time.Time
+}
+
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRefreshScheduler returns a scheduler for am. A nil clock uses the system
+// clock; interval and jitter of 0 use the defaults.
+func NewRefreshScheduler(am *AuthManager, clock Clock, interval, jitter time.Duration) *RefreshScheduler {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	if jitter <= 0 {
+		jitter = DefaultRefreshJitter
+	}
+	if jitter >= interval {
+		jitter = interval / 2
+	}
+	return &RefreshScheduler{
+		am:       am,
+		clock:    clock,
+		interval: interval,
+		jitter:   jitter,
+		triggers: make(chan string, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start starts refreshing in the background until Stop is called
+func (s *RefreshScheduler) Start() {
+	go s.run()
+}
+
+// Stop stops the scheduler. A refresh in progress completes.
+func (s *RefreshScheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Trigger asks for a refresh soon, giving the reason for the logs. Triggers
+// that arrive while one is pending are merged with it, and ones that arrive
+// right after a refresh are skipped.
+func (s *RefreshScheduler) Trigger(reason string) {
+	select {
+	case s.triggers <- reason:
+	default:
+	}
+}
+
+// Refresh refreshes now and returns the result. If a refresh is already in
+// progress, it waits for that one instead of starting another.
+func (s *RefreshScheduler) Refresh(reason string) error {
+	s.mu.Lock()
+	if call := s.inflight; call != nil {
+		s.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	s.inflight = call
+	s.mu.Unlock()
+
+	logger.Debug("Refreshing organizations and device info (%s)", reason)
+	call.err = s.refresh()
+
+	s.mu.Lock()
+	s.inflight = nil
+	s.lastRefresh = s.clock.Now()
+	s.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// refresh prefers MyDevice, which also updates the user, and falls back to
+// the organizations for accounts without OLM credentials and for servers
+// without MyDevice
+func (s *RefreshScheduler) refresh() error {
+	if !s.am.IsAuthenticated() {
+		return nil
+	}
+	if olmId, found := s.am.GetOlmId(); found && olmId != "" && s.am.apiClient.Supports(api.CapabilityMyDevice) {
+		return s.am.RefreshFromMyDevice(olmId)
+	}
+	return s.am.RefreshOrganizations()
+}
+
+func (s *RefreshScheduler) run() {
+	next := s.clock.After(s.nextInterval())
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-next:
+			_ = s.Refresh("interval")
+		case reason := <-s.triggers:
+			s.mu.Lock()
+			recent := !s.lastRefresh.IsZero() && s.clock.Now().Sub(s.lastRefresh) < minTriggeredRefreshSpacing
+			s.mu.Unlock()
+			if recent {
+				logger.Debug("Skipping refresh after %s, refreshed recently", reason)
+				continue
+			}
+			_ = s.Refresh(reason)
+		}
+		next = s.clock.After(s.nextInterval())
+	}
+}
+
+// nextInterval returns the interval with a random jitter applied
+func (s *RefreshScheduler) nextInterval() time.Duration {
+	return s.interval - s.jitter + time.Duration(rand.Int64N(int64(2*s.jitter)+1))
+}
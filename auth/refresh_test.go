@@ -0,0 +1,336 @@
+//go:build windows
+
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/api/apitest"
+	"github.com/fosrl/windows/config"
+)
+
+// fakeClock is a Clock that only moves when told to
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waits   []time.Duration
+	created chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), created: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	c.waits = append(c.waits, d)
+	c.created <- struct{}{}
+	return ch
+}
+
+// Advance moves the clock by d and fires the timers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// waitTimer waits until the scheduler asks for a timer
+func (c *fakeClock) waitTimer(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scheduler did not set a timer")
+	}
+}
+
+func TestNextIntervalJitter(t *testing.T) {
+	s := NewRefreshScheduler(nil, newFakeClock(), 10*time.Minute, time.Minute)
+	lowest, highest := time.Duration(1<<62), time.Duration(0)
+	for range 2000 {
+		d := s.nextInterval()
+		if d < 9*time.Minute || d > 11*time.Minute {
+			t.Fatalf("interval %s outside 10m±1m", d)
+		}
+		lowest, highest = min(lowest, d), max(highest, d)
+	}
+	// The jitter spreads both ways rather than only shortening or lengthening
+	if lowest > 9*time.Minute+30*time.Second || highest < 10*time.Minute+30*time.Second {
+		t.Errorf("intervals between %s and %s, want them spread over 9m to 11m", lowest, highest)
+	}
+
+	for _, tt := range []struct {
+		interval, jitter         time.Duration
+		wantInterval, wantJitter time.Duration
+	}{
+		{0, 0, DefaultRefreshInterval, DefaultRefreshJitter},
+		{time.Minute, 0, time.Minute, DefaultRefreshJitter},
+		{10 * time.Second, 0, 10 * time.Second, 5 * time.Second},
+		{time.Minute, 2 * time.Minute, time.Minute, 30 * time.Second},
+	} {
+		s := NewRefreshScheduler(nil, nil, tt.interval, tt.jitter)
+		if s.interval != tt.wantInterval || s.jitter != tt.wantJitter {
+			t.Errorf("NewRefreshScheduler(%s, %s): interval %s and jitter %s, want %s and %s",
+				tt.interval, tt.jitter, s.interval, s.jitter, tt.wantInterval, tt.wantJitter)
+		}
+	}
+}
+
+// orgsAPI serves the organizations of the user, blocking each request
+// until release is closed if it is set
+type orgsAPI struct {
+	*apitest.Server
+	mu      sync.Mutex
+	orgs    []api.Org
+	status  int
+	entered chan struct{}
+	release chan struct{}
+	// times are the times of clock at which the organizations were listed
+	clock *fakeClock
+	times []time.Time
+}
+
+func newOrgsAPI(t *testing.T, orgs ...api.Org) *orgsAPI {
+	oa := &orgsAPI{orgs: orgs, status: http.StatusOK, entered: make(chan struct{}, 100)}
+	oa.Server = newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"GET /user/{user}/orgs": func(w http.ResponseWriter, r *http.Request) {
+			oa.mu.Lock()
+			orgs, status, release := oa.orgs, oa.status, oa.release
+			if oa.clock != nil {
+				oa.times = append(oa.times, oa.clock.Now())
+			}
+			oa.mu.Unlock()
+			oa.entered <- struct{}{}
+			if release != nil {
+				<-release
+			}
+			apitest.Respond(w, status, api.ListUserOrgsResponse{Orgs: orgs})
+		},
+	})
+	return oa
+}
+
+func (oa *orgsAPI) setOrgs(orgs ...api.Org) {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	oa.orgs = orgs
+}
+
+func (oa *orgsAPI) refreshTimes() []time.Time {
+	oa.mu.Lock()
+	defer oa.mu.Unlock()
+	return slices.Clone(oa.times)
+}
+
+func TestRefreshSharesConcurrentCalls(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+		oa := newOrgsAPI(t, api.Org{Id: "org"})
+		oa.status = status
+		oa.release = make(chan struct{})
+		s := NewRefreshScheduler(signedIn(oa.Server, "org"), newFakeClock(), 0, 0)
+
+		const callers = 5
+		errs := make(chan error, callers)
+		go func() { errs <- s.Refresh("first") }()
+		<-oa.entered
+		for range callers - 1 {
+			go func() { errs <- s.Refresh("joined") }()
+		}
+		// Let the callers reach the refresh in progress before it completes
+		time.Sleep(50 * time.Millisecond)
+		close(oa.release)
+
+		var results []error
+		for range callers {
+			results = append(results, <-errs)
+		}
+		if n := oa.Count("GET /user/{user}/orgs"); n != 1 {
+			t.Errorf("HTTP %d: %d concurrent refreshes made %d requests, want 1", status, callers, n)
+		}
+		for _, err := range results {
+			if (err == nil) != (status == http.StatusOK) || err != results[0] {
+				t.Errorf("HTTP %d: callers got %v, want one shared result", status, results)
+				break
+			}
+		}
+
+		// A refresh after the shared one makes its own request
+		if err := s.Refresh("later"); (err == nil) != (status == http.StatusOK) {
+			t.Errorf("HTTP %d: later refresh: %v", status, err)
+		}
+		if n := oa.Count("GET /user/{user}/orgs"); n != 2 {
+			t.Errorf("HTTP %d: %d requests after a later refresh, want 2", status, n)
+		}
+	}
+}
+
+func TestTriggerSpacing(t *testing.T) {
+	clock := newFakeClock()
+	oa := newOrgsAPI(t, api.Org{Id: "org"})
+	oa.clock = clock
+	s := NewRefreshScheduler(signedIn(oa.Server, "org"), clock, 10*time.Minute, time.Minute)
+	s.Start()
+	defer s.Stop()
+	clock.waitTimer(t)
+	start := clock.Now()
+
+	// drained waits until the scheduler took the pending trigger
+	drained := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(s.triggers) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("the scheduler did not take the trigger")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	s.Trigger("network change")
+	clock.waitTimer(t)
+
+	// Right after a refresh, triggers are skipped
+	clock.Advance(5 * time.Second)
+	s.Trigger("network change")
+	drained()
+	s.Trigger("network change")
+	drained()
+
+	// Once the spacing has passed, a trigger refreshes again
+	clock.Advance(6 * time.Second)
+	s.Trigger("network change")
+	clock.waitTimer(t)
+
+	want := []time.Time{start, start.Add(11 * time.Second)}
+	if got := oa.refreshTimes(); !slices.Equal(got, want) {
+		t.Errorf("refreshed at %v, want %v", got, want)
+	}
+
+	// The interval refreshes without a trigger
+	clock.Advance(11 * time.Minute)
+	clock.waitTimer(t)
+	if got := oa.refreshTimes(); len(got) != 3 || !got[2].Equal(start.Add(11*time.Second+11*time.Minute)) {
+		t.Errorf("refreshed at %v, want a third refresh on the interval", got)
+	}
+
+	clock.mu.Lock()
+	waits := slices.Clone(clock.waits)
+	clock.mu.Unlock()
+	for _, d := range waits {
+		if d < 9*time.Minute || d > 11*time.Minute {
+			t.Errorf("the scheduler waited %s, want 10m±1m", d)
+		}
+	}
+}
+
+func TestRefreshOrgChanges(t *testing.T) {
+	a, b, c := api.Org{Id: "a", Name: "A"}, api.Org{Id: "b", Name: "B"}, api.Org{Id: "c", Name: "C"}
+	oa := newOrgsAPI(t, a, b)
+	am := signedIn(oa.Server, "b")
+	am.organizations = nil
+	accounts := am.accountManager.(*fakeAccounts)
+	accounts.AddAccount(config.Account{UserID: "user", OrgID: "b"})
+
+	changes := make(chan OrgChange, 10)
+	defer am.OrgEvents().Subscribe(func(change OrgChange) { changes <- change }).Unsubscribe()
+	next := func() OrgChange {
+		t.Helper()
+		select {
+		case change := <-changes:
+			return change
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change of the organizations was published")
+			return OrgChange{}
+		}
+	}
+	ids := func(orgs []api.Org) []string {
+		var ids []string
+		for _, org := range orgs {
+			ids = append(ids, org.Id)
+		}
+		return ids
+	}
+
+	// The first list is not a change, and neither is the same list again
+	if err := am.RefreshOrganizations(); err != nil {
+		t.Fatal(err)
+	}
+	if err := am.RefreshOrganizations(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new organization is added without touching the selection
+	oa.setOrgs(a, b, c)
+	if err := am.RefreshOrganizations(); err != nil {
+		t.Fatal(err)
+	}
+	change := next()
+	if !slices.Equal(ids(change.Added), []string{"c"}) || len(change.Removed) != 0 || change.Revoked != nil {
+		t.Errorf("change %+v, want c added", change)
+	}
+	if org := am.CurrentOrg(); org == nil || org.Id != "b" {
+		t.Errorf("selected %v, want b", org)
+	}
+
+	// Leaving an organization that is not selected removes it
+	oa.setOrgs(b, c)
+	if err := am.RefreshOrganizations(); err != nil {
+		t.Fatal(err)
+	}
+	change = next()
+	if len(change.Added) != 0 || !slices.Equal(ids(change.Removed), []string{"a"}) || change.Revoked != nil {
+		t.Errorf("change %+v, want a removed", change)
+	}
+
+	// Leaving the selected organization revokes it
+	oa.setOrgs(c)
+	if err := am.RefreshOrganizations(); err != nil {
+		t.Fatal(err)
+	}
+	change = next()
+	if len(change.Added) != 0 || !slices.Equal(ids(change.Removed), []string{"b"}) || change.Revoked == nil || change.Revoked.Id != "b" {
+		t.Errorf("change %+v, want b removed and revoked", change)
+	}
+	if org := am.CurrentOrg(); org != nil {
+		t.Errorf("selected %v after it was revoked", org)
+	}
+	if account, _ := accounts.Account("user"); account.OrgID != "" {
+		t.Errorf("the account still selects %q", account.OrgID)
+	}
+
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected change %+v", change)
+	default:
+	}
+}
@@ -0,0 +1,101 @@
+//go:build windows
+
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/events"
+)
+
+// Resources are the sites and resources of an organization that clients can
+// reach
+type Resources struct {
+	OrgID     string
+	Sites     []api.Site
+	Resources []api.SiteResource
+	FetchedAt time.Time
+	// Unsupported is set when the server cannot list resources
+	Unsupported bool
+}
+
+// ResourceEvents returns the topic of refreshed resources. Late subscribers
+// receive the latest resources first.
+func (am *AuthManager) ResourceEvents() *events.Topic[Resources] {
+	return am.resourceEvents
+}
+
+// Resources returns the cached resources of the selected organization. They
+// are empty until RefreshResources succeeds for it.
+func (am *AuthManager) Resources() Resources {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	if am.currentOrg == nil || am.resources.OrgID != am.currentOrg.Id {
+		return Resources{}
+	}
+	return am.resources
+}
+
+// RefreshResources fetches the sites and resources of the selected
+// organization
+func (am *AuthManager) RefreshResources() error {
+	am.mu.RLock()
+	authenticated := am.isAuthenticated
+	orgID := ""
+	if am.currentOrg != nil {
+		orgID = am.currentOrg.Id
+	}
+	am.mu.RUnlock()
+
+	if !authenticated || orgID == "" {
+		return nil
+	}
+
+	sitesResponse, err := am.apiClient.ListOrgSites(orgID)
+	if err != nil {
+		return fmt.Errorf("failed to list sites: %w", err)
+	}
+
+	resources := Resources{
+		OrgID:     orgID,
+		Sites:     sitesResponse.Sites,
+		FetchedAt: time.Now(),
+	}
+	resourcesResponse, err := am.apiClient.ListOrgSiteResources(orgID)
+	switch {
+	case api.IsUnsupported(err):
+		// Older servers only have sites
+		resources.Unsupported = true
+		resourcesResponse = &api.ListSiteResourcesResponse{}
+	case err != nil:
+		return fmt.Errorf("failed to list resources: %w", err)
+	}
+	for _, resource := range resourcesResponse.SiteResources {
+		if resource.Enabled != nil && !*resource.Enabled {
+			continue
+		}
+		resources.Resources = append(resources.Resources, resource)
+	}
+	sort.SliceStable(resources.Sites, func(i, j int) bool {
+		return resources.Sites[i].Name < resources.Sites[j].Name
+	})
+	sort.SliceStable(resources.Resources, func(i, j int) bool {
+		return resources.Resources[i].Name < resources.Resources[j].Name
+	})
+
+	am.mu.Lock()
+	// Drop the result if the organization changed while fetching
+	if am.currentOrg == nil || am.currentOrg.Id != orgID {
+		am.mu.Unlock()
+		return nil
+	}
+	am.resources = resources
+	am.mu.Unlock()
+
+	logger.Info("Resources refreshed: %d sites, %d resources", len(resources.Sites), len(resources.Resources))
+	am.resourceEvents.Publish(resources)
+	return nil
+}
@@ -0,0 +1,137 @@
+//go:build windows
+
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/api/apitest"
+)
+
+func TestRefreshResources(t *testing.T) {
+	disabled := false
+	fa := newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSitesResponse{Sites: []api.Site{
+				{SiteId: 2, Name: "Office"},
+				{SiteId: 1, Name: "Lab"},
+			}})
+		},
+		"GET /org/{org}/site-resources": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSiteResourcesResponse{SiteResources: []api.SiteResource{
+				{Id: 1, Name: "Wiki", Destination: "10.0.0.2"},
+				{Id: 2, Name: "Old", Destination: "10.0.0.3", Enabled: &disabled},
+				{Id: 3, Name: "Database", Destination: "10.0.0.4"},
+			}})
+		},
+	})
+	am := signedIn(fa, "org")
+
+	if err := am.RefreshResources(); err != nil {
+		t.Fatal(err)
+	}
+	resources := am.Resources()
+	if resources.OrgID != "org" || resources.Unsupported || resources.FetchedAt.IsZero() {
+		t.Errorf("resources %+v", resources)
+	}
+	if len(resources.Sites) != 2 || resources.Sites[0].Name != "Lab" || resources.Sites[1].Name != "Office" {
+		t.Errorf("sites %+v, want Lab and Office", resources.Sites)
+	}
+	if len(resources.Resources) != 2 || resources.Resources[0].Name != "Database" || resources.Resources[1].Name != "Wiki" {
+		t.Errorf("resources %+v, want Database and Wiki without the disabled one", resources.Resources)
+	}
+	if published, ok := am.ResourceEvents().Latest(); !ok || published.OrgID != "org" || len(published.Resources) != 2 {
+		t.Errorf("published %+v, %v", published, ok)
+	}
+}
+
+func TestRefreshResourcesUnsupported(t *testing.T) {
+	fa := newFakeAPI(t, &api.ServerInfo{Version: "1.9.0", Capabilities: []api.Capability{api.CapabilityMyDevice}}, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSitesResponse{Sites: []api.Site{{SiteId: 1, Name: "Office"}}})
+		},
+		"GET /org/{org}/site-resources": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSiteResourcesResponse{})
+		},
+	})
+	am := signedIn(fa, "org")
+
+	if err := am.RefreshResources(); err != nil {
+		t.Fatal(err)
+	}
+	resources := am.Resources()
+	if !resources.Unsupported || len(resources.Sites) != 1 || len(resources.Resources) != 0 {
+		t.Errorf("resources %+v, want the sites only", resources)
+	}
+	if n := fa.Count("GET /org/{org}/site-resources"); n != 0 {
+		t.Errorf("%d requests for resources the server does not support", n)
+	}
+}
+
+func TestRefreshResourcesFailure(t *testing.T) {
+	fa := newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSitesResponse{Sites: []api.Site{{SiteId: 1, Name: "Office"}}})
+		},
+		"GET /org/{org}/site-resources": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusInternalServerError, nil)
+		},
+	})
+	am := signedIn(fa, "org")
+
+	if err := am.RefreshResources(); err == nil {
+		t.Error("RefreshResources succeeded without the resources")
+	}
+	if resources := am.Resources(); resources.OrgID != "" {
+		t.Errorf("a failed refresh cached %+v", resources)
+	}
+	if _, ok := am.ResourceEvents().Latest(); ok {
+		t.Error("a failed refresh was published")
+	}
+}
+
+func TestRefreshResourcesDropsPreviousOrg(t *testing.T) {
+	var am *AuthManager
+	fa := newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			// The user switches organization while the sites are fetched
+			am.mu.Lock()
+			am.currentOrg = &api.Org{Id: "other"}
+			am.mu.Unlock()
+			apitest.Respond(w, http.StatusOK, api.ListSitesResponse{Sites: []api.Site{{SiteId: 1, Name: "Office"}}})
+		},
+		"GET /org/{org}/site-resources": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSiteResourcesResponse{})
+		},
+	})
+	am = signedIn(fa, "org")
+
+	if err := am.RefreshResources(); err != nil {
+		t.Fatal(err)
+	}
+	if resources := am.Resources(); resources.OrgID != "" {
+		t.Errorf("resources of the previous organization were kept: %+v", resources)
+	}
+	if _, ok := am.ResourceEvents().Latest(); ok {
+		t.Error("resources of the previous organization were published")
+	}
+}
+
+func TestRefreshResourcesSignedOut(t *testing.T) {
+	fa := newFakeAPI(t, nil, map[string]http.HandlerFunc{
+		"GET /org/{org}/sites": func(w http.ResponseWriter, r *http.Request) {
+			apitest.Respond(w, http.StatusOK, api.ListSitesResponse{})
+		},
+	})
+	am := signedIn(fa, "org")
+	am.isAuthenticated = false
+
+	if err := am.RefreshResources(); err != nil {
+		t.Fatal(err)
+	}
+	if n := fa.Count("GET /org/{org}/sites"); n != 0 {
+		t.Errorf("%d requests while signed out", n)
+	}
+}
@@ -0,0 +1,120 @@
+//go:build windows
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/sso"
+)
+
+// ssoTimeout is how long the user has to complete the sign-in in the browser
+const ssoTimeout = 5 * time.Minute
+
+// loginClient returns the client to log in with: a temporary one for the
+// hostname override if there is one, the main one otherwise
+func (am *AuthManager) loginClient(hostnameOverride *string) *api.APIClient {
+	if hostnameOverride != nil && *hostnameOverride != "" {
+		return api.NewAPIClient(*hostnameOverride, "")
+	}
+	return am.apiClient
+}
+
+// ListIdentityProviders returns the identity providers users of an
+// organization can sign in with, or those of the server if orgID is empty
+func (am *AuthManager) ListIdentityProviders(hostnameOverride *string, orgID string) ([]api.Idp, error) {
+	response, err := am.loginClient(hostnameOverride).ListLoginIdps(orgID)
+	if err != nil {
+		am.setErrorMessage(err)
+		return nil, err
+	}
+	return response.Idps, nil
+}
+
+// LoginWithSSO signs in through an identity provider with the authorization
+// code flow and PKCE. openURL opens the authorization page in the system
+// browser, which is redirected to a listener on the loopback interface once
+// the user signs in; the server then exchanges the code for a session. The
+// context can be used to cancel waiting for the browser.
+func (am *AuthManager) LoginWithSSO(ctx context.Context, hostnameOverride *string, idp api.Idp, openURL func(url string) error) error {
+	loginClient := am.loginClient(hostnameOverride)
+
+	state, err := sso.NewState()
+	if err != nil {
+		return err
+	}
+	pkce, err := sso.NewPKCE()
+	if err != nil {
+		return err
+	}
+
+	listener, err := sso.Listen(state)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	urlResponse, err := loginClient.GenerateOidcURL(idp.IdpId, api.GenerateOidcURLRequest{
+		RedirectUrl:         listener.RedirectURL(),
+		State:               state,
+		CodeChallenge:       pkce.Challenge,
+		CodeChallengeMethod: pkce.Method,
+	})
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+
+	// Store the URL for UI display, so that the user can open it again
+	authURL := urlResponse.RedirectUrl
+	am.mu.Lock()
+	am.ssoLoginURL = &authURL
+	am.mu.Unlock()
+	defer func() {
+		am.mu.Lock()
+		am.ssoLoginURL = nil
+		am.mu.Unlock()
+	}()
+
+	logger.Info("Signing in with %s", idp.Name)
+	if err := openURL(authURL); err != nil {
+		logger.Warn("Failed to open browser for sign-in: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, ssoTimeout)
+	defer cancel()
+	code, err := listener.Wait(waitCtx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("the sign-in with %s was not completed in time", idp.Name)
+		}
+		if !errors.Is(err, context.Canceled) {
+			am.setErrorMessage(err)
+		}
+		return err
+	}
+
+	token, err := loginClient.ValidateOidcCallback(idp.IdpId, api.ValidateOidcCallbackRequest{
+		Code:         code,
+		State:        state,
+		CodeVerifier: pkce.Verifier,
+		RedirectUrl:  listener.RedirectURL(),
+	})
+	if err != nil {
+		am.setErrorMessage(err)
+		return err
+	}
+
+	return am.completeLogin(loginClient.CurrentBaseURL(), token)
+}
+
+// SSOLoginURL returns the authorization page of the SSO login in progress
+func (am *AuthManager) SSOLoginURL() *string {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.ssoLoginURL
+}
@@ -5,8 +5,11 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/fosrl/newt/logger"
@@ -32,6 +35,37 @@ type Account struct {
 	Username string `json:"username"`
 	Name     string `json:"name"`
 	Hostname string `json:"hostname"`
+	// Label is a name the user gave the account, shown instead of the email
+	// address
+	Label string `json:"label,omitempty"`
+}
+
+// DisplayName returns the label of the account, or its email address
+func (a Account) DisplayName() string {
+	if a.Label != "" {
+		return a.Label
+	}
+	return a.Email
+}
+
+// DisplayLabels returns the text to show for each account, by user ID. The
+// hostname is added to accounts that would otherwise look the same, such as
+// the same email address on two servers.
+func DisplayLabels(accounts []Account) map[string]string {
+	counts := map[string]int{}
+	for _, account := range accounts {
+		counts[account.DisplayName()]++
+	}
+
+	labels := make(map[string]string, len(accounts))
+	for _, account := range accounts {
+		label := account.DisplayName()
+		if counts[label] > 1 {
+			label = fmt.Sprintf("%s (%s)", label, account.Hostname)
+		}
+		labels[account.UserID] = label
+	}
+	return labels
 }
 
 func NewAccountManager() *AccountManager {
@@ -75,6 +109,11 @@ func NewAccountManager() *AccountManager {
 	return mgr
 }
 
+// Path returns the path of the accounts file
+func (m *AccountManager) Path() string {
+	return m.path
+}
+
 func (m *AccountManager) Save() error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -94,6 +133,33 @@ func (m *AccountManager) saveLocked() error {
 	return nil
 }
 
+// Account returns the account of a user
+func (m *AccountManager) Account(userID string) (Account, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.Accounts[userID]
+	return account, ok
+}
+
+// List returns the accounts sorted by display name and hostname
+func (m *AccountManager) List() []Account {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accounts := make([]Account, 0, len(m.Accounts))
+	for _, account := range m.Accounts {
+		accounts = append(accounts, account)
+	}
+	slices.SortFunc(accounts, func(a, b Account) int {
+		if c := strings.Compare(strings.ToLower(a.DisplayName()), strings.ToLower(b.DisplayName())); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Hostname, b.Hostname)
+	})
+	return accounts
+}
+
 func (m *AccountManager) AddAccount(account Account) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -149,9 +215,25 @@ func (m *AccountManager) SetUserOrganization(userID string, orgID string) error
 
 	if account, ok := m.Accounts[userID]; ok {
 		account.OrgID = orgID
+		m.Accounts[userID] = account
 	} else {
 		return errors.New("account does not exist")
 	}
 
 	return m.saveLocked()
 }
+
+// SetLabel names an account. An empty label shows the email address again.
+func (m *AccountManager) SetLabel(userID string, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.Accounts[userID]
+	if !ok {
+		return errors.New("account does not exist")
+	}
+	account.Label = strings.TrimSpace(label)
+	m.Accounts[userID] = account
+
+	return m.saveLocked()
+}
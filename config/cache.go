@@ -0,0 +1,144 @@
+//go:build windows
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/api"
+)
+
+const (
+	CacheFileName = "cache.json"
+)
+
+// CachedAccount is what the server last said about an account, so that the
+// client can start and show it without reaching the server
+type CachedAccount struct {
+	User              *api.User             `json:"user,omitempty"`
+	UserFetchedAt     time.Time             `json:"userFetchedAt"`
+	Orgs              []api.Org             `json:"orgs,omitempty"`
+	OrgsFetchedAt     time.Time             `json:"orgsFetchedAt"`
+	SelectedOrgID     string                `json:"selectedOrgId,omitempty"`
+	MyDevice          *api.MyDeviceResponse `json:"myDevice,omitempty"`
+	MyDeviceFetchedAt time.Time             `json:"myDeviceFetchedAt"`
+}
+
+// CacheManager stores a CachedAccount per user ID in the cache file
+type CacheManager struct {
+	mu sync.RWMutex
+
+	path string
+
+	Accounts map[string]CachedAccount `json:"accounts"`
+}
+
+func NewCacheManager() *CacheManager {
+	appData := os.Getenv("LOCALAPPDATA")
+	if appData == "" {
+		// Fallback to APPDATA if LOCALAPPDATA is not set
+		appData = os.Getenv("APPDATA")
+	}
+
+	pangolinDir := filepath.Join(appData, AppName)
+	cachePath := filepath.Join(pangolinDir, CacheFileName)
+
+	mgr := &CacheManager{
+		path:     cachePath,
+		Accounts: make(map[string]CachedAccount),
+	}
+
+	if err := os.MkdirAll(pangolinDir, 0o755); err != nil {
+		logger.Error("Failed to create config directory: %v", err)
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Error("failed to read cache file: %v", err)
+		}
+		return mgr
+	}
+
+	if err := json.Unmarshal(data, mgr); err != nil {
+		// The cache only saves round trips, start over with an empty one
+		logger.Error("failed to parse cache file: %v", err)
+		return mgr
+	}
+
+	if mgr.Accounts == nil {
+		mgr.Accounts = make(map[string]CachedAccount)
+	}
+	// Earlier versions cached the secret of the OLM along with the device
+	scrubbed := false
+	for userID, cached := range mgr.Accounts {
+		if cached.MyDevice != nil && cached.MyDevice.Olm != nil && cached.MyDevice.Olm.Secret != nil {
+			olm := *cached.MyDevice.Olm
+			olm.Secret = nil
+			device := *cached.MyDevice
+			device.Olm = &olm
+			cached.MyDevice = &device
+			mgr.Accounts[userID] = cached
+			scrubbed = true
+		}
+	}
+	if scrubbed {
+		if err := mgr.saveLocked(); err != nil {
+			logger.Error("Failed to remove secrets from the cache file: %v", err)
+		}
+	}
+
+	return mgr
+}
+
+// Path returns the path of the cache file
+func (m *CacheManager) Path() string {
+	return m.path
+}
+
+func (m *CacheManager) saveLocked() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(m.path, data, 0o600)
+}
+
+// Get returns the cached state of a user
+func (m *CacheManager) Get(userID string) (CachedAccount, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cached, ok := m.Accounts[userID]
+	return cached, ok
+}
+
+// Update changes the cached state of a user with fn and saves the cache
+func (m *CacheManager) Update(userID string, fn func(*CachedAccount)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cached := m.Accounts[userID]
+	fn(&cached)
+	m.Accounts[userID] = cached
+	return m.saveLocked()
+}
+
+// Remove forgets the cached state of a user
+func (m *CacheManager) Remove(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.Accounts[userID]; !ok {
+		return nil
+	}
+	delete(m.Accounts, userID)
+	return m.saveLocked()
+}
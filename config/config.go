@@ -10,17 +10,27 @@ import (
 	"unsafe"
 
 	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/killswitch"
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/routes"
+	"github.com/fosrl/windows/tlsprofile"
 	"golang.org/x/sys/windows"
 )
 
 const (
-	AppName            = "Pangolin"
-	DefaultHostname    = "https://app.pangolin.net"
-	ConfigFileName     = "pangolin.json"
-	LogLevel           = "debug" // Centralized log level for the application
-	DefaultPrimaryDNS  = "9.9.9.9"
-	DefaultDNSOverride = true
-	DefaultDNSTunnel   = false
+	AppName          = "Pangolin"
+	DefaultHostname  = "https://app.pangolin.net"
+	ConfigFileName   = "pangolin.json"
+	DefaultLogLevel  = "debug" // Log level used until one is configured
+	DefaultLogFormat = "text"
+	// Log rotation defaults
+	DefaultLogMaxSizeMB      = 10
+	DefaultLogMaxAgeDays     = 30
+	DefaultLogMaxTotalSizeMB = 200
+	DefaultLogCompress       = true
+	DefaultPrimaryDNS        = "9.9.9.9"
+	DefaultDNSOverride       = true
+	DefaultDNSTunnel         = false
 )
 
 // Config represents the application configuration
@@ -29,6 +39,43 @@ type Config struct {
 	DNSTunnel    *bool   `json:"dnsTunnel,omitempty"`
 	PrimaryDNS   *string `json:"primaryDNS,omitempty"`
 	SecondaryDNS *string `json:"secondaryDNS,omitempty"`
+	LogLevel     *string `json:"logLevel,omitempty"`
+	LogFormat    *string `json:"logFormat,omitempty"`
+	// ComponentLogLevels overrides LogLevel for individual components
+	ComponentLogLevels map[string]string `json:"componentLogLevels,omitempty"`
+	// Log rotation settings, read when the process starts; a value of 0
+	// disables the corresponding limit
+	LogMaxSizeMB      *int  `json:"logMaxSizeMB,omitempty"`
+	LogMaxAgeDays     *int  `json:"logMaxAgeDays,omitempty"`
+	LogMaxTotalSizeMB *int  `json:"logMaxTotalSizeMB,omitempty"`
+	LogCompress       *bool `json:"logCompress,omitempty"`
+	// RedactPatterns are regular expressions removed from all log output in
+	// addition to the built-in secret patterns
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+	// Notifications turns notification categories on or off; categories
+	// that are not listed are on
+	Notifications map[string]bool `json:"notifications,omitempty"`
+	// LastRunVersion is the version that last ran, to tell the user about
+	// installed updates
+	LastRunVersion *string `json:"lastRunVersion,omitempty"`
+	// PathPreferences holds the site path preferences of each organization
+	// of each account, keyed by user ID and organization ID
+	PathPreferences map[string]PathPreferences `json:"pathPreferences,omitempty"`
+	// ServerProfiles holds the TLS profiles of self-hosted servers, keyed
+	// by host as returned by tlsprofile.HostKey
+	ServerProfiles map[string]tlsprofile.Profile `json:"serverProfiles,omitempty"`
+	// Proxy is the outbound proxy, without its password
+	Proxy *proxy.Config `json:"proxy,omitempty"`
+	// Updates configure how update checks reach the update server
+	Updates *UpdateSettings `json:"updates,omitempty"`
+	// KillSwitch is the kill switch configuration, nil for the defaults
+	KillSwitch *killswitch.Settings `json:"killSwitch,omitempty"`
+	// Routes are the routes included in and excluded from the tunnel for
+	// every organization
+	Routes *routes.Settings `json:"routes,omitempty"`
+	// OrgRoutes are the routes of each organization of each account, keyed
+	// like PathPreferences
+	OrgRoutes map[string]routes.Settings `json:"orgRoutes,omitempty"`
 }
 
 // ConfigManager manages loading and saving of application configuration
@@ -62,6 +109,11 @@ func NewConfigManager() *ConfigManager {
 	return cm
 }
 
+// Path returns the path of the configuration file
+func (cm *ConfigManager) Path() string {
+	return cm.configPath
+}
+
 // GetConfig returns the current configuration
 func (cm *ConfigManager) GetConfig() *Config {
 	cm.mu.RLock()
@@ -156,13 +208,13 @@ func (cm *ConfigManager) GetDNSOverride() bool {
 
 // GetDNSTunnel returns the DNS tunnel setting from config or false if not set
 func (cm *ConfigManager) GetDNSTunnel() bool {
-    cm.mu.RLock()
-    defer cm.mu.RUnlock()
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 
-    if cm.config != nil && cm.config.DNSTunnel != nil {
-        return *cm.config.DNSTunnel
-    }
-    return DefaultDNSTunnel
+	if cm.config != nil && cm.config.DNSTunnel != nil {
+		return *cm.config.DNSTunnel
+	}
+	return DefaultDNSTunnel
 }
 
 // GetPrimaryDNS returns the primary DNS server from config or the default value
@@ -200,13 +252,13 @@ func (cm *ConfigManager) SetDNSOverride(value bool) bool {
 
 // SetDNSTunnel sets the DNS tunnel setting and saves to config
 func (cm *ConfigManager) SetDNSTunnel(value bool) bool {
-    cm.mu.Lock()
-    defer cm.mu.Unlock()
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 
-    // Get current config and copy it to preserve all fields
-    cfg := cm.getConfigCopy()
-    cfg.DNSTunnel = &value
-    return cm.save(cfg)
+	// Get current config and copy it to preserve all fields
+	cfg := cm.getConfigCopy()
+	cfg.DNSTunnel = &value
+	return cm.save(cfg)
 }
 
 // SetPrimaryDNS sets the primary DNS server and saves to config
@@ -235,6 +287,183 @@ func (cm *ConfigManager) SetSecondaryDNS(value string) bool {
 	return cm.save(cfg)
 }
 
+// SetDNSSettings sets all DNS settings at once and saves to config
+func (cm *ConfigManager) SetDNSSettings(dnsOverride, dnsTunnel bool, primaryDNS, secondaryDNS string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Get current config and copy it to preserve all fields
+	cfg := cm.getConfigCopy()
+	cfg.DNSOverride = &dnsOverride
+	cfg.DNSTunnel = &dnsTunnel
+	cfg.PrimaryDNS = &primaryDNS
+	if secondaryDNS == "" {
+		cfg.SecondaryDNS = nil // Remove if empty
+	} else {
+		cfg.SecondaryDNS = &secondaryDNS
+	}
+	return cm.save(cfg)
+}
+
+// GetLogLevel returns the configured log level or the default value
+func (cm *ConfigManager) GetLogLevel() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LogLevel != nil && *cm.config.LogLevel != "" {
+		return *cm.config.LogLevel
+	}
+	return DefaultLogLevel
+}
+
+// GetLogFormat returns the configured log format ("text" or "json") or the default value
+func (cm *ConfigManager) GetLogFormat() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LogFormat != nil && *cm.config.LogFormat != "" {
+		return *cm.config.LogFormat
+	}
+	return DefaultLogFormat
+}
+
+// GetComponentLogLevels returns a copy of the per-component log level overrides
+func (cm *ConfigManager) GetComponentLogLevels() map[string]string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	levels := make(map[string]string)
+	if cm.config != nil {
+		for component, level := range cm.config.ComponentLogLevels {
+			levels[component] = level
+		}
+	}
+	return levels
+}
+
+// SetLogSettings sets the log level, format and per-component overrides and saves to config
+func (cm *ConfigManager) SetLogSettings(level, format string, componentLevels map[string]string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Get current config and copy it to preserve all fields
+	cfg := cm.getConfigCopy()
+	cfg.LogLevel = &level
+	cfg.LogFormat = &format
+	cfg.ComponentLogLevels = nil
+	if len(componentLevels) > 0 {
+		cfg.ComponentLogLevels = make(map[string]string, len(componentLevels))
+		for component, componentLevel := range componentLevels {
+			cfg.ComponentLogLevels[component] = componentLevel
+		}
+	}
+	return cm.save(cfg)
+}
+
+// GetLogMaxSizeMB returns the size in MB at which the log file is rotated
+func (cm *ConfigManager) GetLogMaxSizeMB() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LogMaxSizeMB != nil && *cm.config.LogMaxSizeMB >= 0 {
+		return *cm.config.LogMaxSizeMB
+	}
+	return DefaultLogMaxSizeMB
+}
+
+// GetLogMaxAgeDays returns the number of days rotated log files are kept
+func (cm *ConfigManager) GetLogMaxAgeDays() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LogMaxAgeDays != nil && *cm.config.LogMaxAgeDays >= 0 {
+		return *cm.config.LogMaxAgeDays
+	}
+	return DefaultLogMaxAgeDays
+}
+
+// GetLogMaxTotalSizeMB returns the disk space in MB rotated log files may use
+func (cm *ConfigManager) GetLogMaxTotalSizeMB() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LogMaxTotalSizeMB != nil && *cm.config.LogMaxTotalSizeMB >= 0 {
+		return *cm.config.LogMaxTotalSizeMB
+	}
+	return DefaultLogMaxTotalSizeMB
+}
+
+// GetLogCompress returns whether rotated log files are compressed
+func (cm *ConfigManager) GetLogCompress() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LogCompress != nil {
+		return *cm.config.LogCompress
+	}
+	return DefaultLogCompress
+}
+
+// GetRedactPatterns returns a copy of the configured redaction patterns
+func (cm *ConfigManager) GetRedactPatterns() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil {
+		return nil
+	}
+	return append([]string(nil), cm.config.RedactPatterns...)
+}
+
+// GetNotificationEnabled returns whether notifications of category are shown
+func (cm *ConfigManager) GetNotificationEnabled(category string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil {
+		if enabled, ok := cm.config.Notifications[category]; ok {
+			return enabled
+		}
+	}
+	return true
+}
+
+// SetNotifications sets which notification categories are shown and saves to config
+func (cm *ConfigManager) SetNotifications(categories map[string]bool) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Get current config and copy it to preserve all fields
+	cfg := cm.getConfigCopy()
+	cfg.Notifications = make(map[string]bool, len(categories))
+	for category, enabled := range categories {
+		cfg.Notifications[category] = enabled
+	}
+	return cm.save(cfg)
+}
+
+// GetLastRunVersion returns the version that last ran, or "" if unknown
+func (cm *ConfigManager) GetLastRunVersion() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config != nil && cm.config.LastRunVersion != nil {
+		return *cm.config.LastRunVersion
+	}
+	return ""
+}
+
+// SetLastRunVersion records the running version and saves to config
+func (cm *ConfigManager) SetLastRunVersion(version string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Get current config and copy it to preserve all fields
+	cfg := cm.getConfigCopy()
+	cfg.LastRunVersion = &version
+	return cm.save(cfg)
+}
+
 // getConfigCopy creates a deep copy of the current config
 // Caller must hold the lock
 func (cm *ConfigManager) getConfigCopy() *Config {
@@ -249,9 +478,9 @@ func (cm *ConfigManager) getConfigCopy() *Config {
 		cfg.DNSOverride = &dnsOverride
 	}
 	if cm.config.DNSTunnel != nil {
-        dnsTunnel := *cm.config.DNSTunnel
-        cfg.DNSTunnel = &dnsTunnel
-    }
+		dnsTunnel := *cm.config.DNSTunnel
+		cfg.DNSTunnel = &dnsTunnel
+	}
 	if cm.config.PrimaryDNS != nil {
 		primaryDNS := *cm.config.PrimaryDNS
 		cfg.PrimaryDNS = &primaryDNS
@@ -260,6 +489,83 @@ func (cm *ConfigManager) getConfigCopy() *Config {
 		secondaryDNS := *cm.config.SecondaryDNS
 		cfg.SecondaryDNS = &secondaryDNS
 	}
+	if cm.config.LogLevel != nil {
+		logLevel := *cm.config.LogLevel
+		cfg.LogLevel = &logLevel
+	}
+	if cm.config.LogFormat != nil {
+		logFormat := *cm.config.LogFormat
+		cfg.LogFormat = &logFormat
+	}
+	if cm.config.ComponentLogLevels != nil {
+		cfg.ComponentLogLevels = make(map[string]string, len(cm.config.ComponentLogLevels))
+		for component, level := range cm.config.ComponentLogLevels {
+			cfg.ComponentLogLevels[component] = level
+		}
+	}
+	if cm.config.LogMaxSizeMB != nil {
+		maxSizeMB := *cm.config.LogMaxSizeMB
+		cfg.LogMaxSizeMB = &maxSizeMB
+	}
+	if cm.config.LogMaxAgeDays != nil {
+		maxAgeDays := *cm.config.LogMaxAgeDays
+		cfg.LogMaxAgeDays = &maxAgeDays
+	}
+	if cm.config.LogMaxTotalSizeMB != nil {
+		maxTotalSizeMB := *cm.config.LogMaxTotalSizeMB
+		cfg.LogMaxTotalSizeMB = &maxTotalSizeMB
+	}
+	if cm.config.LogCompress != nil {
+		compress := *cm.config.LogCompress
+		cfg.LogCompress = &compress
+	}
+	if cm.config.RedactPatterns != nil {
+		cfg.RedactPatterns = append([]string(nil), cm.config.RedactPatterns...)
+	}
+	if cm.config.Notifications != nil {
+		cfg.Notifications = make(map[string]bool, len(cm.config.Notifications))
+		for category, enabled := range cm.config.Notifications {
+			cfg.Notifications[category] = enabled
+		}
+	}
+	if cm.config.LastRunVersion != nil {
+		lastRunVersion := *cm.config.LastRunVersion
+		cfg.LastRunVersion = &lastRunVersion
+	}
+	if cm.config.PathPreferences != nil {
+		cfg.PathPreferences = make(map[string]PathPreferences, len(cm.config.PathPreferences))
+		for key, prefs := range cm.config.PathPreferences {
+			cfg.PathPreferences[key] = prefs.copy()
+		}
+	}
+	if cm.config.ServerProfiles != nil {
+		cfg.ServerProfiles = make(map[string]tlsprofile.Profile, len(cm.config.ServerProfiles))
+		for host, profile := range cm.config.ServerProfiles {
+			cfg.ServerProfiles[host] = profile.Copy()
+		}
+	}
+	if cm.config.Proxy != nil {
+		proxyConfig := cm.config.Proxy.Copy()
+		cfg.Proxy = &proxyConfig
+	}
+	if cm.config.Updates != nil {
+		updates := *cm.config.Updates
+		cfg.Updates = &updates
+	}
+	if cm.config.KillSwitch != nil {
+		killSwitch := cm.config.KillSwitch.Copy()
+		cfg.KillSwitch = &killSwitch
+	}
+	if cm.config.Routes != nil {
+		globalRoutes := cm.config.Routes.Copy()
+		cfg.Routes = &globalRoutes
+	}
+	if cm.config.OrgRoutes != nil {
+		cfg.OrgRoutes = make(map[string]routes.Settings, len(cm.config.OrgRoutes))
+		for key, settings := range cm.config.OrgRoutes {
+			cfg.OrgRoutes[key] = settings.Copy()
+		}
+	}
 	return cfg
 }
 
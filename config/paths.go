@@ -0,0 +1,141 @@
+//go:build windows
+
+package config
+
+// PathPreference selects how the tunnel reaches a site
+type PathPreference string
+
+const (
+	// PathAuto tries hole punching and falls back to the relay
+	PathAuto PathPreference = "auto"
+	// PathDirect only uses a direct, hole punched connection
+	PathDirect PathPreference = "direct"
+	// PathRelay always goes through the relay, without hole punching
+	PathRelay PathPreference = "relay"
+)
+
+// PathPreferenceOptions lists the path preferences in the order they are
+// offered to the user
+var PathPreferenceOptions = []PathPreference{PathAuto, PathDirect, PathRelay}
+
+// SitePathPreferenceOptions lists the choices offered for a single site; the
+// empty preference follows the organization default
+var SitePathPreferenceOptions = []PathPreference{"", PathAuto, PathDirect, PathRelay}
+
+// Description returns the label of the preference in the UI
+func (p PathPreference) Description() string {
+	switch p {
+	case "":
+		return "Organization default"
+	case PathDirect:
+		return "Direct only"
+	case PathRelay:
+		return "Relay only"
+	default:
+		return "Automatic"
+	}
+}
+
+// PathPreferences are the path preferences of the sites of one organization
+type PathPreferences struct {
+	// Default applies to sites without their own preference
+	Default PathPreference `json:"default,omitempty"`
+	// Sites maps site IDs to their preference. A site keeps its preference
+	// even when it matches the default, so that changing the default does
+	// not change it.
+	Sites map[int]PathPreference `json:"sites,omitempty"`
+}
+
+// DefaultPath returns the preference of sites without their own
+func (p PathPreferences) DefaultPath() PathPreference {
+	return orAuto(p.Default)
+}
+
+// For returns the preference of a site
+func (p PathPreferences) For(siteID int) PathPreference {
+	if pref := p.Sites[siteID]; pref != "" {
+		return pref
+	}
+	return p.DefaultPath()
+}
+
+// orAuto returns pref, or PathAuto if it is not set
+func orAuto(pref PathPreference) PathPreference {
+	if pref == "" {
+		return PathAuto
+	}
+	return pref
+}
+
+// Holepunch reports whether any site may be reached directly, which is the
+// only reason to punch holes
+func (p PathPreferences) Holepunch() bool {
+	if p.DefaultPath() != PathRelay {
+		return true
+	}
+	for _, pref := range p.Sites {
+		if pref != PathRelay {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns a deep copy of p
+func (p PathPreferences) copy() PathPreferences {
+	c := PathPreferences{Default: p.Default}
+	if p.Sites != nil {
+		c.Sites = make(map[int]PathPreference, len(p.Sites))
+		for siteID, pref := range p.Sites {
+			c.Sites[siteID] = pref
+		}
+	}
+	return c
+}
+
+// pathPreferencesKey returns the key of the path preferences of an
+// organization of an account
+func pathPreferencesKey(userID, orgID string) string {
+	return userID + "/" + orgID
+}
+
+// GetPathPreferences returns the path preferences of an organization of an
+// account
+func (cm *ConfigManager) GetPathPreferences(userID, orgID string) PathPreferences {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil {
+		return PathPreferences{}
+	}
+	return cm.config.PathPreferences[pathPreferencesKey(userID, orgID)].copy()
+}
+
+// SetPathPreferences sets the path preferences of an organization of an
+// account and saves to config
+func (cm *ConfigManager) SetPathPreferences(userID, orgID string, prefs PathPreferences) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if cfg.PathPreferences == nil {
+		cfg.PathPreferences = make(map[string]PathPreferences)
+	}
+	key := pathPreferencesKey(userID, orgID)
+	prefs = prefs.copy()
+	if prefs.Default == PathAuto {
+		prefs.Default = ""
+	}
+	// Sites without a preference follow the default
+	for siteID, pref := range prefs.Sites {
+		if pref == "" {
+			delete(prefs.Sites, siteID)
+		}
+	}
+	if prefs.Default == "" && len(prefs.Sites) == 0 {
+		delete(cfg.PathPreferences, key)
+	} else {
+		cfg.PathPreferences[key] = prefs
+	}
+	return cm.save(cfg)
+}
@@ -0,0 +1,138 @@
+//go:build windows
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathPreferencesFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		prefs       PathPreferences
+		wantDefault PathPreference
+		want        map[int]PathPreference
+		holepunch   bool
+	}{
+		{
+			"nothing set",
+			PathPreferences{},
+			PathAuto,
+			map[int]PathPreference{1: PathAuto},
+			true,
+		},
+		{
+			"default only",
+			PathPreferences{Default: PathRelay},
+			PathRelay,
+			map[int]PathPreference{1: PathRelay},
+			false,
+		},
+		{
+			"site overrides",
+			PathPreferences{Default: PathRelay, Sites: map[int]PathPreference{1: PathDirect, 2: PathRelay, 3: ""}},
+			PathRelay,
+			map[int]PathPreference{1: PathDirect, 2: PathRelay, 3: PathRelay, 4: PathRelay},
+			true,
+		},
+		{
+			"relayed site with a direct default",
+			PathPreferences{Default: PathDirect, Sites: map[int]PathPreference{1: PathRelay}},
+			PathDirect,
+			map[int]PathPreference{1: PathRelay, 2: PathDirect},
+			true,
+		},
+		{
+			"relay everywhere",
+			PathPreferences{Default: PathRelay, Sites: map[int]PathPreference{1: PathRelay}},
+			PathRelay,
+			map[int]PathPreference{1: PathRelay, 2: PathRelay},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.prefs.DefaultPath(); got != tt.wantDefault {
+			t.Errorf("%s: DefaultPath() = %q, want %q", tt.name, got, tt.wantDefault)
+		}
+		for siteID, want := range tt.want {
+			if got := tt.prefs.For(siteID); got != want {
+				t.Errorf("%s: For(%d) = %q, want %q", tt.name, siteID, got, want)
+			}
+		}
+		if got := tt.prefs.Holepunch(); got != tt.holepunch {
+			t.Errorf("%s: Holepunch() = %v, want %v", tt.name, got, tt.holepunch)
+		}
+	}
+}
+
+func TestSetPathPreferences(t *testing.T) {
+	tests := []struct {
+		name  string
+		prefs PathPreferences
+		want  PathPreferences
+	}{
+		{
+			"explicit overrides equal to the default are kept",
+			PathPreferences{Default: PathRelay, Sites: map[int]PathPreference{1: PathRelay, 2: PathDirect}},
+			PathPreferences{Default: PathRelay, Sites: map[int]PathPreference{1: PathRelay, 2: PathDirect}},
+		},
+		{
+			"explicit automatic override is kept",
+			PathPreferences{Sites: map[int]PathPreference{1: PathAuto}},
+			PathPreferences{Sites: map[int]PathPreference{1: PathAuto}},
+		},
+		{
+			"empty overrides follow the default",
+			PathPreferences{Default: PathDirect, Sites: map[int]PathPreference{1: "", 2: PathRelay}},
+			PathPreferences{Default: PathDirect, Sites: map[int]PathPreference{2: PathRelay}},
+		},
+		{
+			"automatic default is not stored",
+			PathPreferences{Default: PathAuto, Sites: map[int]PathPreference{1: PathRelay}},
+			PathPreferences{Sites: map[int]PathPreference{1: PathRelay}},
+		},
+		{
+			"nothing left removes the organization",
+			PathPreferences{Default: PathAuto, Sites: map[int]PathPreference{1: ""}},
+			PathPreferences{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOCALAPPDATA", t.TempDir())
+			cm := NewConfigManager()
+			if !cm.SetPathPreferences("u1", "org1", tt.prefs) {
+				t.Fatal("SetPathPreferences failed")
+			}
+
+			// Read back from disk
+			got := NewConfigManager().GetPathPreferences("u1", "org1")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetPathPreferences = %+v, want %+v", got, tt.want)
+			}
+			_, stored := cm.GetConfig().PathPreferences[pathPreferencesKey("u1", "org1")]
+			if wantStored := tt.want.Default != "" || len(tt.want.Sites) > 0; stored != wantStored {
+				t.Errorf("organization stored = %v, want %v", stored, wantStored)
+			}
+			if other := cm.GetPathPreferences("u1", "org2"); !reflect.DeepEqual(other, PathPreferences{}) {
+				t.Errorf("other organization = %+v, want none", other)
+			}
+		})
+	}
+}
+
+func TestSetPathPreferencesCopies(t *testing.T) {
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+	cm := NewConfigManager()
+	prefs := PathPreferences{Sites: map[int]PathPreference{1: PathRelay}}
+	cm.SetPathPreferences("u1", "org1", prefs)
+
+	// Changing the caller's or the returned map must not change the config
+	prefs.Sites[1] = PathDirect
+	got := cm.GetPathPreferences("u1", "org1")
+	got.Sites[2] = PathDirect
+	if again := cm.GetPathPreferences("u1", "org1"); !reflect.DeepEqual(again.Sites, map[int]PathPreference{1: PathRelay}) {
+		t.Errorf("Sites = %v, want only site 1 relayed", again.Sites)
+	}
+}
@@ -0,0 +1,169 @@
+//go:build windows
+
+package config
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/fosrl/windows/killswitch"
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/tlsprofile"
+)
+
+// GetServerProfile returns the TLS profile of a server, given by URL or
+// hostname
+func (cm *ConfigManager) GetServerProfile(server string) (tlsprofile.Profile, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil {
+		return tlsprofile.Profile{}, false
+	}
+	profile, ok := cm.config.ServerProfiles[tlsprofile.HostKey(server)]
+	if !ok {
+		return tlsprofile.Profile{}, false
+	}
+	return profile.Copy(), true
+}
+
+// SetServerProfile sets the TLS profile of a server and saves to config. A
+// profile that changes nothing removes it. Callers check the profile with
+// Validate first.
+func (cm *ConfigManager) SetServerProfile(server string, profile tlsprofile.Profile) bool {
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if cfg.ServerProfiles == nil {
+		cfg.ServerProfiles = make(map[string]tlsprofile.Profile)
+	}
+	key := tlsprofile.HostKey(server)
+	if profile.IsZero() {
+		delete(cfg.ServerProfiles, key)
+	} else {
+		cfg.ServerProfiles[key] = profile.Copy()
+	}
+	return cm.save(cfg)
+}
+
+// GetProxy returns the outbound proxy configuration, without its password
+func (cm *ConfigManager) GetProxy() proxy.Config {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil || cm.config.Proxy == nil {
+		return proxy.Config{Mode: proxy.ModeSystem}
+	}
+	return cm.config.Proxy.Copy()
+}
+
+// SetProxy sets the outbound proxy configuration and saves to config. The
+// password is not saved; it is kept by the secret manager.
+func (cm *ConfigManager) SetProxy(proxyConfig proxy.Config) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if proxyConfig.EffectiveMode() == proxy.ModeSystem {
+		cfg.Proxy = nil
+	} else {
+		proxyConfig = proxyConfig.WithoutPassword()
+		cfg.Proxy = &proxyConfig
+	}
+	return cm.save(cfg)
+}
+
+// UpdateSettings configure how update checks and downloads reach the update
+// server, on networks where the proxy settings are not enough
+type UpdateSettings struct {
+	// CABundlePath is a PEM file of roots trusted besides the system store,
+	// for networks that intercept TLS
+	CABundlePath string `json:"caBundlePath,omitempty"`
+	// PACURL is a proxy auto-config script that picks the proxy of update
+	// requests instead of the proxy settings
+	PACURL string `json:"pacUrl,omitempty"`
+}
+
+// IsZero reports whether s changes nothing from the defaults
+func (s UpdateSettings) IsZero() bool {
+	return s.CABundlePath == "" && s.PACURL == ""
+}
+
+// Validate checks that the CA bundle holds certificates and that the PAC
+// script is given by an HTTP(S) URL
+func (s UpdateSettings) Validate() error {
+	if s.CABundlePath != "" {
+		pem, err := os.ReadFile(s.CABundlePath)
+		if err != nil {
+			return fmt.Errorf("failed to read the CA bundle: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in the CA bundle %s", s.CABundlePath)
+		}
+	}
+	if s.PACURL != "" {
+		u, err := url.Parse(s.PACURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("the PAC script must be given by an http:// or https:// URL")
+		}
+	}
+	return nil
+}
+
+// GetUpdateSettings returns how update checks reach the update server
+func (cm *ConfigManager) GetUpdateSettings() UpdateSettings {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil || cm.config.Updates == nil {
+		return UpdateSettings{}
+	}
+	return *cm.config.Updates
+}
+
+// SetUpdateSettings sets how update checks reach the update server and saves
+// to config. Callers check the settings with Validate first.
+func (cm *ConfigManager) SetUpdateSettings(settings UpdateSettings) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if settings.IsZero() {
+		cfg.Updates = nil
+	} else {
+		cfg.Updates = &settings
+	}
+	return cm.save(cfg)
+}
+
+// GetKillSwitch returns the kill switch configuration
+func (cm *ConfigManager) GetKillSwitch() killswitch.Settings {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil || cm.config.KillSwitch == nil {
+		return killswitch.Settings{}
+	}
+	return cm.config.KillSwitch.Copy()
+}
+
+// SetKillSwitch sets the kill switch configuration and saves to config.
+// Callers check the settings with Validate first.
+func (cm *ConfigManager) SetKillSwitch(settings killswitch.Settings) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if !settings.Enabled && !settings.AllowLAN && len(settings.AllowedEndpoints) == 0 {
+		cfg.KillSwitch = nil
+	} else {
+		settings = settings.Copy()
+		cfg.KillSwitch = &settings
+	}
+	return cm.save(cfg)
+}
@@ -0,0 +1,66 @@
+//go:build windows
+
+package config
+
+import (
+	"github.com/fosrl/windows/routes"
+)
+
+// GetRoutes returns the routes included in and excluded from the tunnel for
+// every organization
+func (cm *ConfigManager) GetRoutes() routes.Settings {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil || cm.config.Routes == nil {
+		return routes.Settings{}
+	}
+	return cm.config.Routes.Copy()
+}
+
+// SetRoutes sets the routes of every organization and saves to config.
+// Callers check the settings with Validate first.
+func (cm *ConfigManager) SetRoutes(settings routes.Settings) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if settings.IsZero() {
+		cfg.Routes = nil
+	} else {
+		settings = settings.Copy()
+		cfg.Routes = &settings
+	}
+	return cm.save(cfg)
+}
+
+// GetOrgRoutes returns the routes of an organization of an account, which
+// add to those of every organization
+func (cm *ConfigManager) GetOrgRoutes(userID, orgID string) routes.Settings {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if cm.config == nil {
+		return routes.Settings{}
+	}
+	return cm.config.OrgRoutes[pathPreferencesKey(userID, orgID)].Copy()
+}
+
+// SetOrgRoutes sets the routes of an organization of an account and saves to
+// config. Callers check the settings with Validate first.
+func (cm *ConfigManager) SetOrgRoutes(userID, orgID string, settings routes.Settings) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cfg := cm.getConfigCopy()
+	if cfg.OrgRoutes == nil {
+		cfg.OrgRoutes = make(map[string]routes.Settings)
+	}
+	key := pathPreferencesKey(userID, orgID)
+	if settings.IsZero() {
+		delete(cfg.OrgRoutes, key)
+	} else {
+		cfg.OrgRoutes[key] = settings.Copy()
+	}
+	return cm.save(cfg)
+}
@@ -0,0 +1,278 @@
+//go:build windows
+
+// Package diagnostics builds the zip bundle users send to support when the
+// client does not work. Everything in the bundle is redacted.
+package diagnostics
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/tunnel"
+	"github.com/fosrl/windows/version"
+	"golang.org/x/sys/windows"
+)
+
+// ManifestFileName is the name of the manifest inside the bundle
+const ManifestFileName = "manifest.json"
+
+// ManagerReport holds what only the manager service can collect. It is sent
+// to the UI over IPC.
+type ManagerReport struct {
+	Version      string
+	UpdateState  string
+	StateHistory []tunnel.StateTransition
+	Services     []ServiceStatus
+	// Config is the redacted config of the services
+	Config []byte
+}
+
+// Sources are the inputs of a bundle. Missing sources are recorded in the
+// manifest instead of failing the bundle.
+type Sources struct {
+	LogDir       string
+	ConfigPath   string
+	AccountsPath string
+	OLMStatus    *tunnel.OLMStatusResponse
+	OLMError     error
+	StateHistory []tunnel.StateTransition
+	Manager      *ManagerReport
+	ManagerError error
+}
+
+// Manifest describes the contents of a bundle
+type Manifest struct {
+	CreatedAt time.Time       `json:"createdAt"`
+	Version   string          `json:"version"`
+	UserAgent string          `json:"userAgent"`
+	Files     []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes one file in the bundle. If the file could not be
+// collected, Error says why and the file is absent.
+type ManifestEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Size        int64  `json:"size,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type bundleWriter struct {
+	zw       *zip.Writer
+	manifest Manifest
+}
+
+// add writes one file produced by write to the bundle
+func (b *bundleWriter) add(name, description string, write func(w io.Writer) error) {
+	entry := ManifestEntry{Name: name, Description: description}
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		entry.Error = err.Error()
+		b.manifest.Files = append(b.manifest.Files, entry)
+		return
+	}
+	w, err := b.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: b.manifest.CreatedAt,
+	})
+	if err == nil {
+		_, err = w.Write(buf.Bytes())
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	entry.Size = int64(buf.Len())
+	b.manifest.Files = append(b.manifest.Files, entry)
+}
+
+func (b *bundleWriter) addJSON(name, description string, v any, sourceErr error) {
+	b.add(name, description, func(w io.Writer) error {
+		if sourceErr != nil {
+			return sourceErr
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, logging.Redact(string(data)))
+		return err
+	})
+}
+
+// Write writes a bundle built from src to w
+func Write(w io.Writer, src Sources) (*Manifest, error) {
+	b := &bundleWriter{
+		zw: zip.NewWriter(w),
+		manifest: Manifest{
+			CreatedAt: time.Now(),
+			Version:   version.Number,
+			UserAgent: version.UserAgent(),
+		},
+	}
+
+	b.addJSON("environment.json", "Client version and operating system", environment(), nil)
+
+	b.addLogs(src.LogDir)
+
+	b.add("config/pangolin.json", "User preferences, redacted", func(w io.Writer) error {
+		return redactJSONFile(w, src.ConfigPath)
+	})
+	b.add("config/accounts.json", "Signed in accounts, redacted", func(w io.Writer) error {
+		return redactJSONFile(w, src.AccountsPath)
+	})
+
+	b.addJSON("olm-status.json", "Last status reported by the tunnel", src.OLMStatus, src.OLMError)
+	b.addJSON("tunnel-state-history.json", "Tunnel state changes seen by the tray", src.StateHistory, nil)
+
+	if src.Manager != nil {
+		b.addJSON("manager/report.json", "Manager service version, update state and tunnel state changes", struct {
+			Version      string                   `json:"version"`
+			UpdateState  string                   `json:"updateState"`
+			StateHistory []tunnel.StateTransition `json:"stateHistory"`
+		}{src.Manager.Version, src.Manager.UpdateState, src.Manager.StateHistory}, nil)
+		b.addJSON("manager/services.json", "Status of the Pangolin Windows services", src.Manager.Services, nil)
+		b.add("manager/pangolin.json", "Service preferences, redacted", func(w io.Writer) error {
+			if src.Manager.Config == nil {
+				return fmt.Errorf("no service config")
+			}
+			_, err := w.Write(src.Manager.Config)
+			return err
+		})
+	} else {
+		managerErr := src.ManagerError
+		if managerErr == nil {
+			managerErr = fmt.Errorf("manager service not queried")
+		}
+		b.addJSON("manager/report.json", "Manager service version, update state and tunnel state changes", nil, managerErr)
+		services, err := QueryServices()
+		b.addJSON("manager/services.json", "Status of the Pangolin Windows services", services, err)
+	}
+
+	for _, command := range networkCommands {
+		b.add(command.name, command.description, command.run)
+	}
+
+	manifest := b.manifest
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	mw, err := b.zw.Create(ManifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := b.zw.Close(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// WriteFile writes a bundle built from src to path
+func WriteFile(path string, src Sources) (*Manifest, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := Write(file, src)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// DefaultFileName returns the suggested name for a bundle created now
+func DefaultFileName() string {
+	return fmt.Sprintf("pangolin-diagnostics-%s.zip", time.Now().Format("2006-01-02T150405"))
+}
+
+func environment() map[string]string {
+	osVersion := windows.RtlGetVersion()
+	return map[string]string{
+		"version":   version.Number,
+		"userAgent": version.UserAgent(),
+		"os":        fmt.Sprintf("Windows %d.%d.%d", osVersion.MajorVersion, osVersion.MinorVersion, osVersion.BuildNumber),
+		"arch":      runtime.GOARCH,
+		"goVersion": runtime.Version(),
+	}
+}
+
+// addLogs adds the current and rotated log files, decompressed and redacted
+func (b *bundleWriter) addLogs(logDir string) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		b.add("logs/", "Log files", func(io.Writer) error { return err })
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && (strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(logDir, name)
+		b.add("logs/"+strings.TrimSuffix(name, ".gz"), "Log file, redacted", func(w io.Writer) error {
+			return redactLogFile(w, path)
+		})
+	}
+}
+
+func redactLogFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if _, err := io.WriteString(w, logging.Redact(scanner.Text())+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func redactJSONFile(w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	redacted, err := RedactJSON(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(redacted)
+	return err
+}
@@ -0,0 +1,175 @@
+//go:build windows
+
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	olmSecret     = "olm-secret-4f9c2b7e1a8d"
+	sessionToken  = "p_session_token_d41d8cd98f00b204e980"
+	proxyPassword = "hunter2-but-longer"
+	email         = "alice@example.com"
+)
+
+func writeFixture(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtures writes logs and config files holding every secret to dir
+func fixtures(t *testing.T, dir string) Sources {
+	t.Helper()
+	logDir := filepath.Join(dir, "logs")
+	writeFixture(t, filepath.Join(logDir, "pangolin.log"), strings.Join([]string{
+		`INFO: 2026/03/14 09:26:53 [tunnel] Starting OLM with config {"id":"olm-1","secret":"` + olmSecret + `","endpoint":"https://pangolin.example.com"}`,
+		`DEBUG: 2026/03/14 09:26:54 [api] GET /api/v1/user with Cookie: p_session_token=` + sessionToken,
+		`DEBUG: 2026/03/14 09:26:55 [tunnel] olm config {ID:olm-1 Secret:` + olmSecret + ` Endpoint:https://pangolin.example.com}`,
+		`INFO: 2026/03/14 09:26:56 [api] Using proxy http://alice:` + proxyPassword + `@proxy.example.com:3128`,
+	}, "\n"))
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	io.WriteString(zw, `DEBUG: 2026/03/13 18:00:00 [auth] response {"token":"`+sessionToken+`","userId":"u1"}`+"\n")
+	zw.Close()
+	writeFixture(t, filepath.Join(logDir, "pangolin-2026-03-13T18-00-00.log.gz"), gz.String())
+
+	configPath := filepath.Join(dir, "pangolin.json")
+	writeFixture(t, configPath, `{
+  "logLevel": "info",
+  "proxy": {"mode": "http", "address": "proxy.example.com:3128", "username": "alice", "password": "`+proxyPassword+`"},
+  "olm": {"id": "olm-1", "secret": "`+olmSecret+`"}
+}`)
+
+	accountsPath := filepath.Join(dir, "accounts.json")
+	writeFixture(t, accountsPath, `{
+  "activeUserId": "u1",
+  "accounts": {
+    "u1": {
+      "userId": "u1",
+      "email": "`+email+`",
+      "username": "`+email+`",
+      "orgId": "org-1",
+      "hostname": "https://pangolin.example.com",
+      "sessionToken": "`+sessionToken+`"
+    }
+  }
+}`)
+
+	// The manager redacts its config before sending it over IPC
+	managerConfig, err := RedactJSON([]byte(`{"proxy": {"password": "` + proxyPassword + `"}, "updateCABundle": "ca.pem"}`))
+	if err != nil {
+		t.Fatalf("RedactJSON: %v", err)
+	}
+
+	return Sources{
+		LogDir:       logDir,
+		ConfigPath:   configPath,
+		AccountsPath: accountsPath,
+		OLMError:     errors.New("olm not running"),
+		Manager: &ManagerReport{
+			Version:     "1.2.3",
+			UpdateState: "idle",
+			Services:    []ServiceStatus{{Name: "PangolinManager", State: "running"}},
+			Config:      managerConfig,
+		},
+	}
+}
+
+func TestBundleIsRedacted(t *testing.T) {
+	commands := networkCommands
+	networkCommands = nil
+	t.Cleanup(func() { networkCommands = commands })
+
+	var buf bytes.Buffer
+	manifest, err := Write(&buf, fixtures(t, t.TempDir()))
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		contents[f.Name] = string(data)
+	}
+
+	for _, name := range []string{
+		"logs/pangolin.log",
+		"logs/pangolin-2026-03-13T18-00-00.log",
+		"config/pangolin.json",
+		"config/accounts.json",
+		"manager/pangolin.json",
+		ManifestFileName,
+	} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("bundle has no %s; manifest: %+v", name, manifest.Files)
+		}
+	}
+	for name, content := range contents {
+		for _, secret := range []string{olmSecret, sessionToken, proxyPassword, email} {
+			if strings.Contains(content, secret) {
+				t.Errorf("%s contains %q:\n%s", name, secret, content)
+			}
+		}
+	}
+
+	// Redaction keeps what support needs
+	var accounts struct {
+		Accounts map[string]map[string]string `json:"accounts"`
+	}
+	if err := json.Unmarshal([]byte(contents["config/accounts.json"]), &accounts); err != nil {
+		t.Fatalf("accounts.json: %v", err)
+	}
+	account := accounts.Accounts["u1"]
+	if account["email"] != "a***@example.com" || account["hostname"] != "https://pangolin.example.com" {
+		t.Errorf("account = %v, want masked email and hostname kept", account)
+	}
+	if !strings.Contains(contents["logs/pangolin.log"], "proxy.example.com:3128") {
+		t.Errorf("log lost the proxy host:\n%s", contents["logs/pangolin.log"])
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"email", "alice@example.com", "a***@example.com"},
+		{"username", "bob@corp.example.org", "b***@corp.example.org"},
+		{"email", "not-an-email", "not-an-email"},
+		{"email", "@example.com", "@example.com"},
+		{"hostname", "https://pangolin.example.com", "https://pangolin.example.com"},
+		{"username", "alice", "alice"},
+	}
+	for _, tt := range tests {
+		if got := redactValue(tt.key, tt.value); got != tt.want {
+			t.Errorf("redactValue(%q, %q) = %v, want %q", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+//go:build windows
+
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/logging"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// commandTimeout bounds each network snapshot command
+const commandTimeout = 15 * time.Second
+
+// ServiceStatus is the state of a Pangolin Windows service
+type ServiceStatus struct {
+	Name          string `json:"name"`
+	State         string `json:"state"`
+	ProcessID     uint32 `json:"processId,omitempty"`
+	Win32ExitCode uint32 `json:"win32ExitCode,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+var sensitiveKeyPattern = regexp.MustCompile(`(?i)secret|token|password|passwd|cookie|authorization|api_?key|session`)
+
+// emailPattern matches values that are email addresses, such as user names
+// of accounts that sign in with their email
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// RedactJSON replaces the values of sensitive keys in a JSON document and
+// masks email addresses, then applies the log redaction rules.
+func RedactJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v = redactValue("", v)
+	redacted, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []byte(logging.Redact(string(redacted))), nil
+}
+
+func redactValue(key string, v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, item := range value {
+			value[k] = redactValue(k, item)
+		}
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = redactValue(key, item)
+		}
+		return value
+	case string:
+		if sensitiveKeyPattern.MatchString(key) && value != "" {
+			return logging.Redacted
+		}
+		if strings.EqualFold(key, "email") || emailPattern.MatchString(value) {
+			return maskEmail(value)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// maskEmail keeps the first character of the local part and the domain, which
+// is enough for support to tell accounts apart
+func maskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return email
+	}
+	return local[:1] + "***@" + domain
+}
+
+// QueryServices returns the status of the manager service and any tunnel
+// services. Querying works without elevation.
+func QueryServices() ([]ServiceStatus, error) {
+	// mgr.Connect and Mgr.OpenService ask for full access, which requires
+	// elevation; querying only needs these rights.
+	handle, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT|windows.SC_MANAGER_ENUMERATE_SERVICE)
+	if err != nil {
+		return nil, err
+	}
+	m := &mgr.Mgr{Handle: handle}
+	defer m.Disconnect()
+	names, err := m.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []ServiceStatus
+	for _, name := range names {
+		if name != config.AppName+"Manager" && !strings.HasPrefix(name, config.AppName+"Tunnel$") {
+			continue
+		}
+		status := ServiceStatus{Name: name}
+		name16, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			continue
+		}
+		serviceHandle, err := windows.OpenService(handle, name16, windows.SERVICE_QUERY_STATUS)
+		if err != nil {
+			status.Error = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+		service := &mgr.Service{Name: name, Handle: serviceHandle}
+		query, err := service.Query()
+		service.Close()
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.State = serviceStateName(query.State)
+			status.ProcessID = query.ProcessId
+			status.Win32ExitCode = query.Win32ExitCode
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func serviceStateName(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "stopped"
+	case svc.StartPending:
+		return "start-pending"
+	case svc.StopPending:
+		return "stop-pending"
+	case svc.Running:
+		return "running"
+	case svc.ContinuePending:
+		return "continue-pending"
+	case svc.PausePending:
+		return "pause-pending"
+	case svc.Paused:
+		return "paused"
+	default:
+		return fmt.Sprintf("unknown (%d)", state)
+	}
+}
+
+type networkCommand struct {
+	name        string
+	description string
+	args        []string
+}
+
+func (c networkCommand) run(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: windows.CREATE_NO_WINDOW}
+	output, err := cmd.CombinedOutput()
+	if err != nil && len(output) == 0 {
+		return fmt.Errorf("%s: %w", strings.Join(c.args, " "), err)
+	}
+	_, err = io.WriteString(w, logging.Redact(string(output)))
+	return err
+}
+
+// networkCommands snapshot the interfaces, routes and DNS configuration
+var networkCommands = []networkCommand{
+	{"network/ipconfig.txt", "Network interfaces and addresses", []string{"ipconfig", "/all"}},
+	{"network/routes.txt", "Routing table", []string{"route", "print"}},
+	{"network/dns.txt", "DNS servers per interface", []string{"netsh", "interface", "ip", "show", "dnsservers"}},
+	{"network/nrpt.txt", "DNS name resolution policy", []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "Get-DnsClientNrptPolicy | Format-List"}},
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package doctor
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ifTypePropVirtual is IF_TYPE_PROP_VIRTUAL, used by TAP and other software
+// adapters
+const ifTypePropVirtual = 53
+
+// systemAdapters lists the network adapters of this computer with their DNS
+// servers
+func systemAdapters() ([]Adapter, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC,
+			windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST,
+			0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, err
+		}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	var adapters []Adapter
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		adapter := Adapter{
+			Name:        windows.UTF16PtrToString(aa.FriendlyName),
+			Description: windows.UTF16PtrToString(aa.Description),
+			Up:          aa.OperStatus == windows.IfOperStatusUp,
+			Virtual:     aa.IfType == windows.IF_TYPE_TUNNEL || aa.IfType == ifTypePropVirtual,
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			if ip := dns.Address.IP(); ip != nil {
+				adapter.DNSServers = append(adapter.DNSServers, ip.String())
+			}
+		}
+		adapters = append(adapters, adapter)
+	}
+	return adapters, nil
+}
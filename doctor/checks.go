@@ -0,0 +1,599 @@
+//go:build windows
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fosrl/newt/bind"
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/config"
+)
+
+const (
+	// DefaultHolepunchPort is the UDP port Pangolin servers use for hole
+	// punching and relaying
+	DefaultHolepunchPort = 21820
+
+	// certExpiryWarning is how long before the server certificate expires
+	// the TLS check starts to warn
+	certExpiryWarning = 7 * 24 * time.Hour
+	// clockSkewWarn and clockSkewFail bound the difference between the local
+	// clock and the server's. Sessions, certificates and two-factor codes are
+	// all time based.
+	clockSkewWarn = time.Minute
+	clockSkewFail = 5 * time.Minute
+
+	holepunchAttempts = 3
+	holepunchTimeout  = 2 * time.Second
+)
+
+const (
+	checkResolve     = "resolve"
+	checkTLS         = "tls"
+	checkClock       = "clock"
+	checkServer      = "server"
+	checkSession     = "session"
+	checkOrgAccess   = "org-access"
+	checkOlm         = "olm"
+	checkHolepunch   = "holepunch"
+	checkDNSOverride = "dns-override"
+)
+
+const (
+	clockRemediation = `Turn on "Set time automatically" in Windows Settings > Time & language > Date & time, then click "Sync now".`
+	loginRemediation = "Log out and log in again from the tray menu."
+)
+
+// ResolveCheck resolves the host name of the server
+type ResolveCheck struct{}
+
+func (ResolveCheck) ID() string   { return checkResolve }
+func (ResolveCheck) Name() string { return "Server address" }
+
+func (ResolveCheck) Run(ctx context.Context, env *Env) Result {
+	u, err := env.ServerURL()
+	if err != nil {
+		return fail("Log in again and check the server address.", "Invalid server address: %v", err)
+	}
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return pass("%s is an IP address", host)
+	}
+	addrs, err := env.Resolver.LookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		if err == nil {
+			err = errors.New("no addresses")
+		}
+		return fail("Check that the server address is spelled correctly and that this computer is connected to the internet. "+
+			"If you use another VPN or a proxy, try disconnecting it.",
+			"Could not resolve %s: %v", host, err)
+	}
+	return pass("%s resolves to %s", host, strings.Join(addrs, ", "))
+}
+
+// TLSCheck performs a TLS handshake with the server and verifies its
+// certificate
+type TLSCheck struct{}
+
+func (TLSCheck) ID() string         { return checkTLS }
+func (TLSCheck) Name() string       { return "Secure connection" }
+func (TLSCheck) Requires() []string { return []string{checkResolve} }
+
+func (TLSCheck) Run(ctx context.Context, env *Env) Result {
+	u, err := env.ServerURL()
+	if err != nil {
+		return skip("No valid server address")
+	}
+	host := u.Hostname()
+	if u.Scheme != "https" {
+		return warn("Use an https:// server address if your server supports it.",
+			"%s does not use TLS, so traffic to the server is not encrypted", host)
+	}
+
+	address := hostPort(u)
+	conn, err := env.Dial(ctx, "tcp", address)
+	if err != nil {
+		return fail("Check that a firewall or proxy is not blocking outgoing connections to "+address+".",
+			"Could not connect to %s: %v", address, err)
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, env.tlsConfig(host))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return tlsFailure(env, host, err)
+	}
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return fail("", "The server did not send a certificate")
+	}
+	leaf := state.PeerCertificates[0]
+	if remaining := leaf.NotAfter.Sub(env.Now()); remaining < certExpiryWarning {
+		return warn("Ask your Pangolin administrator to renew the server certificate.",
+			"The server certificate expires on %s", leaf.NotAfter.Format(time.DateOnly))
+	}
+	return pass("%s, certificate valid until %s", tls.VersionName(state.Version), leaf.NotAfter.Format(time.DateOnly))
+}
+
+func tlsFailure(env *Env, host string, err error) Result {
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired && invalid.Cert != nil {
+		now := env.Now()
+		if now.Before(invalid.Cert.NotBefore) {
+			return fail(clockRemediation,
+				"The server certificate is valid from %s, but this computer's clock says it is %s",
+				invalid.Cert.NotBefore.Format(time.DateOnly), now.Format(time.DateOnly))
+		}
+		return fail("If the date on this computer is correct, ask your Pangolin administrator to renew the server certificate. "+
+			"Otherwise: "+clockRemediation,
+			"The server certificate expired on %s, and this computer's clock says it is %s",
+			invalid.Cert.NotAfter.Format(time.DateOnly), now.Format(time.DateOnly))
+	}
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		return fail("If your network inspects HTTPS traffic, for example through a corporate proxy or security software, "+
+			"it must trust the server or install its root certificate on this computer. "+
+			"Self-hosted servers need a certificate from a trusted authority.",
+			"The certificate of %s is not trusted", host)
+	}
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return fail("Check the server address. If it is correct, ask your Pangolin administrator to fix the server certificate.",
+			"The server certificate is not valid for %s", host)
+	}
+	return fail("Check that a firewall or proxy is not interfering with HTTPS connections.",
+		"TLS handshake with %s failed: %v", host, err)
+}
+
+// ClockCheck compares the local clock to the Date header of the server
+type ClockCheck struct{}
+
+func (ClockCheck) ID() string         { return checkClock }
+func (ClockCheck) Name() string       { return "Clock" }
+func (ClockCheck) Requires() []string { return []string{checkResolve} }
+
+func (ClockCheck) Run(ctx context.Context, env *Env) Result {
+	u, err := env.ServerURL()
+	if err != nil {
+		return skip("No valid server address")
+	}
+
+	tlsConfig := env.tlsConfig(u.Hostname())
+	// Only the Date header is read and nothing is sent, so the certificate is
+	// not verified here: a wrong clock is a common reason for it to fail,
+	// which is exactly what this check is for.
+	tlsConfig.InsecureSkipVerify = true
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:     env.Dial,
+			TLSClientConfig: tlsConfig,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return skip("No valid server address")
+	}
+	start := env.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return skip("Could not reach the server: %v", err)
+	}
+	resp.Body.Close()
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return skip("The server did not report its time")
+	}
+
+	// The header is truncated to seconds and was sent somewhere during the
+	// request, so compare it to the middle of the request.
+	now := env.Now()
+	local := start.Add(now.Sub(start) / 2)
+	skew := local.Sub(serverTime).Round(time.Second)
+	direction := "ahead of"
+	if skew < 0 {
+		skew = -skew
+		direction = "behind"
+	}
+	switch {
+	case skew >= clockSkewFail:
+		return fail(clockRemediation, "This computer's clock is %s %s the server's", skew, direction)
+	case skew >= clockSkewWarn:
+		return warn(clockRemediation, "This computer's clock is %s %s the server's", skew, direction)
+	default:
+		return pass("This computer's clock matches the server's")
+	}
+}
+
+// ServerCheck checks that the Pangolin API answers
+type ServerCheck struct{}
+
+func (ServerCheck) ID() string         { return checkServer }
+func (ServerCheck) Name() string       { return "Pangolin server" }
+func (ServerCheck) Requires() []string { return []string{checkResolve} }
+
+func (ServerCheck) Run(ctx context.Context, env *Env) Result {
+	if env.API == nil {
+		return skip("Not logged in")
+	}
+	ok, err := env.API.TestConnection()
+	if err != nil {
+		return fail("Log in again and check the server address.", "Could not contact the server: %v", err)
+	}
+	if !ok {
+		return fail("Check that the server address is correct and that the server is running. "+
+			"If it is, a firewall or proxy may be blocking the connection.",
+			"The server at %s did not respond", env.Hostname)
+	}
+	return pass("The server at %s responded", env.Hostname)
+}
+
+// SessionCheck checks that the stored session is still accepted
+type SessionCheck struct{}
+
+func (SessionCheck) ID() string         { return checkSession }
+func (SessionCheck) Name() string       { return "Session" }
+func (SessionCheck) Requires() []string { return []string{checkServer} }
+
+func (SessionCheck) Run(ctx context.Context, env *Env) Result {
+	if env.API == nil || env.UserID == "" {
+		return fail("Log in from the tray menu.", "You are not logged in")
+	}
+	user, err := env.API.GetUser()
+	if err != nil {
+		if isHTTPStatus(err, 401, 403) {
+			return fail(loginRemediation, "Your session has expired or was revoked")
+		}
+		return fail("Try again later. If the problem persists, log out and log in again from the tray menu.",
+			"Could not check your session: %v", err)
+	}
+	name := user.Email
+	if name == "" && user.Username != nil {
+		name = *user.Username
+	}
+	if name == "" {
+		return pass("Your session is valid")
+	}
+	return pass("Logged in as %s", name)
+}
+
+// OrgAccessCheck checks access to the selected organization and reports its
+// policies
+type OrgAccessCheck struct{}
+
+func (OrgAccessCheck) ID() string         { return checkOrgAccess }
+func (OrgAccessCheck) Name() string       { return "Organization access" }
+func (OrgAccessCheck) Requires() []string { return []string{checkSession} }
+
+func (OrgAccessCheck) Run(ctx context.Context, env *Env) Result {
+	if env.OrgID == "" {
+		return fail("Select an organization from the Organizations menu.", "No organization is selected")
+	}
+	resp, err := env.API.CheckOrgUserAccess(env.OrgID, env.UserID)
+	if err != nil {
+		if isHTTPStatus(err, 401, 403, 404) {
+			return fail("Ask your Pangolin administrator to add you to the organization, or select another one.",
+				"You do not have access to organization %s", env.OrgID)
+		}
+		return fail("Try again later.", "Could not check access to organization %s: %v", env.OrgID, err)
+	}
+
+	details, remediations := policyDetails(resp.Policies)
+	if !resp.Allowed {
+		message := fmt.Sprintf("Access to organization %s is denied by its policies", env.OrgID)
+		if resp.Error != nil && *resp.Error != "" {
+			message = fmt.Sprintf("Access to organization %s is denied: %s", env.OrgID, *resp.Error)
+		}
+		if len(details) > 0 {
+			message += " (" + strings.Join(details, "; ") + ")"
+		}
+		remediations = append(remediations, fmt.Sprintf("See %s/%s for details.", env.Hostname, env.OrgID))
+		return fail(strings.Join(remediations, " "), "%s", message)
+	}
+	if len(details) > 0 {
+		return pass("You have access to organization %s (%s)", env.OrgID, strings.Join(details, "; "))
+	}
+	return pass("You have access to organization %s", env.OrgID)
+}
+
+// policyDetails describes the organization policies and what to do about
+// the ones that are not met
+func policyDetails(policies *api.OrgPolicies) (details, remediations []string) {
+	if policies == nil {
+		return nil, nil
+	}
+	if policies.RequiredTwoFactor != nil && *policies.RequiredTwoFactor {
+		details = append(details, "two-factor authentication is required")
+	}
+	if p := policies.MaxSessionLength; p != nil {
+		if p.Compliant {
+			details = append(details, fmt.Sprintf("sessions are limited to %d hours", p.MaxSessionLengthHours))
+		} else {
+			details = append(details, fmt.Sprintf("your session is %d hours old, over the %d hour limit",
+				p.SessionAgeHours, p.MaxSessionLengthHours))
+			remediations = append(remediations, loginRemediation)
+		}
+	}
+	if p := policies.PasswordAge; p != nil {
+		if p.Compliant {
+			details = append(details, fmt.Sprintf("passwords expire after %d days", p.MaxPasswordAgeDays))
+		} else {
+			details = append(details, fmt.Sprintf("your password is %d days old, over the %d day limit",
+				p.PasswordAgeDays, p.MaxPasswordAgeDays))
+			remediations = append(remediations, "Change your password in the Pangolin dashboard.")
+		}
+	}
+	return details, remediations
+}
+
+// OlmCheck checks that the tunnel credentials of this device still exist on
+// the server
+type OlmCheck struct{}
+
+func (OlmCheck) ID() string         { return checkOlm }
+func (OlmCheck) Name() string       { return "Device credentials" }
+func (OlmCheck) Requires() []string { return []string{checkSession} }
+
+func (OlmCheck) Run(ctx context.Context, env *Env) Result {
+	if env.OlmID == "" || !env.HasOlmSecret {
+		return pass("This device is not registered yet; it is registered when you connect")
+	}
+	olm, err := env.API.GetUserOlm(env.UserID, env.OlmID)
+	if err != nil {
+		if isHTTPStatus(err, 404) {
+			return fail("Connect again to register this device with new credentials.",
+				"The credentials of this device no longer exist on the server")
+		}
+		return fail("Try again later.", "Could not check the credentials of this device: %v", err)
+	}
+	if olm == nil || olm.OlmId != env.OlmID {
+		return fail("Connect again to register this device with new credentials.",
+			"The server returned credentials for a different device")
+	}
+	return pass("This device is registered with the server")
+}
+
+// HolepunchCheck sends a test packet to the hole punching port of the server
+// and waits for its reply
+type HolepunchCheck struct{}
+
+func (HolepunchCheck) ID() string         { return checkHolepunch }
+func (HolepunchCheck) Name() string       { return "UDP connectivity" }
+func (HolepunchCheck) Requires() []string { return []string{checkResolve} }
+
+func (HolepunchCheck) Run(ctx context.Context, env *Env) Result {
+	u, err := env.ServerURL()
+	if err != nil {
+		return skip("No valid server address")
+	}
+	port := env.HolepunchPort
+	if port == 0 {
+		port = DefaultHolepunchPort
+	}
+	host := u.Hostname()
+	if net.ParseIP(host) == nil {
+		addrs, err := env.Resolver.LookupHost(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return skip("Could not resolve %s", host)
+		}
+		host = addrs[0]
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	conn, err := env.Dial(ctx, "udp", address)
+	if err != nil {
+		return fail("Check that a firewall is not blocking outgoing UDP traffic.",
+			"Could not open a UDP socket to %s: %v", address, err)
+	}
+	defer conn.Close()
+
+	relayRemediation := fmt.Sprintf("Connections to sites fall back to relaying through the server, which is slower. "+
+		"For direct connections, allow outgoing UDP traffic to port %d in your firewall or ask your network administrator.", port)
+
+	request := make([]byte, bind.MagicTestRequestLen)
+	copy(request, bind.MagicTestRequest)
+	echo := request[len(bind.MagicTestRequest):]
+	response := make([]byte, bind.MagicTestResponseLen)
+	var lastErr error
+	for attempt := 0; attempt < holepunchAttempts; attempt++ {
+		if _, err := rand.Read(echo); err != nil {
+			return fail("", "Could not create a test packet: %v", err)
+		}
+		start := time.Now()
+		if _, err := conn.Write(request); err != nil {
+			return fail("Check that a firewall is not blocking outgoing UDP traffic.",
+				"Could not send a UDP packet to %s: %v", address, err)
+		}
+		deadline := start.Add(holepunchTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(response)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if n == bind.MagicTestResponseLen &&
+				bytes.HasPrefix(response, bind.MagicTestResponse) &&
+				bytes.Equal(response[len(bind.MagicTestResponse):], echo) {
+				return pass("The server answered on UDP port %d in %s", port, time.Since(start).Round(time.Millisecond))
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(lastErr, &netErr) && netErr.Timeout() {
+		return warn(relayRemediation, "No reply from %s on UDP port %d", host, port)
+	}
+	return warn(relayRemediation, "UDP port %d on %s is not reachable: %v", port, host, lastErr)
+}
+
+// DNSOverrideCheck looks for problems with the DNS settings used while
+// connected: upstream servers that do not answer and other VPN adapters
+// that set their own DNS servers
+type DNSOverrideCheck struct{}
+
+func (DNSOverrideCheck) ID() string   { return checkDNSOverride }
+func (DNSOverrideCheck) Name() string { return "DNS settings" }
+
+func (DNSOverrideCheck) Run(ctx context.Context, env *Env) Result {
+	if !env.DNSOverride {
+		return skip("DNS override is turned off")
+	}
+
+	// Any name works to see whether a server answers; prefer one that is
+	// needed anyway.
+	probe := "pangolin.net"
+	if u, err := url.Parse(config.DefaultHostname); err == nil && u.Hostname() != "" {
+		probe = u.Hostname()
+	}
+	if u, err := env.ServerURL(); err == nil && net.ParseIP(u.Hostname()) == nil {
+		probe = u.Hostname()
+	}
+
+	status := StatusPass
+	var problems, remediations []string
+	upstreams := []struct {
+		label    string
+		server   string
+		severity Status
+	}{
+		{"primary", env.PrimaryDNS, StatusFail},
+		{"secondary", env.SecondaryDNS, StatusWarn},
+	}
+	for _, upstream := range upstreams {
+		if upstream.server == "" {
+			continue
+		}
+		problem := ""
+		if net.ParseIP(upstream.server) == nil {
+			problem = fmt.Sprintf("the %s DNS server %q is not an IP address", upstream.label, upstream.server)
+		} else if err := queryUpstream(ctx, env, upstream.server, probe); err != nil {
+			problem = fmt.Sprintf("the %s DNS server %s did not answer", upstream.label, upstream.server)
+		}
+		if problem != "" {
+			problems = append(problems, problem)
+			status = max(status, upstream.severity)
+		}
+	}
+	if len(problems) > 0 {
+		remediations = append(remediations, "Change the DNS servers in Preferences, or turn off DNS override.")
+	}
+
+	if env.Adapters != nil {
+		adapters, err := env.Adapters()
+		if err == nil {
+			var others []string
+			for _, adapter := range adapters {
+				if !adapter.Up || !adapter.Virtual || len(adapter.DNSServers) == 0 ||
+					strings.EqualFold(adapter.Name, config.AppName) {
+					continue
+				}
+				others = append(others, fmt.Sprintf("%s (%s)", adapter.Name, strings.Join(adapter.DNSServers, ", ")))
+			}
+			if len(others) > 0 {
+				problems = append(problems, "other VPN adapters set their own DNS servers: "+strings.Join(others, "; "))
+				remediations = append(remediations, "If names do not resolve while connected, disconnect other VPN clients or turn off DNS override in Preferences.")
+				status = max(status, StatusWarn)
+			}
+		}
+	}
+
+	if status == StatusPass {
+		return pass("The DNS servers %s answer and no other VPN sets DNS servers", joinNonEmpty(env.PrimaryDNS, env.SecondaryDNS))
+	}
+	message := strings.Join(problems, "; ")
+	return Result{
+		Status:      status,
+		Message:     strings.ToUpper(message[:1]) + message[1:],
+		Remediation: strings.Join(remediations, " "),
+	}
+}
+
+// queryUpstream resolves name using only server
+func queryUpstream(ctx context.Context, env *Env, server, name string) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return env.Dial(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+	_, err := resolver.LookupHost(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		// The server answered, even if not with an address
+		return nil
+	}
+	return err
+}
+
+func (env *Env) tlsConfig(serverName string) *tls.Config {
+	var cfg *tls.Config
+	if env.TLSConfig != nil {
+		cfg = env.TLSConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = serverName
+	}
+	if cfg.Time == nil {
+		cfg.Time = env.Now
+	}
+	return cfg
+}
+
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func isHTTPStatus(err error, statuses ...int) bool {
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != api.ErrorTypeHTTPError {
+		return false
+	}
+	for _, status := range statuses {
+		if apiErr.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+func joinNonEmpty(values ...string) string {
+	var nonEmpty []string
+	for _, value := range values {
+		if value != "" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
@@ -0,0 +1,273 @@
+//go:build windows
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fosrl/newt/bind"
+	"github.com/fosrl/windows/api"
+)
+
+// stubAPI answers like a Pangolin server would, or fails with err
+type stubAPI struct {
+	reachable bool
+	err       error
+	user      *api.User
+	access    *api.CheckOrgUserAccessResponse
+	olm       *api.Olm
+}
+
+func (s *stubAPI) TestConnection() (bool, error) { return s.reachable, s.err }
+func (s *stubAPI) GetUser() (*api.User, error)   { return s.user, s.err }
+
+func (s *stubAPI) CheckOrgUserAccess(orgId, userId string) (*api.CheckOrgUserAccessResponse, error) {
+	return s.access, s.err
+}
+
+func (s *stubAPI) GetUserOlm(userId, olmId string) (*api.Olm, error) {
+	return s.olm, s.err
+}
+
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// dialTo returns a Dial that connects to address whatever it is asked for
+func dialTo(address string) func(ctx context.Context, network, _ string) (net.Conn, error) {
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+}
+
+func httpStatusError(status int) error {
+	return &api.APIError{Type: api.ErrorTypeHTTPError, Status: status, Message: http.StatusText(status)}
+}
+
+func TestResolveCheck(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     Status
+	}{
+		{"https://pangolin.example.com", StatusPass},
+		{"https://10.0.0.1", StatusPass},
+		{"https://missing.example.com", StatusFail},
+		{"", StatusFail},
+	}
+	for _, tt := range tests {
+		env := &Env{Hostname: tt.hostname, Resolver: stubResolver{"pangolin.example.com": {"192.0.2.10"}}}
+		if got := (ResolveCheck{}).Run(context.Background(), env); got.Status != tt.want {
+			t.Errorf("%q: %s (%s), want %s", tt.hostname, got.Status, got.Message, tt.want)
+		}
+	}
+}
+
+func TestTLSCheck(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	notAfter := server.Certificate().NotAfter
+
+	tests := []struct {
+		name    string
+		host    string
+		roots   *x509.CertPool
+		now     time.Time
+		want    Status
+		message string
+	}{
+		{"valid", "example.com", roots, time.Now(), StatusPass, "valid until"},
+		{"untrusted", "example.com", nil, time.Now(), StatusFail, "not trusted"},
+		{"wrong host", "pangolin.example.net", roots, time.Now(), StatusFail, "not valid for"},
+		{"expiring", "example.com", roots, notAfter.Add(-24 * time.Hour), StatusWarn, "expires on"},
+		{"clock ahead", "example.com", roots, notAfter.Add(24 * time.Hour), StatusFail, "clock says"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Env{
+				Hostname:  "https://" + tt.host,
+				Dial:      dialTo(server.Listener.Addr().String()),
+				TLSConfig: &tls.Config{RootCAs: tt.roots},
+				Now:       func() time.Time { return tt.now },
+			}
+			got := (TLSCheck{}).Run(context.Background(), env)
+			if got.Status != tt.want || !strings.Contains(got.Message, tt.message) {
+				t.Errorf("%s: %q, want %s containing %q", got.Status, got.Message, tt.want, tt.message)
+			}
+		})
+	}
+
+	env := &Env{Hostname: "http://example.com"}
+	if got := (TLSCheck{}).Run(context.Background(), env); got.Status != StatusWarn {
+		t.Errorf("plain HTTP: %s, want a warning", got.Status)
+	}
+}
+
+func TestClockCheck(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	tests := []struct {
+		skew time.Duration
+		want Status
+	}{
+		{0, StatusPass},
+		{-2 * time.Minute, StatusWarn},
+		{10 * time.Minute, StatusFail},
+	}
+	for _, tt := range tests {
+		env := &Env{
+			Hostname: "https://example.com",
+			Dial:     dialTo(server.Listener.Addr().String()),
+			Now:      func() time.Time { return time.Now().Add(tt.skew) },
+		}
+		if got := (ClockCheck{}).Run(context.Background(), env); got.Status != tt.want {
+			t.Errorf("skew %s: %s (%s), want %s", tt.skew, got.Status, got.Message, tt.want)
+		}
+	}
+}
+
+func TestAPIChecks(t *testing.T) {
+	username := "alice"
+	yes := true
+	tests := []struct {
+		name    string
+		check   Check
+		env     Env
+		want    Status
+		message string
+	}{
+		{"server up", ServerCheck{}, Env{API: &stubAPI{reachable: true}}, StatusPass, "responded"},
+		{"server down", ServerCheck{}, Env{API: &stubAPI{}}, StatusFail, "did not respond"},
+		{"server error", ServerCheck{}, Env{API: &stubAPI{err: errors.New("refused")}}, StatusFail, "refused"},
+		{"not logged in", ServerCheck{}, Env{}, StatusSkip, "Not logged in"},
+
+		{"session", SessionCheck{}, Env{UserID: "u1", API: &stubAPI{user: &api.User{Username: &username}}}, StatusPass, "alice"},
+		{"session expired", SessionCheck{}, Env{UserID: "u1", API: &stubAPI{err: httpStatusError(401)}}, StatusFail, "expired"},
+		{"no session", SessionCheck{}, Env{}, StatusFail, "not logged in"},
+
+		{"no org", OrgAccessCheck{}, Env{API: &stubAPI{}}, StatusFail, "No organization"},
+		{"org allowed", OrgAccessCheck{}, Env{OrgID: "o1", API: &stubAPI{access: &api.CheckOrgUserAccessResponse{
+			Allowed:  true,
+			Policies: &api.OrgPolicies{RequiredTwoFactor: &yes},
+		}}}, StatusPass, "two-factor authentication is required"},
+		{"org denied", OrgAccessCheck{}, Env{OrgID: "o1", Hostname: "https://p.example.com", API: &stubAPI{access: &api.CheckOrgUserAccessResponse{
+			Policies: &api.OrgPolicies{MaxSessionLength: &api.MaxSessionLength{MaxSessionLengthHours: 8, SessionAgeHours: 9}},
+		}}}, StatusFail, "9 hours old, over the 8 hour limit"},
+		{"org forbidden", OrgAccessCheck{}, Env{OrgID: "o1", API: &stubAPI{err: httpStatusError(403)}}, StatusFail, "do not have access"},
+
+		{"olm unregistered", OlmCheck{}, Env{API: &stubAPI{}}, StatusPass, "not registered yet"},
+		{"olm registered", OlmCheck{}, Env{OlmID: "olm1", HasOlmSecret: true, API: &stubAPI{olm: &api.Olm{OlmId: "olm1"}}}, StatusPass, "registered"},
+		{"olm deleted", OlmCheck{}, Env{OlmID: "olm1", HasOlmSecret: true, API: &stubAPI{err: httpStatusError(404)}}, StatusFail, "no longer exist"},
+		{"olm other", OlmCheck{}, Env{OlmID: "olm1", HasOlmSecret: true, API: &stubAPI{olm: &api.Olm{OlmId: "olm2"}}}, StatusFail, "different device"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.check.Run(context.Background(), &tt.env)
+			if got.Status != tt.want || !strings.Contains(got.Message, tt.message) {
+				t.Errorf("%s: %q, want %s containing %q", got.Status, got.Message, tt.want, tt.message)
+			}
+			if (got.Status == StatusFail || got.Status == StatusWarn) && got.Remediation == "" {
+				t.Errorf("no remediation for %q", got.Message)
+			}
+		})
+	}
+}
+
+// echoHolepunch answers test packets like the server's hole punching port
+func echoHolepunch(t *testing.T, answer bool) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !answer || n != bind.MagicTestRequestLen || !bytes.HasPrefix(buf, bind.MagicTestRequest) {
+				continue
+			}
+			reply := append(append([]byte(nil), bind.MagicTestResponse...), buf[len(bind.MagicTestRequest):n]...)
+			conn.WriteToUDP(reply, addr)
+		}
+	}()
+	return conn
+}
+
+func TestHolepunchCheck(t *testing.T) {
+	for _, answer := range []bool{true, false} {
+		server := echoHolepunch(t, answer)
+		defer server.Close()
+		port := server.LocalAddr().(*net.UDPAddr).Port
+
+		env := &Env{Hostname: "https://127.0.0.1", HolepunchPort: port, Dial: (&net.Dialer{}).DialContext}
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		got := (HolepunchCheck{}).Run(ctx, env)
+		cancel()
+
+		want := StatusPass
+		if !answer {
+			want = StatusWarn
+		}
+		if got.Status != want {
+			t.Errorf("answer=%v: %s (%s), want %s", answer, got.Status, got.Message, want)
+		}
+	}
+}
+
+func TestDNSOverrideCheck(t *testing.T) {
+	unreachable := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("unreachable")
+	}
+	otherVPN := func() ([]Adapter, error) {
+		return []Adapter{
+			{Name: "Pangolin", Up: true, Virtual: true, DNSServers: []string{"100.96.0.1"}},
+			{Name: "Ethernet", Up: true, DNSServers: []string{"192.168.1.1"}},
+			{Name: "Corp VPN", Up: true, Virtual: true, DNSServers: []string{"10.0.0.53"}},
+		}, nil
+	}
+
+	tests := []struct {
+		name    string
+		env     Env
+		want    Status
+		message string
+	}{
+		{"off", Env{}, StatusSkip, "turned off"},
+		{"not an address", Env{DNSOverride: true, PrimaryDNS: "dns.example.com"}, StatusFail, "not an IP address"},
+		{"primary down", Env{DNSOverride: true, PrimaryDNS: "9.9.9.9", Dial: unreachable}, StatusFail, "primary DNS server 9.9.9.9 did not answer"},
+		{"secondary down", Env{DNSOverride: true, SecondaryDNS: "1.1.1.1", Dial: unreachable}, StatusWarn, "secondary"},
+		{"other VPN", Env{DNSOverride: true, Adapters: otherVPN}, StatusWarn, "Corp VPN (10.0.0.53)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (DNSOverrideCheck{}).Run(context.Background(), &tt.env)
+			if got.Status != tt.want || !strings.Contains(got.Message, tt.message) {
+				t.Errorf("%s: %q, want %s containing %q", got.Status, got.Message, tt.want, tt.message)
+			}
+			if strings.Contains(got.Message, "Pangolin") || strings.Contains(got.Message, "Ethernet") {
+				t.Errorf("the own tunnel or a physical adapter was reported: %q", got.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+//go:build windows
+
+// Package doctor runs connectivity checks that explain why connecting fails
+// and what the user can do about it.
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/secrets"
+)
+
+// checkTimeout bounds each check
+const checkTimeout = 15 * time.Second
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusWarn
+	StatusFail
+	// StatusSkip means the check did not run, because it does not apply or a
+	// check it depends on failed
+	StatusSkip
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "pass"
+	case StatusWarn:
+		return "warn"
+	case StatusFail:
+		return "fail"
+	case StatusSkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(s))
+	}
+}
+
+// Result is the outcome of one check. Remediation tells the user what to do
+// and is set for warnings and failures.
+type Result struct {
+	ID          string
+	Name        string
+	Status      Status
+	Message     string
+	Remediation string
+	Duration    time.Duration
+}
+
+// Check is one diagnostic step. Checks only talk to the outside world
+// through Env, so they can be run against stubs.
+type Check interface {
+	// ID identifies the check in Requires and in results
+	ID() string
+	// Name is shown to the user
+	Name() string
+	Run(ctx context.Context, env *Env) Result
+}
+
+// Requirer is implemented by checks that are only meaningful if other checks
+// did not fail. They are skipped otherwise.
+type Requirer interface {
+	Requires() []string
+}
+
+// API is the part of the Pangolin API the checks use. *api.APIClient
+// implements it.
+type API interface {
+	TestConnection() (bool, error)
+	GetUser() (*api.User, error)
+	CheckOrgUserAccess(orgId, userId string) (*api.CheckOrgUserAccessResponse, error)
+	GetUserOlm(userId, olmId string) (*api.Olm, error)
+}
+
+// Resolver looks up host names. *net.Resolver implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Adapter is a network adapter as seen by the DNS override check
+type Adapter struct {
+	Name        string
+	Description string
+	Up          bool
+	// Virtual is set for tunnel and other software adapters, which is what
+	// VPN clients create
+	Virtual    bool
+	DNSServers []string
+}
+
+// Env holds what the checks inspect and the dependencies they use
+type Env struct {
+	// Hostname is the server URL of the active account
+	Hostname string
+	UserID   string
+	OrgID    string
+	OlmID    string
+	// HasOlmSecret reports whether the OLM secret is stored; the secret
+	// itself is not needed by any check
+	HasOlmSecret bool
+
+	DNSOverride  bool
+	PrimaryDNS   string
+	SecondaryDNS string
+
+	// HolepunchPort is the UDP port the server uses for hole punching
+	HolepunchPort int
+
+	API      API
+	Resolver Resolver
+	// Dial opens connections to the server, and to upstream DNS servers
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// TLSConfig is cloned for TLS connections; nil uses the system roots
+	TLSConfig *tls.Config
+	Now       func() time.Time
+	Adapters  func() ([]Adapter, error)
+}
+
+// NewEnv returns an Env for the active account, using the real network
+func NewEnv(
+	apiClient *api.APIClient,
+	configManager *config.ConfigManager,
+	accountManager *config.AccountManager,
+	secretManager *secrets.SecretManager,
+) (*Env, error) {
+	account, err := accountManager.ActiveAccount()
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, fmt.Errorf("no active account")
+	}
+
+	env := &Env{
+		Hostname:      account.Hostname,
+		UserID:        account.UserID,
+		OrgID:         account.OrgID,
+		DNSOverride:   configManager.GetDNSOverride(),
+		PrimaryDNS:    configManager.GetPrimaryDNS(),
+		SecondaryDNS:  configManager.GetSecondaryDNS(),
+		HolepunchPort: DefaultHolepunchPort,
+		Resolver:      net.DefaultResolver,
+		Dial:          (&net.Dialer{}).DialContext,
+		Now:           time.Now,
+		Adapters:      systemAdapters,
+	}
+	// A nil *api.APIClient in the interface would not compare equal to nil
+	if apiClient != nil {
+		env.API = apiClient
+	}
+	if olmID, found := secretManager.GetOlmId(account.UserID); found {
+		env.OlmID = olmID
+	}
+	if secret, found := secretManager.GetOlmSecret(account.UserID); found && secret != "" {
+		env.HasOlmSecret = true
+	}
+	return env, nil
+}
+
+// ServerURL returns the parsed Hostname. Hostnames without a scheme use
+// HTTPS, like the API client.
+func (env *Env) ServerURL() (*url.URL, error) {
+	hostname := strings.TrimSpace(env.Hostname)
+	if hostname == "" {
+		return nil, fmt.Errorf("no server address configured")
+	}
+	if !strings.Contains(hostname, "://") {
+		hostname = "https://" + hostname
+	}
+	u, err := url.Parse(hostname)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%q has no host name", env.Hostname)
+	}
+	return u, nil
+}
+
+// DefaultChecks returns the built-in checks in the order they should run
+func DefaultChecks() []Check {
+	return []Check{
+		ResolveCheck{},
+		TLSCheck{},
+		ClockCheck{},
+		ServerCheck{},
+		SessionCheck{},
+		OrgAccessCheck{},
+		OlmCheck{},
+		HolepunchCheck{},
+		DNSOverrideCheck{},
+	}
+}
+
+// Run runs checks in order. A check that requires another one is skipped if
+// that one failed or was itself skipped for that reason. onResult, if not
+// nil, is called after each check, for showing progress.
+func Run(ctx context.Context, env *Env, checks []Check, onResult func(Result)) []Result {
+	results := make([]Result, 0, len(checks))
+	// blocked maps the IDs of checks that failed or were skipped because of
+	// a failure to their names
+	blocked := make(map[string]string)
+	for _, check := range checks {
+		var result Result
+		if blocker, ok := blockingRequirement(check, blocked); ok {
+			result = Result{
+				Status:  StatusSkip,
+				Message: fmt.Sprintf("Skipped because %q did not pass", blocker),
+			}
+			blocked[check.ID()] = check.Name()
+		} else {
+			result = runCheck(ctx, env, check)
+			if result.Status == StatusFail {
+				blocked[check.ID()] = check.Name()
+			}
+		}
+		result.ID = check.ID()
+		result.Name = check.Name()
+		results = append(results, result)
+		if onResult != nil {
+			onResult(result)
+		}
+	}
+	return results
+}
+
+func runCheck(ctx context.Context, env *Env, check Check) (result Result) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			result = Result{Status: StatusFail, Message: fmt.Sprintf("Check failed unexpectedly: %v", r)}
+		}
+		result.Duration = time.Since(start)
+	}()
+	if err := ctx.Err(); err != nil {
+		return Result{Status: StatusSkip, Message: "Cancelled"}
+	}
+	return check.Run(ctx, env)
+}
+
+// blockingRequirement returns the name of a required check that is blocked
+func blockingRequirement(check Check, blocked map[string]string) (string, bool) {
+	requirer, ok := check.(Requirer)
+	if !ok {
+		return "", false
+	}
+	for _, id := range requirer.Requires() {
+		if name, ok := blocked[id]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Worst returns the most severe status in results, where skipped checks
+// count as passed
+func Worst(results []Result) Status {
+	worst := StatusPass
+	for _, result := range results {
+		if result.Status != StatusSkip && result.Status > worst {
+			worst = result.Status
+		}
+	}
+	return worst
+}
+
+// Report formats results as plain text, one check per paragraph
+func Report(results []Result) string {
+	var b strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s] %s: %s\n", strings.ToUpper(result.Status.String()), result.Name, result.Message)
+		if result.Remediation != "" && (result.Status == StatusWarn || result.Status == StatusFail) {
+			fmt.Fprintf(&b, "    %s\n", result.Remediation)
+		}
+	}
+	return b.String()
+}
+
+func pass(format string, args ...any) Result {
+	return Result{Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func skip(format string, args ...any) Result {
+	return Result{Status: StatusSkip, Message: fmt.Sprintf(format, args...)}
+}
+
+func warn(remediation, format string, args ...any) Result {
+	return Result{Status: StatusWarn, Message: fmt.Sprintf(format, args...), Remediation: remediation}
+}
+
+func fail(remediation, format string, args ...any) Result {
+	return Result{Status: StatusFail, Message: fmt.Sprintf(format, args...), Remediation: remediation}
+}
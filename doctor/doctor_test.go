@@ -0,0 +1,144 @@
+//go:build windows
+
+package doctor
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// stubCheck returns a fixed result, or panics if panics is set
+type stubCheck struct {
+	id       string
+	status   Status
+	requires []string
+	panics   bool
+	ran      *[]string
+}
+
+func (c stubCheck) ID() string         { return c.id }
+func (c stubCheck) Name() string       { return "Check " + c.id }
+func (c stubCheck) Requires() []string { return c.requires }
+
+func (c stubCheck) Run(ctx context.Context, env *Env) Result {
+	*c.ran = append(*c.ran, c.id)
+	if c.panics {
+		panic("boom")
+	}
+	return Result{Status: c.status, Message: c.id + " ran", Remediation: "fix " + c.id}
+}
+
+func TestRunSkipsChecksThatRequireAFailedOne(t *testing.T) {
+	var ran []string
+	checks := []Check{
+		stubCheck{id: "a", status: StatusPass, ran: &ran},
+		stubCheck{id: "b", status: StatusFail, requires: []string{"a"}, ran: &ran},
+		stubCheck{id: "c", status: StatusPass, requires: []string{"b"}, ran: &ran},
+		// Skipped because c was skipped because of b
+		stubCheck{id: "d", status: StatusPass, requires: []string{"c"}, ran: &ran},
+		// A warning does not block
+		stubCheck{id: "e", status: StatusWarn, requires: []string{"a"}, ran: &ran},
+		stubCheck{id: "f", status: StatusPass, requires: []string{"e"}, ran: &ran},
+		stubCheck{id: "g", panics: true, ran: &ran},
+		stubCheck{id: "h", status: StatusPass, requires: []string{"g"}, ran: &ran},
+	}
+
+	var reported []string
+	results := Run(context.Background(), &Env{}, checks, func(result Result) {
+		reported = append(reported, result.ID)
+	})
+
+	want := map[string]Status{
+		"a": StatusPass, "b": StatusFail, "c": StatusSkip, "d": StatusSkip,
+		"e": StatusWarn, "f": StatusPass, "g": StatusFail, "h": StatusSkip,
+	}
+	if len(results) != len(checks) {
+		t.Fatalf("got %d results for %d checks", len(results), len(checks))
+	}
+	for _, result := range results {
+		if result.Status != want[result.ID] {
+			t.Errorf("check %s: status %s, want %s", result.ID, result.Status, want[result.ID])
+		}
+		if result.Name != "Check "+result.ID {
+			t.Errorf("check %s: name %q", result.ID, result.Name)
+		}
+	}
+	if got := strings.Join(ran, ","); got != "a,b,e,f,g" {
+		t.Errorf("ran %s, want a,b,e,f,g", got)
+	}
+	if got := strings.Join(reported, ","); got != "a,b,c,d,e,f,g,h" {
+		t.Errorf("reported %s, want every check in order", got)
+	}
+	if !strings.Contains(results[2].Message, `"Check b"`) {
+		t.Errorf("skipped check does not name the failed one: %q", results[2].Message)
+	}
+	if !strings.Contains(results[6].Message, "boom") {
+		t.Errorf("panicking check: %q", results[6].Message)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	var ran []string
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := Run(ctx, &Env{}, []Check{stubCheck{id: "a", ran: &ran}}, nil)
+	if results[0].Status != StatusSkip || len(ran) != 0 {
+		t.Errorf("a cancelled run ran its checks: %+v", results)
+	}
+}
+
+func TestWorst(t *testing.T) {
+	tests := []struct {
+		statuses []Status
+		want     Status
+	}{
+		{nil, StatusPass},
+		{[]Status{StatusPass, StatusSkip}, StatusPass},
+		{[]Status{StatusWarn, StatusPass}, StatusWarn},
+		{[]Status{StatusWarn, StatusFail, StatusSkip}, StatusFail},
+	}
+	for _, tt := range tests {
+		var results []Result
+		for _, status := range tt.statuses {
+			results = append(results, Result{Status: status})
+		}
+		if got := Worst(results); got != tt.want {
+			t.Errorf("Worst(%v) = %s, want %s", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := Report([]Result{
+		{Name: "Clock", Status: StatusPass, Message: "In sync", Remediation: "not shown"},
+		{Name: "Session", Status: StatusFail, Message: "Expired", Remediation: "Log in again."},
+	})
+	want := "[PASS] Clock: In sync\n\n[FAIL] Session: Expired\n    Log in again.\n"
+	if report != want {
+		t.Errorf("Report =\n%s\nwant\n%s", report, want)
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+		wantErr  bool
+	}{
+		{"pangolin.example.com", "https://pangolin.example.com", false},
+		{"http://10.0.0.1:3000", "http://10.0.0.1:3000", false},
+		{"  ", "", true},
+		{"https://", "", true},
+	}
+	for _, tt := range tests {
+		u, err := (&Env{Hostname: tt.hostname}).ServerURL()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ServerURL(%q) error = %v", tt.hostname, err)
+			continue
+		}
+		if err == nil && u.String() != tt.want {
+			t.Errorf("ServerURL(%q) = %s, want %s", tt.hostname, u, tt.want)
+		}
+	}
+}
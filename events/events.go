@@ -0,0 +1,228 @@
+// Package events is a typed publish/subscribe bus. Each kind of event has its
+// own Topic; any number of subscribers receive its events in the order they
+// were published, each on its own goroutine, so a slow subscriber does not
+// hold up the publisher or the other subscribers.
+package events
+
+import (
+	"sync"
+
+	"github.com/fosrl/newt/logger"
+)
+
+// DefaultBuffer is the number of events a subscription queues before its
+// Policy applies
+const DefaultBuffer = 64
+
+// Policy decides what happens when a subscriber falls behind and its buffer
+// is full
+type Policy int
+
+const (
+	// DropOldest discards the oldest queued event to make room. Subscribers
+	// that only care about the latest value use it.
+	DropOldest Policy = iota
+	// DropNewest discards the event being published
+	DropNewest
+	// Block makes Publish wait until the subscriber catches up. Use it only
+	// for subscribers that must see every event and are known to be quick.
+	Block
+)
+
+// Topic is a stream of events of type T
+type Topic[T any] struct {
+	name   string
+	replay bool
+
+	// publishMu serializes Publish, so that every subscriber sees the events
+	// in the same order, including those that block
+	publishMu sync.Mutex
+
+	mu      sync.Mutex
+	subs    map[*Subscription[T]]struct{}
+	latest  T
+	hasLast bool
+}
+
+// NewTopic returns a topic. If replay is set, new subscribers first receive
+// the latest event published before they subscribed, which suits topics that
+// carry state.
+func NewTopic[T any](name string, replay bool) *Topic[T] {
+	return &Topic[T]{
+		name:   name,
+		replay: replay,
+		subs:   make(map[*Subscription[T]]struct{}),
+	}
+}
+
+// Name returns the name of the topic
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Latest returns the last event published, if any
+func (t *Topic[T]) Latest() (T, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latest, t.hasLast
+}
+
+// Publish delivers event to all subscribers
+func (t *Topic[T]) Publish(event T) {
+	t.publishMu.Lock()
+	defer t.publishMu.Unlock()
+
+	t.mu.Lock()
+	t.latest = event
+	t.hasLast = true
+	subs := make([]*Subscription[T], 0, len(t.subs))
+	for sub := range t.subs {
+		subs = append(subs, sub)
+	}
+	// Blocking subscribers are served after the lock is released, so that
+	// subscribing and unsubscribing do not wait for them; publishMu keeps
+	// the next event from overtaking this one meanwhile.
+	var blocking []*Subscription[T]
+	for _, sub := range subs {
+		if sub.policy == Block {
+			blocking = append(blocking, sub)
+			continue
+		}
+		sub.enqueue(event)
+	}
+	t.mu.Unlock()
+
+	for _, sub := range blocking {
+		sub.enqueue(event)
+	}
+}
+
+// Subscribe calls fn with every event published from now on, and first with
+// the latest one if the topic replays. fn runs on a goroutine owned by the
+// subscription and is never called concurrently with itself.
+func (t *Topic[T]) Subscribe(fn func(T), opts ...Option) *Subscription[T] {
+	sub := &Subscription[T]{
+		subscribeOptions: subscribeOptions{policy: DropOldest, buffer: DefaultBuffer},
+		topic:            t,
+		fn:               fn,
+		done:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&sub.subscribeOptions)
+	}
+	if sub.buffer < 1 {
+		sub.buffer = 1
+	}
+	sub.queue = make(chan T, sub.buffer)
+	go sub.run()
+
+	t.mu.Lock()
+	if t.replay && t.hasLast && !sub.noReplay {
+		sub.queue <- t.latest
+	}
+	t.subs[sub] = struct{}{}
+	t.mu.Unlock()
+	return sub
+}
+
+type subscribeOptions struct {
+	policy   Policy
+	buffer   int
+	noReplay bool
+}
+
+// Option configures a subscription
+type Option func(*subscribeOptions)
+
+// WithPolicy sets what happens when the subscriber falls behind. The default
+// is DropOldest.
+func WithPolicy(policy Policy) Option {
+	return func(o *subscribeOptions) { o.policy = policy }
+}
+
+// WithBuffer sets how many events are queued for the subscriber
+func WithBuffer(size int) Option {
+	return func(o *subscribeOptions) { o.buffer = size }
+}
+
+// WithoutReplay skips the latest event of a replaying topic
+func WithoutReplay() Option {
+	return func(o *subscribeOptions) { o.noReplay = true }
+}
+
+// Subscription is a subscriber of a Topic
+type Subscription[T any] struct {
+	subscribeOptions
+	topic *Topic[T]
+	fn    func(T)
+	queue chan T
+	done  chan struct{}
+
+	closeOnce sync.Once
+	dropped   int
+}
+
+// Unsubscribe stops delivery. Events already queued are discarded; a call of
+// the subscriber's function that is in progress completes.
+func (s *Subscription[T]) Unsubscribe() {
+	if s == nil {
+		return
+	}
+	s.topic.mu.Lock()
+	delete(s.topic.subs, s)
+	s.topic.mu.Unlock()
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+func (s *Subscription[T]) enqueue(event T) {
+	switch s.policy {
+	case Block:
+		select {
+		case s.queue <- event:
+		case <-s.done:
+		}
+	case DropNewest:
+		select {
+		case s.queue <- event:
+		default:
+			s.drop()
+		}
+	default:
+		for {
+			select {
+			case s.queue <- event:
+				return
+			default:
+			}
+			select {
+			case <-s.queue:
+				s.drop()
+			default:
+			}
+		}
+	}
+}
+
+// drop counts a discarded event; callers hold the topic lock
+func (s *Subscription[T]) drop() {
+	s.dropped++
+	if s.dropped == 1 || s.dropped%100 == 0 {
+		logger.Warn("Subscriber of %s is falling behind, %d events dropped", s.topic.name, s.dropped)
+	}
+}
+
+func (s *Subscription[T]) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case event := <-s.queue:
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.fn(event)
+		}
+	}
+}
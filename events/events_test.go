@@ -0,0 +1,173 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector records the events a subscriber receives
+type collector struct {
+	mu     sync.Mutex
+	events []int
+}
+
+func (c *collector) add(event int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *collector) get() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.events)
+}
+
+// waitFor waits until c has received n events
+func (c *collector) waitFor(t *testing.T, n int) []int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events := c.get()
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d of %d events", len(events), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentPublishersKeepOneOrder(t *testing.T) {
+	const publishers, perPublisher = 8, 200
+	topic := NewTopic[int]("test.order", false)
+
+	var blocking, slow, buffered collector
+	defer topic.Subscribe(blocking.add, WithPolicy(Block), WithBuffer(1)).Unsubscribe()
+	defer topic.Subscribe(func(event int) {
+		time.Sleep(time.Microsecond)
+		slow.add(event)
+	}, WithPolicy(Block), WithBuffer(1)).Unsubscribe()
+	defer topic.Subscribe(buffered.add, WithBuffer(publishers*perPublisher)).Unsubscribe()
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				topic.Publish(p*perPublisher + i)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	const total = publishers * perPublisher
+	order := blocking.waitFor(t, total)
+	if !slices.Equal(slow.waitFor(t, total), order) {
+		t.Error("two blocking subscribers saw the events in different orders")
+	}
+	if !slices.Equal(buffered.waitFor(t, total), order) {
+		t.Error("a buffered subscriber saw the events in a different order than a blocking one")
+	}
+
+	// Each publisher's own events stay in the order it published them
+	last := make(map[int]int)
+	for _, event := range order {
+		p := event / perPublisher
+		if prev, ok := last[p]; ok && event < prev {
+			t.Fatalf("event %d of publisher %d arrived after %d", event, p, prev)
+		}
+		last[p] = event
+	}
+}
+
+func TestReplay(t *testing.T) {
+	topic := NewTopic[int]("test.replay", true)
+	if _, ok := topic.Latest(); ok {
+		t.Error("a new topic has a latest event")
+	}
+	topic.Publish(1)
+	topic.Publish(2)
+
+	var replayed, fresh collector
+	defer topic.Subscribe(replayed.add).Unsubscribe()
+	defer topic.Subscribe(fresh.add, WithoutReplay()).Unsubscribe()
+	topic.Publish(3)
+
+	if got := replayed.waitFor(t, 2); !slices.Equal(got, []int{2, 3}) {
+		t.Errorf("replaying subscriber got %v, want [2 3]", got)
+	}
+	if got := fresh.waitFor(t, 1); !slices.Equal(got, []int{3}) {
+		t.Errorf("subscriber without replay got %v, want [3]", got)
+	}
+	if latest, ok := topic.Latest(); !ok || latest != 3 {
+		t.Errorf("Latest() = %d, %v", latest, ok)
+	}
+}
+
+func TestDropPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		policy Policy
+		want   []int
+	}{
+		{DropOldest, []int{0, 4, 5}},
+		{DropNewest, []int{0, 1, 2}},
+	} {
+		topic := NewTopic[int]("test.drop", false)
+		release := make(chan struct{})
+		var got collector
+		sub := topic.Subscribe(func(event int) {
+			if event == 0 {
+				<-release
+			}
+			got.add(event)
+		}, WithPolicy(tt.policy), WithBuffer(2))
+
+		topic.Publish(0)
+		// Wait for the subscriber to take 0, so that the rest queue up
+		for len(sub.queue) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 1; i <= 5; i++ {
+			topic.Publish(i)
+		}
+		close(release)
+
+		if events := got.waitFor(t, 3); !slices.Equal(events, tt.want) {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, events, tt.want)
+		}
+		sub.Unsubscribe()
+	}
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	topic := NewTopic[int]("test.unsubscribe", false)
+	release := make(chan struct{})
+	defer close(release)
+	sub := topic.Subscribe(func(int) { <-release }, WithPolicy(Block), WithBuffer(1))
+
+	published := make(chan struct{})
+	go func() {
+		// One event is taken, one fills the buffer and the third blocks
+		for i := 0; i < 3; i++ {
+			topic.Publish(i)
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("Publish did not wait for a blocking subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	sub.Unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unsubscribe did not release the blocked publisher")
+	}
+}
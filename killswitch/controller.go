@@ -0,0 +1,117 @@
+package killswitch
+
+import (
+	"slices"
+	"sync"
+)
+
+// Firewall puts rules in force
+type Firewall interface {
+	// Apply replaces the rules in force with rules, all at once, so that no
+	// traffic slips through in between
+	Apply(rules []Rule) error
+	// Remove removes the rules in force. It does nothing if there are none.
+	Remove() error
+}
+
+// Phase is what the tunnel is doing, as far as the kill switch is concerned
+type Phase int
+
+const (
+	// PhaseStopped is a tunnel that was stopped or failed to start
+	PhaseStopped Phase = iota
+	// PhaseConnecting is a tunnel that is starting
+	PhaseConnecting
+	// PhaseConnected is a tunnel that is up
+	PhaseConnected
+	// PhaseReconnecting is a tunnel that lost its connection and is getting
+	// it back
+	PhaseReconnecting
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseStopped:
+		return "stopped"
+	case PhaseConnecting:
+		return "connecting"
+	case PhaseConnected:
+		return "connected"
+	case PhaseReconnecting:
+		return "reconnecting"
+	default:
+		return "unknown"
+	}
+}
+
+// Controller puts the rules in force while the tunnel is not stopped, and
+// removes them when it is
+type Controller struct {
+	mu       sync.Mutex
+	firewall Firewall
+	// rules are the rules in force, nil for none
+	rules []Rule
+}
+
+// NewController creates a controller that puts the rules in force with
+// firewall
+func NewController(firewall Firewall) *Controller {
+	return &Controller{firewall: firewall}
+}
+
+// Update puts in force the rules for in, or removes them if the tunnel is
+// stopped. The rules are only replaced if they change, so that a tunnel that
+// reconnects keeps them in force throughout.
+func (c *Controller) Update(phase Phase, in Input) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if phase == PhaseStopped {
+		return c.removeLocked()
+	}
+
+	// The tunnel interface goes away while reconnecting; permitting it
+	// again once it is back is enough
+	if phase == PhaseReconnecting && c.rules != nil {
+		return nil
+	}
+
+	rules := Rules(in)
+	if slices.Equal(rules, c.rules) {
+		return nil
+	}
+	if err := c.firewall.Apply(rules); err != nil {
+		return err
+	}
+	c.rules = rules
+	return nil
+}
+
+// Remove removes the rules in force
+func (c *Controller) Remove() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.removeLocked()
+}
+
+func (c *Controller) removeLocked() error {
+	if err := c.firewall.Remove(); err != nil {
+		return err
+	}
+	c.rules = nil
+	return nil
+}
+
+// Engaged reports whether rules are in force
+func (c *Controller) Engaged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rules != nil
+}
+
+// Rules returns the rules in force
+func (c *Controller) Rules() []Rule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.rules)
+}
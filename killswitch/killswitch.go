@@ -0,0 +1,68 @@
+// Package killswitch blocks the traffic that would leave the machine outside
+// the tunnel while the tunnel is connecting, connected or reconnecting. The
+// rules are computed from the tunnel configuration by Rules, without side
+// effects, and put in force by a Firewall as the tunnel state changes.
+package killswitch
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Settings is the kill switch configuration
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// AllowLAN lets the private, link-local and multicast ranges be reached
+	// outside the tunnel, for printers and file shares
+	AllowLAN bool `json:"allowLan,omitempty"`
+	// AllowedEndpoints are addresses or CIDR prefixes that may be reached
+	// outside the tunnel
+	AllowedEndpoints []string `json:"allowedEndpoints,omitempty"`
+}
+
+// Copy returns a copy of s that shares nothing with it
+func (s Settings) Copy() Settings {
+	s.AllowedEndpoints = append([]string(nil), s.AllowedEndpoints...)
+	return s
+}
+
+// String implements fmt.Stringer
+func (s Settings) String() string {
+	if !s.Enabled {
+		return "off"
+	}
+	return fmt.Sprintf("on (lan: %v, allowed: %s)", s.AllowLAN, strings.Join(s.AllowedEndpoints, ";"))
+}
+
+// Validate checks that the allowed endpoints can be parsed
+func (s Settings) Validate() error {
+	_, err := ParseEndpoints(s.AllowedEndpoints)
+	return err
+}
+
+// ParseEndpoints parses addresses and CIDR prefixes. An address is a prefix
+// of its full length.
+func ParseEndpoints(endpoints []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, endpoint := range endpoints {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		if strings.Contains(endpoint, "/") {
+			prefix, err := netip.ParsePrefix(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR prefix", endpoint)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR prefix", endpoint)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
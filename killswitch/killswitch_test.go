@@ -0,0 +1,267 @@
+package killswitch
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// packet is a connection to check against the rules
+type packet struct {
+	direction  Direction
+	remote     string
+	protocol   Protocol
+	remotePort uint16
+	localPort  uint16
+	luid       uint64
+	app        string
+	loopback   bool
+}
+
+// matches reports whether every condition of r holds for p
+func matches(r Rule, p packet) bool {
+	remote := netip.MustParseAddr(p.remote)
+	return r.Direction&p.direction != 0 &&
+		(!r.Remote.IsValid() || r.Remote.Contains(remote)) &&
+		(r.Protocol == ProtocolAny || r.Protocol == p.protocol) &&
+		(r.RemotePort == 0 || r.RemotePort == p.remotePort) &&
+		(r.LocalPort == 0 || r.LocalPort == p.localPort) &&
+		(r.InterfaceLUID == 0 || r.InterfaceLUID == p.luid) &&
+		(r.AppPath == "" || r.AppPath == p.app) &&
+		(!r.Loopback || p.loopback)
+}
+
+// permitted reports whether rules let p through: a matching Permit wins over
+// any Block, as with the filters of the Windows Filtering Platform
+func permitted(rules []Rule, p packet) bool {
+	for _, rule := range rules {
+		if rule.Action == Permit && matches(rule, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func out(remote string, protocol Protocol, port uint16) packet {
+	return packet{direction: Outbound, remote: remote, protocol: protocol, remotePort: port, localPort: 50000}
+}
+
+func TestRules(t *testing.T) {
+	const tunnel = 0x42
+	full := Input{
+		AppPath:      `C:\Program Files\Pangolin\Pangolin.exe`,
+		TunnelLUID:   tunnel,
+		ControlPlane: []netip.AddrPort{netip.MustParseAddrPort("198.51.100.10:443"), netip.MustParseAddrPort("[2001:db8::10]:443")},
+		Proxy:        []netip.AddrPort{netip.MustParseAddrPort("10.1.1.1:3128")},
+		DNSServers:   []netip.Addr{netip.MustParseAddr("192.168.1.1"), netip.MustParseAddr("::ffff:10.0.0.53")},
+		Endpoints:    []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")},
+	}
+	withLAN := full
+	withLAN.AllowLAN = true
+
+	for _, tt := range []struct {
+		name   string
+		in     Input
+		packet packet
+		want   bool
+	}{
+		{"anything else", full, out("93.184.216.34", ProtocolTCP, 443), false},
+		{"loopback", Input{}, packet{direction: Outbound, remote: "127.0.0.1", protocol: ProtocolTCP, remotePort: 8080, loopback: true}, true},
+		{"through the tunnel", full, packet{direction: Outbound, remote: "93.184.216.34", protocol: ProtocolTCP, remotePort: 443, luid: tunnel}, true},
+		{"into the tunnel", full, packet{direction: Inbound, remote: "100.90.128.5", protocol: ProtocolTCP, localPort: 22, luid: tunnel}, true},
+		{"another interface", full, packet{direction: Outbound, remote: "93.184.216.34", protocol: ProtocolTCP, remotePort: 443, luid: 0x7}, false},
+		{"before the tunnel interface exists", Input{}, packet{direction: Outbound, remote: "93.184.216.34", protocol: ProtocolTCP, remotePort: 443, luid: tunnel}, false},
+		{"tunnel service", full, packet{direction: Outbound, remote: "93.184.216.34", protocol: ProtocolUDP, remotePort: 51820, app: full.AppPath}, true},
+		{"another application", full, packet{direction: Outbound, remote: "93.184.216.34", protocol: ProtocolUDP, remotePort: 51820, app: `C:\other.exe`}, false},
+
+		{"control plane", full, out("198.51.100.10", ProtocolTCP, 443), true},
+		{"control plane over IPv6", full, out("2001:db8::10", ProtocolTCP, 443), true},
+		{"control plane on another port", full, out("198.51.100.10", ProtocolTCP, 80), false},
+		{"control plane over UDP", full, out("198.51.100.10", ProtocolUDP, 443), false},
+		{"inbound from the control plane", full, packet{direction: Inbound, remote: "198.51.100.10", protocol: ProtocolTCP, remotePort: 443}, false},
+
+		{"proxy", full, out("10.1.1.1", ProtocolTCP, 3128), true},
+		{"proxy on another port", full, out("10.1.1.1", ProtocolTCP, 8080), false},
+		{"proxy over UDP", full, out("10.1.1.1", ProtocolUDP, 3128), false},
+
+		{"DNS server over UDP", full, out("192.168.1.1", ProtocolUDP, 53), true},
+		{"DNS server over TCP", full, out("192.168.1.1", ProtocolTCP, 53), true},
+		{"IPv4-mapped DNS server", full, out("10.0.0.53", ProtocolUDP, 53), true},
+		{"DNS server on another port", full, out("192.168.1.1", ProtocolTCP, 80), false},
+		{"another resolver", full, out("8.8.8.8", ProtocolUDP, 53), false},
+		{"no DNS servers", Input{}, out("192.168.1.1", ProtocolUDP, 53), false},
+
+		{"allowed endpoint", full, out("203.0.113.7", ProtocolTCP, 22), true},
+		{"allowed endpoint over UDP", full, out("203.0.113.7", ProtocolUDP, 500), true},
+		{"inbound from an allowed endpoint", full, packet{direction: Inbound, remote: "203.0.113.7", protocol: ProtocolTCP, localPort: 22}, false},
+		{"next to an allowed endpoint", full, out("203.0.114.7", ProtocolTCP, 22), false},
+
+		{"LAN blocked", full, out("192.168.1.20", ProtocolTCP, 445), false},
+		{"LAN permitted", withLAN, out("192.168.1.20", ProtocolTCP, 445), true},
+		{"inbound from the LAN", withLAN, packet{direction: Inbound, remote: "10.20.0.5", protocol: ProtocolTCP, localPort: 3389}, true},
+		{"link-local", withLAN, out("169.254.10.1", ProtocolUDP, 5353), true},
+		{"multicast", withLAN, out("224.0.0.251", ProtocolUDP, 5353), true},
+		{"broadcast", withLAN, out("255.255.255.255", ProtocolUDP, 137), true},
+		{"unique local", withLAN, out("fd00::5", ProtocolTCP, 445), true},
+		{"public address with LAN", withLAN, out("93.184.216.34", ProtocolTCP, 443), false},
+		{"shared address space is not LAN", withLAN, out("100.64.0.1", ProtocolTCP, 443), false},
+
+		{"DHCP", Input{}, packet{direction: Outbound, remote: "255.255.255.255", protocol: ProtocolUDP, localPort: 68, remotePort: 67}, true},
+		{"DHCPv6", Input{}, packet{direction: Outbound, remote: "ff02::1:2", protocol: ProtocolUDP, localPort: 546, remotePort: 547}, true},
+		{"neighbor discovery", Input{}, packet{direction: Inbound, remote: "fe80::1", protocol: ProtocolICMPv6}, true},
+		{"ICMPv6 elsewhere", Input{}, out("2001:db8::1", ProtocolICMPv6, 0), false},
+	} {
+		if got := permitted(Rules(tt.in), tt.packet); got != tt.want {
+			t.Errorf("%s: permitted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRulesEndWithBlock(t *testing.T) {
+	for _, in := range []Input{{}, {TunnelLUID: 1, AllowLAN: true, Endpoints: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}}} {
+		rules := Rules(in)
+		last := rules[len(rules)-1]
+		if last.Action != Block || last.Direction != Both || last.Remote.IsValid() || last.Protocol != ProtocolAny {
+			t.Errorf("last rule %s, want one that blocks all traffic", last)
+		}
+		for _, rule := range rules[:len(rules)-1] {
+			if rule.Action != Permit {
+				t.Errorf("rule %s before the last one, want only exceptions", rule)
+			}
+		}
+		if !slices.Equal(rules, Rules(in)) {
+			t.Error("the rules differ for the same input")
+		}
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	prefixes, err := ParseEndpoints([]string{" 203.0.113.7 ", "", "198.51.100.9/24", "2001:db8::1", "::ffff:192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("203.0.113.7/32"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}
+	if !slices.Equal(prefixes, want) {
+		t.Errorf("ParseEndpoints() = %v, want %v", prefixes, want)
+	}
+	for _, endpoint := range []string{"example.com", "203.0.113.0/33", "203.0.113.7:443"} {
+		if _, err := ParseEndpoints([]string{endpoint}); err == nil {
+			t.Errorf("ParseEndpoints(%q) succeeded", endpoint)
+		}
+	}
+	if err := (Settings{Enabled: true, AllowedEndpoints: []string{"not an address"}}).Validate(); err == nil {
+		t.Error("settings with an invalid endpoint are valid")
+	}
+}
+
+// fakeFirewall records the rules put in force, and fails with applyErr and
+// removeErr if they are set
+type fakeFirewall struct {
+	rules     []Rule
+	applied   int
+	removed   int
+	applyErr  error
+	removeErr error
+}
+
+func (f *fakeFirewall) Apply(rules []Rule) error {
+	if f.applyErr != nil {
+		return f.applyErr
+	}
+	f.applied++
+	f.rules = slices.Clone(rules)
+	return nil
+}
+
+func (f *fakeFirewall) Remove() error {
+	if f.removeErr != nil {
+		return f.removeErr
+	}
+	f.removed++
+	f.rules = nil
+	return nil
+}
+
+func TestControllerPhases(t *testing.T) {
+	firewall := &fakeFirewall{}
+	c := NewController(firewall)
+	starting := Input{AppPath: "pangolin.exe", ControlPlane: []netip.AddrPort{netip.MustParseAddrPort("198.51.100.10:443")}}
+	up := starting
+	up.TunnelLUID = 0x42
+
+	step := func(name string, phase Phase, in Input, applied, removed int, engaged bool) {
+		t.Helper()
+		if err := c.Update(phase, in); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if firewall.applied != applied || firewall.removed != removed {
+			t.Errorf("%s: %d applies and %d removals, want %d and %d", name, firewall.applied, firewall.removed, applied, removed)
+		}
+		if c.Engaged() != engaged || !slices.Equal(c.Rules(), firewall.rules) {
+			t.Errorf("%s: engaged %v with %v, firewall has %v", name, c.Engaged(), c.Rules(), firewall.rules)
+		}
+	}
+
+	// Connecting blocks before the tunnel interface exists
+	step("connecting", PhaseConnecting, starting, 1, 0, true)
+	if !slices.Equal(firewall.rules, Rules(starting)) {
+		t.Errorf("rules %v while connecting, want %v", firewall.rules, Rules(starting))
+	}
+	step("connected", PhaseConnected, up, 2, 0, true)
+	step("connected again", PhaseConnected, up, 2, 0, true)
+
+	// The rules of the previous interface stay in force while reconnecting
+	step("reconnecting", PhaseReconnecting, starting, 2, 0, true)
+	if !slices.Equal(firewall.rules, Rules(up)) {
+		t.Errorf("rules %v while reconnecting, want those of the connection", firewall.rules)
+	}
+	reconnected := up
+	reconnected.TunnelLUID = 0x43
+	step("reconnected", PhaseConnected, reconnected, 3, 0, true)
+
+	step("stopped", PhaseStopped, reconnected, 3, 1, false)
+	if c.Rules() != nil {
+		t.Errorf("rules %v after the tunnel stopped", c.Rules())
+	}
+
+	// Reconnecting without rules in force puts them in force
+	step("reconnecting after a stop", PhaseReconnecting, starting, 4, 1, true)
+	if err := c.Remove(); err != nil || c.Engaged() || firewall.removed != 2 {
+		t.Errorf("Remove() = %v, engaged %v after %d removals", err, c.Engaged(), firewall.removed)
+	}
+}
+
+func TestControllerFailures(t *testing.T) {
+	failed := errors.New("the filtering engine failed")
+	firewall := &fakeFirewall{applyErr: failed}
+	c := NewController(firewall)
+	in := Input{TunnelLUID: 0x42}
+
+	if err := c.Update(PhaseConnecting, in); !errors.Is(err, failed) {
+		t.Errorf("Update() = %v, want the failure of the firewall", err)
+	}
+	if c.Engaged() {
+		t.Error("engaged although the rules were not applied")
+	}
+
+	// A failed Apply is retried on the next update, even with the same input
+	firewall.applyErr = nil
+	if err := c.Update(PhaseConnecting, in); err != nil || !c.Engaged() {
+		t.Fatalf("Update() = %v, engaged %v", err, c.Engaged())
+	}
+
+	// Rules that could not be removed are still reported in force
+	firewall.removeErr = failed
+	if err := c.Update(PhaseStopped, in); !errors.Is(err, failed) {
+		t.Errorf("Update(stopped) = %v, want the failure of the firewall", err)
+	}
+	if !c.Engaged() {
+		t.Error("not engaged although the rules could not be removed")
+	}
+}
@@ -0,0 +1,200 @@
+package killswitch
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Action is what a rule does with the traffic it matches
+type Action int
+
+const (
+	// Block drops the traffic. It is the action of the catch-all rule.
+	Block Action = iota
+	// Permit lets the traffic through, and wins over Block
+	Permit
+)
+
+func (a Action) String() string {
+	if a == Permit {
+		return "permit"
+	}
+	return "block"
+}
+
+// Direction is the direction of the connections a rule matches
+type Direction int
+
+const (
+	// Outbound matches the connections the machine opens
+	Outbound Direction = 1 << iota
+	// Inbound matches the connections the machine accepts
+	Inbound
+	// Both matches both directions
+	Both = Outbound | Inbound
+)
+
+// Protocol is an IP protocol number, or ProtocolAny
+type Protocol uint8
+
+const (
+	ProtocolAny    Protocol = 0
+	ProtocolTCP    Protocol = 6
+	ProtocolUDP    Protocol = 17
+	ProtocolICMPv6 Protocol = 58
+)
+
+// Rule is one filter of the kill switch. Its conditions all have to match;
+// the zero value of a condition matches anything.
+type Rule struct {
+	Name      string
+	Action    Action
+	Direction Direction
+	// Remote is the address range of the other end. An invalid prefix
+	// matches both IPv4 and IPv6.
+	Remote     netip.Prefix
+	Protocol   Protocol
+	RemotePort uint16
+	LocalPort  uint16
+	// InterfaceLUID is the local interface
+	InterfaceLUID uint64
+	// AppPath is the executable making the connection
+	AppPath string
+	// Loopback matches only traffic that stays on the machine
+	Loopback bool
+}
+
+// String implements fmt.Stringer, for the logs
+func (r Rule) String() string {
+	var conditions []string
+	if r.Remote.IsValid() {
+		conditions = append(conditions, "remote "+r.Remote.String())
+	}
+	if r.Protocol != ProtocolAny {
+		conditions = append(conditions, fmt.Sprintf("protocol %d", r.Protocol))
+	}
+	if r.RemotePort != 0 {
+		conditions = append(conditions, fmt.Sprintf("remote port %d", r.RemotePort))
+	}
+	if r.LocalPort != 0 {
+		conditions = append(conditions, fmt.Sprintf("local port %d", r.LocalPort))
+	}
+	if r.InterfaceLUID != 0 {
+		conditions = append(conditions, fmt.Sprintf("interface %#x", r.InterfaceLUID))
+	}
+	if r.AppPath != "" {
+		conditions = append(conditions, "app "+r.AppPath)
+	}
+	if r.Loopback {
+		conditions = append(conditions, "loopback")
+	}
+	if len(conditions) == 0 {
+		conditions = append(conditions, "all traffic")
+	}
+	return fmt.Sprintf("%s: %s %s", r.Name, r.Action, strings.Join(conditions, ", "))
+}
+
+// Input is what the rules are computed from
+type Input struct {
+	// AppPath is the executable of the tunnel service. Its own connections
+	// carry the tunnel, so they are always permitted.
+	AppPath string
+	// TunnelLUID is the tunnel interface, 0 until it is created
+	TunnelLUID uint64
+	// ControlPlane are the addresses of the Pangolin server, which every
+	// application may reach, so that the browser can sign in
+	ControlPlane []netip.AddrPort
+	// Proxy are the addresses of an explicit proxy
+	Proxy []netip.AddrPort
+	// DNSServers are the resolvers of the machine. Only they are reachable on
+	// the DNS port; with none, no DNS is allowed outside the tunnel.
+	DNSServers []netip.Addr
+	// Endpoints are the addresses allowed outside the tunnel
+	Endpoints []netip.Prefix
+	// AllowLAN permits the local network
+	AllowLAN bool
+}
+
+// lanPrefixes are the local network: the private, link-local, unique local
+// and multicast ranges, and the broadcast address
+var lanPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("255.255.255.255/32"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// ndpPrefixes are where IPv6 neighbor discovery and router advertisements
+// come from and go to
+var ndpPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff02::/16"),
+}
+
+// Rules computes the rules for in: the exceptions, then a rule that blocks
+// everything else. The result only depends on in.
+func Rules(in Input) []Rule {
+	rules := []Rule{
+		{Name: "loopback", Action: Permit, Direction: Both, Loopback: true},
+	}
+	if in.TunnelLUID != 0 {
+		rules = append(rules, Rule{Name: "tunnel", Action: Permit, Direction: Both, InterfaceLUID: in.TunnelLUID})
+	}
+	if in.AppPath != "" {
+		rules = append(rules, Rule{Name: "tunnel service", Action: Permit, Direction: Both, AppPath: in.AppPath})
+	}
+
+	for _, addrPort := range in.ControlPlane {
+		rules = append(rules, addrPortRule("control plane", addrPort))
+	}
+	for _, addrPort := range in.Proxy {
+		rules = append(rules, addrPortRule("proxy", addrPort))
+	}
+
+	// Getting an address and a route needs DHCP and, for IPv6, neighbor
+	// discovery, before the tunnel can come up
+	rules = append(rules,
+		Rule{Name: "DHCP", Action: Permit, Direction: Both, Protocol: ProtocolUDP, LocalPort: 68, RemotePort: 67},
+		Rule{Name: "DHCPv6", Action: Permit, Direction: Both, Protocol: ProtocolUDP, LocalPort: 546, RemotePort: 547},
+	)
+	for _, prefix := range ndpPrefixes {
+		rules = append(rules, Rule{Name: "neighbor discovery", Action: Permit, Direction: Both, Remote: prefix, Protocol: ProtocolICMPv6})
+	}
+
+	for _, server := range in.DNSServers {
+		remote := netip.PrefixFrom(server.Unmap(), server.Unmap().BitLen())
+		for _, protocol := range []Protocol{ProtocolUDP, ProtocolTCP} {
+			rules = append(rules, Rule{Name: "DNS", Action: Permit, Direction: Outbound, Remote: remote, Protocol: protocol, RemotePort: 53})
+		}
+	}
+
+	for _, prefix := range in.Endpoints {
+		rules = append(rules, Rule{Name: "allowed endpoint", Action: Permit, Direction: Outbound, Remote: prefix})
+	}
+	if in.AllowLAN {
+		for _, prefix := range lanPrefixes {
+			rules = append(rules, Rule{Name: "local network", Action: Permit, Direction: Both, Remote: prefix})
+		}
+	}
+
+	return append(rules, Rule{Name: "block", Action: Block, Direction: Both})
+}
+
+// addrPortRule permits TCP connections to addrPort
+func addrPortRule(name string, addrPort netip.AddrPort) Rule {
+	addr := addrPort.Addr().Unmap()
+	return Rule{
+		Name:       name,
+		Action:     Permit,
+		Direction:  Outbound,
+		Remote:     netip.PrefixFrom(addr, addr.BitLen()),
+		Protocol:   ProtocolTCP,
+		RemotePort: addrPort.Port(),
+	}
+}
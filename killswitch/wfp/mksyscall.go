@@ -0,0 +1,5 @@
+//go:build windows
+
+package wfp
+
+//go:generate go run golang.org/x/sys/windows/mkwinsyscall -output zsyscall_windows.go syscall_windows.go
@@ -0,0 +1,155 @@
+//go:build windows
+
+package wfp
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// The layouts are those of 64-bit Windows, the only architecture released
+
+const (
+	_RPC_C_AUTHN_WINNT = 10
+
+	_FWPM_PROVIDER_FLAG_PERSISTENT = 0x00000001
+	_FWPM_SUBLAYER_FLAG_PERSISTENT = 0x00000001
+	_FWPM_FILTER_FLAG_PERSISTENT   = 0x00000001
+
+	_FWP_UINT8          = 1
+	_FWP_UINT16         = 2
+	_FWP_UINT32         = 3
+	_FWP_UINT64         = 4
+	_FWP_BYTE_BLOB_TYPE = 12
+	_FWP_V4_ADDR_MASK   = 0x100
+	_FWP_V6_ADDR_MASK   = 0x101
+
+	_FWP_MATCH_EQUAL         = 0
+	_FWP_MATCH_FLAGS_ALL_SET = 6
+
+	_FWP_ACTION_BLOCK  = 0x1001
+	_FWP_ACTION_PERMIT = 0x1002
+
+	_FWP_CONDITION_FLAG_IS_LOOPBACK = 0x00000001
+)
+
+const (
+	_FWP_E_FILTER_NOT_FOUND   windows.Errno = 0x80320003
+	_FWP_E_PROVIDER_NOT_FOUND windows.Errno = 0x80320005
+	_FWP_E_SUBLAYER_NOT_FOUND windows.Errno = 0x80320007
+	_FWP_E_ALREADY_EXISTS     windows.Errno = 0x80320009
+)
+
+var (
+	_FWPM_LAYER_ALE_AUTH_CONNECT_V4     = windows.GUID{Data1: 0xc38d57d1, Data2: 0x05a7, Data3: 0x4c33, Data4: [8]byte{0x90, 0x4f, 0x7f, 0xbc, 0xee, 0xe6, 0x0e, 0x82}}
+	_FWPM_LAYER_ALE_AUTH_CONNECT_V6     = windows.GUID{Data1: 0x4a72393b, Data2: 0x319f, Data3: 0x44bc, Data4: [8]byte{0x84, 0xc3, 0xba, 0x54, 0xdc, 0xb3, 0xb6, 0xb4}}
+	_FWPM_LAYER_ALE_AUTH_RECV_ACCEPT_V4 = windows.GUID{Data1: 0xe1cd9fe7, Data2: 0xf4b5, Data3: 0x4273, Data4: [8]byte{0x96, 0xc0, 0x59, 0x2e, 0x48, 0x7b, 0x86, 0x50}}
+	_FWPM_LAYER_ALE_AUTH_RECV_ACCEPT_V6 = windows.GUID{Data1: 0xa3b42c97, Data2: 0x9f04, Data3: 0x4672, Data4: [8]byte{0xb8, 0x7e, 0xce, 0xe9, 0xc4, 0x83, 0x25, 0x7f}}
+
+	_FWPM_CONDITION_IP_REMOTE_ADDRESS  = windows.GUID{Data1: 0xb235ae9a, Data2: 0x1d64, Data3: 0x49b8, Data4: [8]byte{0xa4, 0x4c, 0x5f, 0xf3, 0xd9, 0x09, 0x50, 0x45}}
+	_FWPM_CONDITION_IP_PROTOCOL        = windows.GUID{Data1: 0x3971ef2b, Data2: 0x623e, Data3: 0x4f9a, Data4: [8]byte{0x8c, 0xb1, 0x6e, 0x79, 0xb8, 0x06, 0xb9, 0xa7}}
+	_FWPM_CONDITION_IP_REMOTE_PORT     = windows.GUID{Data1: 0xc35a604d, Data2: 0xd22b, Data3: 0x4e1a, Data4: [8]byte{0x91, 0xb4, 0x68, 0xf6, 0x74, 0xee, 0x67, 0x4b}}
+	_FWPM_CONDITION_IP_LOCAL_PORT      = windows.GUID{Data1: 0x0c1ba1af, Data2: 0x5765, Data3: 0x453f, Data4: [8]byte{0xaf, 0x22, 0xa8, 0xf7, 0x91, 0xac, 0x77, 0x5b}}
+	_FWPM_CONDITION_IP_LOCAL_INTERFACE = windows.GUID{Data1: 0x4cd62a49, Data2: 0x59c3, Data3: 0x4969, Data4: [8]byte{0xb7, 0xf3, 0xbd, 0xa5, 0xd3, 0x28, 0x90, 0xa4}}
+	_FWPM_CONDITION_ALE_APP_ID         = windows.GUID{Data1: 0xd78e1e87, Data2: 0x8644, Data3: 0x4ea5, Data4: [8]byte{0x94, 0x37, 0xd8, 0x09, 0xec, 0xef, 0xc9, 0x71}}
+	_FWPM_CONDITION_FLAGS              = windows.GUID{Data1: 0x632ce23b, Data2: 0x5167, Data3: 0x435c, Data4: [8]byte{0x86, 0xd7, 0xe9, 0x03, 0x68, 0x4a, 0xa8, 0x0c}}
+)
+
+type _FWP_BYTE_BLOB struct {
+	size uint32
+	data *uint8
+}
+
+type _FWPM_DISPLAY_DATA0 struct {
+	name        *uint16
+	description *uint16
+}
+
+type _FWPM_SESSION0 struct {
+	sessionKey           windows.GUID
+	displayData          _FWPM_DISPLAY_DATA0
+	flags                uint32
+	txnWaitTimeoutInMSec uint32
+	processId            uint32
+	sid                  *windows.SID
+	username             *uint16
+	kernelMode           int32
+}
+
+type _FWPM_PROVIDER0 struct {
+	providerKey  windows.GUID
+	displayData  _FWPM_DISPLAY_DATA0
+	flags        uint32
+	providerData _FWP_BYTE_BLOB
+	serviceName  *uint16
+}
+
+type _FWPM_SUBLAYER0 struct {
+	subLayerKey  windows.GUID
+	displayData  _FWPM_DISPLAY_DATA0
+	flags        uint32
+	providerKey  *windows.GUID
+	providerData _FWP_BYTE_BLOB
+	weight       uint16
+}
+
+// _FWP_VALUE0 is also FWP_CONDITION_VALUE0. The value is the union of the
+// scalars up to 32 bits and the pointers to the others.
+type _FWP_VALUE0 struct {
+	valueType uint32
+	value     uintptr
+}
+
+type _FWP_V4_ADDR_AND_MASK struct {
+	addr uint32
+	mask uint32
+}
+
+type _FWP_V6_ADDR_AND_MASK struct {
+	addr         [16]uint8
+	prefixLength uint8
+}
+
+type _FWPM_FILTER_CONDITION0 struct {
+	fieldKey       windows.GUID
+	matchType      uint32
+	conditionValue _FWP_VALUE0
+}
+
+type _FWPM_ACTION0 struct {
+	actionType uint32
+	filterType windows.GUID
+}
+
+type _FWPM_FILTER0 struct {
+	filterKey           windows.GUID
+	displayData         _FWPM_DISPLAY_DATA0
+	flags               uint32
+	providerKey         *windows.GUID
+	providerData        _FWP_BYTE_BLOB
+	layerKey            windows.GUID
+	subLayerKey         windows.GUID
+	weight              _FWP_VALUE0
+	numFilterConditions uint32
+	filterCondition     *_FWPM_FILTER_CONDITION0
+	action              _FWPM_ACTION0
+	providerContextKey  windows.GUID
+	reserved            *windows.GUID
+	filterId            uint64
+	effectiveWeight     _FWP_VALUE0
+}
+
+//sys	fwpmEngineOpen0(serverName *uint16, authnService uint32, authIdentity uintptr, session *_FWPM_SESSION0, engineHandle *windows.Handle) (ret error) = fwpuclnt.FwpmEngineOpen0
+//sys	fwpmEngineClose0(engineHandle windows.Handle) (ret error) = fwpuclnt.FwpmEngineClose0
+//sys	fwpmTransactionBegin0(engineHandle windows.Handle, flags uint32) (ret error) = fwpuclnt.FwpmTransactionBegin0
+//sys	fwpmTransactionCommit0(engineHandle windows.Handle) (ret error) = fwpuclnt.FwpmTransactionCommit0
+//sys	fwpmTransactionAbort0(engineHandle windows.Handle) (ret error) = fwpuclnt.FwpmTransactionAbort0
+//sys	fwpmProviderAdd0(engineHandle windows.Handle, provider *_FWPM_PROVIDER0, sd uintptr) (ret error) = fwpuclnt.FwpmProviderAdd0
+//sys	fwpmProviderDeleteByKey0(engineHandle windows.Handle, key *windows.GUID) (ret error) = fwpuclnt.FwpmProviderDeleteByKey0
+//sys	fwpmSubLayerAdd0(engineHandle windows.Handle, subLayer *_FWPM_SUBLAYER0, sd uintptr) (ret error) = fwpuclnt.FwpmSubLayerAdd0
+//sys	fwpmSubLayerDeleteByKey0(engineHandle windows.Handle, key *windows.GUID) (ret error) = fwpuclnt.FwpmSubLayerDeleteByKey0
+//sys	fwpmSubLayerGetByKey0(engineHandle windows.Handle, key *windows.GUID, subLayer **_FWPM_SUBLAYER0) (ret error) = fwpuclnt.FwpmSubLayerGetByKey0
+//sys	fwpmFilterAdd0(engineHandle windows.Handle, filter *_FWPM_FILTER0, sd uintptr, id *uint64) (ret error) = fwpuclnt.FwpmFilterAdd0
+//sys	fwpmFilterDeleteByKey0(engineHandle windows.Handle, key *windows.GUID) (ret error) = fwpuclnt.FwpmFilterDeleteByKey0
+//sys	fwpmFilterGetByKey0(engineHandle windows.Handle, key *windows.GUID, filter **_FWPM_FILTER0) (ret error) = fwpuclnt.FwpmFilterGetByKey0
+//sys	fwpmGetAppIdFromFileName0(fileName *uint16, appId **_FWP_BYTE_BLOB) (ret error) = fwpuclnt.FwpmGetAppIdFromFileName0
+//sys	fwpmFreeMemory0(p unsafe.Pointer) = fwpuclnt.FwpmFreeMemory0
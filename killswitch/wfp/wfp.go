@@ -0,0 +1,349 @@
+//go:build windows
+
+// Package wfp puts the rules of the kill switch in force with the Windows
+// Filtering Platform.
+//
+// The provider, sublayer and filters are persistent: they outlive the
+// process that added them, so a crash of the tunnel service leaves the
+// traffic blocked rather than let it out. They have fixed keys, so that
+// Remove takes them away from any process, including the one that starts
+// after a crash.
+package wfp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/fosrl/windows/killswitch"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// permitWeight and blockWeight order the filters in the sublayer, so
+	// that the exceptions win over the catch-all block
+	permitWeight = 15
+	blockWeight  = 0
+)
+
+var (
+	providerKey = windows.GUID{Data1: 0x59fc0876, Data2: 0x547f, Data3: 0x4aab, Data4: [8]byte{0xb2, 0x9b, 0x3a, 0x88, 0x78, 0x92, 0x5b, 0xac}}
+	subLayerKey = windows.GUID{Data1: 0x33a1fa1c, Data2: 0x2d95, Data3: 0x4683, Data4: [8]byte{0x99, 0xc2, 0xac, 0x34, 0xe6, 0xed, 0xe6, 0xda}}
+	// filterKeyBase is the key of the first filter; the others count up in
+	// its last four bytes
+	filterKeyBase = windows.GUID{Data1: 0x36487310, Data2: 0x8dd3, Data3: 0x4928, Data4: [8]byte{0x91, 0xc8, 0xb8, 0xbb, 0x00, 0x00, 0x00, 0x00}}
+)
+
+// filterKey returns the key of the filter at index i. The filters in force
+// always have the keys from index 0 up, with no gaps.
+func filterKey(i int) windows.GUID {
+	key := filterKeyBase
+	binary.BigEndian.PutUint32(key.Data4[4:], uint32(i))
+	return key
+}
+
+// Firewall is a killswitch.Firewall
+type Firewall struct {
+	name string
+
+	mu     sync.Mutex
+	engine windows.Handle
+}
+
+// New creates a firewall whose filters are named after name
+func New(name string) *Firewall {
+	return &Firewall{name: name}
+}
+
+// Apply implements killswitch.Firewall in a single transaction. It replaces
+// the filters in force, whichever process added them.
+func (f *Firewall) Apply(rules []killswitch.Rule) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			fwpmTransactionAbort0(f.engine)
+		}
+	}()
+
+	if err := f.addProvider(); err != nil {
+		return err
+	}
+	if err := f.deleteFilters(); err != nil {
+		return err
+	}
+
+	appIDs := make(map[string]*_FWP_BYTE_BLOB)
+	defer func() {
+		for _, appID := range appIDs {
+			fwpmFreeMemory0(unsafe.Pointer(&appID))
+		}
+	}()
+
+	count := 0
+	for _, rule := range rules {
+		n, err := f.addRule(rule, count, appIDs)
+		if err != nil {
+			return fmt.Errorf("failed to add rule %q: %w", rule.Name, err)
+		}
+		count += n
+	}
+
+	if err := fwpmTransactionCommit0(f.engine); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Remove implements killswitch.Firewall. It deletes the filters, sublayer
+// and provider whichever process added them, and closes the session.
+func (f *Firewall) Remove() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			fwpmTransactionAbort0(f.engine)
+		}
+		if closeErr := fwpmEngineClose0(f.engine); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close filtering session: %w", closeErr)
+		}
+		f.engine = 0
+	}()
+
+	if err := f.deleteFilters(); err != nil {
+		return err
+	}
+	if err := fwpmSubLayerDeleteByKey0(f.engine, &subLayerKey); err != nil && !errors.Is(err, _FWP_E_SUBLAYER_NOT_FOUND) {
+		return fmt.Errorf("failed to delete sublayer: %w", err)
+	}
+	if err := fwpmProviderDeleteByKey0(f.engine, &providerKey); err != nil && !errors.Is(err, _FWP_E_PROVIDER_NOT_FOUND) {
+		return fmt.Errorf("failed to delete provider: %w", err)
+	}
+
+	if err := fwpmTransactionCommit0(f.engine); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// begin opens a session if there is none, and begins a transaction in it
+func (f *Firewall) begin() error {
+	if f.engine == 0 {
+		name, err := windows.UTF16PtrFromString(f.name)
+		if err != nil {
+			return err
+		}
+		// Not a dynamic session: its objects would go with it
+		session := _FWPM_SESSION0{
+			displayData:          _FWPM_DISPLAY_DATA0{name: name},
+			txnWaitTimeoutInMSec: windows.INFINITE,
+		}
+		if err := fwpmEngineOpen0(nil, _RPC_C_AUTHN_WINNT, 0, &session, &f.engine); err != nil {
+			return fmt.Errorf("failed to open filtering session: %w", err)
+		}
+	}
+	if err := fwpmTransactionBegin0(f.engine, 0); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return nil
+}
+
+// addProvider adds the provider and sublayer of the filters, unless they
+// are there already
+func (f *Firewall) addProvider() error {
+	name, err := windows.UTF16PtrFromString(f.name)
+	if err != nil {
+		return err
+	}
+	provider := _FWPM_PROVIDER0{
+		providerKey: providerKey,
+		displayData: _FWPM_DISPLAY_DATA0{name: name},
+		flags:       _FWPM_PROVIDER_FLAG_PERSISTENT,
+	}
+	if err := fwpmProviderAdd0(f.engine, &provider, 0); err != nil && !errors.Is(err, _FWP_E_ALREADY_EXISTS) {
+		return fmt.Errorf("failed to add provider: %w", err)
+	}
+	subLayer := _FWPM_SUBLAYER0{
+		subLayerKey: subLayerKey,
+		displayData: _FWPM_DISPLAY_DATA0{name: name},
+		flags:       _FWPM_SUBLAYER_FLAG_PERSISTENT,
+		providerKey: &providerKey,
+		weight:      ^uint16(0),
+	}
+	if err := fwpmSubLayerAdd0(f.engine, &subLayer, 0); err != nil && !errors.Is(err, _FWP_E_ALREADY_EXISTS) {
+		return fmt.Errorf("failed to add sublayer: %w", err)
+	}
+	return nil
+}
+
+// deleteFilters deletes the filters in force, up to the first key missing
+func (f *Firewall) deleteFilters() error {
+	for i := 0; ; i++ {
+		key := filterKey(i)
+		err := fwpmFilterDeleteByKey0(f.engine, &key)
+		if errors.Is(err, _FWP_E_FILTER_NOT_FOUND) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete filter %d: %w", i, err)
+		}
+	}
+}
+
+// addRule adds the filters of rule, one per layer it applies to, with the
+// keys from index first up. It returns the number of filters added.
+func (f *Firewall) addRule(rule killswitch.Rule, first int, appIDs map[string]*_FWP_BYTE_BLOB) (int, error) {
+	count := 0
+	for _, layer := range layers(rule) {
+		c := conditions{}
+		if rule.Remote.IsValid() {
+			c.remote(rule.Remote.Addr().As16(), rule.Remote.Bits(), rule.Remote.Addr().Is4())
+		}
+		if rule.Protocol != killswitch.ProtocolAny {
+			c.add(_FWPM_CONDITION_IP_PROTOCOL, _FWP_MATCH_EQUAL, _FWP_UINT8, uintptr(rule.Protocol))
+		}
+		if rule.RemotePort != 0 {
+			c.add(_FWPM_CONDITION_IP_REMOTE_PORT, _FWP_MATCH_EQUAL, _FWP_UINT16, uintptr(rule.RemotePort))
+		}
+		if rule.LocalPort != 0 {
+			c.add(_FWPM_CONDITION_IP_LOCAL_PORT, _FWP_MATCH_EQUAL, _FWP_UINT16, uintptr(rule.LocalPort))
+		}
+		if rule.InterfaceLUID != 0 {
+			luid := rule.InterfaceLUID
+			c.pin(&luid)
+			c.add(_FWPM_CONDITION_IP_LOCAL_INTERFACE, _FWP_MATCH_EQUAL, _FWP_UINT64, uintptr(unsafe.Pointer(&luid)))
+		}
+		if rule.AppPath != "" {
+			appID, err := appIDFor(rule.AppPath, appIDs)
+			if err != nil {
+				return count, err
+			}
+			c.add(_FWPM_CONDITION_ALE_APP_ID, _FWP_MATCH_EQUAL, _FWP_BYTE_BLOB_TYPE, uintptr(unsafe.Pointer(appID)))
+		}
+		if rule.Loopback {
+			c.add(_FWPM_CONDITION_FLAGS, _FWP_MATCH_FLAGS_ALL_SET, _FWP_UINT32, _FWP_CONDITION_FLAG_IS_LOOPBACK)
+		}
+
+		name, err := windows.UTF16PtrFromString(f.name + ": " + rule.Name)
+		if err != nil {
+			return count, err
+		}
+		filter := _FWPM_FILTER0{
+			filterKey:           filterKey(first + count),
+			displayData:         _FWPM_DISPLAY_DATA0{name: name},
+			flags:               _FWPM_FILTER_FLAG_PERSISTENT,
+			providerKey:         &providerKey,
+			layerKey:            layer,
+			subLayerKey:         subLayerKey,
+			weight:              _FWP_VALUE0{valueType: _FWP_UINT8, value: blockWeight},
+			numFilterConditions: uint32(len(c.list)),
+			action:              _FWPM_ACTION0{actionType: _FWP_ACTION_BLOCK},
+		}
+		if rule.Action == killswitch.Permit {
+			filter.weight.value = permitWeight
+			filter.action.actionType = _FWP_ACTION_PERMIT
+		}
+		if len(c.list) > 0 {
+			filter.filterCondition = &c.list[0]
+		}
+
+		var id uint64
+		err = fwpmFilterAdd0(f.engine, &filter, 0, &id)
+		runtime.KeepAlive(c.pinned)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// layers returns the layers of the directions and address families of rule
+func layers(rule killswitch.Rule) []windows.GUID {
+	v4 := !rule.Remote.IsValid() || rule.Remote.Addr().Is4()
+	v6 := !rule.Remote.IsValid() || rule.Remote.Addr().Is6()
+	var result []windows.GUID
+	if rule.Direction&killswitch.Outbound != 0 {
+		if v4 {
+			result = append(result, _FWPM_LAYER_ALE_AUTH_CONNECT_V4)
+		}
+		if v6 {
+			result = append(result, _FWPM_LAYER_ALE_AUTH_CONNECT_V6)
+		}
+	}
+	if rule.Direction&killswitch.Inbound != 0 {
+		if v4 {
+			result = append(result, _FWPM_LAYER_ALE_AUTH_RECV_ACCEPT_V4)
+		}
+		if v6 {
+			result = append(result, _FWPM_LAYER_ALE_AUTH_RECV_ACCEPT_V6)
+		}
+	}
+	return result
+}
+
+// appIDFor returns the app ID of path, which appIDs keeps until it is freed
+func appIDFor(path string, appIDs map[string]*_FWP_BYTE_BLOB) (*_FWP_BYTE_BLOB, error) {
+	if appID, ok := appIDs[path]; ok {
+		return appID, nil
+	}
+	path16, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var appID *_FWP_BYTE_BLOB
+	if err := fwpmGetAppIdFromFileName0(path16, &appID); err != nil {
+		return nil, fmt.Errorf("failed to get the app ID of %s: %w", path, err)
+	}
+	appIDs[path] = appID
+	return appID, nil
+}
+
+// conditions builds the conditions of a filter, keeping the values they
+// point to alive until the filter is added
+type conditions struct {
+	list   []_FWPM_FILTER_CONDITION0
+	pinned []any
+}
+
+func (c *conditions) add(field windows.GUID, match, valueType uint32, value uintptr) {
+	c.list = append(c.list, _FWPM_FILTER_CONDITION0{
+		fieldKey:       field,
+		matchType:      match,
+		conditionValue: _FWP_VALUE0{valueType: valueType, value: value},
+	})
+}
+
+func (c *conditions) pin(value any) {
+	c.pinned = append(c.pinned, value)
+}
+
+// remote adds the condition on the remote address range
+func (c *conditions) remote(addr [16]byte, bits int, is4 bool) {
+	if is4 {
+		mask := &_FWP_V4_ADDR_AND_MASK{
+			addr: binary.BigEndian.Uint32(addr[12:]),
+			mask: ^uint32(0) << (32 - bits),
+		}
+		if bits == 0 {
+			mask.mask = 0
+		}
+		c.pin(mask)
+		c.add(_FWPM_CONDITION_IP_REMOTE_ADDRESS, _FWP_MATCH_EQUAL, _FWP_V4_ADDR_MASK, uintptr(unsafe.Pointer(mask)))
+		return
+	}
+	mask := &_FWP_V6_ADDR_AND_MASK{addr: addr, prefixLength: uint8(bits)}
+	c.pin(mask)
+	c.add(_FWPM_CONDITION_IP_REMOTE_ADDRESS, _FWP_MATCH_EQUAL, _FWP_V6_ADDR_MASK, uintptr(unsafe.Pointer(mask)))
+}
@@ -0,0 +1,113 @@
+//go:build windows
+
+package wfp
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"unsafe"
+
+	"github.com/fosrl/windows/killswitch"
+	"golang.org/x/sys/windows"
+)
+
+func TestFilterKey(t *testing.T) {
+	if filterKey(0) != filterKeyBase {
+		t.Errorf("filterKey(0) = %v, want %v", filterKey(0), filterKeyBase)
+	}
+	seen := make(map[windows.GUID]int)
+	for i := range 1000 {
+		key := filterKey(i)
+		if j, ok := seen[key]; ok {
+			t.Fatalf("filterKey(%d) = filterKey(%d) = %v", i, j, key)
+		}
+		seen[key] = i
+		if key.Data1 != filterKeyBase.Data1 || key.Data2 != filterKeyBase.Data2 || key.Data3 != filterKeyBase.Data3 {
+			t.Fatalf("filterKey(%d) = %v, not derived from %v", i, key, filterKeyBase)
+		}
+	}
+}
+
+// exists reports which of the filters at indexes 0 to n-1, and whether the
+// sublayer, are in force
+func exists(t *testing.T, n int) (filters []bool, subLayer bool) {
+	t.Helper()
+	var engine windows.Handle
+	if err := fwpmEngineOpen0(nil, _RPC_C_AUTHN_WINNT, 0, &_FWPM_SESSION0{}, &engine); err != nil {
+		t.Fatalf("failed to open filtering session: %v", err)
+	}
+	defer fwpmEngineClose0(engine)
+
+	for i := range n {
+		key := filterKey(i)
+		var filter *_FWPM_FILTER0
+		err := fwpmFilterGetByKey0(engine, &key, &filter)
+		if err != nil && !errors.Is(err, _FWP_E_FILTER_NOT_FOUND) {
+			t.Fatalf("failed to get filter %d: %v", i, err)
+		}
+		if err == nil {
+			fwpmFreeMemory0(unsafe.Pointer(&filter))
+		}
+		filters = append(filters, err == nil)
+	}
+	var sl *_FWPM_SUBLAYER0
+	err := fwpmSubLayerGetByKey0(engine, &subLayerKey, &sl)
+	if err != nil && !errors.Is(err, _FWP_E_SUBLAYER_NOT_FOUND) {
+		t.Fatalf("failed to get sublayer: %v", err)
+	}
+	if err == nil {
+		fwpmFreeMemory0(unsafe.Pointer(&sl))
+	}
+	return filters, err == nil
+}
+
+func TestRemoveAfterCrash(t *testing.T) {
+	if !windows.GetCurrentProcessToken().IsElevated() {
+		t.Skip("the filtering platform needs an elevated process")
+	}
+	// Blocks a range reserved for documentation only, in both directions:
+	// two filters
+	rules := []killswitch.Rule{{
+		Name:      "test",
+		Action:    killswitch.Block,
+		Direction: killswitch.Outbound | killswitch.Inbound,
+		Remote:    netip.MustParsePrefix("192.0.2.0/24"),
+	}}
+	t.Cleanup(func() { New("Pangolin kill switch test").Remove() })
+
+	crashed := New("Pangolin kill switch test")
+	if err := crashed.Apply(rules); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	// Closing the session without Remove is what a crash does
+	if err := fwpmEngineClose0(crashed.engine); err != nil {
+		t.Fatal(err)
+	}
+	filters, subLayer := exists(t, 3)
+	if !filters[0] || !filters[1] || filters[2] || !subLayer {
+		t.Fatalf("after a crash: filters %v and sublayer %v, want the two filters and the sublayer", filters, subLayer)
+	}
+
+	// The next service replaces them, then removes them on stop
+	restarted := New("Pangolin kill switch test")
+	rules[0].Direction = killswitch.Outbound
+	if err := restarted.Apply(rules); err != nil {
+		t.Fatalf("Apply after a crash: %v", err)
+	}
+	if filters, _ := exists(t, 2); !filters[0] || filters[1] {
+		t.Errorf("after Apply: filters %v, want only the first", filters)
+	}
+	if err := restarted.Remove(); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if filters, subLayer := exists(t, 2); filters[0] || filters[1] || subLayer {
+		t.Errorf("after Remove: filters %v and sublayer %v, want none", filters, subLayer)
+	}
+
+	// Removing again, as a service that starts without a kill switch does,
+	// finds nothing to remove
+	if err := New("Pangolin kill switch test").Remove(); err != nil {
+		t.Errorf("Remove with nothing in force: %v", err)
+	}
+}
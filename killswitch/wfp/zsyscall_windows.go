@@ -0,0 +1,175 @@
+// Code generated by 'go generate'; DO NOT EDIT.
+
+package wfp
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var _ unsafe.Pointer
+
+// Do the interface allocations only once for common
+// Errno values.
+const (
+	errnoERROR_IO_PENDING = 997
+)
+
+var (
+	errERROR_IO_PENDING error = syscall.Errno(errnoERROR_IO_PENDING)
+	errERROR_EINVAL     error = syscall.EINVAL
+)
+
+// errnoErr returns common boxed Errno values, to prevent
+// allocations at runtime.
+func errnoErr(e syscall.Errno) error {
+	switch e {
+	case 0:
+		return errERROR_EINVAL
+	case errnoERROR_IO_PENDING:
+		return errERROR_IO_PENDING
+	}
+	// TODO: add more here, after collecting data on the common
+	// error values see on Windows. (perhaps when running
+	// all.bat?)
+	return e
+}
+
+var (
+	modfwpuclnt = windows.NewLazySystemDLL("fwpuclnt.dll")
+
+	procFwpmEngineClose0          = modfwpuclnt.NewProc("FwpmEngineClose0")
+	procFwpmEngineOpen0           = modfwpuclnt.NewProc("FwpmEngineOpen0")
+	procFwpmFilterAdd0            = modfwpuclnt.NewProc("FwpmFilterAdd0")
+	procFwpmFilterDeleteByKey0    = modfwpuclnt.NewProc("FwpmFilterDeleteByKey0")
+	procFwpmFilterGetByKey0       = modfwpuclnt.NewProc("FwpmFilterGetByKey0")
+	procFwpmFreeMemory0           = modfwpuclnt.NewProc("FwpmFreeMemory0")
+	procFwpmGetAppIdFromFileName0 = modfwpuclnt.NewProc("FwpmGetAppIdFromFileName0")
+	procFwpmProviderAdd0          = modfwpuclnt.NewProc("FwpmProviderAdd0")
+	procFwpmProviderDeleteByKey0  = modfwpuclnt.NewProc("FwpmProviderDeleteByKey0")
+	procFwpmSubLayerAdd0          = modfwpuclnt.NewProc("FwpmSubLayerAdd0")
+	procFwpmSubLayerDeleteByKey0  = modfwpuclnt.NewProc("FwpmSubLayerDeleteByKey0")
+	procFwpmSubLayerGetByKey0     = modfwpuclnt.NewProc("FwpmSubLayerGetByKey0")
+	procFwpmTransactionAbort0     = modfwpuclnt.NewProc("FwpmTransactionAbort0")
+	procFwpmTransactionBegin0     = modfwpuclnt.NewProc("FwpmTransactionBegin0")
+	procFwpmTransactionCommit0    = modfwpuclnt.NewProc("FwpmTransactionCommit0")
+)
+
+func fwpmEngineClose0(engineHandle windows.Handle) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmEngineClose0.Addr(), uintptr(engineHandle))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmEngineOpen0(serverName *uint16, authnService uint32, authIdentity uintptr, session *_FWPM_SESSION0, engineHandle *windows.Handle) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmEngineOpen0.Addr(), uintptr(unsafe.Pointer(serverName)), uintptr(authnService), uintptr(authIdentity), uintptr(unsafe.Pointer(session)), uintptr(unsafe.Pointer(engineHandle)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmFilterAdd0(engineHandle windows.Handle, filter *_FWPM_FILTER0, sd uintptr, id *uint64) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmFilterAdd0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(filter)), uintptr(sd), uintptr(unsafe.Pointer(id)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmFilterDeleteByKey0(engineHandle windows.Handle, key *windows.GUID) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmFilterDeleteByKey0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(key)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmFilterGetByKey0(engineHandle windows.Handle, key *windows.GUID, filter **_FWPM_FILTER0) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmFilterGetByKey0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(key)), uintptr(unsafe.Pointer(filter)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmFreeMemory0(p unsafe.Pointer) {
+	syscall.SyscallN(procFwpmFreeMemory0.Addr(), uintptr(p))
+	return
+}
+
+func fwpmGetAppIdFromFileName0(fileName *uint16, appId **_FWP_BYTE_BLOB) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmGetAppIdFromFileName0.Addr(), uintptr(unsafe.Pointer(fileName)), uintptr(unsafe.Pointer(appId)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmProviderAdd0(engineHandle windows.Handle, provider *_FWPM_PROVIDER0, sd uintptr) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmProviderAdd0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(provider)), uintptr(sd))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmProviderDeleteByKey0(engineHandle windows.Handle, key *windows.GUID) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmProviderDeleteByKey0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(key)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmSubLayerAdd0(engineHandle windows.Handle, subLayer *_FWPM_SUBLAYER0, sd uintptr) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmSubLayerAdd0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(subLayer)), uintptr(sd))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmSubLayerDeleteByKey0(engineHandle windows.Handle, key *windows.GUID) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmSubLayerDeleteByKey0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(key)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmSubLayerGetByKey0(engineHandle windows.Handle, key *windows.GUID, subLayer **_FWPM_SUBLAYER0) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmSubLayerGetByKey0.Addr(), uintptr(engineHandle), uintptr(unsafe.Pointer(key)), uintptr(unsafe.Pointer(subLayer)))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmTransactionAbort0(engineHandle windows.Handle) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmTransactionAbort0.Addr(), uintptr(engineHandle))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmTransactionBegin0(engineHandle windows.Handle, flags uint32) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmTransactionBegin0.Addr(), uintptr(engineHandle), uintptr(flags))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
+
+func fwpmTransactionCommit0(engineHandle windows.Handle) (ret error) {
+	r0, _, _ := syscall.SyscallN(procFwpmTransactionCommit0.Addr(), uintptr(engineHandle))
+	if r0 != 0 {
+		ret = syscall.Errno(r0)
+	}
+	return
+}
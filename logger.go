@@ -3,44 +3,35 @@
 package main
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/logging"
 
 	"github.com/fosrl/newt/logger"
 )
 
-// stringToLogLevel converts a string log level to logger.LogLevel
-// Returns INFO as default if the string doesn't match any known level
-func stringToLogLevel(levelStr string) logger.LogLevel {
-	switch strings.ToUpper(levelStr) {
-	case "debug":
-		return logger.DEBUG
-	case "info":
-		return logger.INFO
-	case "warn":
-		return logger.WARN
-	case "error":
-		return logger.ERROR
-	case "fatal":
-		return logger.FATAL
-	default:
-		return logger.DEBUG // Default to INFO if unknown
-	}
-}
-
 // setupLogging initializes the logger and sets up log file output with rotation
 func setupLogging() {
-	// Initialize the logger and set log level FIRST, before any logging calls
-	logInstance := logger.GetLogger()
-
-	// Set the log level from centralized config immediately
-	logLevel := stringToLogLevel(config.LogLevel)
-	logInstance.SetLevel(logLevel)
+	// Install the log backend FIRST, before any logging calls
+	defaultLevel, _ := logging.ParseLevel(config.DefaultLogLevel)
+	logging.Init(os.Stdout, defaultLevel, logging.FormatText)
+
+	// Apply the persisted log settings
+	configManager := config.NewConfigManager()
+	settings := logging.Settings{
+		Level:      configManager.GetLogLevel(),
+		Format:     configManager.GetLogFormat(),
+		Components: configManager.GetComponentLogLevels(),
+	}
+	if err := logging.Configure(settings); err != nil {
+		logger.Error("Invalid log settings, using defaults: %v", err)
+	}
+	if err := logging.SetRedactionPatterns(configManager.GetRedactPatterns()); err != nil {
+		logger.Error("Ignoring redaction patterns: %v", err)
+	}
 
 	// Create log directory if it doesn't exist
 	logDir := config.GetLogDir()
@@ -52,78 +43,28 @@ func setupLogging() {
 
 	logFile := filepath.Join(logDir, "pangolin.log")
 
-	// Rotate log file if needed
-	err = rotateLogFile(logDir, logFile)
-	if err != nil {
-		logger.Error("Failed to rotate log file: %v", err)
-		// Continue anyway to create new log file
-	}
-
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	// Open the log file, rotating it by size and by day
+	writer, err := logging.NewRotatingWriter(logFile, logRotationPolicy(configManager))
 	if err != nil {
 		logger.Error("Failed to open log file: %v", err)
 		return
 	}
 
 	// Set the custom logger output
-	logInstance.SetOutput(file)
-
-	logger.Info("Pangolin logging initialized - log file: %s, log level: %s", logFile, config.LogLevel)
-}
-
-// rotateLogFile handles daily log rotation
-func rotateLogFile(logDir string, logFile string) error {
-	// Get current log file info
-	info, err := os.Stat(logFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // No current log file to rotate
-		}
-		return fmt.Errorf("failed to stat log file: %v", err)
-	}
+	logging.SetOutput(writer)
 
-	// Check if log file is from today
-	now := time.Now()
-	fileTime := info.ModTime()
-
-	// If the log file is from today, no rotation needed
-	if now.Year() == fileTime.Year() && now.YearDay() == fileTime.YearDay() {
-		return nil
-	}
-
-	// Create rotated filename with date
-	rotatedName := fmt.Sprintf("pangolin-%s.log", fileTime.Format("2006-01-02"))
-	rotatedPath := filepath.Join(logDir, rotatedName)
-
-	// Rename current log file to dated filename
-	err = os.Rename(logFile, rotatedPath)
-	if err != nil {
-		return fmt.Errorf("failed to rotate log file: %v", err)
-	}
-
-	// Clean up old log files (keep last 30 days)
-	cleanupOldLogFiles(logDir, 30)
-	return nil
+	current := logging.CurrentSettings()
+	logger.Info("Pangolin logging initialized - log file: %s, log level: %s, format: %s, component levels: %v", logFile, current.Level, current.Format, current.Components)
 }
 
-// cleanupOldLogFiles removes log files older than specified days
-func cleanupOldLogFiles(logDir string, daysToKeep int) {
-	cutoff := time.Now().AddDate(0, 0, -daysToKeep)
-	files, err := os.ReadDir(logDir)
-	if err != nil {
-		return
-	}
-
-	for _, file := range files {
-		if !file.IsDir() && strings.HasPrefix(file.Name(), "pangolin-") && strings.HasSuffix(file.Name(), ".log") {
-			filePath := filepath.Join(logDir, file.Name())
-			info, err := file.Info()
-			if err != nil {
-				continue
-			}
-			if info.ModTime().Before(cutoff) {
-				os.Remove(filePath)
-			}
-		}
+// logRotationPolicy builds the log rotation policy from config
+func logRotationPolicy(configManager *config.ConfigManager) logging.RotationPolicy {
+	const mb = 1024 * 1024
+	return logging.RotationPolicy{
+		MaxSize:      int64(configManager.GetLogMaxSizeMB()) * mb,
+		Daily:        true,
+		Compress:     configManager.GetLogCompress(),
+		MaxAge:       time.Duration(configManager.GetLogMaxAgeDays()) * 24 * time.Hour,
+		MaxTotalSize: int64(configManager.GetLogMaxTotalSizeMB()) * mb,
 	}
 }
@@ -0,0 +1,388 @@
+// Package logging is the log backend shared by every Pangolin process. It
+// plugs into the newt logger used throughout the code base, adds
+// per-component loggers with their own levels, and writes either the
+// classic text format or JSON lines.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+)
+
+// Components with their own logger.
+const (
+	ComponentAPI     = "api"
+	ComponentAuth    = "auth"
+	ComponentTunnel  = "tunnel"
+	ComponentUpdater = "updater"
+	ComponentIPC     = "ipc"
+)
+
+// Components lists every component that has its own logger.
+var Components = []string{ComponentAPI, ComponentAuth, ComponentTunnel, ComponentUpdater, ComponentIPC}
+
+// Format is the on-disk log format.
+type Format int
+
+const (
+	// FormatText writes "LEVEL: 2006/01/02 15:04:05 [component] message".
+	FormatText Format = iota
+	// FormatJSON writes one JSON object per line.
+	FormatJSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatText:
+		return "text"
+	case FormatJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// ParseFormat converts "text" or "json" to a Format.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format: %q", s)
+	}
+}
+
+// ParseLevel converts a level name such as "debug" or "WARN" to a
+// logger.LogLevel.
+func ParseLevel(s string) (logger.LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return logger.DEBUG, nil
+	case "info":
+		return logger.INFO, nil
+	case "warn", "warning":
+		return logger.WARN, nil
+	case "error":
+		return logger.ERROR, nil
+	case "fatal":
+		return logger.FATAL, nil
+	default:
+		return logger.INFO, fmt.Errorf("unknown log level: %q", s)
+	}
+}
+
+// LevelName returns the lower case name of level, as stored in config.
+func LevelName(level logger.LogLevel) string {
+	return strings.ToLower(level.String())
+}
+
+// Record is a single parsed log entry.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Component string    `json:"component,omitempty"`
+	Message   string    `json:"msg"`
+}
+
+// Writer is a logger.LogWriter that filters by component level and formats
+// records as text or JSON lines.
+type Writer struct {
+	mu       sync.Mutex
+	out      io.Writer
+	format   Format
+	level    logger.LogLevel
+	levels   map[string]logger.LogLevel
+	timezone *time.Location
+}
+
+var root = &Writer{
+	out:      os.Stdout,
+	level:    logger.INFO,
+	levels:   make(map[string]logger.LogLevel),
+	timezone: time.Local,
+}
+
+// Init installs the shared writer as the backend of the newt logger. It must
+// be called before anything is logged.
+func Init(out io.Writer, level logger.LogLevel, format Format) {
+	root.mu.Lock()
+	root.out = out
+	root.level = level
+	root.format = format
+	root.mu.Unlock()
+	logger.Init(logger.NewLoggerWithWriter(root))
+	root.syncLoggerLevel()
+}
+
+// SetOutput replaces the destination of all log output.
+func SetOutput(out io.Writer) {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.out = out
+}
+
+// SetFormat changes the output format.
+func SetFormat(format Format) {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.format = format
+}
+
+// GetFormat returns the output format.
+func GetFormat() Format {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	return root.format
+}
+
+// SetLevel changes the level of messages that do not belong to a component
+// with its own level.
+func SetLevel(level logger.LogLevel) {
+	root.mu.Lock()
+	root.level = level
+	root.mu.Unlock()
+	root.syncLoggerLevel()
+}
+
+// GetLevel returns the default level.
+func GetLevel() logger.LogLevel {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	return root.level
+}
+
+// SetComponentLevel overrides the level of one component.
+func SetComponentLevel(component string, level logger.LogLevel) {
+	root.mu.Lock()
+	root.levels[component] = level
+	root.mu.Unlock()
+	root.syncLoggerLevel()
+}
+
+// ClearComponentLevel makes a component follow the default level again.
+func ClearComponentLevel(component string) {
+	root.mu.Lock()
+	delete(root.levels, component)
+	root.mu.Unlock()
+	root.syncLoggerLevel()
+}
+
+// ComponentLevels returns the components with their own level.
+func ComponentLevels() map[string]logger.LogLevel {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	levels := make(map[string]logger.LogLevel, len(root.levels))
+	for component, level := range root.levels {
+		levels[component] = level
+	}
+	return levels
+}
+
+// syncLoggerLevel lowers the newt logger's level to the most verbose level
+// in use, so that it does not drop messages a component wants; the writer
+// does the actual filtering.
+func (w *Writer) syncLoggerLevel() {
+	w.mu.Lock()
+	minLevel := w.level
+	for _, level := range w.levels {
+		if level < minLevel {
+			minLevel = level
+		}
+	}
+	w.mu.Unlock()
+	logger.GetLogger().SetLevel(minLevel)
+}
+
+// Write implements logger.LogWriter for messages logged through the newt
+// logger directly.
+func (w *Writer) Write(level logger.LogLevel, timestamp time.Time, message string) {
+	w.write("", level, timestamp, message)
+}
+
+func (w *Writer) enabled(component string, level logger.LogLevel) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enabledLocked(component, level)
+}
+
+func (w *Writer) enabledLocked(component string, level logger.LogLevel) bool {
+	minLevel, ok := w.levels[component]
+	if !ok {
+		minLevel = w.level
+	}
+	return level >= minLevel
+}
+
+func (w *Writer) write(component string, level logger.LogLevel, timestamp time.Time, message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.enabledLocked(component, level) {
+		return
+	}
+	timestamp = timestamp.In(w.timezone)
+	message = Redact(message)
+	switch w.format {
+	case FormatJSON:
+		line, err := json.Marshal(Record{
+			Time:      timestamp,
+			Level:     level.String(),
+			Component: component,
+			Message:   message,
+		})
+		if err != nil {
+			return
+		}
+		w.out.Write(append(line, '\n'))
+	default:
+		if component != "" {
+			message = "[" + component + "] " + message
+		}
+		fmt.Fprintf(w.out, "%s: %s %s\n", level.String(), timestamp.Format("2006/01/02 15:04:05"), message)
+	}
+}
+
+// ParseRecord parses a line written by Writer in either format.
+func ParseRecord(line string) (Record, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil || record.Level == "" {
+			return Record{}, false
+		}
+		return record, true
+	}
+
+	levelStr, rest, ok := strings.Cut(line, ": ")
+	if !ok {
+		return Record{}, false
+	}
+	if _, err := ParseLevel(levelStr); err != nil {
+		return Record{}, false
+	}
+	const stampLayout = "2006/01/02 15:04:05"
+	if len(rest) < len(stampLayout) {
+		return Record{}, false
+	}
+	stamp, err := time.ParseInLocation(stampLayout, rest[:len(stampLayout)], time.Local)
+	if err != nil {
+		return Record{}, false
+	}
+	record := Record{
+		Time:    stamp,
+		Level:   levelStr,
+		Message: strings.TrimSpace(rest[len(stampLayout):]),
+	}
+	if strings.HasPrefix(record.Message, "[") {
+		if end := strings.Index(record.Message, "] "); end > 1 && !strings.ContainsAny(record.Message[1:end], " []") {
+			record.Component = record.Message[1:end]
+			record.Message = record.Message[end+2:]
+		}
+	}
+	return record, true
+}
+
+// Logger logs on behalf of one component. Its methods mirror the newt
+// logger package functions.
+type Logger struct {
+	component string
+}
+
+// Component returns the logger for component.
+func Component(component string) *Logger {
+	return &Logger{component: component}
+}
+
+func (l *Logger) log(level logger.LogLevel, format string, args ...any) {
+	if !root.enabled(l.component, level) {
+		return
+	}
+	root.write(l.component, level, time.Now(), fmt.Sprintf(format, args...))
+}
+
+// Debug logs debug level messages
+func (l *Logger) Debug(format string, args ...any) {
+	l.log(logger.DEBUG, format, args...)
+}
+
+// Info logs info level messages
+func (l *Logger) Info(format string, args ...any) {
+	l.log(logger.INFO, format, args...)
+}
+
+// Warn logs warning level messages
+func (l *Logger) Warn(format string, args ...any) {
+	l.log(logger.WARN, format, args...)
+}
+
+// Error logs error level messages
+func (l *Logger) Error(format string, args ...any) {
+	l.log(logger.ERROR, format, args...)
+}
+
+// EffectiveLevel returns the level that applies to component.
+func EffectiveLevel(component string) logger.LogLevel {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if level, ok := root.levels[component]; ok {
+		return level
+	}
+	return root.level
+}
+
+// Settings is the persisted and IPC representation of the log configuration.
+type Settings struct {
+	Level      string
+	Format     string
+	Components map[string]string
+}
+
+// CurrentSettings returns the active configuration.
+func CurrentSettings() Settings {
+	settings := Settings{
+		Level:      LevelName(GetLevel()),
+		Format:     GetFormat().String(),
+		Components: make(map[string]string),
+	}
+	for component, level := range ComponentLevels() {
+		settings.Components[component] = LevelName(level)
+	}
+	return settings
+}
+
+// Configure validates and applies settings. Components not listed follow
+// the default level.
+func Configure(settings Settings) error {
+	level, err := ParseLevel(settings.Level)
+	if err != nil {
+		return err
+	}
+	format, err := ParseFormat(settings.Format)
+	if err != nil {
+		return err
+	}
+	levels := make(map[string]logger.LogLevel, len(settings.Components))
+	for component, name := range settings.Components {
+		componentLevel, err := ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("component %s: %w", component, err)
+		}
+		levels[component] = componentLevel
+	}
+
+	root.mu.Lock()
+	root.level = level
+	root.format = format
+	root.levels = levels
+	root.mu.Unlock()
+	root.syncLoggerLevel()
+	return nil
+}
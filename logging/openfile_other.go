@@ -0,0 +1,10 @@
+//go:build !windows
+
+package logging
+
+import "os"
+
+// openLogFile opens path for appending.
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package logging
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// openLogFile opens path for appending. Other processes may rename or delete
+// the file while it is open, which lets whichever process notices first
+// rotate a log file that several processes share.
+func openLogFile(path string) (*os.File, error) {
+	path16, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateFile(
+		path16,
+		windows.FILE_APPEND_DATA|windows.FILE_READ_ATTRIBUTES|windows.SYNCHRONIZE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_ALWAYS,
+		windows.FILE_ATTRIBUTE_NORMAL,
+		0,
+	)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
@@ -0,0 +1,361 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+)
+
+const (
+	// rotationCheckInterval is how often the writer looks at the file on disk,
+	// both to see writes by other processes sharing it and to notice that one
+	// of them rotated it.
+	rotationCheckInterval = time.Second
+	// rotationGrace is how long a rotated file is left alone before it is
+	// compressed, so that other processes still holding it can move on.
+	rotationGrace      = 5 * time.Second
+	rotatedStampLayout = "2006-01-02T15-04-05"
+	compressedSuffix   = ".gz"
+)
+
+// RotationPolicy controls when the log file is rotated and how long rotated
+// files are kept. Zero values disable the corresponding limit.
+type RotationPolicy struct {
+	// MaxSize rotates the file once it grows beyond this many bytes.
+	MaxSize int64
+	// Daily rotates the file when the first message of a new day is written.
+	Daily bool
+	// Compress gzips rotated files.
+	Compress bool
+	// MaxAge removes rotated files last written longer ago than this.
+	MaxAge time.Duration
+	// MaxTotalSize removes the oldest rotated files once together they use
+	// more than this many bytes.
+	MaxTotalSize int64
+}
+
+// RotatingWriter is an io.Writer for a log file that rotates it by size and
+// by day. Several processes may write to the same file; each notices when
+// another one rotated it and reopens the new file.
+type RotatingWriter struct {
+	mu        sync.Mutex
+	path      string
+	policy    RotationPolicy
+	file      *os.File
+	size      int64
+	day       time.Time
+	lastCheck time.Time
+	// lastAttempt and lastErr throttle retries after a failed rotation, for
+	// example because the directory is not writable.
+	lastAttempt time.Time
+	lastErr     string
+	now         func() time.Time
+
+	maintainOnce sync.Once
+	maintain     chan struct{}
+}
+
+// NewRotatingWriter opens path for appending, rotating it first if it is
+// already due, and removes rotated files that are past the policy limits.
+func NewRotatingWriter(path string, policy RotationPolicy) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		path:     path,
+		policy:   policy,
+		now:      time.Now,
+		maintain: make(chan struct{}, 1),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	if w.due(0) {
+		if err := w.rotate(); err != nil {
+			w.file.Close()
+			return nil, err
+		}
+	}
+	w.startMaintenance()
+	return w, nil
+}
+
+// Write implements io.Writer.
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := w.now()
+	if now.Sub(w.lastCheck) >= rotationCheckInterval {
+		w.lastCheck = now
+		w.syncWithDisk()
+	}
+	if w.due(int64(len(p))) && (w.lastErr == "" || now.Sub(w.lastAttempt) >= rotationCheckInterval) {
+		w.lastAttempt = now
+		if err := w.rotate(); err != nil {
+			// Keep logging into the current file rather than losing messages;
+			// a later write tries again. The error is logged once, outside of
+			// the lock held here.
+			if err.Error() != w.lastErr {
+				w.lastErr = err.Error()
+				go logger.Warn("Failed to rotate log file: %v", err)
+			}
+		} else {
+			w.lastErr = ""
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *RotatingWriter) open() error {
+	file, err := openLogFile(w.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.day = w.now()
+	if info.Size() > 0 {
+		w.day = info.ModTime()
+	}
+	w.lastCheck = w.now()
+	return nil
+}
+
+// syncWithDisk picks up writes by other processes and reopens the file if
+// another process rotated it.
+func (w *RotatingWriter) syncWithDisk() {
+	onDisk, err := os.Stat(w.path)
+	current, currentErr := w.file.Stat()
+	if err == nil && currentErr == nil && os.SameFile(onDisk, current) {
+		w.size = onDisk.Size()
+		return
+	}
+	file := w.file
+	if err := w.open(); err != nil {
+		w.file = file
+		return
+	}
+	file.Close()
+}
+
+// due reports whether the file must be rotated before writing n more bytes.
+func (w *RotatingWriter) due(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.policy.MaxSize > 0 && w.size+n > w.policy.MaxSize {
+		return true
+	}
+	if w.policy.Daily {
+		now := w.now()
+		y1, m1, d1 := w.day.Date()
+		y2, m2, d2 := now.Date()
+		if y1 != y2 || m1 != m2 || d1 != d2 {
+			return true
+		}
+	}
+	return false
+}
+
+// rotate renames the current file aside and starts a new one.
+func (w *RotatingWriter) rotate() error {
+	rotated := w.rotatedName(w.now())
+	if err := os.Rename(w.path, rotated); err != nil {
+		return err
+	}
+	file := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	file.Close()
+
+	select {
+	case w.maintain <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (w *RotatingWriter) rotatedName(now time.Time) string {
+	dir, base, ext := w.split()
+	stamp := now.Format(rotatedStampLayout)
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s%s", base, stamp, ext))
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		_, gzErr := os.Stat(name + compressedSuffix)
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return name
+		}
+		name = filepath.Join(dir, fmt.Sprintf("%s-%s.%d%s", base, stamp, i, ext))
+	}
+}
+
+func (w *RotatingWriter) split() (dir, base, ext string) {
+	dir = filepath.Dir(w.path)
+	ext = filepath.Ext(w.path)
+	base = strings.TrimSuffix(filepath.Base(w.path), ext)
+	return dir, base, ext
+}
+
+// startMaintenance starts the goroutine that compresses rotated files and
+// applies the retention limits, and asks it to run once.
+func (w *RotatingWriter) startMaintenance() {
+	w.maintainOnce.Do(func() {
+		go func() {
+			w.runMaintenance(false)
+			for range w.maintain {
+				time.Sleep(rotationGrace)
+				w.runMaintenance(true)
+			}
+		}()
+	})
+	select {
+	case w.maintain <- struct{}{}:
+	default:
+	}
+}
+
+type rotatedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// rotatedFiles lists the rotated files that belong to this log, newest first.
+func (w *RotatingWriter) rotatedFiles() []rotatedFile {
+	dir, base, ext := w.split()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []rotatedFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+"-") {
+			continue
+		}
+		if !strings.HasSuffix(name, ext) && !strings.HasSuffix(name, ext+compressedSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedFile{
+			path:    filepath.Join(dir, name),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	return files
+}
+
+// runMaintenance compresses rotated files and removes the ones beyond the
+// retention limits. Uncompressed files rotated within the grace period are
+// only compressed when afterGrace is set.
+func (w *RotatingWriter) runMaintenance(afterGrace bool) {
+	w.mu.Lock()
+	policy := w.policy
+	w.mu.Unlock()
+	_, _, ext := w.split()
+
+	if policy.Compress {
+		for _, file := range w.rotatedFiles() {
+			if !strings.HasSuffix(file.path, ext) {
+				continue
+			}
+			if !afterGrace && w.now().Sub(file.modTime) < rotationGrace {
+				continue
+			}
+			if err := compressFile(file.path); err != nil {
+				logger.Warn("Failed to compress rotated log file %s: %v", file.path, err)
+			}
+		}
+	}
+
+	cutoff := w.now().Add(-policy.MaxAge)
+	var total int64
+	for _, file := range w.rotatedFiles() {
+		total += file.size
+		expired := policy.MaxAge > 0 && file.modTime.Before(cutoff)
+		overLimit := policy.MaxTotalSize > 0 && total > policy.MaxTotalSize
+		if expired || overLimit {
+			os.Remove(file.path)
+			total -= file.size
+		}
+	}
+}
+
+// compressFile replaces path with a gzipped copy, keeping its modification
+// time so that retention is based on when it was last written.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = info.ModTime()
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err := os.Rename(dst.Name(), path+compressedSuffix); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
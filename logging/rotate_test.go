@@ -0,0 +1,274 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for RotatingWriter.now
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+// newTestWriter opens a writer for dir/pangolin.log without the maintenance
+// goroutine, so that tests run maintenance themselves.
+func newTestWriter(t *testing.T, dir string, policy RotationPolicy, c *clock) *RotatingWriter {
+	t.Helper()
+	w := &RotatingWriter{
+		path:     filepath.Join(dir, "pangolin.log"),
+		policy:   policy,
+		now:      c.now,
+		maintain: make(chan struct{}, 1),
+	}
+	if err := w.open(); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func write(t *testing.T, w *RotatingWriter, s string) {
+	t.Helper()
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("Write(%q): %v", s, err)
+	}
+}
+
+// files returns the contents of every file in dir, keyed by name
+func files(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[entry.Name()] = string(data)
+	}
+	return contents
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	c := &clock{time.Date(2026, 3, 14, 9, 26, 53, 0, time.Local)}
+	w := newTestWriter(t, dir, RotationPolicy{MaxSize: 10}, c)
+
+	write(t, w, "first\n")
+	write(t, w, "mid\n")
+	write(t, w, "second\n") // 10 + 7 bytes is past MaxSize
+	write(t, w, "third ...\n")
+
+	want := map[string]string{
+		"pangolin-2026-03-14T09-26-53.log":   "first\nmid\n",
+		"pangolin-2026-03-14T09-26-53.1.log": "second\n",
+		"pangolin.log":                       "third ...\n",
+	}
+	if got := files(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
+
+func TestRotateLargeWriteIntoEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	c := &clock{time.Date(2026, 3, 14, 9, 0, 0, 0, time.Local)}
+	w := newTestWriter(t, dir, RotationPolicy{MaxSize: 4}, c)
+
+	// An empty file is never rotated, even for a write past MaxSize
+	write(t, w, "longer than four\n")
+
+	want := map[string]string{"pangolin.log": "longer than four\n"}
+	if got := files(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
+
+func TestRotateDaily(t *testing.T) {
+	dir := t.TempDir()
+	c := &clock{time.Date(2026, 3, 14, 23, 58, 0, 0, time.Local)}
+	w := newTestWriter(t, dir, RotationPolicy{Daily: true}, c)
+
+	write(t, w, "saturday\n")
+	c.t = c.t.Add(time.Minute)
+	write(t, w, "still saturday\n")
+	c.t = c.t.Add(2 * time.Minute)
+	write(t, w, "sunday\n")
+
+	want := map[string]string{
+		"pangolin-2026-03-15T00-01-00.log": "saturday\nstill saturday\n",
+		"pangolin.log":                     "sunday\n",
+	}
+	if got := files(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
+
+func TestRotateOpenedFileFromEarlierDay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pangolin.log")
+	if err := os.WriteFile(path, []byte("yesterday\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Date(2026, 3, 13, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &clock{time.Date(2026, 3, 14, 8, 0, 0, 0, time.Local)}
+	w := newTestWriter(t, dir, RotationPolicy{Daily: true}, c)
+	write(t, w, "today\n")
+
+	want := map[string]string{
+		"pangolin-2026-03-14T08-00-00.log": "yesterday\n",
+		"pangolin.log":                     "today\n",
+	}
+	if got := files(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
+
+func TestCompressRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Maintenance compares the clock against file times set by the OS
+	c := &clock{time.Now()}
+	w := newTestWriter(t, dir, RotationPolicy{MaxSize: 8, Compress: true}, c)
+
+	write(t, w, "rotated\n")
+	write(t, w, "current\n")
+	list := w.rotatedFiles()
+	if len(list) != 1 {
+		t.Fatalf("rotated files = %v, want one", list)
+	}
+	rotated := list[0].path
+	info, err := os.Stat(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files rotated within the grace period are left for other processes
+	w.runMaintenance(false)
+	if _, err := os.Stat(rotated); err != nil {
+		t.Errorf("rotated file compressed within the grace period: %v", err)
+	}
+
+	w.runMaintenance(true)
+	if _, err := os.Stat(rotated); !os.IsNotExist(err) {
+		t.Errorf("uncompressed file still present: %v", err)
+	}
+	compressed, err := os.Stat(rotated + ".gz")
+	if err != nil {
+		t.Fatalf("compressed file: %v", err)
+	}
+	if !compressed.ModTime().Equal(info.ModTime()) {
+		t.Errorf("compressed file time = %v, want %v", compressed.ModTime(), info.ModTime())
+	}
+
+	f, err := os.Open(rotated + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading compressed file: %v", err)
+	}
+	if string(data) != "rotated\n" {
+		t.Errorf("compressed contents = %q, want %q", data, "rotated\n")
+	}
+	if zr.Name != filepath.Base(rotated) {
+		t.Errorf("gzip name = %q, want %q", zr.Name, filepath.Base(rotated))
+	}
+
+	// The current file and files already compressed are left alone
+	w.runMaintenance(true)
+	got := files(t, dir)
+	if len(got) != 2 || got["pangolin.log"] != "current\n" {
+		t.Errorf("files after second run = %q", got)
+	}
+}
+
+func TestPruneRotatedFiles(t *testing.T) {
+	now := time.Now()
+	type file struct {
+		name string
+		size int
+		age  time.Duration
+	}
+	existing := []file{
+		{"pangolin.log", 500, 0},
+		{"pangolin-a.log", 100, time.Hour},
+		{"pangolin-b.log.gz", 100, 3 * 24 * time.Hour},
+		{"pangolin-c.log", 100, 10 * 24 * time.Hour},
+		{"pangolin-d.log.gz", 100, 40 * 24 * time.Hour},
+		{"other-e.log", 100, 90 * 24 * time.Hour},
+		{"pangolin-f.txt", 100, 90 * 24 * time.Hour},
+	}
+	all := []string{"other-e.log", "pangolin-a.log", "pangolin-b.log.gz", "pangolin-c.log", "pangolin-d.log.gz", "pangolin-f.txt", "pangolin.log"}
+
+	tests := []struct {
+		name   string
+		policy RotationPolicy
+		want   []string
+	}{
+		{"no limits", RotationPolicy{}, all},
+		{
+			"max age",
+			RotationPolicy{MaxAge: 7 * 24 * time.Hour},
+			[]string{"other-e.log", "pangolin-a.log", "pangolin-b.log.gz", "pangolin-f.txt", "pangolin.log"},
+		},
+		{
+			"max total size keeps the newest",
+			RotationPolicy{MaxTotalSize: 250},
+			[]string{"other-e.log", "pangolin-a.log", "pangolin-b.log.gz", "pangolin-f.txt", "pangolin.log"},
+		},
+		{
+			"max total size at the limit",
+			RotationPolicy{MaxTotalSize: 400},
+			all,
+		},
+		{
+			"both limits",
+			RotationPolicy{MaxAge: 20 * 24 * time.Hour, MaxTotalSize: 150},
+			[]string{"other-e.log", "pangolin-a.log", "pangolin-f.txt", "pangolin.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range existing {
+				path := filepath.Join(dir, f.name)
+				if err := os.WriteFile(path, make([]byte, f.size), 0666); err != nil {
+					t.Fatal(err)
+				}
+				modTime := now.Add(-f.age)
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := newTestWriter(t, dir, tt.policy, &clock{now})
+			w.runMaintenance(true)
+
+			var got []string
+			for name := range files(t, dir) {
+				got = append(got, name)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("remaining files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -11,9 +12,11 @@ import (
 	"github.com/fosrl/windows/api"
 	"github.com/fosrl/windows/auth"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/diagnostics"
 	"github.com/fosrl/windows/elevate"
 	"github.com/fosrl/windows/managers"
 	"github.com/fosrl/windows/secrets"
+	"github.com/fosrl/windows/tunnel"
 	"github.com/fosrl/windows/ui"
 	"github.com/fosrl/windows/version"
 
@@ -37,6 +40,20 @@ func execElevatedManagerServiceInstaller() error {
 	return windows.ERROR_UNHANDLED_EXCEPTION // Not reached
 }
 
+// writeDiagnostics writes a diagnostic bundle from the command line. The
+// manager service is only reachable from the tray, so its report is missing.
+func writeDiagnostics(path string) error {
+	src := diagnostics.Sources{
+		LogDir:       config.GetLogDir(),
+		ConfigPath:   config.NewConfigManager().Path(),
+		AccountsPath: config.NewAccountManager().Path(),
+		ManagerError: errors.New("manager service report is only available when exporting from the tray"),
+	}
+	src.OLMStatus, src.OLMError = tunnel.QueryOLMStatus()
+	_, err := diagnostics.WriteFile(path, src)
+	return err
+}
+
 func main() {
 	// Setup logging first
 	setupLogging()
@@ -73,6 +90,24 @@ func main() {
 		return
 	}
 
+	// Handle /diagnostics flag: write a diagnostic bundle and exit
+	if len(os.Args) >= 2 && os.Args[1] == "/diagnostics" {
+		path := diagnostics.DefaultFileName()
+		if len(os.Args) >= 3 {
+			path = os.Args[2]
+		}
+		// The exit code reports the result, since a GUI binary usually has
+		// no console to print to
+		if err := writeDiagnostics(path); err != nil {
+			logger.Error("Failed to write diagnostics: %v", err)
+			fmt.Fprintf(os.Stderr, "Failed to write diagnostics: %v\n", err)
+			os.Exit(1)
+		}
+		logger.Info("Diagnostics written to %s", path)
+		fmt.Printf("Diagnostics written to %s\n", path)
+		return
+	}
+
 	// Handle /installmanagerservice flag (called after elevation)
 	if len(os.Args) >= 2 && os.Args[1] == "/installmanagerservice" {
 		err := managers.InstallManager()
@@ -214,6 +249,7 @@ func main() {
 
 	// Initialize managers
 	accountManager := config.NewAccountManager()
+	cacheManager := config.NewCacheManager()
 	configManager := config.NewConfigManager()
 	secretManager := secrets.NewSecretManager()
 
@@ -224,8 +260,14 @@ func main() {
 		hostname = config.DefaultHostname
 	}
 
+	// Clients trust the CAs and pins of self-hosted server profiles
+	api.SetServerProfiles(configManager.GetServerProfile)
+	if err := api.SetProxy(secretManager.WithProxyPassword(configManager.GetProxy())); err != nil {
+		logger.Error("Failed to apply the proxy settings: %v", err)
+	}
+
 	apiClient := api.NewAPIClient(hostname, "")
-	authManager := auth.NewAuthManager(apiClient, configManager, accountManager, secretManager)
+	authManager := auth.NewAuthManager(apiClient, configManager, accountManager, cacheManager, secretManager)
 
 	// Initialize auth manager (loads saved session token if available)
 	if err := authManager.Initialize(); err != nil {
@@ -0,0 +1,168 @@
+//go:build windows
+
+package managers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/updater"
+	"github.com/fosrl/windows/version"
+	"golang.org/x/sys/windows/svc"
+)
+
+const (
+	healthCheckIPCTimeout    = time.Minute * 2
+	healthCheckTunnelTimeout = time.Minute
+)
+
+var (
+	ipcHandshakeOnce    sync.Once
+	ipcHandshakeChan    = make(chan struct{})
+	uiProcessesLaunched uint32
+)
+
+// markIPCHandshake records that a UI process completed an IPC call.
+func markIPCHandshake() {
+	ipcHandshakeOnce.Do(func() {
+		close(ipcHandshakeChan)
+	})
+}
+
+// runPostUpdateHealthCheck looks for a rollback record left by the updater.
+// If we are the freshly installed version it verifies that the manager
+// works, and reinstalls the previous version otherwise. If we are the
+// previous version after such a rollback, it reports the rollback to the UI.
+func runPostUpdateHealthCheck() {
+	record, err := updater.LoadRollbackRecord()
+	if err != nil {
+		logger.Error("Failed to load rollback record: %v", err)
+		return
+	}
+	if record == nil {
+		return
+	}
+
+	switch {
+	case record.Phase == updater.RollbackPhaseRollingBack && version.Number == record.PreviousVersion:
+		logger.Warn("Update to %s was rolled back to %s: %s", record.TargetVersion, record.PreviousVersion, record.FailureReason)
+		record.Phase = updater.RollbackPhaseRolledBack
+		if err := updater.SaveRollbackRecord(record); err != nil {
+			logger.Error("Failed to save rollback record: %v", err)
+		}
+		setUpdateState(UpdateStateRolledBack)
+	case record.Phase == updater.RollbackPhaseRollingBack:
+		logger.Error("Rollback from %s to %s did not complete", record.TargetVersion, record.PreviousVersion)
+		updater.ClearRollbackRecord()
+		setUpdateState(UpdateStateRollbackFailed)
+	case record.Phase == updater.RollbackPhasePending && version.Number == record.TargetVersion:
+		logger.Info("Running post-update health check for %s", version.Number)
+		if err := checkUpdateHealth(record); err != nil {
+			logger.Error("Post-update health check failed: %v", err)
+			if err := updater.Rollback(record, err.Error()); err != nil {
+				logger.Error("Failed to roll back update: %v", err)
+				updater.ClearRollbackRecord()
+				setUpdateState(UpdateStateRollbackFailed)
+			}
+			return
+		}
+		logger.Info("Post-update health check passed")
+		updater.ClearRollbackRecord()
+	case record.Phase == updater.RollbackPhasePending:
+		// The installer never replaced us, so there is nothing to verify.
+		logger.Info("Update to %s was not installed, discarding rollback record", record.TargetVersion)
+		updater.ClearRollbackRecord()
+	}
+}
+
+// checkUpdateHealth verifies what the new version must do beyond starting the
+// manager service, which running this check already proves: serve the UI and
+// reconnect the tunnel.
+func checkUpdateHealth(record *updater.RollbackRecord) error {
+	if err := checkIPCHandshake(); err != nil {
+		return fmt.Errorf("IPC handshake: %w", err)
+	}
+	if err := checkTunnelReconnect(record.TunnelName); err != nil {
+		return fmt.Errorf("tunnel reconnect: %w", err)
+	}
+	return nil
+}
+
+// checkIPCHandshake waits for a UI process to complete an IPC call. If no
+// user is logged in, no UI is started and the check is skipped.
+func checkIPCHandshake() error {
+	select {
+	case <-ipcHandshakeChan:
+		return nil
+	case <-time.After(healthCheckIPCTimeout):
+	}
+	if atomic.LoadUint32(&uiProcessesLaunched) == 0 {
+		logger.Info("No UI process was started, skipping IPC health check")
+		return nil
+	}
+	return errors.New("no UI process completed an IPC call")
+}
+
+// checkTunnelReconnect verifies that the tunnel that was connected before the
+// update can run again. If the user has connected a tunnel by now, it is
+// theirs and is only waited on. Otherwise the tunnel is started from its saved
+// config and stopped again so the UI stays in control of the connection;
+// starting and stopping tunnels through the UI waits until then.
+func checkTunnelReconnect(name string) error {
+	if name == "" {
+		return nil
+	}
+	tunnelOwnerLock.Lock()
+	defer tunnelOwnerLock.Unlock()
+
+	if userTunnel := activeTunnelName(); userTunnel != "" {
+		logger.Info("Tunnel %s was connected by the user, checking it instead", userTunnel)
+		return waitForTunnelService(userTunnel)
+	}
+
+	configJSON, err := os.ReadFile(tunnelConfigPath(name))
+	if err != nil {
+		logger.Info("No saved config for tunnel %s, skipping tunnel health check", name)
+		return nil
+	}
+	if err := InstallTunnel(string(configJSON)); err != nil {
+		return err
+	}
+	defer UninstallTunnel(name)
+	return waitForTunnelService(name)
+}
+
+// waitForTunnelService waits for the service of a tunnel to run
+func waitForTunnelService(name string) error {
+	m, err := serviceManager()
+	if err != nil {
+		return err
+	}
+	service, err := m.OpenService(tunnelServiceName(name))
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	deadline := time.Now().Add(healthCheckTunnelTimeout)
+	for {
+		status, err := service.Query()
+		if err != nil {
+			return err
+		}
+		switch status.State {
+		case svc.Running:
+			return nil
+		case svc.Stopped:
+			return fmt.Errorf("tunnel service stopped with exit code %d", status.Win32ExitCode)
+		}
+		if time.Now().After(deadline) {
+			return errors.New("tunnel service did not start in time")
+		}
+		time.Sleep(time.Second)
+	}
+}
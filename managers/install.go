@@ -11,7 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/fosrl/newt/logger"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/tunnel"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
@@ -134,11 +136,7 @@ func InstallTunnel(configJSON string) error {
 		name = "pangolin-tunnel" // Default name
 	}
 
-	// Create service name (Windows service names have restrictions)
-	serviceName := config.AppName + "Tunnel$" + sanitizeServiceName(name)
-	if len(serviceName) > 80 {
-		serviceName = serviceName[:80]
-	}
+	serviceName := tunnelServiceName(name)
 
 	// Check if service already exists
 	service, err := m.OpenService(serviceName)
@@ -171,11 +169,10 @@ func InstallTunnel(configJSON string) error {
 	}
 
 	// Save config to temp file to pass to service
-	configDir := filepath.Join(os.Getenv("ProgramData"), config.AppName, "Tunnels")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	configPath := tunnelConfigPath(name)
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
-	configPath := filepath.Join(configDir, name+".json")
 	if err := os.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
@@ -207,10 +204,7 @@ func UninstallTunnel(name string) error {
 		return err
 	}
 
-	serviceName := config.AppName + "Tunnel$" + sanitizeServiceName(name)
-	if len(serviceName) > 80 {
-		serviceName = serviceName[:80]
-	}
+	serviceName := tunnelServiceName(name)
 
 	service, err := m.OpenService(serviceName)
 	if err != nil {
@@ -221,20 +215,40 @@ func UninstallTunnel(name string) error {
 	}
 	defer service.Close()
 
-	service.Control(svc.Stop)
+	_, err = service.Control(svc.Stop)
+	if err == windows.ERROR_SERVICE_NOT_ACTIVE {
+		// A tunnel service that stopped by crashing left its kill switch in
+		// force; one that is stopping removes it itself
+		if err := tunnel.RemoveKillSwitch(); err != nil {
+			logger.Error("Failed to remove the kill switch of tunnel %s: %v", name, err)
+		}
+	}
 	err = service.Delete()
 	if err != nil && err != windows.ERROR_SERVICE_MARKED_FOR_DELETE {
 		return err
 	}
 
 	// Clean up config file
-	configDir := filepath.Join(os.Getenv("ProgramData"), config.AppName, "Tunnels")
-	configPath := filepath.Join(configDir, name+".json")
-	os.Remove(configPath) // Best effort cleanup
+	os.Remove(tunnelConfigPath(name)) // Best effort cleanup
 
 	return nil
 }
 
+// tunnelServiceName returns the Windows service name for the named tunnel
+func tunnelServiceName(name string) string {
+	// Create service name (Windows service names have restrictions)
+	serviceName := config.AppName + "Tunnel$" + sanitizeServiceName(name)
+	if len(serviceName) > 80 {
+		serviceName = serviceName[:80]
+	}
+	return serviceName
+}
+
+// tunnelConfigPath returns where the config of the named tunnel is stored
+func tunnelConfigPath(name string) string {
+	return filepath.Join(os.Getenv("ProgramData"), config.AppName, "Tunnels", name+".json")
+}
+
 // sanitizeServiceName removes invalid characters from service name
 func sanitizeServiceName(name string) string {
 	// Windows service names can only contain: letters, numbers, and: -_()[]{}
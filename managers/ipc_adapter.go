@@ -2,7 +2,10 @@
 
 package managers
 
-import "github.com/fosrl/windows/tunnel"
+import (
+	"github.com/fosrl/windows/events"
+	"github.com/fosrl/windows/tunnel"
+)
 
 // IPCAdapter implements tunnel.IPCClient interface to avoid circular dependencies
 type IPCAdapter struct{}
@@ -22,13 +25,8 @@ func (a *IPCAdapter) StopTunnel() error {
 	return IPCClientStopTunnel()
 }
 
-// RegisterStateChangeCallback registers a callback for tunnel state changes
-// Returns an unregister function
-func (a *IPCAdapter) RegisterStateChangeCallback(cb func(tunnel.State)) func() {
-	callback := IPCClientRegisterTunnelStateChange(func(state TunnelState) {
-		cb(tunnel.State(state))
-	})
-	return func() {
-		callback.Unregister()
-	}
+// StateEvents returns the topic of tunnel state changes reported by the
+// manager service
+func (a *IPCAdapter) StateEvents() *events.Topic[tunnel.State] {
+	return TunnelStateEvents
 }
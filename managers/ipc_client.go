@@ -8,6 +8,12 @@ import (
 	"os"
 	"sync"
 
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/diagnostics"
+	"github.com/fosrl/windows/events"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/peerhealth"
+	"github.com/fosrl/windows/proxy"
 	"github.com/fosrl/windows/tunnel"
 	"github.com/fosrl/windows/updater"
 )
@@ -22,6 +28,8 @@ const (
 	UpdateFoundNotificationType
 	UpdateProgressNotificationType
 	TunnelStateChangeNotificationType
+	PeerHealthChangeNotificationType
+	SystemEventNotificationType
 )
 
 type MethodType int
@@ -32,6 +40,11 @@ const (
 	UpdateMethodType
 	StartTunnelMethodType
 	StopTunnelMethodType
+	SetLogSettingsMethodType
+	DiagnosticsMethodType
+	PeerHealthMethodType
+	SetProxyMethodType
+	SetUpdateSettingsMethodType
 )
 
 var (
@@ -40,29 +53,16 @@ var (
 	rpcMutex   sync.Mutex
 )
 
-type ManagerStoppingCallback struct {
-	cb func()
-}
-
-var managerStoppingCallbacks = make(map[*ManagerStoppingCallback]bool)
-
-type UpdateFoundCallback struct {
-	cb func(updateState UpdateState)
-}
-
-var updateFoundCallbacks = make(map[*UpdateFoundCallback]bool)
-
-type UpdateProgressCallback struct {
-	cb func(dp updater.DownloadProgress)
-}
-
-var updateProgressCallbacks = make(map[*UpdateProgressCallback]bool)
-
-type TunnelStateChangeCallback struct {
-	cb func(state TunnelState)
-}
-
-var tunnelStateChangeCallbacks = make(map[*TunnelStateChangeCallback]bool)
+// Notifications from the manager service are published to these topics. The
+// topics that carry state replay the latest value to late subscribers.
+var (
+	ManagerStoppingEvents = events.NewTopic[struct{}]("manager.stopping", true)
+	UpdateFoundEvents     = events.NewTopic[UpdateState]("manager.update_found", true)
+	UpdateProgressEvents  = events.NewTopic[updater.DownloadProgress]("manager.update_progress", false)
+	TunnelStateEvents     = events.NewTopic[TunnelState]("manager.tunnel_state", true)
+	PeerHealthEvents      = events.NewTopic[peerhealth.Change]("manager.peer_health", false)
+	SystemEvents          = events.NewTopic[SystemEvent]("manager.system", false)
+)
 
 func InitializeIPCClient(reader, writer, events *os.File) {
 	rpcDecoder = gob.NewDecoder(reader)
@@ -77,18 +77,14 @@ func InitializeIPCClient(reader, writer, events *os.File) {
 			}
 			switch notificationType {
 			case ManagerStoppingNotificationType:
-				for cb := range managerStoppingCallbacks {
-					cb.cb()
-				}
+				ManagerStoppingEvents.Publish(struct{}{})
 			case UpdateFoundNotificationType:
 				var state UpdateState
 				err = decoder.Decode(&state)
 				if err != nil {
 					continue
 				}
-				for cb := range updateFoundCallbacks {
-					cb.cb(state)
-				}
+				UpdateFoundEvents.Publish(state)
 			case UpdateProgressNotificationType:
 				var dp updater.DownloadProgress
 				err = decoder.Decode(&dp.Activity)
@@ -115,18 +111,28 @@ func InitializeIPCClient(reader, writer, events *os.File) {
 				if err != nil {
 					continue
 				}
-				for cb := range updateProgressCallbacks {
-					cb.cb(dp)
-				}
+				UpdateProgressEvents.Publish(dp)
 			case TunnelStateChangeNotificationType:
 				var state TunnelState
 				err = decoder.Decode(&state)
 				if err != nil {
 					continue
 				}
-				for cb := range tunnelStateChangeCallbacks {
-					cb.cb(state)
+				TunnelStateEvents.Publish(state)
+			case PeerHealthChangeNotificationType:
+				var change peerhealth.Change
+				err = decoder.Decode(&change)
+				if err != nil {
+					continue
 				}
+				PeerHealthEvents.Publish(change)
+			case SystemEventNotificationType:
+				var event SystemEvent
+				err = decoder.Decode(&event)
+				if err != nil {
+					continue
+				}
+				SystemEvents.Publish(event)
 			}
 		}
 	}()
@@ -179,56 +185,103 @@ func IPCClientUpdateState() (updateState UpdateState, err error) {
 	return
 }
 
+// IPCClientUpdate asks the manager to install the update, which stops the
+// running tunnel first
 func IPCClientUpdate() error {
-	// Always stop any running tunnel services first
-	// Ignore errors from StopTunnel as it's safe to call even if no tunnel is running
-	_ = IPCClientStopTunnel()
-
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
 
 	return rpcEncoder.Encode(UpdateMethodType)
 }
 
-func IPCClientRegisterManagerStopping(cb func()) *ManagerStoppingCallback {
-	s := &ManagerStoppingCallback{cb}
-	managerStoppingCallbacks[s] = true
-	return s
-}
+func IPCClientStartTunnel(config TunnelConfig) error {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
 
-func (cb *ManagerStoppingCallback) Unregister() {
-	delete(managerStoppingCallbacks, cb)
+	err := rpcEncoder.Encode(StartTunnelMethodType)
+	if err != nil {
+		return err
+	}
+	err = rpcEncoder.Encode(config)
+	if err != nil {
+		return err
+	}
+	err = rpcDecodeError()
+	return err
 }
 
-func IPCClientRegisterUpdateFound(cb func(updateState UpdateState)) *UpdateFoundCallback {
-	s := &UpdateFoundCallback{cb}
-	updateFoundCallbacks[s] = true
-	return s
+func IPCClientStopTunnel() error {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err := rpcEncoder.Encode(StopTunnelMethodType)
+	if err != nil {
+		return err
+	}
+	err = rpcDecodeError()
+	return err
 }
 
-func (cb *UpdateFoundCallback) Unregister() {
-	delete(updateFoundCallbacks, cb)
+// IPCClientSetLogSettings changes the manager's log configuration at runtime
+// and persists it for the manager and tunnel services.
+func IPCClientSetLogSettings(settings logging.Settings) error {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err := rpcEncoder.Encode(SetLogSettingsMethodType)
+	if err != nil {
+		return err
+	}
+	err = rpcEncoder.Encode(settings)
+	if err != nil {
+		return err
+	}
+	err = rpcDecodeError()
+	return err
 }
 
-func IPCClientRegisterUpdateProgress(cb func(dp updater.DownloadProgress)) *UpdateProgressCallback {
-	s := &UpdateProgressCallback{cb}
-	updateProgressCallbacks[s] = true
-	return s
+// IPCClientDiagnostics collects the manager service's part of a diagnostic
+// bundle.
+func IPCClientDiagnostics() (report diagnostics.ManagerReport, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(DiagnosticsMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&report)
+	if err != nil {
+		return
+	}
+	err = rpcDecodeError()
+	return
 }
 
-func (cb *UpdateProgressCallback) Unregister() {
-	delete(updateProgressCallbacks, cb)
+// IPCClientPeerHealth returns the health of the sites of the active tunnel
+func IPCClientPeerHealth() (sites []peerhealth.SiteHealth, err error) {
+	rpcMutex.Lock()
+	defer rpcMutex.Unlock()
+
+	err = rpcEncoder.Encode(PeerHealthMethodType)
+	if err != nil {
+		return
+	}
+	err = rpcDecoder.Decode(&sites)
+	return
 }
 
-func IPCClientStartTunnel(config TunnelConfig) error {
+// IPCClientSetProxy changes the proxy used for update checks and downloads
+// and persists it for the manager service.
+func IPCClientSetProxy(proxyConfig proxy.Config) error {
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
 
-	err := rpcEncoder.Encode(StartTunnelMethodType)
+	err := rpcEncoder.Encode(SetProxyMethodType)
 	if err != nil {
 		return err
 	}
-	err = rpcEncoder.Encode(config)
+	err = rpcEncoder.Encode(proxyConfig)
 	if err != nil {
 		return err
 	}
@@ -236,24 +289,20 @@ func IPCClientStartTunnel(config TunnelConfig) error {
 	return err
 }
 
-func IPCClientStopTunnel() error {
+// IPCClientSetUpdateSettings changes the CA bundle and PAC script used for
+// update checks and downloads and persists them for the manager service.
+func IPCClientSetUpdateSettings(settings config.UpdateSettings) error {
 	rpcMutex.Lock()
 	defer rpcMutex.Unlock()
 
-	err := rpcEncoder.Encode(StopTunnelMethodType)
+	err := rpcEncoder.Encode(SetUpdateSettingsMethodType)
+	if err != nil {
+		return err
+	}
+	err = rpcEncoder.Encode(settings)
 	if err != nil {
 		return err
 	}
 	err = rpcDecodeError()
 	return err
 }
-
-func IPCClientRegisterTunnelStateChange(cb func(state TunnelState)) *TunnelStateChangeCallback {
-	s := &TunnelStateChangeCallback{cb}
-	tunnelStateChangeCallbacks[s] = true
-	return s
-}
-
-func (cb *TunnelStateChangeCallback) Unregister() {
-	delete(tunnelStateChangeCallbacks, cb)
-}
@@ -5,31 +5,45 @@ package managers
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"io"
 	"os"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/fosrl/newt/logger"
 	"golang.org/x/sys/windows"
 
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/diagnostics"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/peerhealth"
+	"github.com/fosrl/windows/proxy"
 	"github.com/fosrl/windows/tunnel"
 	"github.com/fosrl/windows/updater"
+	"github.com/fosrl/windows/version"
 )
 
+var ipcLogger = logging.Component(logging.ComponentIPC)
+
 // RunTunnelService is exported so main.go can call it
 func RunTunnelService(configJSON string) error {
 	return tunnel.RunTunnelService(configJSON)
 }
 
 var (
+	managerConfig       *config.ConfigManager
+	managerConfigOnce   sync.Once
 	managerServices     = make(map[*ManagerService]bool)
 	managerServicesLock sync.RWMutex
 	haveQuit            uint32
 	quitManagersChan    = make(chan struct{}, 1)
 	activeTunnels       = make(map[string]bool) // Track active tunnel names
 	activeTunnelsLock   sync.RWMutex
+	// tunnelOwnerLock is held by the post-update health check while it runs
+	// a tunnel of its own, so that the user starting or stopping a tunnel
+	// waits for it to be handed back
+	tunnelOwnerLock sync.Mutex
 )
 
 type ManagerService struct {
@@ -56,7 +70,7 @@ func (s *ManagerService) Quit(stopTunnelsOnQuit bool) (alreadyQuit bool, err err
 
 	if stopTunnelsOnQuit {
 		// Stop all active tunnels before quitting
-		logger.Info("Quit requested with stopTunnelsOnQuit=true, stopping all tunnels")
+		ipcLogger.Info("Quit requested with stopTunnelsOnQuit=true, stopping all tunnels")
 		activeTunnelsLock.Lock()
 		tunnelNames := make([]string, 0, len(activeTunnels))
 		for name := range activeTunnels {
@@ -65,29 +79,45 @@ func (s *ManagerService) Quit(stopTunnelsOnQuit bool) (alreadyQuit bool, err err
 		activeTunnelsLock.Unlock()
 
 		for _, name := range tunnelNames {
-			logger.Info("Stopping tunnel: %s", name)
+			ipcLogger.Info("Stopping tunnel: %s", name)
 			if err := UninstallTunnel(name); err != nil {
-				logger.Error("Failed to stop tunnel %s: %v", name, err)
+				ipcLogger.Error("Failed to stop tunnel %s: %v", name, err)
 				// Continue stopping other tunnels even if one fails
 			}
 		}
-		logger.Info("All tunnels stopped")
+		ipcLogger.Info("All tunnels stopped")
 	}
 
 	quitManagersChan <- struct{}{}
 	return false, nil
 }
 
+// activeTunnelName returns the name of a running tunnel, if any.
+func activeTunnelName() string {
+	activeTunnelsLock.RLock()
+	defer activeTunnelsLock.RUnlock()
+	for name := range activeTunnels {
+		return name
+	}
+	return ""
+}
+
 func (s *ManagerService) UpdateState() UpdateState {
-	return updateState
+	return getUpdateState()
 }
 
 func (s *ManagerService) Update() {
 	if s.elevatedToken == 0 {
 		return
 	}
+	// The tunnel is stopped for the installer. Its name is recorded first, so
+	// that the new version can check that it reconnects.
+	tunnelName := activeTunnelName()
+	if err := s.StopTunnel(); err != nil {
+		ipcLogger.Error("Failed to stop tunnel before updating: %v", err)
+	}
 	// Use the existing updater package's DownloadVerifyAndExecute function
-	progress := updater.DownloadVerifyAndExecute(uintptr(s.elevatedToken))
+	progress := updater.DownloadVerifyAndExecute(uintptr(s.elevatedToken), updater.UpdateOptions{TunnelName: tunnelName})
 	go func() {
 		for {
 			dp := <-progress
@@ -99,11 +129,63 @@ func (s *ManagerService) Update() {
 	}()
 }
 
-func (s *ManagerService) StartTunnel(config tunnel.Config) error {
-	// Set up callback to notify on state changes
-	tunnel.SetStateChangeCallback(func(state TunnelState) {
-		IPCServerNotifyTunnelStateChange(state)
+// getManagerConfig returns the config of the SYSTEM profile, which the
+// manager and tunnel services share
+func getManagerConfig() *config.ConfigManager {
+	managerConfigOnce.Do(func() {
+		managerConfig = config.NewConfigManager()
 	})
+	return managerConfig
+}
+
+// PeerHealth returns the health of the sites of the active tunnel
+func (s *ManagerService) PeerHealth() []peerhealth.SiteHealth {
+	return peerHealth.Snapshot(time.Now())
+}
+
+// Diagnostics collects the parts of a diagnostic bundle that only the manager
+// service has access to.
+func (s *ManagerService) Diagnostics() (diagnostics.ManagerReport, error) {
+	if s.elevatedToken == 0 {
+		return diagnostics.ManagerReport{}, windows.ERROR_ACCESS_DENIED
+	}
+	report := diagnostics.ManagerReport{
+		Version:      version.Number,
+		UpdateState:  getUpdateState().String(),
+		StateHistory: tunnel.StateHistory(),
+	}
+	services, err := diagnostics.QueryServices()
+	if err != nil {
+		ipcLogger.Warn("Failed to query services for diagnostics: %v", err)
+	}
+	report.Services = services
+	if data, err := os.ReadFile(getManagerConfig().Path()); err == nil {
+		if redacted, err := diagnostics.RedactJSON(data); err == nil {
+			report.Config = redacted
+		}
+	}
+	return report, nil
+}
+
+// SetLogSettings applies new log settings to the manager and persists them
+// in the config shared by the manager and tunnel services.
+func (s *ManagerService) SetLogSettings(settings logging.Settings) error {
+	if s.elevatedToken == 0 {
+		return windows.ERROR_ACCESS_DENIED
+	}
+	if err := logging.Configure(settings); err != nil {
+		return err
+	}
+	if !getManagerConfig().SetLogSettings(settings.Level, settings.Format, settings.Components) {
+		return errors.New("failed to save log settings")
+	}
+	ipcLogger.Info("Log settings changed: level=%s, format=%s, components=%v", settings.Level, settings.Format, settings.Components)
+	return nil
+}
+
+func (s *ManagerService) StartTunnel(config tunnel.Config) error {
+	tunnelOwnerLock.Lock()
+	defer tunnelOwnerLock.Unlock()
 
 	// Set up callbacks for tunnel service to call install/uninstall
 	tunnel.SetInstallTunnelCallback(InstallTunnel)
@@ -119,17 +201,12 @@ func (s *ManagerService) StartTunnel(config tunnel.Config) error {
 	activeTunnelsLock.Lock()
 	activeTunnels[config.Name] = true
 	activeTunnelsLock.Unlock()
-	// Notify UI of initial state change (starting)
-	state := tunnel.GetState()
-	IPCServerNotifyTunnelStateChange(state)
 	return nil
 }
 
 func (s *ManagerService) StopTunnel() error {
-	// Set up callback to notify on state changes
-	tunnel.SetStateChangeCallback(func(state TunnelState) {
-		IPCServerNotifyTunnelStateChange(state)
-	})
+	tunnelOwnerLock.Lock()
+	defer tunnelOwnerLock.Unlock()
 
 	// Set up callbacks for tunnel service to call install/uninstall
 	tunnel.SetInstallTunnelCallback(InstallTunnel)
@@ -137,21 +214,18 @@ func (s *ManagerService) StopTunnel() error {
 		return UninstallTunnel(name)
 	})
 
+	// Get the tunnel name from the tunnel package before stopping clears it
+	tunnelName := tunnel.GetTunnelName()
 	err := tunnel.StopTunnel()
 	if err != nil {
 		return err
 	}
 	// Remove tunnel from active list
-	// Get the tunnel name from the tunnel package
-	tunnelName := tunnel.GetTunnelName()
 	if tunnelName != "" {
 		activeTunnelsLock.Lock()
 		delete(activeTunnels, tunnelName)
 		activeTunnelsLock.Unlock()
 	}
-	// Notify UI of initial state change (stopping)
-	state := tunnel.GetState()
-	IPCServerNotifyTunnelStateChange(state)
 	return nil
 }
 
@@ -164,6 +238,7 @@ func (s *ManagerService) ServeConn(reader io.Reader, writer io.Writer) {
 		if err != nil {
 			return
 		}
+		markIPCHandshake()
 		switch methodType {
 		case QuitMethodType:
 			var stopTunnelsOnQuit bool
@@ -205,6 +280,55 @@ func (s *ManagerService) ServeConn(reader io.Reader, writer io.Writer) {
 			if err != nil {
 				return
 			}
+		case PeerHealthMethodType:
+			sites := s.PeerHealth()
+			err = encoder.Encode(sites)
+			if err != nil {
+				return
+			}
+		case DiagnosticsMethodType:
+			report, retErr := s.Diagnostics()
+			err = encoder.Encode(report)
+			if err != nil {
+				return
+			}
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case SetLogSettingsMethodType:
+			var settings logging.Settings
+			err := decoder.Decode(&settings)
+			if err != nil {
+				return
+			}
+			retErr := s.SetLogSettings(settings)
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case SetProxyMethodType:
+			var proxyConfig proxy.Config
+			err := decoder.Decode(&proxyConfig)
+			if err != nil {
+				return
+			}
+			retErr := s.SetProxy(proxyConfig)
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
+		case SetUpdateSettingsMethodType:
+			var settings config.UpdateSettings
+			err := decoder.Decode(&settings)
+			if err != nil {
+				return
+			}
+			retErr := s.SetUpdateSettings(settings)
+			err = encoder.Encode(errToString(retErr))
+			if err != nil {
+				return
+			}
 		default:
 			return
 		}
@@ -289,3 +413,11 @@ func IPCServerNotifyManagerStopping() {
 func IPCServerNotifyTunnelStateChange(state TunnelState) {
 	notifyAll(TunnelStateChangeNotificationType, false, state)
 }
+
+func IPCServerNotifyPeerHealthChange(change peerhealth.Change) {
+	notifyAll(PeerHealthChangeNotificationType, false, change)
+}
+
+func IPCServerNotifySystemEvent(event SystemEvent) {
+	notifyAll(SystemEventNotificationType, false, event)
+}
@@ -0,0 +1,64 @@
+//go:build windows
+
+package managers
+
+import (
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/peerhealth"
+	"github.com/fosrl/windows/tunnel"
+)
+
+// peerHealthInterval is how often the OLM status is sampled while a tunnel
+// is active
+const peerHealthInterval = 2 * time.Second
+
+var peerHealth = peerhealth.NewTracker(peerhealth.DefaultWindow, peerhealth.DefaultThresholds)
+
+// monitorPeerHealth samples the peer status of the active tunnel into
+// peerHealth and tells the UI processes about sites that degrade or recover
+func monitorPeerHealth() {
+	ticker := time.NewTicker(peerHealthInterval)
+	defer ticker.Stop()
+
+	tracking := false
+	for now := range ticker.C {
+		if tunnel.GetState() == tunnel.StateStopped {
+			if tracking {
+				peerHealth.Reset()
+				tracking = false
+			}
+			continue
+		}
+
+		status, err := tunnel.QueryOLMStatus()
+		if err != nil {
+			// The tunnel service is still starting or has gone away
+			continue
+		}
+		tracking = true
+
+		observations := make([]peerhealth.Observation, 0, len(status.PeerStatuses))
+		for id, peer := range status.PeerStatuses {
+			if peer == nil {
+				continue
+			}
+			observations = append(observations, peerhealth.Observation{
+				SiteID:    id,
+				Name:      peer.SiteName,
+				Connected: peer.Connected,
+				RTT:       peer.RTT,
+				Relay:     peer.IsRelay,
+			})
+		}
+		for _, change := range peerHealth.Record(now, observations) {
+			if change.Degraded {
+				logger.Warn("Site %s is degraded: %s", change.Name, change.Reason)
+			} else {
+				logger.Info("Site %s recovered", change.Name)
+			}
+			IPCServerNotifyPeerHealthChange(change)
+		}
+	}
+}
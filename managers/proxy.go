@@ -0,0 +1,79 @@
+//go:build windows
+
+package managers
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/secrets"
+	"github.com/fosrl/windows/updater"
+)
+
+// SetProxy applies a new outbound proxy to update checks and downloads and
+// persists it for the manager, the password in the SYSTEM credential store.
+func (s *ManagerService) SetProxy(proxyConfig proxy.Config) error {
+	if s.elevatedToken == 0 {
+		return windows.ERROR_ACCESS_DENIED
+	}
+	if err := applyUpdaterNetwork(proxyConfig, getManagerConfig().GetUpdateSettings()); err != nil {
+		return err
+	}
+	if !secrets.NewSecretManager().SaveProxyPassword(proxyConfig.Password) {
+		return errors.New("failed to save the proxy password")
+	}
+	if !getManagerConfig().SetProxy(proxyConfig) {
+		return errors.New("failed to save proxy settings")
+	}
+	ipcLogger.Info("Proxy settings changed: %s", proxyConfig)
+	return nil
+}
+
+// SetUpdateSettings applies a CA bundle and PAC script to update checks and
+// downloads and persists them for the manager.
+func (s *ManagerService) SetUpdateSettings(settings config.UpdateSettings) error {
+	if s.elevatedToken == 0 {
+		return windows.ERROR_ACCESS_DENIED
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	proxyConfig := secrets.NewSecretManager().WithProxyPassword(getManagerConfig().GetProxy())
+	if err := applyUpdaterNetwork(proxyConfig, settings); err != nil {
+		return err
+	}
+	if !getManagerConfig().SetUpdateSettings(settings) {
+		return errors.New("failed to save update settings")
+	}
+	ipcLogger.Info("Update settings changed: CA bundle %q, PAC script %q", settings.CABundlePath, settings.PACURL)
+	return nil
+}
+
+// loadUpdaterProxy applies the saved proxy and update settings to update
+// checks and downloads
+func loadUpdaterProxy() {
+	proxyConfig := secrets.NewSecretManager().WithProxyPassword(getManagerConfig().GetProxy())
+	if err := applyUpdaterNetwork(proxyConfig, getManagerConfig().GetUpdateSettings()); err != nil {
+		ipcLogger.Error("Failed to apply the saved proxy settings: %v", err)
+	}
+}
+
+// applyUpdaterNetwork sets the proxy and CA bundle of the fetcher, keeping
+// the rest of its configuration. A PAC script takes the place of the proxy.
+func applyUpdaterNetwork(proxyConfig proxy.Config, settings config.UpdateSettings) error {
+	fetcherProxy := updater.ProxyConfig{Mode: updater.ProxyModePAC, PACURL: settings.PACURL}
+	if settings.PACURL == "" {
+		var err error
+		if fetcherProxy, err = updater.ProxyConfigFrom(proxyConfig); err != nil {
+			return err
+		}
+	}
+	updater.UpdateFetcherConfig(func(cfg *updater.FetcherConfig) {
+		cfg.Proxy = fetcherProxy
+		cfg.CABundlePath = settings.CABundlePath
+	})
+	return nil
+}
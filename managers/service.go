@@ -8,11 +8,14 @@ import (
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/fosrl/newt/logger"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/events"
+	"github.com/fosrl/windows/tunnel"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 )
@@ -205,6 +208,7 @@ func (service *managerService) Execute(args []string, r <-chan svc.ChangeRequest
 				return
 			}
 
+			atomic.AddUint32(&uiProcessesLaunched, 1)
 			procsLock.Lock()
 			procs[session] = proc
 			procsLock.Unlock()
@@ -239,7 +243,19 @@ func (service *managerService) Execute(args []string, r <-chan svc.ChangeRequest
 		}()
 	}
 
+	// Forward the tunnel state changes made on behalf of UI processes to all of them
+	tunnelStateSub := tunnel.StateEvents.Subscribe(IPCServerNotifyTunnelStateChange, events.WithPolicy(events.Block), events.WithoutReplay())
+	defer tunnelStateSub.Unsubscribe()
+
+	loadUpdaterProxy()
 	go checkForUpdates()
+	go monitorPeerHealth()
+
+	if stopWatchingNetwork, err := watchNetworkChanges(); err != nil {
+		logger.Error("Failed to watch for network changes: %v", err)
+	} else {
+		defer stopWatchingNetwork()
+	}
 	// TODO: Add driver cleanup when driver package is implemented
 	// go driver.UninstallLegacyWintun()
 
@@ -265,7 +281,9 @@ func (service *managerService) Execute(args []string, r <-chan svc.ChangeRequest
 	}
 	windows.WTSFreeMemory(uintptr(unsafe.Pointer(sessionsPointer)))
 
-	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptSessionChange}
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptSessionChange | svc.AcceptPowerEvent}
+
+	go runPostUpdateHealthCheck()
 
 	uninstall := false
 loop:
@@ -285,6 +303,11 @@ loop:
 				break loop
 			case svc.Interrogate:
 				changes <- c.CurrentStatus
+			case svc.PowerEvent:
+				if c.EventType == pbtAPMResumeAutomatic {
+					logger.Info("Resumed from sleep")
+					IPCServerNotifySystemEvent(ResumedEvent)
+				}
 			case svc.SessionChange:
 				sessionNotification := (*windows.WTSSESSION_NOTIFICATION)(unsafe.Pointer(c.EventData))
 				if uintptr(sessionNotification.Size) != unsafe.Sizeof(*sessionNotification) {
@@ -0,0 +1,85 @@
+//go:build windows
+
+package managers
+
+import (
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"golang.org/x/sys/windows"
+)
+
+// SystemEvent is a change of the machine's state after which what the UI
+// processes know about the server may be stale
+type SystemEvent int
+
+const (
+	// NetworkChangedEvent is sent once the machine's addresses have settled
+	// after changing, such as when joining another network
+	NetworkChangedEvent SystemEvent = iota
+	// ResumedEvent is sent when the machine resumes from sleep
+	ResumedEvent
+)
+
+func (e SystemEvent) String() string {
+	switch e {
+	case NetworkChangedEvent:
+		return "network change"
+	case ResumedEvent:
+		return "resume"
+	default:
+		return "unknown"
+	}
+}
+
+// pbtAPMResumeAutomatic is the power event sent when the machine resumes
+// from sleep, whether or not a user is present
+const pbtAPMResumeAutomatic = 0x12
+
+// networkChangeSettle is how long the addresses must stay unchanged before
+// a network change is reported, since joining a network changes several
+const networkChangeSettle = 3 * time.Second
+
+// addressChanges receives a value whenever an address changes. It is buffered
+// so that the notification callback never blocks.
+var addressChanges = make(chan struct{}, 1)
+
+var addressChangeCallback = windows.NewCallback(func(callerContext, row, notificationType uintptr) uintptr {
+	select {
+	case addressChanges <- struct{}{}:
+	default:
+	}
+	return 0
+})
+
+// watchNetworkChanges tells the UI processes when the machine's addresses
+// change until the returned function is called
+func watchNetworkChanges() (stop func(), err error) {
+	var handle windows.Handle
+	err = windows.NotifyUnicastIpAddressChange(windows.AF_UNSPEC, addressChangeCallback, nil, false, &handle)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case <-addressChanges:
+				settle = time.After(networkChangeSettle)
+			case <-settle:
+				settle = nil
+				logger.Info("Network changed")
+				IPCServerNotifySystemEvent(NetworkChangedEvent)
+			}
+		}
+	}()
+
+	return func() {
+		windows.CancelMibChangeNotify2(handle)
+		close(done)
+	}, nil
+}
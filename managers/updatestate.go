@@ -3,6 +3,8 @@
 package managers
 
 import (
+	"fmt"
+	"sync"
 	"time"
 	_ "unsafe"
 
@@ -20,9 +22,46 @@ const (
 	UpdateStateUnknown UpdateState = iota
 	UpdateStateFoundUpdate
 	UpdateStateUpdatesDisabledUnofficialBuild
+	UpdateStateRolledBack
+	UpdateStateRollbackFailed
 )
 
-var updateState = UpdateStateUnknown
+func (s UpdateState) String() string {
+	switch s {
+	case UpdateStateUnknown:
+		return "unknown"
+	case UpdateStateFoundUpdate:
+		return "found-update"
+	case UpdateStateUpdatesDisabledUnofficialBuild:
+		return "updates-disabled-unofficial-build"
+	case UpdateStateRolledBack:
+		return "rolled-back"
+	case UpdateStateRollbackFailed:
+		return "rollback-failed"
+	default:
+		return fmt.Sprintf("UpdateState(%d)", uint32(s))
+	}
+}
+
+var (
+	updateState     = UpdateStateUnknown
+	updateStateLock sync.RWMutex
+)
+
+// getUpdateState returns the update state to report to the UI
+func getUpdateState() UpdateState {
+	updateStateLock.RLock()
+	defer updateStateLock.RUnlock()
+	return updateState
+}
+
+// setUpdateState changes the update state and notifies the UI
+func setUpdateState(state UpdateState) {
+	updateStateLock.Lock()
+	updateState = state
+	updateStateLock.Unlock()
+	IPCServerNotifyUpdateFound(state)
+}
 
 func jitterSleep(min, max time.Duration) {
 	time.Sleep(min + time.Millisecond*time.Duration(fastrandn(uint32((max-min+1)/time.Millisecond))))
@@ -54,10 +93,12 @@ func checkForUpdates() {
 	noError, didNotify := true, false
 	for {
 		update, err := updater.CheckForUpdate()
-		if err == nil && update != nil && !didNotify {
+		if err == nil && update != nil && update.Version() == updater.SkippedVersion() {
+			logger.Info("Update %s was rolled back before, not offering it again", update.Version())
+			jitterSleep(time.Hour-time.Minute*3, time.Hour+time.Minute*3)
+		} else if err == nil && update != nil && !didNotify {
 			logger.Info("An update is available")
-			updateState = UpdateStateFoundUpdate
-			IPCServerNotifyUpdateFound(updateState)
+			setUpdateState(UpdateStateFoundUpdate)
 			didNotify = true
 		} else if err != nil && !didNotify {
 			logger.Error("Update checker: %v", err)
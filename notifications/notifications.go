@@ -0,0 +1,250 @@
+// Package notifications turns client events into desktop notifications. It
+// decides what is worth telling the user and drops repeats, so that a flapping
+// tunnel does not flood the notification area. Showing the notifications is
+// left to a Sink, which keeps this package independent of the tray.
+package notifications
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DedupWindow is how long an identical notification is suppressed
+	DedupWindow = time.Minute
+	// RateLimit is the number of notifications a category may show per
+	// RateWindow; further ones are dropped
+	RateLimit  = 3
+	RateWindow = time.Minute
+)
+
+// Category groups notifications so that users can turn them off together
+type Category string
+
+const (
+	CategoryTunnel  Category = "tunnel"
+	CategorySession Category = "session"
+	CategoryUpdates Category = "updates"
+	CategorySites   Category = "sites"
+)
+
+// Categories lists all categories in the order they are shown in preferences
+var Categories = []Category{CategoryTunnel, CategorySession, CategoryUpdates, CategorySites}
+
+// Description returns the label of the category in preferences
+func (c Category) Description() string {
+	switch c {
+	case CategoryTunnel:
+		return "Tunnel connected, disconnected or failed"
+	case CategorySession:
+		return "Session expiring or organization access revoked"
+	case CategoryUpdates:
+		return "Updates available or installed"
+	case CategorySites:
+		return "Site connections lost or degraded"
+	default:
+		return string(c)
+	}
+}
+
+// Severity selects the icon of a notification
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// EventKind identifies what happened
+type EventKind int
+
+const (
+	EventTunnelConnected EventKind = iota
+	EventTunnelReconnected
+	EventTunnelDisconnected
+	EventTunnelReconnecting
+	EventTunnelFailed
+	EventSessionExpiring
+	EventOrgAccessRevoked
+	EventUpdateAvailable
+	EventUpdateInstalled
+	EventPeerLost
+	EventSiteDegraded
+	EventSiteRecovered
+)
+
+// Event is something that happened in the client. Only the fields relevant to
+// Kind are set.
+type Event struct {
+	Kind EventKind
+	// UserInitiated is set when the event is the result of a user action,
+	// such as clicking Disconnect
+	UserInitiated bool
+	// Org is the name or ID of the organization
+	Org string
+	// Site is the name of the site whose connection was lost or changed
+	// health
+	Site string
+	// Reason says why a site is degraded
+	Reason string
+	// Version is the version that is available or was installed
+	Version string
+	// ExpiresIn is how long until the session expires
+	ExpiresIn time.Duration
+	// Err is the reason the tunnel failed
+	Err error
+}
+
+// Notification is what the user sees
+type Notification struct {
+	Category Category
+	Severity Severity
+	Title    string
+	Message  string
+}
+
+// Map returns the notification for e. It returns false for events that should
+// not be shown, such as a disconnect the user asked for.
+func Map(e Event) (Notification, bool) {
+	switch e.Kind {
+	case EventTunnelConnected:
+		message := "The tunnel is connected."
+		if e.Org != "" {
+			message = fmt.Sprintf("Connected to %s.", e.Org)
+		}
+		return Notification{CategoryTunnel, SeverityInfo, "Connected", message}, true
+	case EventTunnelReconnected:
+		return Notification{CategoryTunnel, SeverityInfo, "Reconnected", "The tunnel connection was restored."}, true
+	case EventTunnelDisconnected:
+		if e.UserInitiated {
+			return Notification{}, false
+		}
+		return Notification{CategoryTunnel, SeverityWarning, "Disconnected", "The tunnel stopped unexpectedly. Resources are no longer reachable."}, true
+	case EventTunnelReconnecting:
+		return Notification{CategoryTunnel, SeverityWarning, "Connection Lost", "The tunnel lost its connection and is reconnecting."}, true
+	case EventTunnelFailed:
+		message := "The tunnel failed to connect."
+		if e.Err != nil {
+			message = fmt.Sprintf("The tunnel failed to connect: %v", e.Err)
+		}
+		return Notification{CategoryTunnel, SeverityError, "Connection Failed", message}, true
+	case EventSessionExpiring:
+		return Notification{CategorySession, SeverityWarning, "Session Expiring",
+			fmt.Sprintf("Your session expires in %s. Log in again to stay connected.", formatDuration(e.ExpiresIn))}, true
+	case EventOrgAccessRevoked:
+		message := "Your access to the organization was revoked."
+		if e.Org != "" {
+			message = fmt.Sprintf("Your access to %s was revoked.", e.Org)
+		}
+		return Notification{CategorySession, SeverityError, "Access Revoked", message}, true
+	case EventUpdateAvailable:
+		message := "A new version of Pangolin is available."
+		if e.Version != "" {
+			message = fmt.Sprintf("Pangolin %s is available.", e.Version)
+		}
+		return Notification{CategoryUpdates, SeverityInfo, "Update Available", message}, true
+	case EventUpdateInstalled:
+		return Notification{CategoryUpdates, SeverityInfo, "Update Installed",
+			fmt.Sprintf("Pangolin was updated to %s.", e.Version)}, true
+	case EventPeerLost:
+		return Notification{CategorySites, SeverityWarning, "Site Unreachable",
+			fmt.Sprintf("The connection to %s was lost.", e.Site)}, true
+	case EventSiteDegraded:
+		message := fmt.Sprintf("The connection to %s is degraded.", e.Site)
+		if e.Reason != "" {
+			message = fmt.Sprintf("The connection to %s is degraded: %s.", e.Site, e.Reason)
+		}
+		return Notification{CategorySites, SeverityWarning, "Site Degraded", message}, true
+	case EventSiteRecovered:
+		return Notification{CategorySites, SeverityInfo, "Site Recovered",
+			fmt.Sprintf("The connection to %s recovered.", e.Site)}, true
+	default:
+		return Notification{}, false
+	}
+}
+
+// formatDuration rounds d to what a user cares about
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	case d >= time.Hour:
+		return "1 hour"
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	default:
+		return "a minute"
+	}
+}
+
+// Sink shows a notification
+type Sink func(Notification)
+
+// Notifier maps events to notifications and passes them to a Sink, except for
+// disabled categories, repeats within DedupWindow and notifications beyond
+// the rate limit of their category.
+type Notifier struct {
+	mu       sync.Mutex
+	sink     Sink
+	enabled  func(Category) bool
+	now      func() time.Time
+	lastSeen map[Notification]time.Time
+	shown    map[Category][]time.Time
+}
+
+// NewNotifier returns a Notifier that passes notifications to sink. enabled
+// reports whether a category is turned on; nil enables all of them.
+func NewNotifier(sink Sink, enabled func(Category) bool) *Notifier {
+	if enabled == nil {
+		enabled = func(Category) bool { return true }
+	}
+	return &Notifier{
+		sink:     sink,
+		enabled:  enabled,
+		now:      time.Now,
+		lastSeen: make(map[Notification]time.Time),
+		shown:    make(map[Category][]time.Time),
+	}
+}
+
+// Notify shows the notification for e, if any, and reports whether it did
+func (n *Notifier) Notify(e Event) bool {
+	notification, ok := Map(e)
+	if !ok || !n.enabled(notification.Category) {
+		return false
+	}
+
+	n.mu.Lock()
+	now := n.now()
+	if last, seen := n.lastSeen[notification]; seen && now.Sub(last) < DedupWindow {
+		n.mu.Unlock()
+		return false
+	}
+	for key, last := range n.lastSeen {
+		if now.Sub(last) >= DedupWindow {
+			delete(n.lastSeen, key)
+		}
+	}
+
+	recent := n.shown[notification.Category][:0]
+	for _, t := range n.shown[notification.Category] {
+		if now.Sub(t) < RateWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= RateLimit {
+		n.shown[notification.Category] = recent
+		n.mu.Unlock()
+		return false
+	}
+	// Only a notification that is shown counts as seen, so one dropped by the
+	// rate limit can still be shown once the category calms down
+	n.lastSeen[notification] = now
+	n.shown[notification.Category] = append(recent, now)
+	n.mu.Unlock()
+
+	n.sink(notification)
+	return true
+}
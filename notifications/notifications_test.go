@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestNotifier returns a Notifier on a fake clock and the notifications it
+// showed
+func newTestNotifier(enabled func(Category) bool) (*Notifier, *time.Time, *[]Notification) {
+	var shown []Notification
+	n := NewNotifier(func(notification Notification) {
+		shown = append(shown, notification)
+	}, enabled)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	return n, &now, &shown
+}
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		event    Event
+		show     bool
+		category Category
+		severity Severity
+		message  string
+	}{
+		{Event{Kind: EventTunnelConnected, Org: "Acme"}, true, CategoryTunnel, SeverityInfo, "Connected to Acme."},
+		{Event{Kind: EventTunnelDisconnected, UserInitiated: true}, false, "", 0, ""},
+		{Event{Kind: EventTunnelDisconnected}, true, CategoryTunnel, SeverityWarning, "stopped unexpectedly"},
+		{Event{Kind: EventTunnelFailed, Err: errors.New("no route")}, true, CategoryTunnel, SeverityError, "no route"},
+		{Event{Kind: EventSessionExpiring, ExpiresIn: 90 * time.Minute}, true, CategorySession, SeverityWarning, "1 hour"},
+		{Event{Kind: EventSessionExpiring, ExpiresIn: 30 * time.Second}, true, CategorySession, SeverityWarning, "a minute"},
+		{Event{Kind: EventOrgAccessRevoked, Org: "Acme"}, true, CategorySession, SeverityError, "access to Acme"},
+		{Event{Kind: EventUpdateAvailable, Version: "1.2.0"}, true, CategoryUpdates, SeverityInfo, "1.2.0 is available"},
+		{Event{Kind: EventSiteDegraded, Site: "Office", Reason: "high latency"}, true, CategorySites, SeverityWarning, "Office is degraded: high latency"},
+		{Event{Kind: EventKind(999)}, false, "", 0, ""},
+	}
+	for _, tt := range tests {
+		got, ok := Map(tt.event)
+		if ok != tt.show {
+			t.Errorf("Map(%+v) shown = %v, want %v", tt.event, ok, tt.show)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.Category != tt.category || got.Severity != tt.severity || !strings.Contains(got.Message, tt.message) {
+			t.Errorf("Map(%+v) = %+v, want %s/%d containing %q", tt.event, got, tt.category, tt.severity, tt.message)
+		}
+	}
+}
+
+func TestNotifierDedup(t *testing.T) {
+	n, now, shown := newTestNotifier(nil)
+	connected := Event{Kind: EventTunnelConnected, Org: "Acme"}
+
+	if !n.Notify(connected) {
+		t.Fatal("the first notification was not shown")
+	}
+	*now = now.Add(DedupWindow - time.Second)
+	if n.Notify(connected) {
+		t.Error("a repeat within the dedup window was shown")
+	}
+	if !n.Notify(Event{Kind: EventTunnelConnected, Org: "Other"}) {
+		t.Error("a different notification was suppressed as a repeat")
+	}
+	*now = now.Add(time.Second)
+	if !n.Notify(connected) {
+		t.Error("a repeat after the dedup window was suppressed")
+	}
+	if len(*shown) != 3 {
+		t.Errorf("showed %d notifications, want 3", len(*shown))
+	}
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+	n, now, shown := newTestNotifier(nil)
+	site := func(name string) Event { return Event{Kind: EventPeerLost, Site: name} }
+	start := *now
+
+	for i := 0; i < RateLimit; i++ {
+		if !n.Notify(site(string(rune('A' + i)))) {
+			t.Fatalf("notification %d within the rate limit was dropped", i)
+		}
+		*now = now.Add(time.Second)
+	}
+	if n.Notify(site("Dropped")) {
+		t.Error("a notification beyond the rate limit was shown")
+	}
+	if !n.Notify(Event{Kind: EventUpdateAvailable}) {
+		t.Error("the rate limit of one category held back another")
+	}
+
+	// Once the first one leaves the rate window, the dropped notification
+	// can be shown: it was never shown, so it is not a repeat
+	*now = start.Add(RateWindow)
+	if !n.Notify(site("Dropped")) {
+		t.Error("a notification dropped by the rate limit was later suppressed as a repeat")
+	}
+	if got := len(*shown); got != RateLimit+2 {
+		t.Errorf("showed %d notifications, want %d", got, RateLimit+2)
+	}
+}
+
+func TestNotifierDisabledCategory(t *testing.T) {
+	n, _, shown := newTestNotifier(func(c Category) bool { return c != CategorySites })
+	if n.Notify(Event{Kind: EventPeerLost, Site: "Office"}) {
+		t.Error("a notification of a disabled category was shown")
+	}
+	if n.Notify(Event{Kind: EventTunnelDisconnected, UserInitiated: true}) {
+		t.Error("a disconnect the user asked for was shown")
+	}
+	if !n.Notify(Event{Kind: EventTunnelReconnecting}) {
+		t.Error("a notification of an enabled category was dropped")
+	}
+	if len(*shown) != 1 {
+		t.Errorf("showed %d notifications, want 1", len(*shown))
+	}
+}
@@ -0,0 +1,282 @@
+// Package peerhealth keeps a rolling window of the status of each site's peer
+// connection and summarizes it: round-trip time percentiles, uptime, how much
+// of the time the connection went through a relay and how often it flapped.
+// Sites whose summary crosses the thresholds are reported as degraded.
+package peerhealth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is how much history is kept per site
+	DefaultWindow = 10 * time.Minute
+	// HistoryPoints is the number of points in SiteHealth.RTTHistory
+	HistoryPoints = 60
+	// minSamples is the number of samples a site needs before it can be
+	// reported as degraded, so that a new connection is not judged by its
+	// handshake
+	minSamples = 10
+)
+
+// Thresholds decide when a site is degraded
+type Thresholds struct {
+	// RTT is the highest acceptable 95th percentile round-trip time
+	RTT time.Duration
+	// Uptime is the lowest acceptable fraction of samples that were connected
+	Uptime float64
+	// Flaps is the highest acceptable number of times the connection was
+	// lost within the window
+	Flaps int
+}
+
+// DefaultThresholds are the thresholds used by the manager service
+var DefaultThresholds = Thresholds{
+	RTT:    250 * time.Millisecond,
+	Uptime: 0.95,
+	Flaps:  3,
+}
+
+// Observation is the status of a site's peer at one point in time
+type Observation struct {
+	SiteID    int
+	Name      string
+	Connected bool
+	RTT       time.Duration
+	Relay     bool
+}
+
+// SiteHealth summarizes the window of a site
+type SiteHealth struct {
+	SiteID    int
+	Name      string
+	Connected bool
+	Relay     bool
+	RTTP50    time.Duration
+	RTTP95    time.Duration
+	RTTP99    time.Duration
+	// Uptime is the fraction of samples that were connected
+	Uptime float64
+	// RelayFraction is the fraction of connected samples that went through a
+	// relay
+	RelayFraction float64
+	// Flaps is the number of times the connection was lost
+	Flaps   int
+	Samples int
+	// RTTHistory is the average round-trip time over equal slices of the
+	// window, oldest first. Slices in which the site was not connected are 0.
+	RTTHistory []time.Duration
+	Degraded   bool
+	// Reasons lists the thresholds a degraded site crossed
+	Reasons []string
+}
+
+// Change is a site becoming degraded or recovering
+type Change struct {
+	SiteID   int
+	Name     string
+	Degraded bool
+	Reason   string
+}
+
+type sample struct {
+	time      time.Time
+	connected bool
+	rtt       time.Duration
+	relay     bool
+}
+
+type site struct {
+	name     string
+	samples  []sample
+	degraded bool
+}
+
+// Tracker keeps the window of every site. It is safe for concurrent use.
+type Tracker struct {
+	mu         sync.Mutex
+	window     time.Duration
+	thresholds Thresholds
+	sites      map[int]*site
+}
+
+// NewTracker returns a tracker that keeps window of history and judges sites
+// by thresholds
+func NewTracker(window time.Duration, thresholds Thresholds) *Tracker {
+	return &Tracker{
+		window:     window,
+		thresholds: thresholds,
+		sites:      make(map[int]*site),
+	}
+}
+
+// Record adds the observations made at the given time and returns the sites
+// that became degraded or recovered as a result. Sites that have not been
+// observed for a whole window are forgotten.
+func (t *Tracker) Record(at time.Time, observations []Observation) []Change {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var changes []Change
+	for _, o := range observations {
+		s, ok := t.sites[o.SiteID]
+		if !ok {
+			s = &site{}
+			t.sites[o.SiteID] = s
+		}
+		if o.Name != "" {
+			s.name = o.Name
+		}
+		s.samples = append(s.samples, sample{time: at, connected: o.Connected, rtt: o.RTT, relay: o.Relay})
+	}
+
+	cutoff := at.Add(-t.window)
+	for id, s := range t.sites {
+		i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].time.After(cutoff) })
+		s.samples = s.samples[i:]
+		if len(s.samples) == 0 {
+			delete(t.sites, id)
+			continue
+		}
+
+		health := t.summarize(id, s, at)
+		if health.Degraded != s.degraded {
+			s.degraded = health.Degraded
+			changes = append(changes, Change{
+				SiteID:   id,
+				Name:     s.name,
+				Degraded: health.Degraded,
+				Reason:   strings.Join(health.Reasons, ", "),
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].SiteID < changes[j].SiteID })
+	return changes
+}
+
+// Snapshot returns the health of every site as of the given time, sorted by
+// name
+func (t *Tracker) Snapshot(at time.Time) []SiteHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sites := make([]SiteHealth, 0, len(t.sites))
+	for id, s := range t.sites {
+		sites = append(sites, t.summarize(id, s, at))
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].Name != sites[j].Name {
+			return sites[i].Name < sites[j].Name
+		}
+		return sites[i].SiteID < sites[j].SiteID
+	})
+	return sites
+}
+
+// Reset forgets all sites, such as when the tunnel stops
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sites = make(map[int]*site)
+}
+
+// summarize computes the health of s; callers hold t.mu
+func (t *Tracker) summarize(id int, s *site, at time.Time) SiteHealth {
+	health := SiteHealth{
+		SiteID:  id,
+		Name:    s.name,
+		Samples: len(s.samples),
+	}
+	if len(s.samples) == 0 {
+		return health
+	}
+	last := s.samples[len(s.samples)-1]
+	health.Connected = last.connected
+	health.Relay = last.connected && last.relay
+
+	var connected, relayed int
+	var rtts []time.Duration
+	for i, sm := range s.samples {
+		if sm.connected {
+			connected++
+			if sm.relay {
+				relayed++
+			}
+			if sm.rtt > 0 {
+				rtts = append(rtts, sm.rtt)
+			}
+		} else if i > 0 && s.samples[i-1].connected {
+			health.Flaps++
+		}
+	}
+	health.Uptime = float64(connected) / float64(len(s.samples))
+	if connected > 0 {
+		health.RelayFraction = float64(relayed) / float64(connected)
+	}
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	health.RTTP50 = percentile(rtts, 50)
+	health.RTTP95 = percentile(rtts, 95)
+	health.RTTP99 = percentile(rtts, 99)
+	health.RTTHistory = history(s.samples, at.Add(-t.window), t.window)
+
+	if len(s.samples) >= minSamples {
+		if t.thresholds.RTT > 0 && health.RTTP95 > t.thresholds.RTT {
+			health.Reasons = append(health.Reasons, fmt.Sprintf("round-trip time %s", health.RTTP95.Round(time.Millisecond)))
+		}
+		if t.thresholds.Uptime > 0 && health.Uptime < t.thresholds.Uptime {
+			health.Reasons = append(health.Reasons, fmt.Sprintf("uptime %.0f%%", health.Uptime*100))
+		}
+		if t.thresholds.Flaps > 0 && health.Flaps > t.thresholds.Flaps {
+			health.Reasons = append(health.Reasons, fmt.Sprintf("%d reconnects", health.Flaps))
+		}
+		health.Degraded = len(health.Reasons) > 0
+	}
+	return health
+}
+
+// percentile returns the p-th percentile of the sorted durations, using the
+// nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// history averages the round-trip times of the connected samples over
+// HistoryPoints equal slices of the window starting at start
+func history(samples []sample, start time.Time, window time.Duration) []time.Duration {
+	sums := make([]time.Duration, HistoryPoints)
+	counts := make([]int, HistoryPoints)
+	slice := window / HistoryPoints
+	if slice <= 0 {
+		slice = 1
+	}
+	for _, sm := range samples {
+		if !sm.connected || sm.rtt <= 0 {
+			continue
+		}
+		i := int(sm.time.Sub(start) / slice)
+		if i < 0 {
+			i = 0
+		} else if i >= HistoryPoints {
+			i = HistoryPoints - 1
+		}
+		sums[i] += sm.rtt
+		counts[i]++
+	}
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= time.Duration(counts[i])
+		}
+	}
+	return sums
+}
@@ -0,0 +1,263 @@
+package peerhealth
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+
+// at returns the time sec seconds after base
+func at(sec float64) time.Time {
+	return base.Add(time.Duration(sec * float64(time.Second)))
+}
+
+func ms(values ...int) []time.Duration {
+	durations := make([]time.Duration, len(values))
+	for i, v := range values {
+		durations[i] = time.Duration(v) * time.Millisecond
+	}
+	return durations
+}
+
+func TestPercentile(t *testing.T) {
+	oneToHundred := make([]int, 100)
+	for i := range oneToHundred {
+		oneToHundred[i] = i + 1
+	}
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"one sample p50", ms(40), 50, 40 * time.Millisecond},
+		{"one sample p99", ms(40), 99, 40 * time.Millisecond},
+		{"p0 is the lowest", ms(10, 20, 30), 0, 10 * time.Millisecond},
+		{"p100 is the highest", ms(10, 20, 30), 100, 30 * time.Millisecond},
+		{"p50 of four", ms(10, 20, 30, 40), 50, 20 * time.Millisecond},
+		{"nearest rank rounds up", ms(10, 20, 30), 50, 20 * time.Millisecond},
+		{"p95 of ten", ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 95, 10 * time.Millisecond},
+		{"p95 of twenty", ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20), 95, 19 * time.Millisecond},
+		{"p50 of a hundred", ms(oneToHundred...), 50, 50 * time.Millisecond},
+		{"p99 of a hundred", ms(oneToHundred...), 99, 99 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("%s: percentile(%d) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	// A one minute window has one point per second
+	window := time.Minute
+	samples := []sample{
+		{time: at(-5), connected: true, rtt: 90 * time.Millisecond},
+		{time: at(0.2), connected: true, rtt: 10 * time.Millisecond},
+		{time: at(0.8), connected: true, rtt: 30 * time.Millisecond},
+		{time: at(1.5), connected: false, rtt: 500 * time.Millisecond},
+		{time: at(2.5), connected: true, rtt: 0},
+		{time: at(30), connected: true, rtt: 45 * time.Millisecond},
+		{time: at(59.9), connected: true, rtt: 70 * time.Millisecond},
+		{time: at(75), connected: true, rtt: 80 * time.Millisecond},
+	}
+	want := make([]time.Duration, HistoryPoints)
+	want[0] = 130 * time.Millisecond / 3 // earlier samples count in the first point
+	want[30] = 45 * time.Millisecond
+	want[59] = 75 * time.Millisecond // later samples count in the last point
+
+	if got := history(samples, at(0), window); !slices.Equal(got, want) {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	type obs struct {
+		connected bool
+		rtt       int
+		relay     bool
+	}
+	up := func(rtt int) obs { return obs{true, rtt, false} }
+	relayed := func(rtt int) obs { return obs{true, rtt, true} }
+	down := obs{}
+
+	tests := []struct {
+		name    string
+		samples []obs
+		want    SiteHealth
+	}{
+		{
+			"all connected",
+			[]obs{up(10), up(20), up(30), up(40)},
+			SiteHealth{Connected: true, RTTP50: 20 * time.Millisecond, RTTP95: 40 * time.Millisecond, RTTP99: 40 * time.Millisecond, Uptime: 1, Samples: 4},
+		},
+		{
+			"uptime and flaps",
+			[]obs{up(10), down, down, up(10), down, up(10), up(10), up(10)},
+			SiteHealth{Connected: true, RTTP50: 10 * time.Millisecond, RTTP95: 10 * time.Millisecond, RTTP99: 10 * time.Millisecond, Uptime: 5.0 / 8, Flaps: 2, Samples: 8},
+		},
+		{
+			"starting disconnected is not a flap",
+			[]obs{down, down, up(10), up(10)},
+			SiteHealth{Connected: true, RTTP50: 10 * time.Millisecond, RTTP95: 10 * time.Millisecond, RTTP99: 10 * time.Millisecond, Uptime: 0.5, Samples: 4},
+		},
+		{
+			"relay fraction counts connected samples",
+			[]obs{relayed(50), up(10), down, relayed(50), up(10)},
+			SiteHealth{Connected: true, RTTP50: 10 * time.Millisecond, RTTP95: 50 * time.Millisecond, RTTP99: 50 * time.Millisecond, Uptime: 0.8, RelayFraction: 0.5, Flaps: 1, Samples: 5},
+		},
+		{
+			"currently relayed",
+			[]obs{up(10), relayed(50)},
+			SiteHealth{Connected: true, Relay: true, RTTP50: 10 * time.Millisecond, RTTP95: 50 * time.Millisecond, RTTP99: 50 * time.Millisecond, Uptime: 1, RelayFraction: 0.5, Samples: 2},
+		},
+		{
+			"relay flag of a lost connection is ignored",
+			[]obs{relayed(50), {false, 0, true}},
+			SiteHealth{RTTP50: 50 * time.Millisecond, RTTP95: 50 * time.Millisecond, RTTP99: 50 * time.Millisecond, Uptime: 0.5, RelayFraction: 1, Flaps: 1, Samples: 2},
+		},
+		{
+			"no round-trip times",
+			[]obs{up(0), down},
+			SiteHealth{Uptime: 0.5, Flaps: 1, Samples: 2},
+		},
+	}
+	for _, tt := range tests {
+		tracker := NewTracker(time.Minute, Thresholds{})
+		for i, o := range tt.samples {
+			tracker.Record(at(float64(i)), []Observation{{SiteID: 7, Name: "office", Connected: o.connected, RTT: time.Duration(o.rtt) * time.Millisecond, Relay: o.relay}})
+		}
+		sites := tracker.Snapshot(at(float64(len(tt.samples) - 1)))
+		if len(sites) != 1 {
+			t.Fatalf("%s: Snapshot = %+v, want one site", tt.name, sites)
+		}
+		got := sites[0]
+		got.RTTHistory = nil
+		tt.want.SiteID, tt.want.Name = 7, "office"
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordWindowCutoff(t *testing.T) {
+	tracker := NewTracker(10*time.Second, Thresholds{})
+	record := func(sec float64, connected bool) {
+		tracker.Record(at(sec), []Observation{{SiteID: 1, Name: "office", Connected: connected, RTT: 20 * time.Millisecond}})
+	}
+	record(0, true)
+	record(5, false) // flap
+	record(8, true)
+	record(9, false) // flap
+
+	health := tracker.Snapshot(at(9))[0]
+	if health.Flaps != 2 || health.Samples != 4 {
+		t.Errorf("before the cutoff: flaps = %d, samples = %d, want 2, 4", health.Flaps, health.Samples)
+	}
+
+	// At 12s the sample at 0s leaves the window, and with it the first flap,
+	// which has no connected sample before it anymore. Samples exactly at
+	// the cutoff are dropped too.
+	record(12, false)
+	health = tracker.Snapshot(at(12))[0]
+	if health.Flaps != 1 || health.Samples != 4 || health.Uptime != 0.25 {
+		t.Errorf("after the cutoff: flaps = %d, samples = %d, uptime = %v, want 1, 4, 0.25", health.Flaps, health.Samples, health.Uptime)
+	}
+	record(15, false)
+	health = tracker.Snapshot(at(15))[0]
+	if health.Flaps != 1 || health.Samples != 4 {
+		t.Errorf("sample at the cutoff: flaps = %d, samples = %d, want 1, 4", health.Flaps, health.Samples)
+	}
+}
+
+func TestRecordForgetsSites(t *testing.T) {
+	tracker := NewTracker(10*time.Second, Thresholds{})
+	tracker.Record(at(0), []Observation{{SiteID: 2, Name: "lab", Connected: true}, {SiteID: 1, Name: "office", Connected: true}})
+	tracker.Record(at(5), []Observation{{SiteID: 1, Connected: true}})
+
+	sites := tracker.Snapshot(at(5))
+	if len(sites) != 2 || sites[0].Name != "lab" || sites[1].Name != "office" {
+		t.Errorf("Snapshot = %+v, want lab and office sorted by name", sites)
+	}
+
+	// Site 2 was last seen at 0s, a whole window ago
+	tracker.Record(at(10), []Observation{{SiteID: 1, Connected: true}})
+	sites = tracker.Snapshot(at(10))
+	if len(sites) != 1 || sites[0].SiteID != 1 || sites[0].Name != "office" {
+		t.Errorf("Snapshot = %+v, want only office, keeping its name", sites)
+	}
+
+	tracker.Reset()
+	if sites := tracker.Snapshot(at(10)); len(sites) != 0 {
+		t.Errorf("Snapshot after Reset = %+v", sites)
+	}
+}
+
+func TestRecordChanges(t *testing.T) {
+	thresholds := Thresholds{RTT: 100 * time.Millisecond, Uptime: 0.9, Flaps: 2}
+	good := Observation{SiteID: 1, Name: "office", Connected: true, RTT: 20 * time.Millisecond}
+	slow := Observation{SiteID: 1, Name: "office", Connected: true, RTT: 300 * time.Millisecond}
+	lost := Observation{SiteID: 1, Name: "office"}
+
+	type step struct {
+		o    Observation
+		want []Change
+	}
+	repeat := func(n int, o Observation) []step {
+		steps := make([]step, n)
+		for i := range steps {
+			steps[i] = step{o: o}
+		}
+		return steps
+	}
+	degraded := func(reason string) []Change {
+		return []Change{{SiteID: 1, Name: "office", Degraded: true, Reason: reason}}
+	}
+	recovered := []Change{{SiteID: 1, Name: "office"}}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			"too few samples to judge",
+			repeat(minSamples-1, lost),
+		},
+		{
+			"lost connection",
+			append(repeat(minSamples-1, lost), step{lost, degraded("uptime 0%")}),
+		},
+		{
+			"slow connection recovers once slow samples leave the window",
+			slices.Concat(
+				repeat(minSamples-1, slow),
+				[]step{{slow, degraded("round-trip time 300ms")}},
+				repeat(minSamples-1, good),
+				[]step{{good, recovered}},
+				repeat(3, good),
+			),
+		},
+		{
+			"flapping",
+			slices.Concat(
+				[]step{{good, nil}, {lost, nil}, {good, nil}, {lost, nil}, {good, nil}, {lost, nil}},
+				repeat(3, good),
+				[]step{{good, degraded("uptime 70%, 3 reconnects")}},
+			),
+		},
+	}
+	for _, tt := range tests {
+		// One sample per second in a ten second window keeps minSamples
+		tracker := NewTracker(time.Duration(minSamples)*time.Second, thresholds)
+		for i, s := range tt.steps {
+			got := tracker.Record(at(float64(i)), []Observation{s.o})
+			if !reflect.DeepEqual(got, s.want) {
+				t.Errorf("%s: step %d: changes = %+v, want %+v", tt.name, i, got, s.want)
+			}
+		}
+	}
+}
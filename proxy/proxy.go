@@ -0,0 +1,265 @@
+// Package proxy describes the outbound proxy used to reach the Pangolin
+// server and the update server: the proxy of the system, none, or an
+// explicit HTTP(S) or SOCKS5 proxy with optional credentials and a list of
+// hosts that bypass it.
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Mode selects how connections reach the servers
+type Mode string
+
+const (
+	// ModeSystem uses the proxy settings of the system: on Windows, those
+	// of the user, with their PAC script, and the environment otherwise. It
+	// is the default.
+	ModeSystem Mode = "system"
+	// ModeNone connects directly
+	ModeNone Mode = "none"
+	// ModeHTTP uses an explicit HTTP or HTTPS proxy
+	ModeHTTP Mode = "http"
+	// ModeSOCKS5 uses an explicit SOCKS5 proxy
+	ModeSOCKS5 Mode = "socks5"
+)
+
+// Config is the proxy configuration
+type Config struct {
+	Mode Mode `json:"mode,omitempty"`
+	// Address is the host and port of an explicit proxy. An HTTP proxy given
+	// as an https:// URL is reached over TLS.
+	Address string `json:"address,omitempty"`
+	// Username and Password authenticate to an explicit proxy. The password
+	// is kept by the secret manager, never in the config file.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Bypass lists hosts that skip an explicit proxy. Entries may be exact
+	// host names, domain suffixes (".corp" or "*.corp"), patterns such as
+	// "10.*", or "<local>" for host names without a dot.
+	Bypass []string `json:"bypass,omitempty"`
+}
+
+// ErrAuthenticationRequired is returned when the proxy rejects the
+// credentials, or needs some and none were given
+var ErrAuthenticationRequired = errors.New("the proxy requires a user name and password, or rejected the ones given")
+
+// EffectiveMode returns the mode, ModeSystem if none is set
+func (c Config) EffectiveMode() Mode {
+	if c.Mode == "" {
+		return ModeSystem
+	}
+	return c.Mode
+}
+
+// IsExplicit reports whether an explicit proxy is configured
+func (c Config) IsExplicit() bool {
+	mode := c.EffectiveMode()
+	return mode == ModeHTTP || mode == ModeSOCKS5
+}
+
+// Copy returns a copy of c that shares nothing with it
+func (c Config) Copy() Config {
+	c.Bypass = append([]string(nil), c.Bypass...)
+	return c
+}
+
+// WithoutPassword returns c without its password, to be saved or logged
+func (c Config) WithoutPassword() Config {
+	c = c.Copy()
+	c.Password = ""
+	return c
+}
+
+// String implements fmt.Stringer without the password
+func (c Config) String() string {
+	if !c.IsExplicit() {
+		return string(c.EffectiveMode())
+	}
+	user := ""
+	if c.Username != "" {
+		user = c.Username + "@"
+	}
+	return fmt.Sprintf("%s://%s%s (bypass: %s)", c.EffectiveMode(), user, hostPort(c.Address), strings.Join(c.Bypass, ";"))
+}
+
+// Validate checks that the configuration can be used
+func (c Config) Validate() error {
+	switch c.EffectiveMode() {
+	case ModeSystem, ModeNone:
+		return nil
+	case ModeHTTP, ModeSOCKS5:
+		_, err := c.URL()
+		return err
+	default:
+		return fmt.Errorf("unknown proxy mode %q", c.Mode)
+	}
+}
+
+// hostPort returns the host and port of an address given with or without a
+// scheme
+func hostPort(address string) string {
+	address = strings.TrimSpace(address)
+	if _, rest, ok := strings.Cut(address, "://"); ok {
+		address = rest
+	}
+	return strings.TrimRight(address, "/")
+}
+
+// URL returns the URL of an explicit proxy, with its credentials
+func (c Config) URL() (*url.URL, error) {
+	mode := c.EffectiveMode()
+	if mode != ModeHTTP && mode != ModeSOCKS5 {
+		return nil, fmt.Errorf("no explicit proxy is configured (mode %s)", mode)
+	}
+
+	address := strings.TrimSpace(c.Address)
+	if address == "" {
+		return nil, errors.New("the proxy address is empty")
+	}
+	scheme := string(mode)
+	if before, _, ok := strings.Cut(address, "://"); ok {
+		switch strings.ToLower(before) {
+		case "http", "https":
+			if mode != ModeHTTP {
+				return nil, fmt.Errorf("the proxy address %q is not a SOCKS5 proxy", address)
+			}
+		case "socks5", "socks5h":
+			if mode != ModeSOCKS5 {
+				return nil, fmt.Errorf("the proxy address %q is not an HTTP proxy", address)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", before)
+		}
+		scheme = strings.ToLower(before)
+	}
+
+	u, err := url.Parse(scheme + "://" + hostPort(address))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %q: %w", address, err)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("invalid proxy address %q: expected host:port", address)
+	}
+	if c.Username != "" {
+		u.User = url.UserPassword(c.Username, c.Password)
+	}
+	return u, nil
+}
+
+// Func returns the function that picks the proxy of a request, for
+// http.Transport.Proxy
+func (c Config) Func() (func(*http.Request) (*url.URL, error), error) {
+	switch c.EffectiveMode() {
+	case ModeSystem:
+		return FromSystem, nil
+	case ModeNone:
+		return nil, nil
+	}
+
+	proxyURL, err := c.URL()
+	if err != nil {
+		return nil, err
+	}
+	bypass := append([]string(nil), c.Bypass...)
+	return func(req *http.Request) (*url.URL, error) {
+		if Bypassed(req.URL.Hostname(), bypass) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// Bypassed reports whether host matches one of the bypass entries
+func Bypassed(host string, bypass []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range bypass {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "<local>":
+			if !strings.Contains(host, ".") && net.ParseIP(host) == nil {
+				return true
+			}
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		case strings.Contains(entry, "*"):
+			if matched, _ := path.Match(entry, host); matched {
+				return true
+			}
+		case host == entry:
+			return true
+		}
+	}
+	return false
+}
+
+// Check connects to target through the proxy and reports whether it could be
+// reached. Any HTTP response from target counts, since only the path through
+// the proxy is checked.
+func Check(ctx context.Context, c Config, target string) error {
+	proxyFunc, err := c.Func()
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   15 * time.Second,
+		// The first response is enough
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return fmt.Errorf("invalid server address %q: %w", target, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if IsAuthenticationError(err) {
+			return ErrAuthenticationRequired
+		}
+		// The server was reached; its certificate is not the proxy's concern
+		var verifyErr *tls.CertificateVerificationError
+		if errors.As(err, &verifyErr) {
+			return nil
+		}
+		return fmt.Errorf("failed to reach %s through the proxy: %w", req.URL.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return ErrAuthenticationRequired
+	}
+	return nil
+}
+
+// IsAuthenticationError reports whether err is the proxy refusing the
+// credentials. net/http reports the status of a failed CONNECT and SOCKS5
+// authentication failures only as text.
+func IsAuthenticationError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, http.StatusText(http.StatusProxyAuthRequired)) ||
+		strings.Contains(msg, "username/password authentication failed")
+}
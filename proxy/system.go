@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Resolve returns a configuration that reaches server the way c does, for a
+// process that does not see the settings c refers to, such as a service
+// running as another user. In ModeSystem, that is the proxy the system
+// selects for server as an explicit proxy, or ModeNone for a direct
+// connection. Other modes are returned as they are.
+func (c Config) Resolve(server string) (Config, error) {
+	if c.EffectiveMode() != ModeSystem {
+		return c.Copy(), nil
+	}
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	req, err := http.NewRequest(http.MethodGet, server, nil)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid server address %q: %w", server, err)
+	}
+	proxyURL, err := FromSystem(req)
+	if err != nil {
+		return Config{}, err
+	}
+	if proxyURL == nil {
+		return Config{Mode: ModeNone}, nil
+	}
+
+	resolved := Config{Mode: ModeHTTP, Address: proxyURL.Host}
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "http":
+	case "https":
+		resolved.Address = "https://" + proxyURL.Host
+	case "socks5", "socks5h":
+		resolved.Mode = ModeSOCKS5
+		resolved.Address = proxyURL.Scheme + "://" + proxyURL.Host
+	default:
+		return Config{}, fmt.Errorf("unsupported system proxy scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.User != nil {
+		resolved.Username = proxyURL.User.Username()
+		resolved.Password, _ = proxyURL.User.Password()
+	}
+	return resolved, nil
+}
+
+// splitProxyList splits a proxy or bypass list of Windows, whose entries are
+// separated by semicolons or white space
+func splitProxyList(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool { return r == ';' || unicode.IsSpace(r) })
+}
+
+// parseProxyList returns the proxy a Windows proxy list selects for scheme.
+// A list is either one proxy for every scheme, like "proxy:8080", or proxies
+// per scheme, like "http=proxy:80;https=proxy:443"; the entry of the scheme
+// wins over one for every scheme. A list without either selects a direct
+// connection, returned as nil.
+func parseProxyList(list, scheme string) (*url.URL, error) {
+	var chosen string
+	for _, entry := range splitProxyList(list) {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			if strings.EqualFold(key, scheme) {
+				chosen = value
+				break
+			}
+			continue
+		}
+		if chosen == "" {
+			chosen = entry
+		}
+	}
+	if chosen == "" {
+		return nil, nil
+	}
+	if !strings.Contains(chosen, "://") {
+		chosen = "http://" + chosen
+	}
+	u, err := url.Parse(chosen)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid system proxy %q", chosen)
+	}
+	return u, nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// FromSystem returns the proxy of the environment for a request, for
+// http.Transport.Proxy; outside Windows, that is the proxy configuration of
+// the system
+func FromSystem(req *http.Request) (*url.URL, error) {
+	return http.ProxyFromEnvironment(req)
+}
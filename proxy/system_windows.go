@@ -0,0 +1,55 @@
+//go:build windows
+
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/fosrl/windows/updater/winhttp"
+	"github.com/fosrl/windows/version"
+)
+
+var (
+	autoProxyOnce    sync.Once
+	autoProxySession *winhttp.Session
+)
+
+// FromSystem returns the proxy the proxy settings of Windows select for a
+// request, for http.Transport.Proxy: the PAC script they set or discover,
+// then their manual proxy and its bypass list. Without any, the environment
+// is used, like http.ProxyFromEnvironment. The settings are those of the
+// user the process runs as.
+func FromSystem(req *http.Request) (*url.URL, error) {
+	config, err := winhttp.CurrentUserProxyConfig()
+	if err != nil {
+		return http.ProxyFromEnvironment(req)
+	}
+
+	if config.AutoDetect || config.AutoConfigURL != "" {
+		// The session only evaluates PAC scripts; if it cannot be opened,
+		// the manual proxy still applies
+		autoProxyOnce.Do(func() {
+			autoProxySession, _ = winhttp.NewSessionWithProxy(version.UserAgent(), &winhttp.ProxyConfig{Direct: true})
+		})
+		if autoProxySession != nil {
+			// The PAC script only needs the scheme and host
+			target := req.URL.Scheme + "://" + req.URL.Host + "/"
+			list, err := autoProxySession.AutoProxyForURL(target, config.AutoDetect, config.AutoConfigURL)
+			if err == nil {
+				return parseProxyList(list, req.URL.Scheme)
+			}
+			// Most networks have no script to discover; the manual proxy
+			// still applies then
+		}
+	}
+
+	if config.Proxy != "" {
+		if Bypassed(req.URL.Hostname(), splitProxyList(config.Bypass)) {
+			return nil, nil
+		}
+		return parseProxyList(config.Proxy, req.URL.Scheme)
+	}
+	return http.ProxyFromEnvironment(req)
+}
@@ -0,0 +1,519 @@
+// Package qrcode encodes short text, such as a URL, as a QR code (ISO/IEC
+// 18004) in byte mode with error correction level M. Only versions 1 to 10
+// are supported, which hold up to 213 bytes; that is enough for a
+// verification URL and keeps the code readable on screen.
+package qrcode
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// ErrTooLong is returned when the text does not fit in a version 10 code
+var ErrTooLong = errors.New("text is too long for a QR code")
+
+// quietZone is the width in modules of the light border around the code
+const quietZone = 4
+
+// blockLayout is the error correction block structure of a version at level M
+type blockLayout struct {
+	ecPerBlock  int
+	shortBlocks int // blocks of shortData data codewords
+	shortData   int
+	longBlocks  int // blocks of shortData+1 data codewords
+}
+
+var layouts = [...]blockLayout{
+	1:  {10, 1, 16, 0},
+	2:  {16, 1, 28, 0},
+	3:  {26, 1, 44, 0},
+	4:  {18, 2, 32, 0},
+	5:  {24, 2, 43, 0},
+	6:  {16, 4, 27, 0},
+	7:  {18, 4, 31, 0},
+	8:  {22, 2, 38, 2},
+	9:  {22, 3, 36, 2},
+	10: {26, 4, 43, 1},
+}
+
+var alignmentPositions = [...][]int{
+	1:  nil,
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+func (l blockLayout) dataCodewords() int {
+	return l.shortBlocks*l.shortData + l.longBlocks*(l.shortData+1)
+}
+
+// Code is an encoded QR code
+type Code struct {
+	// Version is the version of the code, from 1 to 10
+	Version int
+	// Size is the width and height in modules, without the quiet zone
+	Size int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Encode encodes text as a QR code of the smallest version it fits in
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v < len(layouts); v++ {
+		if 4+countBits(v)+8*len(data) <= 8*layouts[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addErrorCorrection(encodeData(version, data)))
+	c.applyBestMask()
+	return c, nil
+}
+
+// Black reports whether the module at column x and row y is dark. Modules
+// outside the code, such as in the quiet zone, are light.
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Image renders the code with its quiet zone, scale pixels per module
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (c.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, width, width))
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			shade := color.Gray{Y: 0xff}
+			if c.Black(x/scale-quietZone, y/scale-quietZone) {
+				shade = color.Gray{Y: 0}
+			}
+			img.SetGray(x, y, shade)
+		}
+	}
+	return img
+}
+
+func newCode(version int) *Code {
+	size := 4*version + 17
+	c := &Code{
+		Version:    version,
+		Size:       size,
+		modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+	return c
+}
+
+// countBits returns the length of the character count in byte mode
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData returns the data codewords: the mode, the count, the bytes, a
+// terminator and padding
+func encodeData(version int, data []byte) []byte {
+	capacity := layouts[version].dataCodewords()
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	terminator := min(4, 8*capacity-len(bits))
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < 8*capacity; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 != 0)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// addErrorCorrection splits data into blocks, computes their error
+// correction codewords and interleaves them
+func (c *Code) addErrorCorrection(data []byte) []byte {
+	layout := layouts[c.Version]
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for i := 0; i < layout.shortBlocks+layout.longBlocks; i++ {
+		length := layout.shortData
+		if i >= layout.shortBlocks {
+			length++
+		}
+		block := data[offset : offset+length]
+		offset += length
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	var result []byte
+	for i := 0; i <= layout.shortData; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		carry := z >> 7
+		z = z<<1 ^ carry*0x1d
+		z ^= (y >> i & 1) * x
+	}
+	return z
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree,
+// without its leading coefficient, highest power first
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	// Timing patterns, partly overwritten by the finder patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, center := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				c.setFunction(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap a finder
+	positions := alignmentPositions[c.Version]
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas until the mask is known
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// formatBits returns the 15-bit format information of level M with mask:
+// the level and mask, their BCH code and the format mask pattern
+func formatBits(mask int) int {
+	// Level M is 00
+	data := mask
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	return (data<<10 | remainder) ^ 0x5412
+}
+
+// drawFormatBits draws the error correction level and mask, twice
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	// The dark module
+	c.setFunction(8, c.Size-8, true)
+}
+
+// versionBits returns the 18-bit version information: the version and its
+// BCH code
+func versionBits(version int) int {
+	remainder := version
+	for i := 0; i < 12; i++ {
+		remainder = remainder<<1 ^ (remainder>>11)*0x1f25
+	}
+	return version<<12 | remainder
+}
+
+// drawVersion draws the version information of versions 7 and up, twice
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionBits(c.Version)
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the two-module wide columns that
+// zigzag up and down from the bottom right corner
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// Skip the vertical timing pattern
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vertical := 0; vertical < c.Size; vertical++ {
+			y := vertical
+			if upward {
+				y = c.Size - 1 - vertical
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunction[y][x] || i >= 8*len(codewords) {
+					continue
+				}
+				c.modules[y][x] = codewords[i/8]>>(7-i%8)&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask inverts the data modules the mask selects. Applying the same
+// mask again undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && maskBit(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty
+func (c *Code) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+}
+
+// penalty scores the patterns that make a code hard to read
+func (c *Code) penalty() int {
+	penalty := 0
+	lines := make([][]bool, 0, 2*c.Size)
+	for y := 0; y < c.Size; y++ {
+		lines = append(lines, c.modules[y])
+	}
+	for x := 0; x < c.Size; x++ {
+		column := make([]bool, c.Size)
+		for y := range column {
+			column[y] = c.modules[y][x]
+		}
+		lines = append(lines, column)
+	}
+
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, line := range lines {
+		// Runs of five or more modules of the same color
+		run := 1
+		for i := 1; i <= len(line); i++ {
+			if i < len(line) && line[i] == line[i-1] {
+				run++
+				continue
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+			run = 1
+		}
+
+		// Patterns that look like finders, with the quiet zone counting as
+		// light modules
+		padded := make([]bool, len(line)+2*quietZone)
+		copy(padded[quietZone:], line)
+		for i := 0; i+11 <= len(padded); i++ {
+			for _, pattern := range finderLike {
+				if equal(padded[i:i+11], pattern) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			// 2x2 blocks of the same color
+			if x+1 < c.Size && y+1 < c.Size {
+				color := c.modules[y][x]
+				if color == c.modules[y][x+1] && color == c.modules[y+1][x] && color == c.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Imbalance of dark and light modules, per 5% away from half
+	total := c.Size * c.Size
+	deviation := abs(dark*20 - total*10)
+	penalty += 10 * (deviation / total)
+	return penalty
+}
+
+func equal(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,193 @@
+package qrcode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The golden files in testdata hold reference encodings, one row per line
+// with '#' for dark and '.' for light modules. Files with several masks
+// separate them with a blank line.
+
+const (
+	version7Text  = "https://app.pangolin.net/auth/login/device?code=WDJB-MJHT&client=pangolin-windows&host=workstation-42.corp.example.com"
+	version10Text = "https://pangolin.internal.example.com:8443/auth/login/device?code=WDJB-MJHT&client=pangolin-windows&version=0.4.1&host=workstation-42.corp.example.com&redirect=%2Fdashboard%2Forgs%2Facme%2Fsites"
+)
+
+func readGolden(t *testing.T, name string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	masks := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n\n")
+	for i := range masks {
+		masks[i] += "\n"
+	}
+	return masks
+}
+
+// matrix draws c the way the golden files do
+func matrix(c *Code) string {
+	var b strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// formatWord reads the format information next to the top left finder
+func (c *Code) formatWord() int {
+	bits := 0
+	set := func(i, x, y int) {
+		if c.modules[y][x] {
+			bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(i, 8, i)
+	}
+	set(6, 8, 7)
+	set(7, 8, 8)
+	set(8, 7, 8)
+	for i := 9; i < 15; i++ {
+		set(i, 14-i, 8)
+	}
+	return bits
+}
+
+// versionWord reads the version information above the bottom left finder
+func (c *Code) versionWord() int {
+	bits := 0
+	for i := 0; i < 18; i++ {
+		if c.modules[c.Size-11+i%3][i/3] {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+func TestEncodeGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		golden  string
+		version int
+		mask    int
+	}{
+		{"version 1", "HELLO WORLD", "version1-masks.txt", 1, 4},
+		{"version 7", version7Text, "version7.txt", 7, 0},
+		{"version 10", version10Text, "version10.txt", 10, 0},
+	}
+	for _, tt := range tests {
+		c, err := Encode(tt.text)
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", tt.name, err)
+		}
+		if c.Version != tt.version || c.Size != 4*tt.version+17 {
+			t.Errorf("%s: version %d size %d, want version %d", tt.name, c.Version, c.Size, tt.version)
+		}
+		if got, want := matrix(c), readGolden(t, tt.golden)[tt.mask]; got != want {
+			t.Errorf("%s: modules differ from %s:\n got\n%s\nwant\n%s", tt.name, tt.golden, got, want)
+		}
+	}
+}
+
+func TestMasksGolden(t *testing.T) {
+	data := encodeData(1, []byte("HELLO WORLD"))
+	golden := readGolden(t, "version1-masks.txt")
+	if len(golden) != 8 {
+		t.Fatalf("golden has %d masks, want 8", len(golden))
+	}
+	for mask := 0; mask < 8; mask++ {
+		c := newCode(1)
+		c.drawFunctionPatterns()
+		c.drawCodewords(c.addErrorCorrection(data))
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if got := matrix(c); got != golden[mask] {
+			t.Errorf("mask %d: modules differ:\n got\n%s\nwant\n%s", mask, got, golden[mask])
+		}
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// The level M words from the format information table of ISO/IEC 18004
+	want := []int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+	for mask, w := range want {
+		if got := formatBits(mask); got != w {
+			t.Errorf("formatBits(%d) = %#04x, want %#04x", mask, got, w)
+		}
+		c := newCode(1)
+		c.drawFormatBits(mask)
+		if got := c.formatWord(); got != w {
+			t.Errorf("mask %d: drawn format word = %#04x, want %#04x", mask, got, w)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	// The version information table of ISO/IEC 18004
+	tests := []struct {
+		version int
+		want    int
+	}{
+		{7, 0x07C94},
+		{8, 0x085BC},
+		{9, 0x09A99},
+		{10, 0x0A4D3},
+	}
+	for _, tt := range tests {
+		if got := versionBits(tt.version); got != tt.want {
+			t.Errorf("versionBits(%d) = %#05x, want %#05x", tt.version, got, tt.want)
+		}
+		c := newCode(tt.version)
+		c.drawVersion()
+		if got := c.versionWord(); got != tt.want {
+			t.Errorf("version %d: drawn version word = %#05x, want %#05x", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeSmallestVersion(t *testing.T) {
+	tests := []struct {
+		length  int
+		version int
+	}{
+		{0, 1},
+		{14, 1},
+		{15, 2},
+		{106, 6},
+		{107, 7},
+		{122, 7},
+		{180, 9},
+		{181, 10},
+		{213, 10},
+	}
+	for _, tt := range tests {
+		c, err := Encode(strings.Repeat("a", tt.length))
+		if err != nil {
+			t.Errorf("%d bytes: %v", tt.length, err)
+			continue
+		}
+		if c.Version != tt.version {
+			t.Errorf("%d bytes: version %d, want %d", tt.length, c.Version, tt.version)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("a", 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("214 bytes: err = %v, want ErrTooLong", err)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build windows
+
+package routes
+
+import (
+	"net/netip"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// LocalNetworks lists the subnets of the addresses of the interfaces that are
+// up, other than skip, the loopback and link-local addresses
+func LocalNetworks(skip string) ([]LocalNetwork, error) {
+	size := uint32(15 * 1024)
+	var buf []byte
+	for {
+		buf = make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC,
+			windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST|windows.GAA_FLAG_SKIP_DNS_SERVER,
+			0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, err
+		}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	var locals []LocalNetwork
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		name := windows.UTF16PtrToString(aa.FriendlyName)
+		if aa.OperStatus != windows.IfOperStatusUp || aa.IfType == windows.IF_TYPE_SOFTWARE_LOOPBACK || name == skip {
+			continue
+		}
+		for ua := aa.FirstUnicastAddress; ua != nil; ua = ua.Next {
+			addr, ok := netip.AddrFromSlice(ua.Address.IP())
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			if addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+				continue
+			}
+			prefix, err := addr.Prefix(int(ua.OnLinkPrefixLength))
+			if err != nil {
+				continue
+			}
+			locals = append(locals, LocalNetwork{Interface: name, LUID: aa.Luid, Prefix: prefix})
+		}
+	}
+	return locals, nil
+}
@@ -0,0 +1,249 @@
+// Package routes decides which address ranges go through the tunnel beyond
+// the routes of the sites, and which stay outside it. The lists are merged,
+// resolved against each other and checked against the local networks by
+// functions without side effects; the tunnel service applies the result.
+package routes
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Settings are the include and exclude lists of CIDR prefixes, global or
+// of one organization
+type Settings struct {
+	// Include are routed through the tunnel
+	Include []string `json:"include,omitempty"`
+	// Exclude stay outside the tunnel, even where a site or an included
+	// prefix covers them
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Copy returns a copy of s that shares nothing with it
+func (s Settings) Copy() Settings {
+	s.Include = append([]string(nil), s.Include...)
+	s.Exclude = append([]string(nil), s.Exclude...)
+	return s
+}
+
+// IsZero reports whether s routes nothing either way
+func (s Settings) IsZero() bool {
+	return len(s.Include) == 0 && len(s.Exclude) == 0
+}
+
+// String implements fmt.Stringer
+func (s Settings) String() string {
+	return fmt.Sprintf("include: %s; exclude: %s", strings.Join(s.Include, ","), strings.Join(s.Exclude, ","))
+}
+
+// Validate checks that the prefixes can be parsed
+func (s Settings) Validate() error {
+	if _, err := ParsePrefixes(s.Include); err != nil {
+		return fmt.Errorf("included routes: %w", err)
+	}
+	if _, err := ParsePrefixes(s.Exclude); err != nil {
+		return fmt.Errorf("excluded routes: %w", err)
+	}
+	return nil
+}
+
+// ParsePrefixes parses addresses and CIDR prefixes. An address is a prefix
+// of its full length. A default route is refused: through the tunnel it
+// would capture the connection that carries the tunnel, and outside it it
+// would leave nothing to route.
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR prefix", entry)
+			}
+			prefix = p
+		} else {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR prefix", entry)
+			}
+			// A prefix drops the zone of its address
+			if addr.Zone() != "" {
+				return nil, fmt.Errorf("%q has a zone", entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if prefix.Bits() == 0 {
+			return nil, fmt.Errorf("%q covers every address", entry)
+		}
+		prefixes = append(prefixes, unmap(prefix))
+	}
+	return prefixes, nil
+}
+
+// unmap returns p masked, with an IPv4-mapped IPv6 prefix as IPv4
+func unmap(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() {
+		bits := p.Bits() - 96
+		if bits < 0 {
+			bits = 0
+		}
+		p = netip.PrefixFrom(p.Addr().Unmap(), bits)
+	}
+	return p.Masked()
+}
+
+// comparePrefixes orders IPv4 before IPv6, then by address, then shorter
+// prefixes first, so that a prefix comes before those it contains
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// Merge returns the smallest sorted list of prefixes that covers the same
+// addresses as prefixes: duplicates and prefixes contained in others are
+// dropped, and adjacent halves are joined.
+func Merge(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.IsValid() {
+			sorted = append(sorted, unmap(p))
+		}
+	}
+	slices.SortFunc(sorted, comparePrefixes)
+
+	var merged []netip.Prefix
+	for _, p := range sorted {
+		if n := len(merged); n > 0 && contains(merged[n-1], p) {
+			continue
+		}
+		merged = append(merged, p)
+		// Joining two halves may complete a half with the one before
+		for n := len(merged); n >= 2; n = len(merged) {
+			parent, ok := siblings(merged[n-2], merged[n-1])
+			if !ok {
+				break
+			}
+			merged = append(merged[:n-2], parent)
+		}
+	}
+	return merged
+}
+
+// contains reports whether a contains all of b
+func contains(a, b netip.Prefix) bool {
+	return a.Bits() <= b.Bits() && a.Contains(b.Addr())
+}
+
+// siblings returns the parent of a and b if they are its two halves
+func siblings(a, b netip.Prefix) (netip.Prefix, bool) {
+	if a.Bits() != b.Bits() || a.Bits() == 0 || a == b || a.Addr().Is4() != b.Addr().Is4() {
+		return netip.Prefix{}, false
+	}
+	parent := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+	if parent.Addr() != a.Addr() || !parent.Contains(b.Addr()) {
+		return netip.Prefix{}, false
+	}
+	return parent, true
+}
+
+// Covered splits prefixes into those that lie entirely within one of by,
+// and the others
+func Covered(prefixes, by []netip.Prefix) (covered, uncovered []netip.Prefix) {
+	for _, p := range prefixes {
+		p = unmap(p)
+		if slices.ContainsFunc(by, func(b netip.Prefix) bool { return contains(unmap(b), p) }) {
+			covered = append(covered, p)
+		} else {
+			uncovered = append(uncovered, p)
+		}
+	}
+	return covered, uncovered
+}
+
+// Plan is what the tunnel applies: the prefixes to route through it, and
+// those to keep outside it
+type Plan struct {
+	Include []netip.Prefix
+	Exclude []netip.Prefix
+}
+
+// Combine resolves the global settings and those of an organization into a
+// plan. The lists of both are joined, and an exclusion wins over an
+// inclusion wherever they overlap: an included prefix within an excluded one
+// is dropped, and an excluded prefix within an included one is routed
+// outside the tunnel as the more specific route.
+func Combine(global, org Settings) (Plan, error) {
+	include, err := ParsePrefixes(append(slices.Clone(global.Include), org.Include...))
+	if err != nil {
+		return Plan{}, fmt.Errorf("included routes: %w", err)
+	}
+	exclude, err := ParsePrefixes(append(slices.Clone(global.Exclude), org.Exclude...))
+	if err != nil {
+		return Plan{}, fmt.Errorf("excluded routes: %w", err)
+	}
+	exclude = Merge(exclude)
+	_, include = Covered(Merge(include), exclude)
+	return Plan{Include: include, Exclude: exclude}, nil
+}
+
+// IsZero reports whether the plan changes no route
+func (p Plan) IsZero() bool {
+	return len(p.Include) == 0 && len(p.Exclude) == 0
+}
+
+// Settings returns the plan as settings, to be carried in a tunnel
+// configuration
+func (p Plan) Settings() Settings {
+	return Settings{Include: prefixStrings(p.Include), Exclude: prefixStrings(p.Exclude)}
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	var s []string
+	for _, p := range prefixes {
+		s = append(s, p.String())
+	}
+	return s
+}
+
+// LocalNetwork is the subnet of an address of a local interface
+type LocalNetwork struct {
+	Interface string
+	// LUID identifies the interface to the routing table
+	LUID   uint64
+	Prefix netip.Prefix
+}
+
+// Conflict is a route of the tunnel that overlaps a local network, so that
+// part of it is reached through one or the other depending on the metrics
+type Conflict struct {
+	Route netip.Prefix
+	Local LocalNetwork
+}
+
+// String implements fmt.Stringer
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s overlaps %s of %s", c.Route, c.Local.Prefix, c.Local.Interface)
+}
+
+// Conflicts returns the routes that overlap a local network, in the order of
+// routes
+func Conflicts(routes []netip.Prefix, locals []LocalNetwork) []Conflict {
+	var conflicts []Conflict
+	for _, route := range routes {
+		route = unmap(route)
+		for _, local := range locals {
+			if route.Overlaps(unmap(local.Prefix)) {
+				conflicts = append(conflicts, Conflict{Route: route, Local: local})
+			}
+		}
+	}
+	return conflicts
+}
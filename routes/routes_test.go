@@ -0,0 +1,172 @@
+package routes
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func prefixes(s string) []netip.Prefix {
+	var p []netip.Prefix
+	for _, field := range strings.Fields(s) {
+		p = append(p, netip.MustParsePrefix(field))
+	}
+	return p
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes([]string{" 10.1.2.3 ", "", "192.168.1.7/24", "2001:db8::1/64", "::ffff:10.0.0.0/104", "fd00::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := prefixes("10.1.2.3/32 192.168.1.0/24 2001:db8::/64 10.0.0.0/8 fd00::1/128"); !slices.Equal(got, want) {
+		t.Errorf("ParsePrefixes() = %v, want %v", got, want)
+	}
+	for _, entry := range []string{"example.com", "10.0.0.0/33", "10.0.0.1:80", "0.0.0.0/0", "::/0", "fe80::1%eth0"} {
+		if _, err := ParsePrefixes([]string{entry}); err == nil {
+			t.Errorf("ParsePrefixes(%q) succeeded", entry)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"10.0.0.0/8 10.0.0.0/8", "10.0.0.0/8"},
+		{"10.1.0.0/16 10.0.0.0/8 10.2.3.0/24", "10.0.0.0/8"},
+		{"10.0.1.0/24 10.0.0.0/24", "10.0.0.0/23"},
+		// Joining cascades up while halves complete each other
+		{"10.0.0.0/24 10.0.1.0/24 10.0.2.0/23", "10.0.0.0/22"},
+		{"10.0.0.0/25 10.0.0.128/26 10.0.0.192/26", "10.0.0.0/24"},
+		// Neighbours that are not halves of one prefix stay apart
+		{"10.0.1.0/24 10.0.2.0/24", "10.0.1.0/24 10.0.2.0/24"},
+		{"192.168.0.0/16 10.0.0.0/8 172.16.0.0/12", "10.0.0.0/8 172.16.0.0/12 192.168.0.0/16"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"::ffff:10.0.0.0/104 10.0.0.0/8", "10.0.0.0/8"},
+		{"2001:db8::/33 2001:db8:8000::/33 10.0.0.0/8", "10.0.0.0/8 2001:db8::/32"},
+		// IPv4 and IPv6 are never joined
+		{"0.0.0.0/1 128.0.0.0/1", "0.0.0.0/0"},
+		{"128.0.0.0/1 ::/1", "128.0.0.0/1 ::/1"},
+	} {
+		got := Merge(prefixes(tt.in))
+		if !slices.Equal(got, prefixes(tt.want)) {
+			t.Errorf("Merge(%s) = %v, want %s", tt.in, got, tt.want)
+		}
+	}
+	if got := Merge([]netip.Prefix{{}, netip.MustParsePrefix("10.0.0.0/8")}); !slices.Equal(got, prefixes("10.0.0.0/8")) {
+		t.Errorf("Merge() with an invalid prefix = %v", got)
+	}
+}
+
+func TestCovered(t *testing.T) {
+	for _, tt := range []struct {
+		in, by, covered, uncovered string
+	}{
+		{"10.1.0.0/16 192.168.1.0/24", "10.0.0.0/8", "10.1.0.0/16", "192.168.1.0/24"},
+		{"10.0.0.0/8", "10.0.0.0/8", "10.0.0.0/8", ""},
+		// Overlapping is not enough
+		{"10.0.0.0/8", "10.1.0.0/16", "", "10.0.0.0/8"},
+		{"10.0.0.0/8", "", "", "10.0.0.0/8"},
+		{"::ffff:10.1.0.0/112", "10.0.0.0/8", "10.1.0.0/16", ""},
+		{"2001:db8::/48", "2001:db8::/32 10.0.0.0/8", "2001:db8::/48", ""},
+	} {
+		covered, uncovered := Covered(prefixes(tt.in), prefixes(tt.by))
+		if !slices.Equal(covered, prefixes(tt.covered)) || !slices.Equal(uncovered, prefixes(tt.uncovered)) {
+			t.Errorf("Covered(%s, %s) = %v, %v, want %s and %s", tt.in, tt.by, covered, uncovered, tt.covered, tt.uncovered)
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		global, org      Settings
+		include, exclude string
+	}{
+		{"nothing", Settings{}, Settings{}, "", ""},
+		{"joined", Settings{Include: []string{"10.0.0.0/24"}}, Settings{Include: []string{"10.0.1.0/24"}, Exclude: []string{"192.168.1.5"}}, "10.0.0.0/23", "192.168.1.5/32"},
+		{"included within an exclusion is dropped", Settings{Include: []string{"10.1.0.0/16", "172.16.0.0/12"}}, Settings{Exclude: []string{"10.0.0.0/8"}}, "172.16.0.0/12", "10.0.0.0/8"},
+		{"exclusion within an inclusion stays", Settings{Include: []string{"10.0.0.0/8"}, Exclude: []string{"10.1.2.0/24"}}, Settings{}, "10.0.0.0/8", "10.1.2.0/24"},
+		{"duplicates across both", Settings{Exclude: []string{"192.168.1.0/24"}}, Settings{Exclude: []string{"192.168.1.0/24", "192.168.1.9"}}, "", "192.168.1.0/24"},
+	} {
+		plan, err := Combine(tt.global, tt.org)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(plan.Include, prefixes(tt.include)) || !slices.Equal(plan.Exclude, prefixes(tt.exclude)) {
+			t.Errorf("%s: plan %+v, want include %s and exclude %s", tt.name, plan, tt.include, tt.exclude)
+		}
+		if plan.IsZero() != (tt.include == "" && tt.exclude == "") {
+			t.Errorf("%s: IsZero() = %v", tt.name, plan.IsZero())
+		}
+	}
+
+	// The global list is not changed by appending the organization's
+	global := Settings{Include: make([]string, 1, 2), Exclude: []string{"192.168.1.0/24"}}
+	global.Include[0] = "10.0.0.0/8"
+	if _, err := Combine(global, Settings{Include: []string{"172.16.0.0/12"}}); err != nil {
+		t.Fatal(err)
+	}
+	if backing := global.Include[:2]; backing[1] != "" {
+		t.Errorf("Combine() wrote %q into the global list", backing[1])
+	}
+
+	for _, settings := range []Settings{{Include: []string{"not a prefix"}}, {Exclude: []string{"0.0.0.0/0"}}} {
+		if _, err := Combine(Settings{}, settings); err == nil {
+			t.Errorf("Combine() with %s succeeded", settings)
+		}
+	}
+}
+
+func TestPlanSettings(t *testing.T) {
+	plan := Plan{Include: prefixes("10.0.0.0/8 2001:db8::/32"), Exclude: prefixes("10.1.0.0/16")}
+	settings := plan.Settings()
+	if !slices.Equal(settings.Include, []string{"10.0.0.0/8", "2001:db8::/32"}) || !slices.Equal(settings.Exclude, []string{"10.1.0.0/16"}) {
+		t.Errorf("Settings() = %s", settings)
+	}
+	if again, err := Combine(settings, Settings{}); err != nil || !slices.Equal(again.Include, plan.Include) || !slices.Equal(again.Exclude, plan.Exclude) {
+		t.Errorf("the settings of a plan combine to %+v (%v), want the plan", again, err)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	wifi := LocalNetwork{Interface: "Wi-Fi", LUID: 1, Prefix: netip.MustParsePrefix("192.168.1.0/24")}
+	lab := LocalNetwork{Interface: "Ethernet", LUID: 2, Prefix: netip.MustParsePrefix("10.20.0.0/16")}
+	v6 := LocalNetwork{Interface: "Wi-Fi", LUID: 1, Prefix: netip.MustParsePrefix("2001:db8:1::/64")}
+	locals := []LocalNetwork{wifi, lab, v6}
+
+	for _, tt := range []struct {
+		name   string
+		routes string
+		want   []Conflict
+	}{
+		{"none", "172.16.0.0/12 2001:db8:2::/48", nil},
+		{"route containing a local network", "192.168.0.0/16", []Conflict{{netip.MustParsePrefix("192.168.0.0/16"), wifi}}},
+		{"route within a local network", "10.20.30.0/24", []Conflict{{netip.MustParsePrefix("10.20.30.0/24"), lab}}},
+		{"same prefix", "192.168.1.0/24", []Conflict{{netip.MustParsePrefix("192.168.1.0/24"), wifi}}},
+		{"IPv6", "2001:db8::/32", []Conflict{{netip.MustParsePrefix("2001:db8::/32"), v6}}},
+		{"IPv4-mapped route", "::ffff:10.0.0.0/104", []Conflict{{netip.MustParsePrefix("10.0.0.0/8"), lab}}},
+		{"in the order of the routes", "10.0.0.0/8 192.168.1.128/25", []Conflict{
+			{netip.MustParsePrefix("10.0.0.0/8"), lab},
+			{netip.MustParsePrefix("192.168.1.128/25"), wifi},
+		}},
+		{"one route, several local networks", "0.0.0.0/1 128.0.0.0/1", []Conflict{
+			{netip.MustParsePrefix("0.0.0.0/1"), lab},
+			{netip.MustParsePrefix("128.0.0.0/1"), wifi},
+		}},
+	} {
+		if got := Conflicts(prefixes(tt.routes), locals); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Conflicts(%s) = %v, want %v", tt.name, tt.routes, got, tt.want)
+		}
+	}
+
+	want := "192.168.0.0/16 overlaps 192.168.1.0/24 of Wi-Fi"
+	if got := (Conflict{Route: netip.MustParsePrefix("192.168.0.0/16"), Local: wifi}).String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -57,14 +57,15 @@ else
 fi
 echo "✓ Updated version/version.go"
 
-# Update installer/pangolin.wxs
+# Update installer/pangolin.wxs. Only the ProductVersion define carries the
+# version; the package and upgrade elements reference it.
 echo "Updating installer/pangolin.wxs..."
 if [[ "$OSTYPE" == "darwin"* ]]; then
     # macOS
-    sed -i '' "s/Version=\"[^\"]*\"/Version=\"${VERSION}\"/" "${INSTALLER_WXS}"
+    sed -i '' "s/<?define ProductVersion = \"[^\"]*\" ?>/<?define ProductVersion = \"${VERSION}\" ?>/" "${INSTALLER_WXS}"
 else
     # Linux
-    sed -i "s/Version=\"[^\"]*\"/Version=\"${VERSION}\"/" "${INSTALLER_WXS}"
+    sed -i "s/<?define ProductVersion = \"[^\"]*\" ?>/<?define ProductVersion = \"${VERSION}\" ?>/" "${INSTALLER_WXS}"
 fi
 echo "✓ Updated installer/pangolin.wxs"
 
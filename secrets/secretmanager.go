@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/proxy"
 	"github.com/zalando/go-keyring"
 )
 
@@ -54,7 +56,9 @@ func (sm *SecretManager) deleteSecret(key string) bool {
 
 // GetSessionToken retrieves the session token for the given user ID
 func (sm *SecretManager) GetSessionToken(userId string) (string, bool) {
-	return sm.getSecret(sm.sessionTokenKey(userId))
+	token, found := sm.getSecret(sm.sessionTokenKey(userId))
+	logging.RegisterSecret(token)
+	return token, found
 }
 
 // GetOlmId retrieves the OLM ID for the given user ID
@@ -64,17 +68,21 @@ func (sm *SecretManager) GetOlmId(userId string) (string, bool) {
 
 // GetOlmSecret retrieves the OLM secret for the given user ID
 func (sm *SecretManager) GetOlmSecret(userId string) (string, bool) {
-	return sm.getSecret(sm.olmSecretKey(userId))
+	secret, found := sm.getSecret(sm.olmSecretKey(userId))
+	logging.RegisterSecret(secret)
+	return secret, found
 }
 
 // SaveSessionToken saves a session token for the given user ID
 func (sm *SecretManager) SaveSessionToken(userId string, token string) bool {
+	logging.RegisterSecret(token)
 	return sm.saveSecret(sm.sessionTokenKey(userId), token)
 }
 
 // SaveOlmCredentials saves both OLM ID and secret for the given user ID
 // Returns true if both were saved successfully
 func (sm *SecretManager) SaveOlmCredentials(userId, olmId, secret string) bool {
+	logging.RegisterSecret(secret)
 	idSaved := sm.saveSecret(sm.olmIdKey(userId), olmId)
 	secretSaved := sm.saveSecret(sm.olmSecretKey(userId), secret)
 	return idSaved && secretSaved
@@ -100,6 +108,35 @@ func (sm *SecretManager) DeleteOlmCredentials(userId string) bool {
 	return idDeleted && secretDeleted
 }
 
+// GetProxyPassword retrieves the password of the explicit proxy
+func (sm *SecretManager) GetProxyPassword() (string, bool) {
+	password, found := sm.getSecret(proxyPasswordKey)
+	logging.RegisterSecret(password)
+	return password, found
+}
+
+// SaveProxyPassword saves the password of the explicit proxy. An empty
+// password deletes it.
+func (sm *SecretManager) SaveProxyPassword(password string) bool {
+	if password == "" {
+		return sm.deleteSecret(proxyPasswordKey)
+	}
+	logging.RegisterSecret(password)
+	return sm.saveSecret(proxyPasswordKey, password)
+}
+
+// WithProxyPassword returns proxyConfig with the saved password, if it
+// authenticates to an explicit proxy
+func (sm *SecretManager) WithProxyPassword(proxyConfig proxy.Config) proxy.Config {
+	if proxyConfig.IsExplicit() && proxyConfig.Username != "" {
+		proxyConfig.Password, _ = sm.GetProxyPassword()
+	}
+	return proxyConfig
+}
+
+// proxyPasswordKey is the key for storing the proxy password
+const proxyPasswordKey = "proxy-password"
+
 // sessionTokenKey returns the key for storing session tokens
 func (sm *SecretManager) sessionTokenKey(userId string) string {
 	return fmt.Sprintf("session-token-%s", userId)
@@ -0,0 +1,197 @@
+// Package sso implements the client side of an OAuth 2.0 authorization code
+// flow with PKCE (RFC 7636) for native apps (RFC 8252): the authorization
+// page opens in the system browser, which is redirected back to a listener on
+// the loopback interface. The listener checks the state before handing out
+// the code, so that a redirect that was not started by this client is
+// rejected.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CallbackPath is the path of the redirect URL
+const CallbackPath = "/callback"
+
+var (
+	// ErrStateMismatch is returned when the redirect carries another state
+	// than the one the flow was started with
+	ErrStateMismatch = errors.New("the sign-in response does not belong to this sign-in")
+	// ErrMissingCode is returned when the redirect carries no code
+	ErrMissingCode = errors.New("the sign-in response has no authorization code")
+)
+
+// AuthorizationError is returned when the identity provider redirects with an
+// error instead of a code, such as when the user declines
+type AuthorizationError struct {
+	Code        string
+	Description string
+}
+
+func (e *AuthorizationError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("sign-in failed: %s", e.Description)
+	}
+	return fmt.Sprintf("sign-in failed: %s", e.Code)
+}
+
+// PKCE is a code verifier and the challenge derived from it
+type PKCE struct {
+	Verifier  string
+	Challenge string
+	// Method is always S256
+	Method string
+}
+
+// NewPKCE returns a random code verifier with its S256 challenge
+func NewPKCE() (PKCE, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return PKCE{}, err
+	}
+	return PKCE{
+		Verifier:  verifier,
+		Challenge: Challenge(verifier),
+		Method:    "S256",
+	}, nil
+}
+
+// Challenge returns the S256 challenge of a code verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewState returns a random state value
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type result struct {
+	code string
+	err  error
+}
+
+// Listener receives the redirect of one sign-in on the loopback interface
+type Listener struct {
+	listener net.Listener
+	server   *http.Server
+	state    string
+
+	once    sync.Once
+	results chan result
+}
+
+// Listen starts a listener on a random port of 127.0.0.1 that accepts the
+// redirect carrying state
+func Listen(state string) (*Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the sign-in response: %w", err)
+	}
+
+	l := &Listener{
+		listener: listener,
+		state:    state,
+		results:  make(chan result, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(CallbackPath, l.handleCallback)
+	l.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go l.server.Serve(listener)
+	return l, nil
+}
+
+// RedirectURL returns the URL the identity provider redirects to
+func (l *Listener) RedirectURL() string {
+	return fmt.Sprintf("http://%s%s", l.listener.Addr().String(), CallbackPath)
+}
+
+// Wait waits for the redirect and returns its authorization code
+func (l *Listener) Wait(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-l.results:
+		return r.code, r.err
+	}
+}
+
+// Close stops the listener
+func (l *Listener) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return l.server.Shutdown(ctx)
+}
+
+func (l *Listener) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Requests with another state are not answers to this sign-in, such as
+	// a page that tries to log the user in to its own account. They are
+	// rejected without ending the wait.
+	state := query.Get("state")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(l.state)) != 1 {
+		writePage(w, http.StatusBadRequest, "Sign-in failed", ErrStateMismatch.Error())
+		return
+	}
+
+	var res result
+	switch {
+	case query.Get("error") != "":
+		res.err = &AuthorizationError{Code: query.Get("error"), Description: query.Get("error_description")}
+	case query.Get("code") == "":
+		res.err = ErrMissingCode
+	default:
+		res.code = query.Get("code")
+	}
+
+	delivered := false
+	l.once.Do(func() {
+		l.results <- res
+		delivered = true
+	})
+	if !delivered {
+		writePage(w, http.StatusConflict, "Sign-in already completed", "You can close this window.")
+		return
+	}
+	if res.err != nil {
+		writePage(w, http.StatusOK, "Sign-in failed", res.err.Error()+" Return to Pangolin to try again.")
+		return
+	}
+	writePage(w, http.StatusOK, "Signed in", "You can close this window and return to Pangolin.")
+}
+
+func writePage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%[1]s</title></head>
+<body style="font-family: 'Segoe UI', sans-serif; text-align: center; margin-top: 15%%">
+<h2>%[1]s</h2><p>%[2]s</p>
+</body></html>
+`, html.EscapeString(title), html.EscapeString(message))
+}
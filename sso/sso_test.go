@@ -0,0 +1,181 @@
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636, appendix B: the verifier encodes these
+	// octets, and the challenge is the one the RFC gives for it
+	octets := []byte{116, 24, 223, 180, 151, 153, 224, 37, 79, 250, 96, 125, 216, 173, 187, 186,
+		22, 212, 37, 77, 105, 214, 191, 240, 91, 88, 5, 88, 83, 132, 141, 121}
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const want = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if encoded := base64.RawURLEncoding.EncodeToString(octets); encoded != verifier {
+		t.Fatalf("the octets encode to %q, not the verifier of the RFC", encoded)
+	}
+	if got := Challenge(verifier); got != want {
+		t.Errorf("Challenge(%q) = %q, want %q", verifier, got, want)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	pkce, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 allows verifiers of 43 to 128 unreserved characters
+	if n := len(pkce.Verifier); n < 43 || n > 128 || strings.Trim(pkce.Verifier, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~") != "" {
+		t.Errorf("verifier %q is not a valid code verifier", pkce.Verifier)
+	}
+	if pkce.Challenge != Challenge(pkce.Verifier) || pkce.Method != "S256" {
+		t.Errorf("PKCE %+v does not derive the challenge with S256", pkce)
+	}
+	other, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Verifier == pkce.Verifier {
+		t.Error("two verifiers are the same")
+	}
+}
+
+// redirect sends the browser redirect with query to the listener and returns
+// the status of the page shown
+func redirect(t *testing.T, l *Listener, query url.Values) int {
+	t.Helper()
+	resp, err := http.Get(l.RedirectURL() + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func listen(t *testing.T) *Listener {
+	t.Helper()
+	l, err := Listen("state-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	if u, err := url.Parse(l.RedirectURL()); err != nil || u.Hostname() != "127.0.0.1" || u.Path != CallbackPath {
+		t.Fatalf("redirect URL %s is not on the loopback interface", l.RedirectURL())
+	}
+	return l
+}
+
+func wait(t *testing.T, l *Listener) (string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	code, err := l.Wait(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("no redirect was delivered")
+	}
+	return code, err
+}
+
+func TestListenerDeliversCode(t *testing.T) {
+	l := listen(t)
+	if status := redirect(t, l, url.Values{"state": {"state-value"}, "code": {"the-code"}}); status != http.StatusOK {
+		t.Errorf("status %d, want 200", status)
+	}
+	code, err := wait(t, l)
+	if err != nil || code != "the-code" {
+		t.Errorf("Wait() = %q, %v, want the-code", code, err)
+	}
+}
+
+func TestListenerRejectsStateMismatch(t *testing.T) {
+	l := listen(t)
+	for _, query := range []url.Values{
+		{"state": {"other-state"}, "code": {"forged-code"}},
+		{"code": {"forged-code"}},
+		{"state": {"state-value-and-more"}, "code": {"forged-code"}},
+	} {
+		if status := redirect(t, l, query); status != http.StatusBadRequest {
+			t.Errorf("%v: status %d, want 400", query, status)
+		}
+	}
+
+	// The wait goes on for the redirect of this sign-in
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if code, err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() = %q, %v after redirects of another sign-in", code, err)
+	}
+	redirect(t, l, url.Values{"state": {"state-value"}, "code": {"the-code"}})
+	if code, err := wait(t, l); err != nil || code != "the-code" {
+		t.Errorf("Wait() = %q, %v, want the-code", code, err)
+	}
+}
+
+func TestListenerErrorRedirect(t *testing.T) {
+	for _, tt := range []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{"error": {"access_denied"}, "error_description": {"The user declined"}}, "sign-in failed: The user declined"},
+		{url.Values{"error": {"server_error"}}, "sign-in failed: server_error"},
+		// An error wins over a code
+		{url.Values{"error": {"access_denied"}, "code": {"the-code"}}, "sign-in failed: access_denied"},
+	} {
+		l := listen(t)
+		tt.query.Set("state", "state-value")
+		if status := redirect(t, l, tt.query); status != http.StatusOK {
+			t.Errorf("%v: status %d, want 200", tt.query, status)
+		}
+		code, err := wait(t, l)
+		var authErr *AuthorizationError
+		if !errors.As(err, &authErr) || err.Error() != tt.want || code != "" {
+			t.Errorf("%v: Wait() = %q, %v, want %q", tt.query, code, err, tt.want)
+		}
+		if authErr != nil && authErr.Code != tt.query.Get("error") {
+			t.Errorf("%v: error code %q", tt.query, authErr.Code)
+		}
+	}
+}
+
+func TestListenerMissingCode(t *testing.T) {
+	l := listen(t)
+	redirect(t, l, url.Values{"state": {"state-value"}})
+	if code, err := wait(t, l); !errors.Is(err, ErrMissingCode) || code != "" {
+		t.Errorf("Wait() = %q, %v, want ErrMissingCode", code, err)
+	}
+}
+
+func TestListenerDeliversOnce(t *testing.T) {
+	l := listen(t)
+	if status := redirect(t, l, url.Values{"state": {"state-value"}, "code": {"first"}}); status != http.StatusOK {
+		t.Errorf("first redirect: status %d, want 200", status)
+	}
+	if status := redirect(t, l, url.Values{"state": {"state-value"}, "code": {"second"}}); status != http.StatusConflict {
+		t.Errorf("second redirect: status %d, want 409", status)
+	}
+	if code, err := wait(t, l); err != nil || code != "first" {
+		t.Errorf("Wait() = %q, %v, want first", code, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if code, err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %q, %v after the code was taken", code, err)
+	}
+}
+
+func TestListenerCanceled(t *testing.T) {
+	l := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() = %v, want context.Canceled", err)
+	}
+}
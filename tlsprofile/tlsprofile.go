@@ -0,0 +1,261 @@
+// Package tlsprofile builds the TLS configuration used to reach a self-hosted
+// Pangolin server: certificates of a private CA to trust besides the system
+// roots, pins of the server's public keys, a client certificate for mutual
+// TLS and the lowest TLS version to accept.
+package tlsprofile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pinPrefix starts a pin in the notation of HTTP public key pinning
+const pinPrefix = "sha256/"
+
+// Profile is the TLS profile of a server
+type Profile struct {
+	// CACertificates holds PEM certificates trusted in addition to the
+	// system roots
+	CACertificates string `json:"caCertificates,omitempty"`
+	// SPKIPins are base64 SHA-256 hashes of the subject public key info of
+	// the server certificate or one of its issuers, optionally prefixed with
+	// "sha256/". If there are any, the server must present one of them.
+	SPKIPins []string `json:"spkiPins,omitempty"`
+	// ClientCertificateFile and ClientKeyFile are PEM files of a client
+	// certificate for mutual TLS
+	ClientCertificateFile string `json:"clientCertificateFile,omitempty"`
+	ClientKeyFile         string `json:"clientKeyFile,omitempty"`
+	// MinTLSVersion is the lowest TLS version to accept, "1.2" or "1.3".
+	// TLS 1.2 if empty.
+	MinTLSVersion string `json:"minTlsVersion,omitempty"`
+}
+
+// IsZero reports whether the profile changes nothing from the defaults
+func (p Profile) IsZero() bool {
+	return p.CACertificates == "" && len(p.SPKIPins) == 0 && p.ClientCertificateFile == "" &&
+		p.ClientKeyFile == "" && p.MinTLSVersion == ""
+}
+
+// Copy returns a copy of p that shares nothing with it
+func (p Profile) Copy() Profile {
+	p.SPKIPins = append([]string(nil), p.SPKIPins...)
+	return p
+}
+
+// PinMismatchError is returned when the server presents none of the pinned
+// public keys, which happens when its certificate was replaced or the
+// connection is intercepted
+type PinMismatchError struct {
+	Host string
+	// Presented are the pins of the certificates of the verified chains
+	Presented []string
+}
+
+func (e *PinMismatchError) Error() string {
+	host := e.Host
+	if host == "" {
+		host = "the server"
+	}
+	return fmt.Sprintf("the certificate of %s does not match the pinned keys (the server presented %s); if the server's certificate was replaced on purpose, update the pins in its server profile",
+		host, strings.Join(e.Presented, ", "))
+}
+
+// SPKIPin returns the pin of a certificate's public key, with its prefix
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// parsePin returns the hash a pin stands for
+func parsePin(pin string) ([]byte, error) {
+	encoded := strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix)
+	hash, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid SPKI pin %q: expected the base64 SHA-256 hash of a public key", pin)
+	}
+	return hash, nil
+}
+
+func parseMinVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported minimum TLS version %q: use 1.2 or 1.3", version)
+	}
+}
+
+// Validate checks that the profile can be used, without building it
+func (p Profile) Validate() error {
+	_, err := p.TLSConfig()
+	return err
+}
+
+// TLSConfig returns the TLS configuration of the profile. The server name is
+// set by the caller, or by net/http from the URL.
+func (p Profile) TLSConfig() (*tls.Config, error) {
+	minVersion, err := parseMinVersion(p.MinTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: minVersion}
+
+	if strings.TrimSpace(p.CACertificates) != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		added, err := appendPEM(roots, []byte(p.CACertificates))
+		if err != nil {
+			return nil, err
+		}
+		if added == 0 {
+			return nil, errors.New("the CA certificates of the server profile contain no PEM certificate")
+		}
+		config.RootCAs = roots
+	}
+
+	if p.ClientCertificateFile != "" || p.ClientKeyFile != "" {
+		if p.ClientCertificateFile == "" || p.ClientKeyFile == "" {
+			return nil, errors.New("a client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(p.ClientCertificateFile, p.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(p.SPKIPins) > 0 {
+		pins := make([][]byte, 0, len(p.SPKIPins))
+		for _, pin := range p.SPKIPins {
+			hash, err := parsePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins = append(pins, hash)
+		}
+		// The chain is verified as usual first; the pins narrow it down
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins)
+		}
+	}
+
+	return config, nil
+}
+
+// appendPEM adds the certificates in data to pool, failing on a PEM block
+// that is not a valid certificate so that a typo does not go unnoticed
+func appendPEM(pool *x509.CertPool, data []byte) (int, error) {
+	added := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return added, fmt.Errorf("invalid CA certificate in the server profile: %w", err)
+		}
+		pool.AddCert(cert)
+		added++
+	}
+	return added, nil
+}
+
+// verifyPins accepts the connection if a pinned key is in a verified chain.
+// The certificates the server presented are not enough on their own: a
+// server can send any certificate along with its chain, and only those that
+// chain up to a trusted root prove anything.
+func verifyPins(cs tls.ConnectionState, pins [][]byte) error {
+	pinned := func(certs []*x509.Certificate) bool {
+		for _, cert := range certs {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, chain := range cs.VerifiedChains {
+		if pinned(chain) {
+			return nil
+		}
+	}
+
+	// The pins of the verified chains are the ones that could be pinned
+	var presented []string
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if pin := SPKIPin(cert); !slices.Contains(presented, pin) {
+				presented = append(presented, pin)
+			}
+		}
+	}
+	return &PinMismatchError{Host: cs.ServerName, Presented: presented}
+}
+
+// HostKey returns the key of the profile of a server: the lower-case host
+// and port of its URL, without the default HTTPS port
+func HostKey(server string) string {
+	server = strings.TrimSpace(server)
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(server)
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "443" {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
+
+// Check makes a request to server through transport, which carries the TLS
+// configuration of the profile, so that a certificate the profile rejects is
+// reported before a connection that would otherwise fail with a less clear
+// error. Any HTTP response counts as success.
+func Check(ctx context.Context, server string, transport *http.Transport) error {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, server, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,176 @@
+package tlsprofile
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newCert issues a certificate for 127.0.0.1, signed by parent or
+// self-signed if parent is nil
+func newCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+}
+
+// serve starts a TLS server presenting leaf followed by extra
+func serve(t *testing.T, leaf *testCert, extra ...*testCert) *httptest.Server {
+	t.Helper()
+	chain := [][]byte{leaf.cert.Raw}
+	for _, cert := range extra {
+		chain = append(chain, cert.cert.Raw)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: chain, PrivateKey: leaf.key}}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func check(t *testing.T, server *httptest.Server, profile Profile) error {
+	t.Helper()
+	config, err := profile.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Check(context.Background(), server.URL, &http.Transport{TLSClientConfig: config})
+}
+
+func TestPins(t *testing.T) {
+	ca := newCert(t, "Test CA", true, nil)
+	leaf := newCert(t, "server", false, ca)
+	// A certificate the server sends along that chains to nothing trusted
+	unrelated := newCert(t, "Unrelated", true, nil)
+	server := serve(t, leaf, unrelated)
+
+	for _, tt := range []struct {
+		name string
+		pins []string
+		ok   bool
+	}{
+		{"leaf pinned", []string{SPKIPin(leaf.cert)}, true},
+		{"CA pinned", []string{SPKIPin(ca.cert)}, true},
+		{"pin without prefix", []string{SPKIPin(ca.cert)[len(pinPrefix):]}, true},
+		{"one of several pinned", []string{SPKIPin(newCert(t, "Other", true, nil).cert), SPKIPin(leaf.cert)}, true},
+		{"unverified certificate pinned", []string{SPKIPin(unrelated.cert)}, false},
+		{"nothing presented pinned", []string{SPKIPin(newCert(t, "Other", true, nil).cert)}, false},
+	} {
+		err := check(t, server, Profile{CACertificates: ca.pem(), SPKIPins: tt.pins})
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var pinErr *PinMismatchError
+		if !errors.As(err, &pinErr) {
+			t.Errorf("%s: error %v, want a PinMismatchError", tt.name, err)
+			continue
+		}
+		want := []string{SPKIPin(leaf.cert), SPKIPin(ca.cert)}
+		if len(pinErr.Presented) != len(want) || pinErr.Presented[0] != want[0] || pinErr.Presented[1] != want[1] {
+			t.Errorf("%s: presented %v, want the verified chain %v", tt.name, pinErr.Presented, want)
+		}
+	}
+}
+
+func TestPinsDoNotReplaceVerification(t *testing.T) {
+	ca := newCert(t, "Test CA", true, nil)
+	server := serve(t, newCert(t, "server", false, ca))
+
+	// A pinned key does not make an untrusted chain trusted
+	config, err := Profile{SPKIPins: []string{SPKIPin(ca.cert)}}.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Check(context.Background(), server.URL, &http.Transport{TLSClientConfig: config})
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("error %v, want an unknown authority", err)
+	}
+}
+
+func TestTLSConfigInvalid(t *testing.T) {
+	for _, profile := range []Profile{
+		{SPKIPins: []string{"sha256/not base64"}},
+		{SPKIPins: []string{"sha256/AAAA"}},
+		{CACertificates: "not a certificate"},
+		{CACertificates: "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"},
+		{ClientCertificateFile: "client.pem"},
+		{MinTLSVersion: "1.1"},
+	} {
+		if _, err := profile.TLSConfig(); err == nil {
+			t.Errorf("TLSConfig of %+v succeeded", profile)
+		}
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	for _, tt := range []struct {
+		server, want string
+	}{
+		{"https://Pangolin.Example.com", "pangolin.example.com"},
+		{"pangolin.example.com", "pangolin.example.com"},
+		{"https://pangolin.example.com:443/path", "pangolin.example.com"},
+		{"https://pangolin.example.com:8443", "pangolin.example.com:8443"},
+		{"https://[2001:db8::1]:8443", "[2001:db8::1]:8443"},
+	} {
+		if got := HostKey(tt.server); got != tt.want {
+			t.Errorf("HostKey(%q) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
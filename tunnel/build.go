@@ -4,31 +4,56 @@ package tunnel
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/fosrl/newt/logger"
-
 	olmpkg "github.com/fosrl/olm/olm"
-	configpkg "github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/tlsprofile"
 	"github.com/fosrl/windows/version"
+	"github.com/gorilla/websocket"
 )
 
+// tunnelKillSwitch is the kill switch of the running tunnel, nil when it is
+// off
+var tunnelKillSwitch *killSwitch
+
 // buildTunnel builds the tunnel
 func buildTunnel(config Config) error {
-	logger.Debug("Build tunnel called: config: %+v", config)
+	logger.Debug("Build tunnel called: config: %s", config)
+
+	if err := configureConnections(config); err != nil {
+		return err
+	}
+
+	// The kill switch fails closed: a tunnel that was asked to block the
+	// traffic outside it does not start without
+	ks, err := startKillSwitch(config)
+	if err != nil {
+		return err
+	}
+	tunnelKillSwitch = ks
 
 	// Create context for OLM
 	olmContext := context.Background()
 
 	// Create OLM GlobalConfig with hardcoded values from Swift
 	olmInitConfig := olmpkg.GlobalConfig{
-		LogLevel:   configpkg.LogLevel,
+		LogLevel:   logging.LevelName(logging.EffectiveLevel(logging.ComponentTunnel)),
 		EnableAPI:  true,
 		SocketPath: OLMNamedPipePath,
 		Version:    version.Number,
 		Agent:      "Pangolin Windows",
 		OnConnected: func() {
 			logger.Info("Tunnel: OLM connected")
+			SetState(StateRunning)
+			notifyStateChange(StateRunning)
+			applyRoutes(config)
 		},
 		OnRegistered: func() {
 			logger.Info("Tunnel: OLM registered")
@@ -41,6 +66,8 @@ func buildTunnel(config Config) error {
 	// Initialize OLM with context and GlobalConfig
 	olmpkg.Init(olmContext, olmInitConfig)
 
+	// OLM takes no route lists of its own; applyRoutes adds the included and
+	// excluded routes once it has brought the interface up
 	olmConfig := olmpkg.TunnelConfig{
 		Endpoint:             config.Endpoint,
 		ID:                   config.ID,
@@ -69,3 +96,134 @@ func buildTunnel(config Config) error {
 	logger.Debug("Build tunnel completed successfully")
 	return nil
 }
+
+// serverTransport carries the proxy and the TLS profile of the server, nil
+// until configureConnections has run
+var serverTransport *http.Transport
+
+// configureConnections makes the proxy and the TLS profile of the server
+// apply to the connections OLM makes to it from this process. OLM takes
+// neither setting of its own; it connects with the default HTTP transport
+// and the default websocket dialer. The settings are installed once, before
+// OLM starts, and only for the server: requests of the default transport to
+// its host are routed to a transport of their own, and the default dialer is
+// replaced by one that uses the proxy for the server only and refuses to
+// apply the profile to any other host. With a TLS profile, the endpoint is
+// checked first, so that a pin mismatch or an untrusted certificate fails
+// here with a clear error instead of as a connection that keeps failing.
+func configureConnections(config Config) error {
+	if serverTransport != nil {
+		return errors.New("the connections to the server are already configured")
+	}
+	if config.Proxy == nil && config.TLS == nil {
+		return nil
+	}
+	host := tlsprofile.HostKey(config.Endpoint)
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	transport := defaultTransport.Clone()
+	dialer := *websocket.DefaultDialer
+
+	if config.Proxy != nil {
+		proxyFunc, err := config.Proxy.Func()
+		if err != nil {
+			return fmt.Errorf("the proxy settings cannot be used: %w", err)
+		}
+		transport.Proxy = proxyFunc
+		dialer.Proxy = serverProxy(host, proxyFunc, dialer.Proxy)
+		logger.Info("Tunnel: Using proxy %s for %s", config.Proxy, host)
+	}
+
+	if config.TLS != nil {
+		tlsConfig, err := config.TLS.TLSConfig()
+		if err != nil {
+			return fmt.Errorf("the server profile of %s cannot be used: %w", host, err)
+		}
+		transport.TLSClientConfig = tlsConfig
+		dialer.TLSClientConfig = serverOnly(serverHostname(config.Endpoint), tlsConfig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := tlsprofile.Check(ctx, config.Endpoint, transport); err != nil {
+			logger.Error("Tunnel: TLS check of %s failed: %v", config.Endpoint, err)
+			return fmt.Errorf("failed to verify the server %s: %w", host, err)
+		}
+		logger.Info("Tunnel: Using the server profile of %s", host)
+	}
+
+	// RegisterProtocol panics on a scheme registered twice, which the check
+	// of serverTransport above rules out
+	route := serverRoute{host: host, transport: transport}
+	defaultTransport.RegisterProtocol("https", route)
+	defaultTransport.RegisterProtocol("http", route)
+	websocket.DefaultDialer = &dialer
+	serverTransport = transport
+	return nil
+}
+
+// requestHost returns the host key of a request URL, to compare with the one
+// of the server
+func requestHost(u *url.URL) string {
+	return tlsprofile.HostKey(u.Scheme + "://" + u.Host)
+}
+
+// serverRoute sends the requests of the default transport to the server
+// through the transport of the server, and leaves the others to the default
+type serverRoute struct {
+	host      string
+	transport *http.Transport
+}
+
+func (r serverRoute) RoundTrip(req *http.Request) (*http.Response, error) {
+	if requestHost(req.URL) != r.host {
+		return nil, http.ErrSkipAltProtocol
+	}
+	return r.transport.RoundTrip(req)
+}
+
+// serverProxy returns a proxy function that uses proxyFunc for the server
+// and fallback, which may be nil, for any other host
+func serverProxy(host string, proxyFunc, fallback func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if requestHost(req.URL) == host {
+			if proxyFunc == nil {
+				return nil, nil
+			}
+			return proxyFunc(req)
+		}
+		if fallback == nil {
+			return nil, nil
+		}
+		return fallback(req)
+	}
+}
+
+// serverHostname returns the host name of the server, as TLS names it
+func serverHostname(server string) string {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return server
+	}
+	return u.Hostname()
+}
+
+// serverOnly returns a copy of config that fails the handshake with any host
+// but hostname. The server is verified before a client certificate is sent,
+// so neither the CAs nor the client certificate of the profile are used with
+// another host.
+func serverOnly(hostname string, config *tls.Config) *tls.Config {
+	config = config.Clone()
+	verify := config.VerifyConnection
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if !strings.EqualFold(cs.ServerName, hostname) {
+			return fmt.Errorf("the server profile of %s does not apply to %s", hostname, cs.ServerName)
+		}
+		if verify != nil {
+			return verify(cs)
+		}
+		return nil
+	}
+	return config
+}
@@ -3,8 +3,6 @@
 package tunnel
 
 import (
-	"github.com/fosrl/newt/logger"
-
 	olmpkg "github.com/fosrl/olm/olm"
 )
 
@@ -15,5 +13,9 @@ func destroyTunnel(config Config) {
 	olmpkg.StopApi()
 	olmpkg.StopTunnel()
 
+	removeExcludedRoutes()
+	tunnelKillSwitch.stop()
+	tunnelKillSwitch = nil
+
 	logger.Debug("Destroy tunnel completed successfully")
 }
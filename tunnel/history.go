@@ -0,0 +1,44 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"sync"
+	"time"
+)
+
+// maxStateHistory is the number of state transitions kept for diagnostics
+const maxStateHistory = 200
+
+// StateTransition is a tunnel state change as seen by this process
+type StateTransition struct {
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+}
+
+var (
+	stateHistory     []StateTransition
+	stateHistoryLock sync.Mutex
+)
+
+// recordStateChange appends state to the state history unless it repeats the
+// last recorded state
+func recordStateChange(state State) {
+	stateHistoryLock.Lock()
+	defer stateHistoryLock.Unlock()
+	name := state.String()
+	if n := len(stateHistory); n > 0 && stateHistory[n-1].State == name {
+		return
+	}
+	stateHistory = append(stateHistory, StateTransition{Time: time.Now(), State: name})
+	if len(stateHistory) > maxStateHistory {
+		stateHistory = stateHistory[len(stateHistory)-maxStateHistory:]
+	}
+}
+
+// StateHistory returns the recent tunnel state transitions, oldest first
+func StateHistory() []StateTransition {
+	stateHistoryLock.Lock()
+	defer stateHistoryLock.Unlock()
+	return append([]StateTransition(nil), stateHistory...)
+}
@@ -0,0 +1,247 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/fosrl/windows/events"
+	"github.com/fosrl/windows/killswitch"
+	"github.com/fosrl/windows/killswitch/wfp"
+	"golang.org/x/sys/windows"
+)
+
+// killSwitchName names the filters of the kill switch in the firewall
+const killSwitchName = "Pangolin kill switch"
+
+// killSwitch keeps the rules of the kill switch in force while the tunnel
+// service runs. The filters are persistent, so a crash of the service leaves
+// the traffic blocked until the tunnel is started or uninstalled again.
+type killSwitch struct {
+	config     Config
+	input      killswitch.Input
+	controller *killswitch.Controller
+	sub        *events.Subscription[State]
+}
+
+// startKillSwitch puts the rules in force for a connecting tunnel, and keeps
+// them up to date as its state changes. It returns nil if the kill switch is
+// off.
+func startKillSwitch(config Config) (*killSwitch, error) {
+	if config.KillSwitch == nil || !config.KillSwitch.Enabled {
+		if err := RemoveKillSwitch(); err != nil {
+			logger.Error("Tunnel: Failed to remove the kill switch left behind: %v", err)
+		}
+		return nil, nil
+	}
+
+	input, err := killSwitchInput(config)
+	if err != nil {
+		return nil, err
+	}
+	ks := &killSwitch{
+		config:     config,
+		input:      input,
+		controller: killswitch.NewController(wfp.New(killSwitchName)),
+	}
+	if err := ks.controller.Update(killswitch.PhaseConnecting, input); err != nil {
+		ks.controller.Remove()
+		return nil, fmt.Errorf("failed to engage the kill switch: %w", err)
+	}
+	logger.Info("Tunnel: Kill switch engaged (%s)", config.KillSwitch)
+	for _, rule := range ks.controller.Rules() {
+		logger.Debug("Tunnel: Kill switch rule %s", rule)
+	}
+
+	ks.sub = StateEvents.Subscribe(ks.update)
+	return ks, nil
+}
+
+// update follows a state change of the tunnel. Once it is up, its interface
+// is permitted too.
+func (ks *killSwitch) update(state State) {
+	phase := killSwitchPhase(state)
+	if phase == killswitch.PhaseConnected {
+		luid, err := interfaceLUID(ks.config.InterfaceName)
+		if err != nil {
+			logger.Error("Tunnel: Kill switch cannot find the interface %s: %v", ks.config.InterfaceName, err)
+		}
+		ks.input.TunnelLUID = luid
+	}
+	if err := ks.controller.Update(phase, ks.input); err != nil {
+		logger.Error("Tunnel: Failed to update the kill switch (%s): %v", phase, err)
+	}
+}
+
+// stop removes the rules
+func (ks *killSwitch) stop() {
+	if ks == nil {
+		return
+	}
+	ks.sub.Unsubscribe()
+	if err := ks.controller.Remove(); err != nil {
+		logger.Error("Tunnel: Failed to release the kill switch: %v", err)
+		return
+	}
+	logger.Info("Tunnel: Kill switch released")
+}
+
+// RemoveKillSwitch removes the filters of a kill switch that a crashed
+// tunnel service left in force. A kill switch that is on replaces them when
+// the tunnel starts instead, so that the traffic stays blocked throughout.
+func RemoveKillSwitch() error {
+	return wfp.New(killSwitchName).Remove()
+}
+
+// killSwitchPhase maps a tunnel state to the phase of the kill switch
+func killSwitchPhase(state State) killswitch.Phase {
+	switch state {
+	case StateStarting, StateRegistering, StateRegistered:
+		return killswitch.PhaseConnecting
+	case StateRunning:
+		return killswitch.PhaseConnected
+	case StateReconnecting:
+		return killswitch.PhaseReconnecting
+	default:
+		return killswitch.PhaseStopped
+	}
+}
+
+// killSwitchInput gathers what the rules are computed from. The names are
+// resolved now, before anything is blocked.
+func killSwitchInput(config Config) (killswitch.Input, error) {
+	// The excluded routes are meant to be reached outside the tunnel
+	endpoints, err := killswitch.ParseEndpoints(append(slices.Clone(config.KillSwitch.AllowedEndpoints), config.ExcludeRoutes...))
+	if err != nil {
+		return killswitch.Input{}, err
+	}
+	appPath, err := os.Executable()
+	if err != nil {
+		return killswitch.Input{}, err
+	}
+	input := killswitch.Input{
+		AppPath:   appPath,
+		Endpoints: endpoints,
+		AllowLAN:  config.KillSwitch.AllowLAN,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := config.Endpoint
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	input.ControlPlane, err = resolveURL(ctx, server)
+	if err != nil {
+		return killswitch.Input{}, fmt.Errorf("failed to resolve the server %s: %w", config.Endpoint, err)
+	}
+	if config.Proxy != nil && config.Proxy.IsExplicit() {
+		proxyURL, err := config.Proxy.URL()
+		if err != nil {
+			return killswitch.Input{}, err
+		}
+		input.Proxy, err = resolveURL(ctx, proxyURL.String())
+		if err != nil {
+			return killswitch.Input{}, fmt.Errorf("failed to resolve the proxy: %w", err)
+		}
+	}
+
+	input.DNSServers, err = systemDNSServers(config.InterfaceName)
+	if err != nil {
+		logger.Warn("Tunnel: Kill switch cannot list the DNS servers: %v", err)
+	}
+	return input, nil
+}
+
+// resolveURL returns the addresses and port of the host of rawURL
+func resolveURL(ctx context.Context, rawURL string) ([]netip.AddrPort, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	port := uint16(443)
+	if u.Scheme == "http" {
+		port = 80
+	}
+	if p := u.Port(); p != "" {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		port = uint16(n)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	addrPorts := make([]netip.AddrPort, 0, len(addrs))
+	for _, addr := range addrs {
+		addrPorts = append(addrPorts, netip.AddrPortFrom(addr.Unmap(), port))
+	}
+	return addrPorts, nil
+}
+
+// adapterAddresses returns the network adapters of this computer
+func adapterAddresses() ([]byte, error) {
+	size := uint32(15 * 1024)
+	for {
+		buf := make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC,
+			windows.GAA_FLAG_SKIP_ANYCAST|windows.GAA_FLAG_SKIP_MULTICAST,
+			0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			return buf[:size], nil
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, err
+		}
+	}
+}
+
+// systemDNSServers returns the DNS servers of the adapters that are up,
+// other than the tunnel
+func systemDNSServers(tunnelName string) ([]netip.Addr, error) {
+	buf, err := adapterAddresses()
+	if err != nil || len(buf) == 0 {
+		return nil, err
+	}
+	var servers []netip.Addr
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp || windows.UTF16PtrToString(aa.FriendlyName) == tunnelName {
+			continue
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			if addr, ok := netip.AddrFromSlice(dns.Address.IP()); ok {
+				servers = append(servers, addr.Unmap())
+			}
+		}
+	}
+	return servers, nil
+}
+
+// interfaceLUID returns the LUID of the adapter named name
+func interfaceLUID(name string) (uint64, error) {
+	buf, err := adapterAddresses()
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) > 0 {
+		for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+			if windows.UTF16PtrToString(aa.FriendlyName) == name {
+				return aa.Luid, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no adapter named %s", name)
+}
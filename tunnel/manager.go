@@ -10,15 +10,16 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/Microsoft/go-winio"
 	"github.com/fosrl/windows/auth"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/events"
+	"github.com/fosrl/windows/routes"
 	"github.com/fosrl/windows/secrets"
-
-	"github.com/fosrl/newt/logger"
 )
 
 // IPCClient provides an interface for IPC operations needed by the tunnel manager
@@ -26,7 +27,7 @@ import (
 type IPCClient interface {
 	StartTunnel(config Config) error
 	StopTunnel() error
-	RegisterStateChangeCallback(cb func(State)) func() // Returns unregister function
+	StateEvents() *events.Topic[State] // State changes reported by the manager service
 }
 
 // Manager manages tunnel connection state and operations
@@ -35,8 +36,11 @@ type Manager struct {
 	mu             sync.RWMutex
 	currentState   State
 	isConnected    bool
-	stateCallback  func(State)
-	unregisterCb   func()
+	stateEvents    *events.Topic[State]
+	statusEvents   *events.Topic[*OLMStatusResponse]
+	ipcStateSub    *events.Subscription[State]
+	holepunch      bool       // whether the running tunnel punches holes
+	switchMu       sync.Mutex // serializes organization switches
 	ipcClient      IPCClient
 	authManager    *auth.AuthManager
 	configManager  *config.ConfigManager
@@ -46,6 +50,7 @@ type Manager struct {
 	pollCtx       context.Context
 	pollCancel    context.CancelFunc
 	pollingActive bool
+	lastStatus    *OLMStatusResponse
 }
 
 // NewManager creates a new Manager instance
@@ -64,20 +69,19 @@ func NewManager(
 		accountManager: accountManager,
 		secretManager:  secretManager,
 		ipcClient:      ipcClient,
+		stateEvents:    events.NewTopic[State]("tunnel.manager.state", true),
+		statusEvents:   events.NewTopic[*OLMStatusResponse]("tunnel.manager.status", false),
 	}
 
-	// Register for tunnel state change notifications
+	// Subscribe to tunnel state change notifications
 	if ipcClient != nil {
-		tm.unregisterCb = ipcClient.RegisterStateChangeCallback(func(state State) {
+		tm.ipcStateSub = ipcClient.StateEvents().Subscribe(func(state State) {
 			tm.mu.Lock()
 			tm.currentState = state
 			tm.isConnected = (state == StateRunning)
 			tm.mu.Unlock()
 
-			// Call user-provided callback if set
-			if tm.stateCallback != nil {
-				tm.stateCallback(state)
-			}
+			tm.stateEvents.Publish(state)
 		})
 	}
 
@@ -103,10 +107,8 @@ func (tm *Manager) Close() {
 		tm.pollCtx = nil
 	}
 
-	if tm.unregisterCb != nil {
-		tm.unregisterCb()
-		tm.unregisterCb = nil
-	}
+	tm.ipcStateSub.Unsubscribe()
+	tm.ipcStateSub = nil
 }
 
 // State returns the current tunnel state
@@ -123,11 +125,16 @@ func (tm *Manager) IsConnected() bool {
 	return tm.isConnected
 }
 
-// RegisterStateChangeCallback registers a callback that will be called when tunnel state changes
-func (tm *Manager) RegisterStateChangeCallback(cb func(State)) {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	tm.stateCallback = cb
+// StateEvents returns the topic of tunnel state changes. Late subscribers
+// receive the current state first.
+func (tm *Manager) StateEvents() *events.Topic[State] {
+	return tm.stateEvents
+}
+
+// StatusEvents returns the topic of every OLM status received while status
+// polling is active
+func (tm *Manager) StatusEvents() *events.Topic[*OLMStatusResponse] {
+	return tm.statusEvents
 }
 
 // buildConfig builds the tunnel configuration from auth manager, config manager, and secret manager
@@ -149,7 +156,7 @@ func (tm *Manager) buildConfig() (Config, error) {
 		return Config{}, fmt.Errorf("no organization selected")
 	}
 
-	userId := tm.authManager.CurrentUser().UserId
+	userId := activeAccount.UserID
 	olmId, found := tm.secretManager.GetOlmId(userId)
 	if !found || olmId == "" {
 		return Config{}, fmt.Errorf("OLM ID not found")
@@ -177,17 +184,37 @@ func (tm *Manager) buildConfig() (Config, error) {
 		Secret:              olmSecret,
 		UserToken:           userToken,
 		MTU:                 1280,
-		Holepunch:           true,
+		Holepunch:           tm.configManager.GetPathPreferences(userId, currentOrg.Id).Holepunch(),
 		PingIntervalSeconds: 5,
 		PingTimeoutSeconds:  5,
 		Endpoint:            activeAccount.Hostname,
 		DNS:                 primaryDNS, // Use primary DNS without :53
 		OrgID:               currentOrg.Id,
-		InterfaceName:       "Pangolin",
+		InterfaceName:       InterfaceName,
 		UpstreamDNS:         upstreamDNS, // Each value has :53 appended
 		OverrideDNS:         dnsOverride,
 		TunnelDNS:           dnsTunnel,
 	}
+	if profile, ok := tm.configManager.GetServerProfile(activeAccount.Hostname); ok && !profile.IsZero() {
+		config.TLS = &profile
+	}
+	// The tunnel service runs as SYSTEM, which does not see the proxy
+	// settings of the user, so the system proxy is resolved here
+	proxyConfig, err := tm.secretManager.WithProxyPassword(tm.configManager.GetProxy()).Resolve(activeAccount.Hostname)
+	if err != nil {
+		return Config{}, fmt.Errorf("the proxy settings cannot be used: %w", err)
+	}
+	config.Proxy = &proxyConfig
+	if killSwitch := tm.configManager.GetKillSwitch(); killSwitch.Enabled {
+		config.KillSwitch = &killSwitch
+	}
+	plan, err := routes.Combine(tm.configManager.GetRoutes(), tm.configManager.GetOrgRoutes(userId, currentOrg.Id))
+	if err != nil {
+		return Config{}, fmt.Errorf("the route settings cannot be used: %w", err)
+	}
+	planned := plan.Settings()
+	config.IncludeRoutes = planned.Include
+	config.ExcludeRoutes = planned.Exclude
 
 	return config, nil
 }
@@ -338,6 +365,10 @@ func (tm *Manager) Connect() error {
 		)
 	}
 
+	tm.mu.Lock()
+	tm.holepunch = config.Holepunch
+	tm.mu.Unlock()
+
 	logger.Info("Starting status polling")
 	tm.StartStatusPolling()
 
@@ -386,6 +417,13 @@ type OLMStatusResponse struct {
 	OrgID           string                 `json:"orgId,omitempty"`
 	PeerStatuses    map[int]*OLMPeerStatus `json:"peers,omitempty"`
 	NetworkSettings map[string]interface{} `json:"networkSettings,omitempty"`
+	// Capabilities lists the optional API features of the running OLM
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Supports reports whether OLM advertises capability
+func (s *OLMStatusResponse) Supports(capability string) bool {
+	return s != nil && slices.Contains(s.Capabilities, capability)
 }
 
 // OLMPeerStatus represents the status of a peer connection
@@ -435,6 +473,25 @@ func createOLMHTTPClient() (*http.Client, error) {
 
 // GetOLMStatus retrieves the status from OLM via the named pipe API
 func (tm *Manager) GetOLMStatus() (*OLMStatusResponse, error) {
+	status, err := QueryOLMStatus()
+	if err != nil {
+		return nil, err
+	}
+	tm.mu.Lock()
+	tm.lastStatus = status
+	tm.mu.Unlock()
+	return status, nil
+}
+
+// LastOLMStatus returns the most recent status retrieved from OLM, or nil
+func (tm *Manager) LastOLMStatus() *OLMStatusResponse {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.lastStatus
+}
+
+// QueryOLMStatus retrieves the status from OLM via the named pipe API
+func QueryOLMStatus() (*OLMStatusResponse, error) {
 	client, err := createOLMHTTPClient()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OLM HTTP client: %w", err)
@@ -466,8 +523,9 @@ func (tm *Manager) GetOLMStatus() (*OLMStatusResponse, error) {
 	return &statusResp, nil
 }
 
-// SwitchOLMOrg switches the organization in OLM via the named pipe API
-func (tm *Manager) SwitchOLMOrg(orgID string) error {
+// switchOLMOrg switches the organization in OLM via the named pipe API. Use
+// SwitchOrganization, which also updates the selection.
+func (tm *Manager) switchOLMOrg(orgID string) error {
 	tm.mu.RLock()
 	currentState := tm.currentState
 	tm.mu.RUnlock()
@@ -557,6 +615,8 @@ func (tm *Manager) StartStatusPolling() {
 					continue
 				}
 
+				tm.statusEvents.Publish(status)
+
 				// If terminated, disconnect the tunnel
 				if status.Terminated {
 					logger.Info("OLM status indicates terminated, disconnecting tunnel")
@@ -582,17 +642,19 @@ func (tm *Manager) StartStatusPolling() {
 				// Update the global tunnel state (for consistency with GetState())
 				SetState(newState)
 
-				// Update Manager's internal state and trigger callback (this notifies the UI)
+				// Update Manager's internal state and publish it (this notifies the UI)
 				tm.mu.Lock()
 				oldState := tm.currentState
 				tm.currentState = newState
 				tm.isConnected = (newState == StateRunning)
-				callback := tm.stateCallback
 				tm.mu.Unlock()
 
-				// Only trigger callback if state actually changed
-				if oldState != newState && callback != nil {
-					callback(newState)
+				// Only publish if state actually changed
+				if oldState != newState {
+					tm.stateEvents.Publish(newState)
+				}
+				if oldState != StateRunning && newState == StateRunning {
+					go tm.applyPathPreferences()
 				}
 			}
 		}
@@ -0,0 +1,133 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fosrl/windows/api"
+)
+
+const (
+	// orgSwitchTimeout is how long OLM has to report the new organization
+	// after being asked to switch
+	orgSwitchTimeout = 15 * time.Second
+	// orgSwitchPollInterval is how often the OLM status is checked meanwhile
+	orgSwitchPollInterval = 500 * time.Millisecond
+)
+
+// SwitchOrganization makes org the selected organization. It checks that the
+// user may access it, persists the selection and, if the tunnel is running,
+// switches OLM to it in place and waits for OLM to report it. If any step
+// fails, the previous organization is restored in both, or the tunnel is
+// disconnected if OLM cannot return to it. Errors are ConnectionErrors.
+func (tm *Manager) SwitchOrganization(org *api.Org) error {
+	tm.switchMu.Lock()
+	defer tm.switchMu.Unlock()
+
+	previous := tm.authManager.CurrentOrg()
+	if previous != nil && previous.Id == org.Id {
+		return nil
+	}
+
+	state := tm.State()
+	if state != StateRunning && state != StateStopped && state != StateError {
+		return formatConnectionError("Organization Switch Failed",
+			fmt.Sprintf("The organization can only be switched while the tunnel is connected or disconnected (currently %s).", strings.TrimSuffix(state.DisplayText(), "...")),
+			nil)
+	}
+
+	// Checks access and the organization's policies, and persists the
+	// selection
+	if err := tm.authManager.SelectOrganization(org); err != nil {
+		return formatConnectionError("Organization Switch Failed", err.Error(), err)
+	}
+
+	// A tunnel that is not running connects to the selected organization
+	// next time
+	if state != StateRunning {
+		return nil
+	}
+
+	logger.Info("Switching tunnel organization to: %s", org.Id)
+	err := tm.switchOLMOrg(org.Id)
+	if err == nil {
+		err = tm.waitForOLMOrg(org.Id)
+	}
+	if err != nil {
+		logger.Error("Failed to switch tunnel organization, rolling back: %v", err)
+		disconnected, rollbackErr := tm.rollbackOrgSwitch(previous)
+		var message string
+		switch {
+		case rollbackErr == nil:
+			message = fmt.Sprintf("The tunnel could not switch to %s and stays connected to the previous organization: %v", org.Name, err)
+		case disconnected:
+			message = fmt.Sprintf("The tunnel could not switch to %s: %v. It could not return to the previous organization either (%v), so it was disconnected.", org.Name, err, rollbackErr)
+		default:
+			message = fmt.Sprintf("The tunnel could not switch to %s: %v. It could not return to the previous organization either (%v), and may be connected to either. Disconnect and connect again.", org.Name, err, rollbackErr)
+		}
+		return formatConnectionError("Organization Switch Failed", message, err)
+	}
+
+	logger.Info("Switched tunnel organization to: %s", org.Id)
+
+	// The new organization has its own path preferences
+	go tm.applyPathPreferences()
+	return nil
+}
+
+// waitForOLMOrg waits for OLM to report orgID. Versions of OLM that do not
+// report the organization are trusted once they answer.
+func (tm *Manager) waitForOLMOrg(orgID string) error {
+	deadline := time.Now().Add(orgSwitchTimeout)
+	var lastErr error
+	for {
+		status, err := QueryOLMStatus()
+		if err != nil {
+			lastErr = err
+		} else if status.OrgID == orgID {
+			return nil
+		} else if status.OrgID == "" {
+			logger.Warn("OLM does not report its organization, cannot verify the switch")
+			return nil
+		} else {
+			lastErr = fmt.Errorf("OLM still reports organization %s", status.OrgID)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for OLM to switch: %w", lastErr)
+		}
+		time.Sleep(orgSwitchPollInterval)
+	}
+}
+
+// rollbackOrgSwitch restores the previous organization after a failed
+// switch. OLM is switched back as well, since it may have started
+// switching, and must report the previous organization again. If it cannot,
+// or there was no previous organization to return to, the organization of
+// the tunnel is unknown and it is disconnected. It returns whether it was,
+// and why OLM could not be switched back.
+func (tm *Manager) rollbackOrgSwitch(previous *api.Org) (bool, error) {
+	tm.authManager.SetCurrentOrganization(previous)
+
+	var err error
+	if previous == nil {
+		err = errors.New("no organization was selected before")
+	} else if err = tm.switchOLMOrg(previous.Id); err == nil {
+		err = tm.waitForOLMOrg(previous.Id)
+	}
+	if err == nil {
+		logger.Info("Switched tunnel back to organization: %s", previous.Id)
+		return false, nil
+	}
+
+	logger.Error("Failed to switch tunnel back to the previous organization, disconnecting: %v", err)
+	if stopErr := tm.Disconnect(); stopErr != nil {
+		logger.Error("Failed to disconnect the tunnel after a failed organization switch: %v", stopErr)
+		return false, err
+	}
+	return true, err
+}
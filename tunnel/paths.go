@@ -0,0 +1,213 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fosrl/windows/config"
+)
+
+// CapabilityPathPreferences is advertised in the status of OLM versions that
+// accept path preferences at /path-preferences
+const CapabilityPathPreferences = "path-preferences"
+
+// ErrPathPreferencesUnsupported is returned when the running OLM does not
+// advertise CapabilityPathPreferences; its sites then use the automatic path
+var ErrPathPreferencesUnsupported = errors.New("OLM does not support path preferences")
+
+// PathPreferencesRequest represents the request body for setting the path
+// preferences of the sites
+type PathPreferencesRequest struct {
+	Default   string         `json:"default"`
+	Sites     map[int]string `json:"sites,omitempty"`
+	Holepunch bool           `json:"holepunch"`
+}
+
+// PathPreferences returns the path preferences of the selected organization
+func (tm *Manager) PathPreferences() config.PathPreferences {
+	userID, orgID := tm.currentAccountOrg()
+	if userID == "" || orgID == "" {
+		return config.PathPreferences{}
+	}
+	return tm.configManager.GetPathPreferences(userID, orgID)
+}
+
+// SetPathPreference sets the path preference of a site of the selected
+// organization and applies it to the running tunnel. An empty preference
+// makes the site follow the default again.
+func (tm *Manager) SetPathPreference(siteID int, pref config.PathPreference) error {
+	return tm.updatePathPreferences(func(prefs *config.PathPreferences) {
+		if prefs.Sites == nil {
+			prefs.Sites = make(map[int]config.PathPreference)
+		}
+		prefs.Sites[siteID] = pref
+	})
+}
+
+// SetDefaultPathPreference sets the path preference of the sites of the
+// selected organization that have none of their own, and applies it to the
+// running tunnel
+func (tm *Manager) SetDefaultPathPreference(pref config.PathPreference) error {
+	return tm.updatePathPreferences(func(prefs *config.PathPreferences) {
+		prefs.Default = pref
+	})
+}
+
+func (tm *Manager) updatePathPreferences(update func(*config.PathPreferences)) error {
+	userID, orgID := tm.currentAccountOrg()
+	if userID == "" || orgID == "" {
+		return fmt.Errorf("no organization selected")
+	}
+	prefs := tm.configManager.GetPathPreferences(userID, orgID)
+	update(&prefs)
+	if !tm.configManager.SetPathPreferences(userID, orgID, prefs) {
+		return fmt.Errorf("failed to save path preferences")
+	}
+
+	tm.mu.RLock()
+	running := tm.currentState == StateRunning
+	holepunch := tm.holepunch
+	tm.mu.RUnlock()
+	if !running {
+		return nil
+	}
+	if prefs.Holepunch() && !holepunch {
+		logger.Info("Hole punching is turned off for this tunnel; direct paths take effect on the next connect")
+	}
+	return tm.ApplyPathPreferences()
+}
+
+// ApplyPathPreferences sends the path preferences of the selected
+// organization to OLM, if it supports them
+func (tm *Manager) ApplyPathPreferences() error {
+	status := tm.LastOLMStatus()
+	if status == nil {
+		var err error
+		if status, err = tm.GetOLMStatus(); err != nil {
+			return err
+		}
+	}
+	if !status.Supports(CapabilityPathPreferences) {
+		return ErrPathPreferencesUnsupported
+	}
+
+	tm.mu.RLock()
+	holepunch := tm.holepunch
+	tm.mu.RUnlock()
+	reqBody := pathPreferencesRequest(tm.PathPreferences(), holepunch)
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	client, err := createOLMHTTPClient()
+	if err != nil {
+		return fmt.Errorf("failed to create OLM HTTP client: %w", err)
+	}
+
+	// Make POST request to /path-preferences endpoint
+	req, err := http.NewRequest("POST", "http://localhost/path-preferences", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to OLM: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OLM API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	logger.Info("Applied path preferences: default=%s, %d site overrides", reqBody.Default, len(reqBody.Sites))
+	return nil
+}
+
+// pathPreferencesRequest builds the request that sends prefs to OLM
+func pathPreferencesRequest(prefs config.PathPreferences, holepunch bool) PathPreferencesRequest {
+	req := PathPreferencesRequest{
+		Default:   string(prefs.DefaultPath()),
+		Holepunch: holepunch,
+	}
+	if len(prefs.Sites) > 0 {
+		req.Sites = make(map[int]string, len(prefs.Sites))
+		for siteID, pref := range prefs.Sites {
+			req.Sites[siteID] = string(pref)
+		}
+	}
+	return req
+}
+
+// applyPathPreferences applies the path preferences once the tunnel is up
+func (tm *Manager) applyPathPreferences() {
+	err := tm.ApplyPathPreferences()
+	if errors.Is(err, ErrPathPreferencesUnsupported) {
+		logger.Warn("%v, all sites use the automatic path", err)
+	} else if err != nil {
+		logger.Error("Failed to apply path preferences: %v", err)
+	}
+}
+
+// PathReason explains the path a peer is using, given the site's preference
+func (tm *Manager) PathReason(pref config.PathPreference, peer *OLMPeerStatus) string {
+	if peer == nil || !peer.Connected {
+		switch pref {
+		case config.PathDirect:
+			return "Waiting for a direct connection (direct only)"
+		case config.PathRelay:
+			return "Waiting for the relay (relay only)"
+		default:
+			return "Not connected"
+		}
+	}
+
+	tm.mu.RLock()
+	holepunch := tm.holepunch
+	tm.mu.RUnlock()
+
+	if peer.IsRelay {
+		switch {
+		case pref == config.PathRelay:
+			return "Relay, as preferred for this site"
+		case !holepunch:
+			return "Relay, because hole punching is off for this connection"
+		case pref == config.PathDirect:
+			return "Relay, although direct only is preferred"
+		default:
+			return "Relay, because hole punching did not succeed"
+		}
+	}
+	switch pref {
+	case config.PathDirect:
+		return "Direct, as preferred for this site"
+	case config.PathRelay:
+		return "Direct, although relay only is preferred"
+	default:
+		return "Direct, because hole punching succeeded"
+	}
+}
+
+// currentAccountOrg returns the IDs of the active account and the selected
+// organization
+func (tm *Manager) currentAccountOrg() (userID, orgID string) {
+	if tm.authManager == nil {
+		return "", ""
+	}
+	if user := tm.authManager.CurrentUser(); user != nil {
+		userID = user.UserId
+	}
+	if org := tm.authManager.CurrentOrg(); org != nil {
+		orgID = org.Id
+	}
+	return userID, orgID
+}
@@ -0,0 +1,95 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fosrl/windows/config"
+)
+
+func TestOLMStatusSupports(t *testing.T) {
+	var status OLMStatusResponse
+	if err := json.Unmarshal([]byte(`{"connected":true,"capabilities":["path-preferences"]}`), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Supports(CapabilityPathPreferences) {
+		t.Errorf("Supports(%q) = false for %v", CapabilityPathPreferences, status.Capabilities)
+	}
+	if status.Supports("other") {
+		t.Error(`Supports("other") = true`)
+	}
+
+	// OLM versions without the field support nothing optional
+	var old OLMStatusResponse
+	if err := json.Unmarshal([]byte(`{"connected":true}`), &old); err != nil {
+		t.Fatal(err)
+	}
+	if old.Supports(CapabilityPathPreferences) {
+		t.Error("status without capabilities supports path preferences")
+	}
+	var missing *OLMStatusResponse
+	if missing.Supports(CapabilityPathPreferences) {
+		t.Error("nil status supports path preferences")
+	}
+}
+
+func TestPathPreferencesRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefs     config.PathPreferences
+		holepunch bool
+		want      string
+	}{
+		{
+			"nothing set",
+			config.PathPreferences{},
+			true,
+			`{"default":"auto","holepunch":true}`,
+		},
+		{
+			"explicit overrides are sent even when they match the default",
+			config.PathPreferences{Default: config.PathRelay, Sites: map[int]config.PathPreference{1: config.PathRelay, 2: config.PathDirect}},
+			false,
+			`{"default":"relay","sites":{"1":"relay","2":"direct"},"holepunch":false}`,
+		},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(pathPreferencesRequest(tt.prefs, tt.holepunch))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: request = %s, want %s", tt.name, data, tt.want)
+		}
+	}
+}
+
+func TestPathReason(t *testing.T) {
+	direct := &OLMPeerStatus{Connected: true}
+	relay := &OLMPeerStatus{Connected: true, IsRelay: true}
+	tests := []struct {
+		pref      config.PathPreference
+		peer      *OLMPeerStatus
+		holepunch bool
+		want      string
+	}{
+		{config.PathAuto, nil, true, "Not connected"},
+		{config.PathDirect, &OLMPeerStatus{}, true, "Waiting for a direct connection (direct only)"},
+		{config.PathRelay, nil, true, "Waiting for the relay (relay only)"},
+		{config.PathRelay, relay, true, "Relay, as preferred for this site"},
+		{config.PathAuto, relay, false, "Relay, because hole punching is off for this connection"},
+		{config.PathDirect, relay, true, "Relay, although direct only is preferred"},
+		{config.PathAuto, relay, true, "Relay, because hole punching did not succeed"},
+		{config.PathDirect, direct, true, "Direct, as preferred for this site"},
+		{config.PathRelay, direct, true, "Direct, although relay only is preferred"},
+		{config.PathAuto, direct, true, "Direct, because hole punching succeeded"},
+	}
+	for _, tt := range tests {
+		tm := &Manager{holepunch: tt.holepunch}
+		if got := tm.PathReason(tt.pref, tt.peer); got != tt.want {
+			t.Errorf("PathReason(%q, %+v) with holepunch %v = %q, want %q", tt.pref, tt.peer, tt.holepunch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+//go:build windows
+
+package tunnel
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/fosrl/windows/routes"
+	"golang.org/x/sys/windows"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+)
+
+// OrgRoutes returns the routes of the selected organization
+func (tm *Manager) OrgRoutes() routes.Settings {
+	userID, orgID := tm.currentAccountOrg()
+	if userID == "" || orgID == "" {
+		return routes.Settings{}
+	}
+	return tm.configManager.GetOrgRoutes(userID, orgID)
+}
+
+// SetOrgRoutes sets the routes of the selected organization. They take
+// effect the next time the tunnel connects.
+func (tm *Manager) SetOrgRoutes(settings routes.Settings) error {
+	userID, orgID := tm.currentAccountOrg()
+	if userID == "" || orgID == "" {
+		return fmt.Errorf("no organization selected")
+	}
+	if !tm.configManager.SetOrgRoutes(userID, orgID, settings) {
+		return fmt.Errorf("failed to save routes")
+	}
+	return nil
+}
+
+// excludedRoute is a route added on another interface to keep an excluded
+// prefix outside the tunnel
+type excludedRoute struct {
+	luid        winipcfg.LUID
+	destination netip.Prefix
+	nextHop     netip.Addr
+}
+
+var (
+	// excludedRoutes are the routes added to exclude prefixes, deleted when
+	// the tunnel stops. The routes on the tunnel interface go away with it.
+	excludedRoutes     []excludedRoute
+	excludedRoutesLock sync.Mutex
+)
+
+// applyRoutes applies the included and excluded routes of config once OLM
+// has brought the tunnel interface up, and reports the routes of the tunnel
+// that overlap a local network. It runs again on every connect, as the
+// interface may have been recreated.
+func applyRoutes(config Config) {
+	include, err := routes.ParsePrefixes(config.IncludeRoutes)
+	if err != nil {
+		logger.Error("Tunnel: Invalid included routes: %v", err)
+		return
+	}
+	exclude, err := routes.ParsePrefixes(config.ExcludeRoutes)
+	if err != nil {
+		logger.Error("Tunnel: Invalid excluded routes: %v", err)
+		return
+	}
+	luid, err := interfaceLUID(config.InterfaceName)
+	if err != nil {
+		logger.Error("Tunnel: Cannot apply routes: %v", err)
+		return
+	}
+	tunnel := winipcfg.LUID(luid)
+
+	for _, destination := range include {
+		if err := tunnel.AddRoute(destination, unspecified(destination), 0); err != nil && err != windows.ERROR_OBJECT_ALREADY_EXISTS {
+			logger.Error("Tunnel: Failed to route %s through the tunnel: %v", destination, err)
+			continue
+		}
+		logger.Info("Tunnel: Routing %s through the tunnel", destination)
+	}
+
+	locals, err := routes.LocalNetworks(config.InterfaceName)
+	if err != nil {
+		logger.Warn("Tunnel: Cannot list the local networks: %v", err)
+	}
+	removeExcludedRoutes()
+	if len(exclude) > 0 {
+		excludeRoutes(tunnel, exclude, locals)
+	}
+
+	table, err := winipcfg.GetIPForwardTable2(windows.AF_UNSPEC)
+	if err != nil {
+		logger.Warn("Tunnel: Cannot read the routing table: %v", err)
+		return
+	}
+	var tunnelRoutes []netip.Prefix
+	for i := range table {
+		if table[i].InterfaceLUID == tunnel {
+			tunnelRoutes = append(tunnelRoutes, table[i].DestinationPrefix.Prefix())
+		}
+	}
+	for _, conflict := range routes.Conflicts(tunnelRoutes, locals) {
+		if covered, _ := routes.Covered([]netip.Prefix{conflict.Local.Prefix}, exclude); len(covered) > 0 {
+			continue
+		}
+		logger.Warn("Tunnel: Route %s; exclude %s to keep reaching the local network", conflict, conflict.Local.Prefix)
+	}
+}
+
+// excludeRoutes routes the excluded prefixes outside the tunnel: on the
+// local network they are part of, or through the default gateway. Routes of
+// the tunnel within an excluded prefix are deleted, as they would win over
+// the exclusion; a broader route of the tunnel loses to it, as the less
+// specific one.
+func excludeRoutes(tunnel winipcfg.LUID, exclude []netip.Prefix, locals []routes.LocalNetwork) {
+	table, err := winipcfg.GetIPForwardTable2(windows.AF_UNSPEC)
+	if err != nil {
+		logger.Error("Tunnel: Cannot read the routing table to exclude routes: %v", err)
+		return
+	}
+
+	for i := range table {
+		row := &table[i]
+		if row.InterfaceLUID != tunnel {
+			continue
+		}
+		destination := row.DestinationPrefix.Prefix()
+		if covered, _ := routes.Covered([]netip.Prefix{destination}, exclude); len(covered) == 0 {
+			continue
+		}
+		if err := row.Delete(); err != nil {
+			logger.Error("Tunnel: Failed to remove the route of %s from the tunnel: %v", destination, err)
+		}
+	}
+
+	excludedRoutesLock.Lock()
+	defer excludedRoutesLock.Unlock()
+	for _, destination := range exclude {
+		route, ok := outsideRoute(destination, tunnel, table, locals)
+		if !ok {
+			logger.Error("Tunnel: No route outside the tunnel to exclude %s", destination)
+			continue
+		}
+		err := route.luid.AddRoute(destination, route.nextHop, 0)
+		if err == windows.ERROR_OBJECT_ALREADY_EXISTS {
+			// The route is someone else's; it stays when the tunnel stops
+			logger.Info("Tunnel: %s is already routed outside the tunnel", destination)
+			continue
+		}
+		if err != nil {
+			logger.Error("Tunnel: Failed to exclude %s from the tunnel: %v", destination, err)
+			continue
+		}
+		excludedRoutes = append(excludedRoutes, route)
+		logger.Info("Tunnel: Excluding %s from the tunnel", destination)
+	}
+}
+
+// outsideRoute returns the route of destination outside the tunnel: on-link
+// if a local network contains it, otherwise through the default gateway of
+// its family with the lowest metric
+func outsideRoute(destination netip.Prefix, tunnel winipcfg.LUID, table []winipcfg.MibIPforwardRow2, locals []routes.LocalNetwork) (excludedRoute, bool) {
+	for _, local := range locals {
+		if winipcfg.LUID(local.LUID) != tunnel && local.Prefix.Bits() <= destination.Bits() && local.Prefix.Contains(destination.Addr()) {
+			return excludedRoute{luid: winipcfg.LUID(local.LUID), destination: destination, nextHop: unspecified(destination)}, true
+		}
+	}
+
+	var best *winipcfg.MibIPforwardRow2
+	for i := range table {
+		row := &table[i]
+		prefix := row.DestinationPrefix.Prefix()
+		if row.InterfaceLUID == tunnel || prefix.Bits() != 0 || prefix.Addr().Is4() != destination.Addr().Is4() {
+			continue
+		}
+		if best == nil || row.Metric < best.Metric {
+			best = row
+		}
+	}
+	if best == nil {
+		return excludedRoute{}, false
+	}
+	return excludedRoute{luid: best.InterfaceLUID, destination: destination, nextHop: best.NextHop.Addr()}, true
+}
+
+// removeExcludedRoutes deletes the routes excludeRoutes added, leaving those
+// that were already in the routing table
+func removeExcludedRoutes() {
+	excludedRoutesLock.Lock()
+	defer excludedRoutesLock.Unlock()
+
+	for _, route := range excludedRoutes {
+		if err := route.luid.DeleteRoute(route.destination, route.nextHop); err != nil && err != windows.ERROR_NOT_FOUND {
+			logger.Error("Tunnel: Failed to remove the exclusion of %s: %v", route.destination, err)
+		}
+	}
+	excludedRoutes = nil
+}
+
+// unspecified returns the next hop of an on-link route to destination
+func unspecified(destination netip.Prefix) netip.Addr {
+	if destination.Addr().Is4() {
+		return netip.IPv4Unspecified()
+	}
+	return netip.IPv6Unspecified()
+}
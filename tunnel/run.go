@@ -5,7 +5,6 @@ package tunnel
 import (
 	"time"
 
-	"github.com/fosrl/newt/logger"
 	"golang.org/x/sys/windows/svc"
 )
 
@@ -4,41 +4,39 @@ package tunnel
 
 import (
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"sync"
 
-	"github.com/fosrl/newt/logger"
-
-	olmpkg "github.com/fosrl/olm/olm"
+	"github.com/fosrl/windows/events"
+	"github.com/fosrl/windows/killswitch"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/tlsprofile"
 )
 
 var (
 	tunnelState       State = StateStopped
 	tunnelStateLock   sync.RWMutex
-	stateChangeCb     func(State)
-	stateChangeLock   sync.RWMutex
 	currentTunnelName string
 	tunnelNameLock    sync.RWMutex
 )
 
-// SetStateChangeCallback sets a callback that will be called when tunnel state changes
-func SetStateChangeCallback(cb func(State)) {
-	stateChangeLock.Lock()
-	defer stateChangeLock.Unlock()
-	stateChangeCb = cb
-}
+// StateEvents carries the tunnel state changes made by StartTunnel and
+// StopTunnel
+var StateEvents = events.NewTopic[State]("tunnel.state", true)
 
 func notifyStateChange(state State) {
-	stateChangeLock.RLock()
-	cb := stateChangeCb
-	stateChangeLock.RUnlock()
-	if cb != nil {
-		cb(state)
-	}
+	recordStateChange(state)
+	StateEvents.Publish(state)
 }
 
 // OLMNamedPipePath is the Windows named pipe path for OLM API communication
 const OLMNamedPipePath = `\\.\pipe\pangolin-olm`
 
+// InterfaceName is the name of the tunnel network interface
+const InterfaceName = "Pangolin"
+
 // State represents the state of a tunnel
 type State int
 
@@ -123,14 +121,26 @@ type Config struct {
 	InterfaceName       string   `json:"interfaceName"`
 	UpstreamDNS         []string `json:"upstreamDns"`
 	OverrideDNS         bool     `json:"overrideDns"`
-	TunnelDNS           bool   `json:"tunnelDns"`
+	TunnelDNS           bool     `json:"tunnelDns"`
+	// TLS is the profile of a self-hosted server, nil for none
+	TLS *tlsprofile.Profile `json:"tls,omitempty"`
+	// Proxy is the outbound proxy with its password, nil for the system's
+	Proxy *proxy.Config `json:"proxy,omitempty"`
+	// KillSwitch blocks the traffic outside the tunnel, nil for off
+	KillSwitch *killswitch.Settings `json:"killSwitch,omitempty"`
+	// IncludeRoutes are CIDR prefixes routed through the tunnel besides
+	// the sites, and ExcludeRoutes those kept outside it, resolved from the
+	// global and organization lists
+	IncludeRoutes []string `json:"includeRoutes,omitempty"`
+	ExcludeRoutes []string `json:"excludeRoutes,omitempty"`
 }
 
 func StartTunnel(config Config) error {
 	logger.Info("Tunnel: StartTunnel called")
 
 	// Log the config
-	logger.Info("Tunnel: Starting tunnel with config")
+	config.registerSecrets()
+	logger.Info("Tunnel: Starting tunnel with config: %s", config)
 
 	// Store tunnel name for later use
 	tunnelNameLock.Lock()
@@ -219,6 +229,7 @@ func GetState() State {
 }
 
 func SetState(state State) {
+	recordStateChange(state)
 	tunnelStateLock.Lock()
 	defer tunnelStateLock.Unlock()
 	tunnelState = state
@@ -257,9 +268,54 @@ func installTunnelFromManager(configJSON string) error {
 func ConfigFromJSON(jsonStr string) (Config, error) {
 	var config Config
 	err := json.Unmarshal([]byte(jsonStr), &config)
+	config.registerSecrets()
 	return config, err
 }
 
+// registerSecrets keeps the credentials in c out of all log output
+func (c Config) registerSecrets() {
+	logging.RegisterSecret(c.Secret)
+	logging.RegisterSecret(c.UserToken)
+	if c.Proxy != nil {
+		logging.RegisterSecret(c.Proxy.Password)
+	}
+}
+
+// String implements fmt.Stringer without the credentials, so that configs
+// can be logged with %v and %+v
+func (c Config) String() string {
+	return fmt.Sprintf("{Name:%s Endpoint:%s ID:%s Secret:%s MTU:%d DNS:%s Holepunch:%v PingIntervalSeconds:%d PingTimeoutSeconds:%d UserToken:%s OrgID:%s InterfaceName:%s UpstreamDNS:%v OverrideDNS:%v TunnelDNS:%v TLS:%v Proxy:%v KillSwitch:%v IncludeRoutes:%v ExcludeRoutes:%v}",
+		c.Name, c.Endpoint, c.ID, logging.SecretString(c.Secret), c.MTU, c.DNS, c.Holepunch,
+		c.PingIntervalSeconds, c.PingTimeoutSeconds, logging.SecretString(c.UserToken), c.OrgID,
+		c.InterfaceName, c.UpstreamDNS, c.OverrideDNS, c.TunnelDNS, c.TLS != nil, c.Proxy, c.KillSwitch, c.IncludeRoutes, c.ExcludeRoutes)
+}
+
+// LogValue implements slog.LogValuer without the credentials
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", c.Name),
+		slog.String("endpoint", c.Endpoint),
+		slog.String("id", c.ID),
+		slog.String("secret", logging.SecretString(c.Secret)),
+		slog.Int("mtu", c.MTU),
+		slog.String("dns", c.DNS),
+		slog.Bool("holepunch", c.Holepunch),
+		slog.Int("pingIntervalSeconds", c.PingIntervalSeconds),
+		slog.Int("pingTimeoutSeconds", c.PingTimeoutSeconds),
+		slog.String("userToken", logging.SecretString(c.UserToken)),
+		slog.String("orgId", c.OrgID),
+		slog.String("interfaceName", c.InterfaceName),
+		slog.Any("upstreamDns", c.UpstreamDNS),
+		slog.Bool("overrideDns", c.OverrideDNS),
+		slog.Bool("tunnelDns", c.TunnelDNS),
+		slog.Bool("tls", c.TLS != nil),
+		slog.Any("proxy", c.Proxy),
+		slog.Any("killSwitch", c.KillSwitch),
+		slog.Any("includeRoutes", c.IncludeRoutes),
+		slog.Any("excludeRoutes", c.ExcludeRoutes),
+	)
+}
+
 // ToJSON converts a Config struct to JSON string
 func (c Config) ToJSON() (string, error) {
 	jsonBytes, err := json.Marshal(c)
@@ -275,13 +331,3 @@ func uninstallTunnelFromManager(name string) error {
 	}
 	return uninstallTunnelFunc(name)
 }
-
-func SwitchOrg(orgID string) error {
-	logger.Info("Tunnel: SwitchOrg called with orgID: %s", orgID)
-
-	// Call olmpkg.SwitchOrg
-	olmpkg.SwitchOrg(orgID)
-
-	logger.Info("Tunnel: SwitchOrg completed")
-	return nil
-}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package ui
+
+import (
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/config"
+	"github.com/tailscale/walk"
+	. "github.com/tailscale/walk/declarative"
+)
+
+// showRenameAccountDialog asks for a label for account. It returns the label,
+// empty to show the email address again, and whether the user confirmed.
+func showRenameAccountDialog(owner walk.Form, account config.Account) (string, bool) {
+	var dlg *walk.Dialog
+	var labelLineEdit *walk.LineEdit
+	var saveButton, cancelButton *walk.PushButton
+
+	err := Dialog{
+		AssignTo:      &dlg,
+		Title:         "Rename Account",
+		DefaultButton: &saveButton,
+		CancelButton:  &cancelButton,
+		MinSize:       Size{Width: 360, Height: 0},
+		Layout:        VBox{Margins: Margins{Left: 20, Top: 15, Right: 20, Bottom: 10}, Spacing: 6},
+		Children: []Widget{
+			Label{
+				Text: "Name shown for " + account.Email + " (leave empty to show the email address)",
+			},
+			LineEdit{
+				AssignTo:  &labelLineEdit,
+				Text:      account.Label,
+				CueBanner: account.Email,
+				MaxLength: 64,
+			},
+			Composite{
+				Layout: HBox{MarginsZero: true, Spacing: 8},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo:  &saveButton,
+						Text:      "Save",
+						MinSize:   Size{Width: 75, Height: 0},
+						OnClicked: func() { dlg.Accept() },
+					},
+					PushButton{
+						AssignTo:  &cancelButton,
+						Text:      "Cancel",
+						MinSize:   Size{Width: 75, Height: 0},
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}.Create(owner)
+	if err != nil {
+		logger.Error("Failed to create rename account dialog: %v", err)
+		return "", false
+	}
+
+	if dlg.Run() != walk.DlgCmdOK {
+		return "", false
+	}
+	return labelLineEdit.Text(), true
+}
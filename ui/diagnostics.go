@@ -0,0 +1,77 @@
+//go:build windows
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/diagnostics"
+	"github.com/fosrl/windows/managers"
+	"github.com/fosrl/windows/tunnel"
+	"github.com/tailscale/walk"
+	"github.com/tailscale/win"
+)
+
+// exportDiagnostics asks where to save a diagnostic bundle and writes it in
+// the background
+func exportDiagnostics() {
+	fd := walk.FileDialog{
+		Filter:   "Zip Archives (*.zip)|*.zip|All Files (*.*)|*.*",
+		FilePath: diagnostics.DefaultFileName(),
+		Title:    "Export diagnostics",
+	}
+	if ok, _ := fd.ShowSave(mainWindow); !ok {
+		return
+	}
+	if fd.FilterIndex == 1 && !strings.HasSuffix(strings.ToLower(fd.FilePath), ".zip") {
+		fd.FilePath += ".zip"
+	}
+	path := fd.FilePath
+
+	go func() {
+		logger.Info("Exporting diagnostics to %s", path)
+		_, err := diagnostics.WriteFile(path, collectDiagnosticSources())
+		walk.App().Synchronize(func() {
+			if err != nil {
+				logger.Error("Failed to export diagnostics: %v", err)
+				td := walk.NewTaskDialog()
+				_, _ = td.Show(walk.TaskDialogOpts{
+					Owner:         mainWindow,
+					Title:         "Export Failed",
+					Content:       fmt.Sprintf("Failed to export diagnostics: %v", err),
+					IconSystem:    walk.TaskDialogSystemIconError,
+					CommonButtons: win.TDCBF_OK_BUTTON,
+				})
+				return
+			}
+			trayIcon.ShowInfo("Diagnostics Exported", fmt.Sprintf("Saved to %s", path))
+		})
+	}()
+}
+
+// collectDiagnosticSources gathers the bundle inputs from this process and
+// the manager service
+func collectDiagnosticSources() diagnostics.Sources {
+	src := diagnostics.Sources{
+		LogDir:       config.GetLogDir(),
+		ConfigPath:   configManager.Path(),
+		AccountsPath: accountManager.Path(),
+		StateHistory: tunnel.StateHistory(),
+	}
+	if tunnelManager != nil {
+		src.OLMStatus = tunnelManager.LastOLMStatus()
+	}
+	if src.OLMStatus == nil {
+		src.OLMStatus, src.OLMError = tunnel.QueryOLMStatus()
+	}
+	report, err := managers.IPCClientDiagnostics()
+	if err != nil {
+		src.ManagerError = err
+	} else {
+		src.Manager = &report
+	}
+	return src
+}
@@ -0,0 +1,92 @@
+//go:build windows
+
+package ui
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/doctor"
+	"github.com/tailscale/walk"
+	"github.com/tailscale/win"
+)
+
+// runDoctor runs the connectivity checks in the background and shows the
+// results
+func runDoctor() {
+	go func() {
+		env, err := doctor.NewEnv(apiClient, configManager, accountManager, secretManager)
+		if err != nil {
+			logger.Error("Failed to prepare connection checks: %v", err)
+			walk.App().Synchronize(func() {
+				td := walk.NewTaskDialog()
+				_, _ = td.Show(walk.TaskDialogOpts{
+					Owner:         mainWindow,
+					Title:         "Connection Checks",
+					Content:       "Log in to an account before running the connection checks.",
+					IconSystem:    walk.TaskDialogSystemIconInformation,
+					CommonButtons: win.TDCBF_OK_BUTTON,
+				})
+			})
+			return
+		}
+
+		logger.Info("Running connection checks")
+		results := doctor.Run(context.Background(), env, doctor.DefaultChecks(), func(result doctor.Result) {
+			logger.Info("Connection check %q: %s: %s", result.Name, result.Status, result.Message)
+		})
+		walk.App().Synchronize(func() {
+			showDoctorResults(results)
+		})
+	}()
+}
+
+// showDoctorResults shows the results of the connectivity checks, offering
+// to export a diagnostic bundle if something is wrong
+func showDoctorResults(results []doctor.Result) {
+	var problems int
+	for _, result := range results {
+		if result.Status == doctor.StatusWarn || result.Status == doctor.StatusFail {
+			problems++
+		}
+	}
+
+	opts := walk.TaskDialogOpts{
+		Owner:         mainWindow,
+		Title:         "Connection Checks",
+		Content:       doctor.Report(results),
+		CommonButtons: win.TDCBF_CLOSE_BUTTON,
+	}
+	switch doctor.Worst(results) {
+	case doctor.StatusFail:
+		opts.IconSystem = walk.TaskDialogSystemIconError
+	case doctor.StatusWarn:
+		opts.IconSystem = walk.TaskDialogSystemIconWarning
+	default:
+		opts.IconSystem = walk.TaskDialogSystemIconInformation
+	}
+	switch problems {
+	case 0:
+		opts.Instruction = "All checks passed"
+	case 1:
+		opts.Instruction = "1 problem found"
+	default:
+		opts.Instruction = fmt.Sprintf("%d problems found", problems)
+	}
+
+	export := false
+	if problems > 0 {
+		opts.CustomButtons = []walk.TaskDialogCustomButton{{MainText: "Export Diagnostics..."}}
+		opts.CustomButtons[0].Clicked().Attach(func() bool {
+			export = true
+			return false
+		})
+	}
+
+	td := walk.NewTaskDialog()
+	_, _ = td.Show(opts)
+	if export {
+		exportDiagnostics()
+	}
+}
@@ -41,6 +41,11 @@ const (
 	stateHostingSelection loginState = iota
 	stateReadyToLogin
 	stateDeviceAuthCode
+	statePassword
+	stateTwoFactorCode
+	stateEmailVerification
+	stateSSO
+	stateSSOWaiting
 	stateSuccess
 )
 
@@ -109,7 +114,9 @@ func isDarkMode() bool {
 	return value == 0
 }
 
-// ShowLoginDialog shows the login dialog with full authentication flow
+// ShowLoginDialog shows the login dialog with full authentication flow.
+// reauthAccount is an account whose session expired, to sign in to again on
+// its server, or nil to add an account.
 func ShowLoginDialog(
 	parent walk.Form,
 	authManager *auth.AuthManager,
@@ -117,6 +124,7 @@ func ShowLoginDialog(
 	accountManager *config.AccountManager,
 	apiClient *api.APIClient,
 	tunnelManager *tunnel.Manager,
+	reauthAccount *config.Account,
 ) {
 	// Check if a login dialog is already open
 	openLoginDialogMutex.Lock()
@@ -154,19 +162,51 @@ func ShowLoginDialog(
 		temporaryHostname = activeAccount.Hostname
 	}
 
+	// Email and password login, for machines without a browser
+	loginEmail := ""
+	if reauthAccount != nil {
+		// Start on the account's server, ready to sign in
+		temporaryHostname = reauthAccount.Hostname
+		selfHostedURL = reauthAccount.Hostname
+		hostingOpt = hostingSelfHosted
+		currentState = stateReadyToLogin
+		loginEmail = reauthAccount.Email
+	}
+	loginPassword := ""
+	loginCode := ""
+	ssoOrgID := ""
+
+	// The device auth code can be shown as a QR code instead, for signing
+	// in from a phone
+	showQRCode := false
+	qrCodeURL := ""
+
 	// Context for canceling polling goroutine and login operation
 	pollCtx, cancelPoll := context.WithCancel(context.Background())
 	loginCtx, cancelLogin := context.WithCancel(context.Background())
+	// cancelAttempt cancels the device auth or SSO login in progress, so
+	// that the user can sign in another way
+	var cancelAttempt context.CancelFunc
+	var cancelAttemptMu sync.Mutex
 
 	// UI components
 	var cloudButton, selfHostedButton *walk.PushButton
 	var urlLabel, hintLabel *walk.Label
 	var urlLineEdit *walk.LineEdit
 	var codeLabel *walk.Label
-	var copyButton, openBrowserButton *walk.PushButton
+	var copyButton, openBrowserButton, qrCodeButton *walk.PushButton
+	var qrCodeImageView *walk.ImageView
+	var expiryLabel, serverInfoLabel *walk.Label
 	var manualURLLabel *walk.Label
 	var manualURLComposite *walk.Composite
 	var progressBar *walk.ProgressBar
+	var passwordLinkLabel *walk.LinkLabel
+	var emailLabel, passwordLabel, codePromptLabel *walk.Label
+	var emailLineEdit, passwordLineEdit, codeLineEdit *walk.LineEdit
+	var resendButton *walk.PushButton
+	var ssoOrgLabel, ssoWaitingLabel *walk.Label
+	var ssoOrgLineEdit *walk.LineEdit
+	var ssoOpenBrowserButton *walk.PushButton
 	var backButton, cancelButton, loginButton *walk.PushButton
 	var logoContainer *walk.Composite
 	var termsLabel, andLabel *walk.Label
@@ -174,6 +214,12 @@ func ShowLoginDialog(
 	var termsComposite *walk.Composite
 
 	isReadyToLogin := func() bool {
+		switch currentState {
+		case statePassword:
+			return strings.TrimSpace(loginEmail) != "" && loginPassword != ""
+		case stateTwoFactorCode, stateEmailVerification:
+			return strings.TrimSpace(loginCode) != ""
+		}
 		switch hostingOpt {
 		case hostingCloud:
 			return true
@@ -188,11 +234,14 @@ func ShowLoginDialog(
 		walk.App().Synchronize(func() {
 			showBack := currentState != stateHostingSelection
 			showCancel := true
-			showLogin := currentState == stateReadyToLogin
+			showLogin := currentState == stateReadyToLogin || currentState == statePassword ||
+				currentState == stateTwoFactorCode || currentState == stateEmailVerification ||
+				currentState == stateSSO
 
 			if backButton != nil {
 				backButton.SetVisible(showBack)
-				backButton.SetEnabled(!isLoggingIn)
+				// Waiting for the browser can be abandoned
+				backButton.SetEnabled(!isLoggingIn || currentState == stateSSOWaiting)
 			}
 			if cancelButton != nil {
 				cancelButton.SetVisible(showCancel)
@@ -201,6 +250,14 @@ func ShowLoginDialog(
 			if loginButton != nil {
 				loginButton.SetVisible(showLogin)
 				loginButton.SetEnabled(!isLoggingIn && isReadyToLogin())
+				if currentState == stateTwoFactorCode || currentState == stateEmailVerification {
+					loginButton.SetText("Verify")
+				} else {
+					loginButton.SetText("Login")
+				}
+			}
+			if resendButton != nil {
+				resendButton.SetEnabled(!isLoggingIn)
 			}
 		})
 	}
@@ -211,6 +268,8 @@ func ShowLoginDialog(
 			showHostingSelection := currentState == stateHostingSelection
 			showReadyToLogin := currentState == stateReadyToLogin
 			showDeviceAuthCode := currentState == stateDeviceAuthCode
+			showPassword := currentState == statePassword
+			showCode := currentState == stateTwoFactorCode || currentState == stateEmailVerification
 
 			if cloudButton != nil {
 				cloudButton.SetVisible(showHostingSelection)
@@ -230,7 +289,10 @@ func ShowLoginDialog(
 			}
 
 			if codeLabel != nil {
-				codeLabel.SetVisible(showDeviceAuthCode)
+				codeLabel.SetVisible(showDeviceAuthCode && !showQRCode)
+			}
+			if qrCodeImageView != nil {
+				qrCodeImageView.SetVisible(showDeviceAuthCode && showQRCode)
 			}
 			if copyButton != nil {
 				copyButton.SetVisible(showDeviceAuthCode)
@@ -238,15 +300,61 @@ func ShowLoginDialog(
 			if openBrowserButton != nil {
 				openBrowserButton.SetVisible(showDeviceAuthCode)
 			}
+			if qrCodeButton != nil {
+				qrCodeButton.SetVisible(showDeviceAuthCode)
+				if showQRCode {
+					qrCodeButton.SetText("Show Code")
+				} else {
+					qrCodeButton.SetText("Show QR Code")
+				}
+			}
+			// The QR code takes the room of the manual URL
 			if manualURLComposite != nil {
-				manualURLComposite.SetVisible(showDeviceAuthCode)
+				manualURLComposite.SetVisible(showDeviceAuthCode && !showQRCode)
 			}
 			if manualURLLabel != nil {
-				manualURLLabel.SetVisible(showDeviceAuthCode)
+				manualURLLabel.SetVisible(showDeviceAuthCode && !showQRCode)
+			}
+			if expiryLabel != nil {
+				expiryLabel.SetVisible(showDeviceAuthCode)
+			}
+			if serverInfoLabel != nil {
+				serverInfoLabel.SetVisible(showDeviceAuthCode && serverInfoLabel.Text() != "")
 			}
 			if progressBar != nil {
 				progressBar.SetVisible(showDeviceAuthCode)
 			}
+			if passwordLinkLabel != nil {
+				passwordLinkLabel.SetVisible(showDeviceAuthCode)
+			}
+
+			for _, widget := range []walk.Widget{emailLabel, emailLineEdit, passwordLabel, passwordLineEdit} {
+				if widget != nil {
+					widget.SetVisible(showPassword)
+				}
+			}
+			for _, widget := range []walk.Widget{codePromptLabel, codeLineEdit} {
+				if widget != nil {
+					widget.SetVisible(showCode)
+				}
+			}
+			if resendButton != nil {
+				resendButton.SetVisible(currentState == stateEmailVerification)
+			}
+
+			for _, widget := range []walk.Widget{ssoOrgLabel, ssoOrgLineEdit} {
+				if widget != nil {
+					widget.SetVisible(currentState == stateSSO)
+				}
+			}
+			for _, widget := range []walk.Widget{ssoWaitingLabel, ssoOpenBrowserButton} {
+				if widget != nil {
+					widget.SetVisible(currentState == stateSSOWaiting)
+				}
+			}
+			if progressBar != nil && currentState == stateSSOWaiting {
+				progressBar.SetVisible(true)
+			}
 
 			// Show terms notice only on hosting selection page
 			if termsComposite != nil {
@@ -287,6 +395,113 @@ func ShowLoginDialog(
 		})
 	}
 
+	// updateDeviceAuthProgress shows the time left to enter the device auth
+	// code and renders its QR code
+	updateDeviceAuthProgress := func(progress auth.DeviceAuthProgress) {
+		walk.App().Synchronize(func() {
+			if expiryLabel != nil {
+				remaining := progress.Remaining.Round(time.Second)
+				text := fmt.Sprintf("Code expires in %d:%02d", int(remaining.Minutes()), int(remaining.Seconds())%60)
+				if progress.Status == auth.DeviceAuthRetrying {
+					text += " - cannot reach the server, retrying"
+				}
+				expiryLabel.SetText(text)
+			}
+
+			if qrCodeImageView == nil || progress.VerificationURLComplete == qrCodeURL {
+				return
+			}
+			qrCodeURL = progress.VerificationURLComplete
+			code, err := progress.QRCode()
+			if err != nil {
+				logger.Error("Failed to create QR code: %v", err)
+				return
+			}
+			// About 120 pixels wide at 96 DPI, in whole pixels per module
+			dpi := dlg.DPI()
+			scale := max(1, 120*dpi/96/(code.Size+8))
+			bitmap, err := walk.NewBitmapFromImageForDPI(code.Image(scale), dpi)
+			if err != nil {
+				logger.Error("Failed to create QR code image: %v", err)
+				return
+			}
+			if previous := qrCodeImageView.Image(); previous != nil {
+				defer previous.Dispose()
+			}
+			qrCodeImageView.SetImage(bitmap)
+		})
+	}
+
+	// finishLogin closes the dialog after a successful login
+	finishLogin := func() {
+		// Always stop any running tunnel after login, then close
+		logger.Info("Stopping tunnel after successful login")
+		if err := managers.IPCClientStopTunnel(); err != nil {
+			logger.Error("Failed to stop tunnel after login: %v", err)
+			// Still close the dialog even if stopping tunnel fails
+		}
+
+		walk.App().Synchronize(func() {
+			isLoggingIn = false
+			loginSucceeded = true
+			dlg.Accept()
+		})
+	}
+
+	// confirmServer asks whether to sign in to a server despite a warning
+	confirmServer := func(title, instruction, content string) bool {
+		proceed := make(chan bool, 1)
+		walk.App().Synchronize(func() {
+			td := walk.NewTaskDialog()
+			result, err := td.Show(walk.TaskDialogOpts{
+				Owner:         dlg,
+				Title:         title,
+				Instruction:   instruction,
+				Content:       content + "\n\nContinue anyway?",
+				IconSystem:    walk.TaskDialogSystemIconWarning,
+				CommonButtons: win.TDCBF_OK_BUTTON | win.TDCBF_CANCEL_BUTTON,
+			})
+			proceed <- err == nil && !result.Canceled
+		})
+		return <-proceed
+	}
+
+	// checkServer confirms that the server is a Pangolin server that works
+	// with this client before signing in to it, and follows it if it moved
+	// permanently. It returns context.Canceled if the user chose not to
+	// continue with an old server or one that did not answer like a
+	// Pangolin server.
+	checkServer := func(ctx context.Context) error {
+		discovery, err := api.DiscoverServer(ctx, temporaryHostname)
+		if err != nil {
+			return err
+		}
+		if discovery.Warning != "" && !confirmServer("Server", "The server did not answer like a Pangolin server", discovery.Warning) {
+			return context.Canceled
+		}
+		switch discovery.Compatibility {
+		case api.ClientTooOld:
+			return fmt.Errorf("%s requires Pangolin for Windows %s or later. Update this app and try again.",
+				discovery.Describe(), discovery.Info.MinClientVersion)
+		case api.ServerTooOld:
+			if !confirmServer("Server Version", "The server is older than this app supports",
+				fmt.Sprintf("%s is older than %s, the oldest version this app is known to work with. Signing in may fail, or parts of the app may not work.", discovery.Describe(), api.MinServerVersion)) {
+				return context.Canceled
+			}
+		}
+
+		if discovery.Redirected(temporaryHostname) {
+			logger.Info("Signing in to %s instead of %s, where the server moved", discovery.BaseURL, temporaryHostname)
+		}
+		temporaryHostname = discovery.BaseURL
+		walk.App().Synchronize(func() {
+			if serverInfoLabel != nil {
+				serverInfoLabel.SetText(fmt.Sprintf("%s at %s", discovery.Describe(), discovery.BaseURL))
+			}
+		})
+		return nil
+	}
+
 	performLogin := func() {
 		// Ensure server URL is configured (but don't persist yet)
 		if hostingOpt == hostingSelfHosted {
@@ -312,8 +527,17 @@ func ShowLoginDialog(
 			temporaryHostname = "https://app.pangolin.net"
 		}
 
+		attemptCtx, cancel := context.WithCancel(loginCtx)
+		defer cancel()
+		cancelAttemptMu.Lock()
+		cancelAttempt = cancel
+		cancelAttemptMu.Unlock()
+
 		// Pass temporary hostname to login (it will use a temporary API client internally)
-		err := authManager.LoginWithDeviceAuth(loginCtx, &temporaryHostname)
+		err := checkServer(attemptCtx)
+		if err == nil {
+			err = authManager.LoginWithDeviceAuth(attemptCtx, &temporaryHostname, updateDeviceAuthProgress)
+		}
 		if err != nil {
 			// Don't show error dialog if context was canceled (user closed dialog)
 			if errors.Is(err, context.Canceled) {
@@ -353,18 +577,191 @@ func ShowLoginDialog(
 			return
 		}
 
-		// Success - always stop any running tunnel after login, then close
-		logger.Info("Stopping tunnel after successful login")
-		if err := managers.IPCClientStopTunnel(); err != nil {
-			logger.Error("Failed to stop tunnel after login: %v", err)
-			// Still close the dialog even if stopping tunnel fails
+		finishLogin()
+	}
+
+	// performPasswordLogin runs one step of the email and password login: the
+	// password, the two-factor code or the email verification code
+	performPasswordLogin := func(step loginState, email, password, code string) {
+		if hostingOpt == hostingCloud {
+			temporaryHostname = "https://app.pangolin.net"
+		}
+
+		var err error
+		switch step {
+		case stateEmailVerification:
+			err = authManager.VerifyEmail(code)
+		case stateTwoFactorCode:
+			err = authManager.LoginWithPassword(&temporaryHostname, email, password, &code)
+		default:
+			if err = checkServer(loginCtx); err == nil {
+				err = authManager.LoginWithPassword(&temporaryHostname, email, password, nil)
+			}
+		}
+		if errors.Is(err, context.Canceled) {
+			walk.App().Synchronize(func() {
+				isLoggingIn = false
+				updateUI()
+			})
+			return
+		}
+
+		// The server asks for another code
+		var authErr *auth.AuthError
+		if errors.As(err, &authErr) && (authErr.Type == auth.AuthErrorTwoFactorRequired || authErr.Type == auth.AuthErrorEmailVerificationRequired) {
+			walk.App().Synchronize(func() {
+				isLoggingIn = false
+				if authErr.Type == auth.AuthErrorTwoFactorRequired {
+					currentState = stateTwoFactorCode
+					codePromptLabel.SetText("Enter the code from your authenticator app")
+				} else {
+					currentState = stateEmailVerification
+					codePromptLabel.SetText(fmt.Sprintf("Enter the code sent to %s", email))
+				}
+				loginCode = ""
+				codeLineEdit.SetText("")
+				updateUI()
+				codeLineEdit.SetFocus()
+			})
+			return
 		}
 
+		if err != nil {
+			walk.App().Synchronize(func() {
+				isLoggingIn = false
+				td := walk.NewTaskDialog()
+				td.Show(walk.TaskDialogOpts{
+					Owner:         dlg,
+					Title:         "Login Error",
+					Content:       err.Error(),
+					IconSystem:    walk.TaskDialogSystemIconError,
+					CommonButtons: win.TDCBF_OK_BUTTON,
+				})
+				// Let the user try the step again
+				if step == statePassword {
+					loginPassword = ""
+					passwordLineEdit.SetText("")
+				} else {
+					loginCode = ""
+					codeLineEdit.SetText("")
+				}
+				updateUI()
+			})
+			return
+		}
+
+		finishLogin()
+	}
+
+	// performSSOLogin discovers the identity providers of the organization and
+	// signs in with one of them in the browser
+	performSSOLogin := func(orgID string) {
+		if hostingOpt == hostingCloud {
+			temporaryHostname = "https://app.pangolin.net"
+		}
+
+		showError := func(message string) {
+			walk.App().Synchronize(func() {
+				isLoggingIn = false
+				currentState = stateSSO
+				td := walk.NewTaskDialog()
+				td.Show(walk.TaskDialogOpts{
+					Owner:         dlg,
+					Title:         "Login Error",
+					Content:       message,
+					IconSystem:    walk.TaskDialogSystemIconError,
+					CommonButtons: win.TDCBF_OK_BUTTON,
+				})
+				updateUI()
+			})
+		}
+
+		if err := checkServer(loginCtx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				walk.App().Synchronize(func() {
+					isLoggingIn = false
+					updateUI()
+				})
+				return
+			}
+			showError(err.Error())
+			return
+		}
+
+		idps, err := authManager.ListIdentityProviders(&temporaryHostname, strings.TrimSpace(orgID))
+		if err != nil {
+			showError(fmt.Sprintf("Failed to find the identity providers: %v", err))
+			return
+		}
+		if len(idps) == 0 {
+			showError("No single sign-on identity providers are set up for this organization.")
+			return
+		}
+
+		// Let the user pick if there are several
+		idp := idps[0]
+		if len(idps) > 1 {
+			chosen := make(chan int, 1)
+			walk.App().Synchronize(func() {
+				opts := walk.TaskDialogOpts{
+					Owner:           dlg,
+					Title:           "Single Sign-On",
+					Instruction:     "Choose how to sign in",
+					CommonButtons:   win.TDCBF_CANCEL_BUTTON,
+					CommandLinkMode: walk.TaskDialogCommandLinks,
+				}
+				choice := -1
+				for _, candidate := range idps {
+					opts.CustomButtons = append(opts.CustomButtons, walk.TaskDialogCustomButton{MainText: candidate.Name})
+				}
+				for i := range opts.CustomButtons {
+					opts.CustomButtons[i].Clicked().Attach(func() bool {
+						choice = i
+						return false
+					})
+				}
+				td := walk.NewTaskDialog()
+				_, _ = td.Show(opts)
+				chosen <- choice
+			})
+			choice := <-chosen
+			if choice < 0 {
+				walk.App().Synchronize(func() {
+					isLoggingIn = false
+					currentState = stateSSO
+					updateUI()
+				})
+				return
+			}
+			idp = idps[choice]
+		}
+
+		attemptCtx, cancel := context.WithCancel(loginCtx)
+		defer cancel()
+		cancelAttemptMu.Lock()
+		cancelAttempt = cancel
+		cancelAttemptMu.Unlock()
+
 		walk.App().Synchronize(func() {
-			isLoggingIn = false
-			loginSucceeded = true
-			dlg.Accept()
+			currentState = stateSSOWaiting
+			ssoWaitingLabel.SetText(fmt.Sprintf("Complete the sign-in with %s in your browser.", idp.Name))
+			updateUI()
 		})
+
+		err = authManager.LoginWithSSO(attemptCtx, &temporaryHostname, idp, browser.OpenURL)
+		if errors.Is(err, context.Canceled) {
+			walk.App().Synchronize(func() {
+				isLoggingIn = false
+				updateUI()
+			})
+			return
+		}
+		if err != nil {
+			showError(err.Error())
+			return
+		}
+
+		finishLogin()
 	}
 
 	Dialog{
@@ -449,6 +846,11 @@ func ShowLoginDialog(
 						Font:      Font{PointSize: 24, Bold: true},
 						Visible:   false,
 					},
+					ImageView{
+						AssignTo: &qrCodeImageView,
+						Mode:     ImageViewModeIdeal,
+						Visible:  false,
+					},
 					Composite{
 						Layout: HBox{MarginsZero: true, Spacing: 8, Alignment: AlignHCenterVNear},
 						Children: []Widget{
@@ -474,6 +876,15 @@ func ShowLoginDialog(
 									}
 								},
 							},
+							PushButton{
+								AssignTo: &qrCodeButton,
+								Text:     "Show QR Code",
+								Visible:  false,
+								OnClicked: func() {
+									showQRCode = !showQRCode
+									updateUI()
+								},
+							},
 						},
 					},
 					Composite{
@@ -490,6 +901,146 @@ func ShowLoginDialog(
 							},
 						},
 					},
+					Label{
+						AssignTo:  &expiryLabel,
+						Font:      Font{PointSize: 8},
+						Alignment: AlignHCenterVCenter,
+						Visible:   false,
+						TextColor: walk.RGB(0x80, 0x80, 0x80),
+					},
+					Label{
+						AssignTo:  &serverInfoLabel,
+						Font:      Font{PointSize: 8},
+						Alignment: AlignHCenterVCenter,
+						Visible:   false,
+						TextColor: walk.RGB(0x80, 0x80, 0x80),
+					},
+					LinkLabel{
+						AssignTo:  &passwordLinkLabel,
+						Text:      `Other ways to sign in: <a id="password">Email and password</a> or <a id="sso">Single sign-on</a>`,
+						Font:      Font{PointSize: 8},
+						Alignment: AlignHCenterVCenter,
+						Visible:   false,
+						OnLinkActivated: func(link *walk.LinkLabelLink) {
+							hasAutoOpenedBrowser = false
+							cancelAttemptMu.Lock()
+							if cancelAttempt != nil {
+								cancelAttempt()
+							}
+							cancelAttemptMu.Unlock()
+							if link.Id() == "sso" {
+								currentState = stateSSO
+								updateUI()
+								ssoOrgLineEdit.SetFocus()
+							} else {
+								currentState = statePassword
+								updateUI()
+								emailLineEdit.SetFocus()
+							}
+						},
+					},
+					// Email and password login
+					Label{
+						AssignTo: &emailLabel,
+						Text:     "Email",
+						Visible:  false,
+					},
+					LineEdit{
+						AssignTo: &emailLineEdit,
+						Text:     loginEmail,
+						MinSize:  Size{Width: 300, Height: 0},
+						Visible:  false,
+						OnTextChanged: func() {
+							loginEmail = emailLineEdit.Text()
+							updateButtons()
+						},
+					},
+					Label{
+						AssignTo: &passwordLabel,
+						Text:     "Password",
+						Visible:  false,
+					},
+					LineEdit{
+						AssignTo:     &passwordLineEdit,
+						PasswordMode: true,
+						MinSize:      Size{Width: 300, Height: 0},
+						Visible:      false,
+						OnTextChanged: func() {
+							loginPassword = passwordLineEdit.Text()
+							updateButtons()
+						},
+					},
+					// Two-factor and email verification codes
+					Label{
+						AssignTo:  &codePromptLabel,
+						Alignment: AlignHCenterVNear,
+						Visible:   false,
+					},
+					LineEdit{
+						AssignTo:  &codeLineEdit,
+						MinSize:   Size{Width: 200, Height: 0},
+						MaxLength: 64,
+						Visible:   false,
+						OnTextChanged: func() {
+							loginCode = codeLineEdit.Text()
+							updateButtons()
+						},
+					},
+					PushButton{
+						AssignTo: &resendButton,
+						Text:     "Send a New Code",
+						Visible:  false,
+						OnClicked: func() {
+							go func() {
+								err := authManager.ResendEmailVerification()
+								walk.App().Synchronize(func() {
+									td := walk.NewTaskDialog()
+									opts := walk.TaskDialogOpts{
+										Owner:         dlg,
+										Title:         "Verification Code Sent",
+										Content:       fmt.Sprintf("A new code was sent to %s.", loginEmail),
+										IconSystem:    walk.TaskDialogSystemIconInformation,
+										CommonButtons: win.TDCBF_OK_BUTTON,
+									}
+									if err != nil {
+										opts.Title = "Login Error"
+										opts.Content = fmt.Sprintf("Failed to send a new code: %v", err)
+										opts.IconSystem = walk.TaskDialogSystemIconError
+									}
+									td.Show(opts)
+								})
+							}()
+						},
+					},
+					// Single sign-on
+					Label{
+						AssignTo: &ssoOrgLabel,
+						Text:     "Organization ID (leave empty for the server's providers)",
+						Visible:  false,
+					},
+					LineEdit{
+						AssignTo: &ssoOrgLineEdit,
+						MinSize:  Size{Width: 300, Height: 0},
+						Visible:  false,
+						OnTextChanged: func() {
+							ssoOrgID = ssoOrgLineEdit.Text()
+						},
+					},
+					Label{
+						AssignTo:  &ssoWaitingLabel,
+						Alignment: AlignHCenterVNear,
+						Visible:   false,
+					},
+					PushButton{
+						AssignTo: &ssoOpenBrowserButton,
+						Text:     "Open Browser",
+						Visible:  false,
+						OnClicked: func() {
+							if url := authManager.SSOLoginURL(); url != nil {
+								openBrowser(*url)
+							}
+						},
+					},
 				},
 			},
 			// Terms and Privacy notice
@@ -544,7 +1095,23 @@ func ShowLoginDialog(
 						MaxSize:  Size{Width: 75, Height: 0},
 						Visible:  false,
 						OnClicked: func() {
-							if currentState == stateDeviceAuthCode {
+							if currentState == statePassword || currentState == stateTwoFactorCode || currentState == stateEmailVerification ||
+								currentState == stateSSO || currentState == stateSSOWaiting {
+								authManager.CancelPasswordLogin()
+								cancelAttemptMu.Lock()
+								if cancelAttempt != nil {
+									cancelAttempt()
+								}
+								cancelAttemptMu.Unlock()
+								loginCode = ""
+								codeLineEdit.SetText("")
+								if hostingOpt == hostingSelfHosted {
+									currentState = stateReadyToLogin
+								} else {
+									currentState = stateHostingSelection
+									hostingOpt = hostingNone
+								}
+							} else if currentState == stateDeviceAuthCode {
 								// Cancel the auth flow
 								currentState = stateHostingSelection
 								hostingOpt = hostingNone
@@ -576,10 +1143,21 @@ func ShowLoginDialog(
 						MaxSize:  Size{Width: 75, Height: 0},
 						Visible:  false,
 						OnClicked: func() {
-							currentState = stateDeviceAuthCode
-							isLoggingIn = true
-							updateUI()
-							go performLogin()
+							switch currentState {
+							case statePassword, stateTwoFactorCode, stateEmailVerification:
+								isLoggingIn = true
+								updateUI()
+								go performPasswordLogin(currentState, loginEmail, loginPassword, loginCode)
+							case stateSSO:
+								isLoggingIn = true
+								updateUI()
+								go performSSOLogin(ssoOrgID)
+							default:
+								currentState = stateDeviceAuthCode
+								isLoggingIn = true
+								updateUI()
+								go performLogin()
+							}
 						},
 					},
 				},
@@ -678,6 +1256,7 @@ func ShowLoginDialog(
 		// Clear device auth state if login didn't succeed
 		if !loginSucceeded {
 			authManager.ClearDeviceAuth()
+			authManager.CancelPasswordLogin()
 			logger.Info("Cleared device auth state after dialog close")
 		}
 
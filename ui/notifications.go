@@ -0,0 +1,255 @@
+//go:build windows
+
+package ui
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/auth"
+	"github.com/fosrl/windows/managers"
+	"github.com/fosrl/windows/notifications"
+	"github.com/fosrl/windows/peerhealth"
+	"github.com/fosrl/windows/tunnel"
+	"github.com/fosrl/windows/version"
+	"github.com/tailscale/walk"
+)
+
+const (
+	// sessionCheckInterval is how often org access and the session length
+	// policy are checked while logged in
+	sessionCheckInterval = 30 * time.Minute
+	// sessionExpiryWarning is how long before the session expires the user
+	// is told about it
+	sessionExpiryWarning = 24 * time.Hour
+)
+
+var (
+	notifier *notifications.Notifier
+
+	// notifyMutex protects the state below, which turns tunnel states and
+	// OLM status into events
+	notifyMutex sync.Mutex
+	// lastNotifiedState is the last tunnel state seen
+	lastNotifiedState = tunnel.StateStopped
+	// connectionLost is set when a running tunnel lost its connection, so that
+	// getting it back is reported as reconnected
+	connectionLost bool
+	// userDisconnect is set when the user asked to disconnect
+	userDisconnect bool
+	// connectedSites maps the IDs of connected sites to their names
+	connectedSites map[int]string
+	// sessionWarned and accessRevoked keep the session checks from repeating
+	// themselves every interval
+	sessionWarned bool
+	accessRevoked bool
+)
+
+// setupNotifications creates the notifier and starts watching the events
+// that are not delivered to the tray by subscriptions
+func setupNotifications() {
+	notifier = notifications.NewNotifier(showNotification, func(category notifications.Category) bool {
+		return configManager.GetNotificationEnabled(string(category))
+	})
+
+	tunnelManager.StatusEvents().Subscribe(notifySiteChanges)
+	managers.PeerHealthEvents.Subscribe(notifySiteHealth)
+	authManager.OrgEvents().Subscribe(notifyOrgChange)
+
+	if last := configManager.GetLastRunVersion(); last != version.Number {
+		if last != "" {
+			notifier.Notify(notifications.Event{Kind: notifications.EventUpdateInstalled, Version: version.Number})
+		}
+		configManager.SetLastRunVersion(version.Number)
+	}
+
+	go func() {
+		for {
+			time.Sleep(sessionCheckInterval)
+			checkSession()
+		}
+	}()
+}
+
+// showNotification shows n as a notification of the tray icon
+func showNotification(n notifications.Notification) {
+	logger.Info("Notification: %s: %s", n.Title, n.Message)
+	walk.App().Synchronize(func() {
+		if trayIcon == nil {
+			return
+		}
+		switch n.Severity {
+		case notifications.SeverityError:
+			trayIcon.ShowError(n.Title, n.Message)
+		case notifications.SeverityWarning:
+			trayIcon.ShowWarning(n.Title, n.Message)
+		default:
+			trayIcon.ShowInfo(n.Title, n.Message)
+		}
+	})
+}
+
+// setUserDisconnect marks the next stop of the tunnel as asked for by the
+// user, so that it is not reported
+func setUserDisconnect(expected bool) {
+	notifyMutex.Lock()
+	userDisconnect = expected
+	notifyMutex.Unlock()
+}
+
+// notifyTunnelState turns a tunnel state change into an event
+func notifyTunnelState(state tunnel.State) {
+	if notifier == nil {
+		return
+	}
+	notifyMutex.Lock()
+	previous := lastNotifiedState
+	lastNotifiedState = state
+	var event notifications.Event
+	notify := true
+	switch state {
+	case tunnel.StateRunning:
+		if previous == tunnel.StateRunning {
+			notify = false
+		} else if connectionLost {
+			event.Kind = notifications.EventTunnelReconnected
+		} else {
+			event.Kind = notifications.EventTunnelConnected
+			if org := authManager.CurrentOrg(); org != nil {
+				event.Org = org.Name
+			}
+		}
+		connectionLost = false
+	case tunnel.StateReconnecting, tunnel.StateRegistered:
+		// A running tunnel that is only registered again lost its peers
+		event.Kind = notifications.EventTunnelReconnecting
+		notify = previous == tunnel.StateRunning
+		if notify {
+			connectionLost = true
+		}
+	case tunnel.StateError:
+		event.Kind = notifications.EventTunnelFailed
+		notify = previous != tunnel.StateError
+	case tunnel.StateStopped:
+		event.Kind = notifications.EventTunnelDisconnected
+		event.UserInitiated = userDisconnect
+		notify = previous != tunnel.StateStopped
+		userDisconnect = false
+		connectionLost = false
+		connectedSites = nil
+	default:
+		notify = false
+	}
+	notifyMutex.Unlock()
+
+	if notify {
+		notifier.Notify(event)
+	}
+}
+
+// notifySiteChanges reports sites whose peer connection was lost while the
+// tunnel stays up
+func notifySiteChanges(status *tunnel.OLMStatusResponse) {
+	if notifier == nil || status == nil {
+		return
+	}
+	var lost []string
+	notifyMutex.Lock()
+	connected := make(map[int]string, len(status.PeerStatuses))
+	for id, peer := range status.PeerStatuses {
+		if peer != nil && peer.Connected {
+			connected[id] = peer.SiteName
+		}
+	}
+	// Losing every site at once is the tunnel losing its connection, which
+	// is reported by the tunnel state
+	if status.Connected && len(connected) > 0 {
+		for id, name := range connectedSites {
+			if _, ok := connected[id]; !ok {
+				lost = append(lost, name)
+			}
+		}
+	}
+	connectedSites = connected
+	notifyMutex.Unlock()
+
+	for _, name := range lost {
+		notifier.Notify(notifications.Event{Kind: notifications.EventPeerLost, Site: name})
+	}
+}
+
+// notifySiteHealth reports sites that degrade or recover
+func notifySiteHealth(change peerhealth.Change) {
+	if notifier == nil {
+		return
+	}
+	event := notifications.Event{Kind: notifications.EventSiteRecovered, Site: change.Name}
+	if change.Degraded {
+		event.Kind = notifications.EventSiteDegraded
+		event.Reason = change.Reason
+	}
+	notifier.Notify(event)
+}
+
+// notifyOrgChange reports losing access to the selected organization
+func notifyOrgChange(change auth.OrgChange) {
+	if notifier != nil && change.Revoked != nil {
+		notifier.Notify(notifications.Event{Kind: notifications.EventOrgAccessRevoked, Org: change.Revoked.Name})
+	}
+}
+
+// notifyUpdateState reports a newly found update
+func notifyUpdateState(updateState managers.UpdateState) {
+	if notifier != nil && updateState == managers.UpdateStateFoundUpdate {
+		notifier.Notify(notifications.Event{Kind: notifications.EventUpdateAvailable})
+	}
+}
+
+// checkSession checks access to the selected organization and warns before
+// its session length policy ends the session
+func checkSession() {
+	if notifier == nil || authManager == nil || apiClient == nil || !authManager.IsAuthenticated() {
+		return
+	}
+	user := authManager.CurrentUser()
+	org := authManager.CurrentOrg()
+	if user == nil || org == nil {
+		return
+	}
+
+	response, err := apiClient.CheckOrgUserAccess(org.Id, user.UserId)
+	var apiErr *api.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Status == 403) {
+		logger.Debug("Failed to check organization access: %v", err)
+		return
+	}
+
+	notifyMutex.Lock()
+	var events []notifications.Event
+	revoked := err != nil || !response.Allowed
+	if revoked && !accessRevoked {
+		events = append(events, notifications.Event{Kind: notifications.EventOrgAccessRevoked, Org: org.Name})
+	}
+	accessRevoked = revoked
+
+	warned := false
+	if !revoked && response.Policies != nil && response.Policies.MaxSessionLength != nil {
+		policy := response.Policies.MaxSessionLength
+		remaining := time.Duration(policy.MaxSessionLengthHours-policy.SessionAgeHours) * time.Hour
+		if policy.Compliant && remaining <= sessionExpiryWarning {
+			warned = true
+			if !sessionWarned {
+				events = append(events, notifications.Event{Kind: notifications.EventSessionExpiring, ExpiresIn: remaining})
+			}
+		}
+	}
+	sessionWarned = warned
+	notifyMutex.Unlock()
+
+	for _, event := range events {
+		notifier.Notify(event)
+	}
+}
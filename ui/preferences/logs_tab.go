@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/logging"
 
 	"github.com/fosrl/newt/logger"
 	"github.com/tailscale/walk"
@@ -39,9 +40,10 @@ type LogsTab struct {
 
 // LogLine represents a single log line
 type LogLine struct {
-	Stamp time.Time
-	Level string
-	Line  string
+	Stamp     time.Time
+	Level     string
+	Component string
+	Line      string
 }
 
 // NewLogsTab creates a new logs tab
@@ -109,6 +111,12 @@ func (lt *LogsTab) Create(parent *walk.TabWidget) (*walk.TabPage, error) {
 	levelCol.SetWidth(80)
 	lt.logView.Columns().Add(levelCol)
 
+	componentCol := walk.NewTableViewColumn()
+	componentCol.SetName("Component")
+	componentCol.SetTitle("Component")
+	componentCol.SetWidth(80)
+	lt.logView.Columns().Add(componentCol)
+
 	msgCol := walk.NewTableViewColumn()
 	msgCol.SetName("Line")
 	msgCol.SetTitle("Log message")
@@ -210,10 +218,7 @@ func (lt *LogsTab) onCopy() {
 	}
 	for i := 0; i < len(selectedItemIndexes); i++ {
 		logItem := lt.model.items[selectedItemIndexes[i]]
-		logLines.WriteString(fmt.Sprintf("%s [%s] %s\r\n",
-			logItem.Stamp.Format("2006-01-02 15:04:05.000"),
-			logItem.Level,
-			logItem.Line))
+		logLines.WriteString(formatLogLine(logItem) + "\r\n")
 	}
 	walk.Clipboard().SetText(logLines.String())
 }
@@ -256,10 +261,7 @@ func (lt *LogsTab) onSave() {
 
 	writeFileWithOverwriteHandling(lt.window, fd.FilePath, func(file *os.File) error {
 		for _, item := range lt.model.items {
-			line := fmt.Sprintf("%s [%s] %s\r\n",
-				item.Stamp.Format("2006-01-02 15:04:05.000"),
-				item.Level,
-				item.Line)
+			line := formatLogLine(item) + "\r\n"
 			if _, err := file.WriteString(line); err != nil {
 				return fmt.Errorf("failed to write log line: %w", err)
 			}
@@ -375,12 +377,10 @@ func (mdl *logModel) readNewLines() {
 	}
 	currentSize := info.Size()
 
-	// If file was rotated (size decreased), reset position
+	// If file was rotated (size decreased), read the new file from the start.
+	// The lines already shown came from the rotated file and are kept.
 	if currentSize < mdl.lastSize {
 		mdl.filePos = 0
-		mdl.mu.Lock()
-		mdl.items = mdl.items[:0] // Clear items
-		mdl.mu.Unlock()
 	}
 
 	// If no new data, return
@@ -431,35 +431,49 @@ func (mdl *logModel) readNewLines() {
 	})
 }
 
+// formatLogLine formats a log line for copying and exporting
+func formatLogLine(item LogLine) string {
+	if item.Component != "" {
+		return fmt.Sprintf("%s [%s] [%s] %s", item.Stamp.Format("2006-01-02 15:04:05.000"), item.Level, item.Component, item.Line)
+	}
+	return fmt.Sprintf("%s [%s] %s", item.Stamp.Format("2006-01-02 15:04:05.000"), item.Level, item.Line)
+}
+
+var (
+	logLineRe2 = regexp.MustCompile(`^\[([^\]]+)\]\s+\[([^\]]+)\]\s+(.+)$`)
+	logLineRe3 = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?)\s+(\w+)\s+(.+)$`)
+	logLineRe4 = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(\w+)\s+(.+)$`)
+	logLineRe5 = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(.+)$`)
+)
+
 // parseLogLine attempts to parse a log line into a LogLine struct
 // Supports various log formats:
-// - LEVEL: YYYY/MM/DD HH:MM:SS message (pangolin format)
+// - LEVEL: YYYY/MM/DD HH:MM:SS [component] message (pangolin text format)
+// - {"time":...,"level":...,"component":...,"msg":...} (pangolin JSON format)
 // - [timestamp] [level] message
 // - timestamp level message
 // - ISO8601 timestamp level message
 func parseLogLine(line string) *LogLine {
-	line = strings.TrimSpace(line)
+	// Lines written by older versions may still contain secrets
+	line = logging.Redact(strings.TrimSpace(line))
 	if line == "" {
 		return nil
 	}
 
-	// Format 1: LEVEL: YYYY/MM/DD HH:MM:SS message (pangolin format)
-	// Example: ERROR: 2025/11/26 11:37:43 Failed to poll OLM status...
-	re1 := regexp.MustCompile(`^(\w+):\s+(\d{4}/\d{2}/\d{2}\s+\d{2}:\d{2}:\d{2})\s+(.+)$`)
-	if matches := re1.FindStringSubmatch(line); len(matches) == 4 {
-		if t, err := parseTimestamp(matches[2]); err == nil {
-			return &LogLine{
-				Stamp: t,
-				Level: matches[1],
-				Line:  matches[3],
-			}
+	// Format 1: pangolin text or JSON format
+	// Example: ERROR: 2025/11/26 11:37:43 [tunnel] Failed to poll OLM status...
+	if record, ok := logging.ParseRecord(line); ok {
+		return &LogLine{
+			Stamp:     record.Time,
+			Level:     record.Level,
+			Component: record.Component,
+			Line:      record.Message,
 		}
 	}
 
 	// Try to parse common log formats
 	// Format 2: [2006-01-02 15:04:05.000] [LEVEL] message
-	re2 := regexp.MustCompile(`^\[([^\]]+)\]\s+\[([^\]]+)\]\s+(.+)$`)
-	if matches := re2.FindStringSubmatch(line); len(matches) == 4 {
+	if matches := logLineRe2.FindStringSubmatch(line); len(matches) == 4 {
 		if t, err := parseTimestamp(matches[1]); err == nil {
 			return &LogLine{
 				Stamp: t,
@@ -470,8 +484,7 @@ func parseLogLine(line string) *LogLine {
 	}
 
 	// Format 3: 2006-01-02T15:04:05.000Z level message
-	re3 := regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?)\s+(\w+)\s+(.+)$`)
-	if matches := re3.FindStringSubmatch(line); len(matches) == 4 {
+	if matches := logLineRe3.FindStringSubmatch(line); len(matches) == 4 {
 		if t, err := time.Parse(time.RFC3339Nano, matches[1]); err == nil {
 			return &LogLine{
 				Stamp: t,
@@ -482,8 +495,7 @@ func parseLogLine(line string) *LogLine {
 	}
 
 	// Format 4: 2006-01-02 15:04:05.000 level message
-	re4 := regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(\w+)\s+(.+)$`)
-	if matches := re4.FindStringSubmatch(line); len(matches) == 4 {
+	if matches := logLineRe4.FindStringSubmatch(line); len(matches) == 4 {
 		if t, err := parseTimestamp(matches[1]); err == nil {
 			return &LogLine{
 				Stamp: t,
@@ -494,8 +506,7 @@ func parseLogLine(line string) *LogLine {
 	}
 
 	// Format 5: Just timestamp and message (no level)
-	re5 := regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(.+)$`)
-	if matches := re5.FindStringSubmatch(line); len(matches) == 3 {
+	if matches := logLineRe5.FindStringSubmatch(line); len(matches) == 3 {
 		if t, err := parseTimestamp(matches[1]); err == nil {
 			return &LogLine{
 				Stamp: t,
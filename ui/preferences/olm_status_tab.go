@@ -4,11 +4,16 @@ package preferences
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/managers"
+	"github.com/fosrl/windows/peerhealth"
 	"github.com/fosrl/windows/tunnel"
 
 	"github.com/tailscale/walk"
@@ -42,6 +47,10 @@ type peerWidgets struct {
 	endpointLabel *walk.Label
 	indicator     *walk.Label
 	statusLabel   *walk.Label
+	sparkline     *walk.CustomWidget
+	healthLabel   *walk.Label
+	pathLabel     *walk.Label
+	pathComboBox  *walk.ComboBox
 }
 
 // OLMStatusTab handles the OLM status viewing tab
@@ -63,6 +72,10 @@ type OLMStatusTab struct {
 	formattedContainer *walk.Composite
 	statusContainer    *walk.Composite
 	peersContainer     *walk.Composite
+	defaultPathBox     *walk.ComboBox
+	// updatingPaths is set while the path combo boxes are changed by code
+	// rather than by the user; it is only used on the UI thread
+	updatingPaths bool
 
 	// Widget references for updating (protected by mu)
 	statusWidgets *statusWidgets
@@ -70,6 +83,8 @@ type OLMStatusTab struct {
 
 	// Current status (protected by mu)
 	currentStatus *tunnel.OLMStatusResponse
+	peerHealth    map[int]peerhealth.SiteHealth // keyed by siteID
+	pathPrefs     config.PathPreferences
 	displayMode   DisplayMode
 }
 
@@ -149,6 +164,11 @@ func (ost *OLMStatusTab) Create(parent *walk.TabWidget) (*walk.TabPage, error) {
 		peersSectionLabel.SetFont(font)
 	}
 
+	// Path preference for sites without one of their own
+	if err := ost.createDefaultPathRow(); err != nil {
+		return nil, err
+	}
+
 	// Peers container
 	if ost.peersContainer, err = walk.NewComposite(ost.formattedContainer); err != nil {
 		return nil, err
@@ -401,9 +421,22 @@ func (ost *OLMStatusTab) pollOLMStatus() {
 				continue
 			}
 
+			// Peer health is tracked by the manager service
+			var health map[int]peerhealth.SiteHealth
+			if sites, err := managers.IPCClientPeerHealth(); err == nil {
+				health = make(map[int]peerhealth.SiteHealth, len(sites))
+				for _, site := range sites {
+					health[site.SiteID] = site
+				}
+			}
+
+			pathPrefs := ost.tunnelManager.PathPreferences()
+
 			// Update current status
 			ost.mu.Lock()
 			ost.currentStatus = status
+			ost.peerHealth = health
+			ost.pathPrefs = pathPrefs
 			ost.mu.Unlock()
 
 			// Update UI
@@ -520,6 +553,14 @@ func (ost *OLMStatusTab) formatStatus(connected, registered bool) string {
 
 // updatePeersList updates the peers container, reusing existing widgets when possible
 func (ost *OLMStatusTab) updatePeersList(status *tunnel.OLMStatusResponse) {
+	ost.mu.Lock()
+	defaultPath := ost.pathPrefs.DefaultPath()
+	ost.mu.Unlock()
+	if ost.defaultPathBox != nil {
+		ost.setPathComboBox(ost.defaultPathBox, config.PathPreferenceOptions, defaultPath)
+		setPathComboBoxEnabled(ost.defaultPathBox, status.Supports(tunnel.CapabilityPathPreferences), defaultPathToolTip)
+	}
+
 	if status == nil || status.PeerStatuses == nil || len(status.PeerStatuses) == 0 {
 		ost.mu.Lock()
 		// Hide all peer widgets
@@ -586,6 +627,9 @@ func (ost *OLMStatusTab) updatePeersList(status *tunnel.OLMStatusResponse) {
 					pw.statusLabel.SetText("Disconnected")
 				}
 			}
+			health, ok := ost.peerHealth[siteID]
+			updatePeerHealth(pw, health, ok)
+			ost.updatePeerPath(pw, siteID, peer)
 			if pw.row != nil {
 				pw.row.SetVisible(true)
 			}
@@ -605,6 +649,11 @@ func (ost *OLMStatusTab) updatePeersList(status *tunnel.OLMStatusResponse) {
 		if err := ost.createPeerWidget(peerInfo.siteID, peerInfo.name, peerInfo.endpoint, peerInfo.connected); err != nil {
 			continue
 		}
+		ost.mu.Lock()
+		if pw, ok := ost.peerWidgets[peerInfo.siteID]; ok {
+			ost.updatePeerPath(pw, peerInfo.siteID, status.PeerStatuses[peerInfo.siteID])
+		}
+		ost.mu.Unlock()
 	}
 }
 
@@ -695,11 +744,282 @@ func (ost *OLMStatusTab) createPeerWidget(siteID int, name, endpoint string, con
 	pw.statusLabel.SetText(statusText)
 	pw.statusLabel.SetTextColor(walk.RGB(100, 100, 100))
 
+	// Round-trip time over the health window
+	pw.sparkline, err = walk.NewCustomWidgetPixels(row, 0, func(canvas *walk.Canvas, updateBounds walk.Rectangle) error {
+		ost.mu.Lock()
+		health := ost.peerHealth[siteID]
+		ost.mu.Unlock()
+		return drawSparkline(canvas, pw.sparkline.ClientBoundsPixels(), health)
+	})
+	if err != nil {
+		return err
+	}
+	pw.sparkline.SetMinMaxSize(walk.Size{Width: 120, Height: 24}, walk.Size{Width: 120, Height: 24})
+	pw.sparkline.SetToolTipText("Round-trip time over the last 10 minutes")
+
+	// Health summary and path
+	detailsContainer, err := walk.NewComposite(row)
+	if err != nil {
+		return err
+	}
+	detailsLayout := walk.NewVBoxLayout()
+	detailsLayout.SetMargins(walk.Margins{})
+	detailsLayout.SetSpacing(2)
+	detailsContainer.SetLayout(detailsLayout)
+
+	pw.healthLabel, err = walk.NewLabel(detailsContainer)
+	if err != nil {
+		return err
+	}
+	pw.healthLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	pw.pathLabel, err = walk.NewLabel(detailsContainer)
+	if err != nil {
+		return err
+	}
+	pw.pathLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	// Path preference
+	if pw.pathComboBox, err = newPathComboBox(row, config.SitePathPreferenceOptions); err != nil {
+		return err
+	}
+	pw.pathComboBox.SetToolTipText(sitePathToolTip)
+	pw.pathComboBox.CurrentIndexChanged().Attach(func() {
+		if ost.updatingPaths {
+			return
+		}
+		ost.setPathPreference(siteID, pw.pathComboBox.CurrentIndex())
+	})
+
 	// Add spacer to match status row structure
 	walk.NewHSpacer(row)
 
 	ost.mu.Lock()
 	ost.peerWidgets[siteID] = pw
+	health, ok := ost.peerHealth[siteID]
+	updatePeerHealth(pw, health, ok)
 	ost.mu.Unlock()
 	return nil
 }
+
+// createDefaultPathRow creates the row with the path preference of sites
+// without one of their own
+func (ost *OLMStatusTab) createDefaultPathRow() error {
+	row, err := walk.NewComposite(ost.formattedContainer)
+	if err != nil {
+		return err
+	}
+	rowLayout := walk.NewHBoxLayout()
+	rowLayout.SetMargins(walk.Margins{})
+	rowLayout.SetSpacing(12)
+	row.SetLayout(rowLayout)
+
+	label, err := walk.NewLabel(row)
+	if err != nil {
+		return err
+	}
+	label.SetText("Default path")
+	label.SetMinMaxSize(walk.Size{Width: 200, Height: 0}, walk.Size{Width: 200, Height: 0})
+
+	if ost.defaultPathBox, err = newPathComboBox(row, config.PathPreferenceOptions); err != nil {
+		return err
+	}
+	ost.defaultPathBox.SetToolTipText(defaultPathToolTip)
+	ost.defaultPathBox.CurrentIndexChanged().Attach(func() {
+		if ost.updatingPaths {
+			return
+		}
+		ost.setPathPreference(-1, ost.defaultPathBox.CurrentIndex())
+	})
+
+	walk.NewHSpacer(row)
+	if ost.tunnelManager == nil {
+		row.SetVisible(false)
+	}
+	return nil
+}
+
+const (
+	sitePathToolTip    = "How the tunnel reaches this site"
+	defaultPathToolTip = "How the tunnel reaches sites of this organization that have no path of their own"
+)
+
+// newPathComboBox creates a combo box offering the path preferences options
+func newPathComboBox(parent walk.Container, options []config.PathPreference) (*walk.ComboBox, error) {
+	comboBox, err := walk.NewDropDownBox(parent)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(options))
+	for i, pref := range options {
+		names[i] = pref.Description()
+	}
+	if err := comboBox.SetModel(names); err != nil {
+		return nil, err
+	}
+	comboBox.SetCurrentIndex(0)
+	return comboBox, nil
+}
+
+// setPathComboBox selects pref among the options of comboBox without
+// treating it as a choice of the user
+func (ost *OLMStatusTab) setPathComboBox(comboBox *walk.ComboBox, options []config.PathPreference, pref config.PathPreference) {
+	for i, option := range options {
+		if option == pref && comboBox.CurrentIndex() != i {
+			ost.updatingPaths = true
+			comboBox.SetCurrentIndex(i)
+			ost.updatingPaths = false
+		}
+	}
+}
+
+// setPathComboBoxEnabled lets the user choose a path only if OLM applies
+// it; toolTip describes the choice
+func setPathComboBoxEnabled(comboBox *walk.ComboBox, supported bool, toolTip string) {
+	comboBox.SetEnabled(supported)
+	if !supported {
+		toolTip = "This version of OLM does not support path preferences; all sites use the automatic path"
+	}
+	comboBox.SetToolTipText(toolTip)
+}
+
+// setPathPreference saves the path preference the user chose for a site, or
+// for all sites without their own if siteID is -1
+func (ost *OLMStatusTab) setPathPreference(siteID, index int) {
+	options := config.SitePathPreferenceOptions
+	if siteID < 0 {
+		options = config.PathPreferenceOptions
+	}
+	if ost.tunnelManager == nil || index < 0 || index >= len(options) {
+		return
+	}
+	pref := options[index]
+	go func() {
+		var err error
+		if siteID < 0 {
+			err = ost.tunnelManager.SetDefaultPathPreference(pref)
+		} else {
+			err = ost.tunnelManager.SetPathPreference(siteID, pref)
+		}
+		if errors.Is(err, tunnel.ErrPathPreferencesUnsupported) {
+			logger.Warn("Path preference saved, but %v", err)
+		} else if err != nil {
+			logger.Error("Failed to set path preference: %v", err)
+		}
+	}()
+}
+
+// updatePeerPath shows the path of a peer and its preference; callers hold
+// ost.mu
+func (ost *OLMStatusTab) updatePeerPath(pw *peerWidgets, siteID int, peer *tunnel.OLMPeerStatus) {
+	if ost.tunnelManager == nil {
+		return
+	}
+	// Without support in OLM, every site uses the automatic path
+	supported := ost.currentStatus.Supports(tunnel.CapabilityPathPreferences)
+	pref := config.PathAuto
+	if supported {
+		pref = ost.pathPrefs.For(siteID)
+	}
+	if pw.pathLabel != nil {
+		pw.pathLabel.SetText(ost.tunnelManager.PathReason(pref, peer))
+	}
+	if pw.pathComboBox != nil {
+		ost.setPathComboBox(pw.pathComboBox, config.SitePathPreferenceOptions, ost.pathPrefs.Sites[siteID])
+		setPathComboBoxEnabled(pw.pathComboBox, supported, sitePathToolTip)
+	}
+}
+
+// updatePeerHealth shows the health of a peer in its row
+func updatePeerHealth(pw *peerWidgets, health peerhealth.SiteHealth, ok bool) {
+	if pw.healthLabel != nil {
+		if ok && health.Samples > 0 {
+			pw.healthLabel.SetText(formatPeerHealth(health))
+			if health.Degraded {
+				pw.healthLabel.SetTextColor(walk.RGB(200, 120, 0))
+			} else {
+				pw.healthLabel.SetTextColor(walk.RGB(100, 100, 100))
+			}
+			pw.healthLabel.SetVisible(true)
+		} else {
+			pw.healthLabel.SetVisible(false)
+		}
+	}
+	if pw.sparkline != nil {
+		pw.sparkline.SetVisible(ok && health.Samples > 0)
+		pw.sparkline.Invalidate()
+	}
+}
+
+// formatPeerHealth summarizes the health of a peer in one line
+func formatPeerHealth(health peerhealth.SiteHealth) string {
+	parts := []string{
+		fmt.Sprintf("p50 %d ms, p95 %d ms", health.RTTP50.Milliseconds(), health.RTTP95.Milliseconds()),
+		fmt.Sprintf("%.1f%% up", health.Uptime*100),
+	}
+	if health.RelayFraction > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f%% relayed", health.RelayFraction*100))
+	}
+	switch health.Flaps {
+	case 0:
+	case 1:
+		parts = append(parts, "1 reconnect")
+	default:
+		parts = append(parts, fmt.Sprintf("%d reconnects", health.Flaps))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// drawSparkline draws the round-trip time history of a peer into bounds,
+// leaving gaps where the peer was not connected
+func drawSparkline(canvas *walk.Canvas, bounds walk.Rectangle, health peerhealth.SiteHealth) error {
+	points := health.RTTHistory
+	if len(points) < 2 || bounds.Width < 2 || bounds.Height < 2 {
+		return nil
+	}
+
+	color := walk.RGB(0, 160, 0)
+	if health.Degraded {
+		color = walk.RGB(200, 120, 0)
+	}
+	pen, err := walk.NewCosmeticPen(walk.PenSolid, color)
+	if err != nil {
+		return err
+	}
+	defer pen.Dispose()
+
+	// Scale to the highest point, but keep a few milliseconds of jitter from
+	// filling the whole height
+	scale := 10 * time.Millisecond
+	for _, rtt := range points {
+		if rtt > scale {
+			scale = rtt
+		}
+	}
+
+	var run []walk.Point
+	flush := func() error {
+		defer func() { run = run[:0] }()
+		switch len(run) {
+		case 0:
+			return nil
+		case 1:
+			return canvas.DrawLinePixels(pen, run[0], walk.Point{X: run[0].X + 1, Y: run[0].Y})
+		default:
+			return canvas.DrawPolylinePixels(pen, run)
+		}
+	}
+	for i, rtt := range points {
+		if rtt <= 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		run = append(run, walk.Point{
+			X: bounds.X + i*(bounds.Width-1)/(len(points)-1),
+			Y: bounds.Y + bounds.Height - 1 - int(int64(rtt)*int64(bounds.Height-2)/int64(scale)),
+		})
+	}
+	return flush()
+}
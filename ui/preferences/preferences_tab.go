@@ -3,10 +3,19 @@
 package preferences
 
 import (
+	"context"
+	"errors"
 	"strings"
 
 	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/api"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/killswitch"
+	"github.com/fosrl/windows/logging"
+	"github.com/fosrl/windows/managers"
+	"github.com/fosrl/windows/notifications"
+	"github.com/fosrl/windows/proxy"
+	"github.com/fosrl/windows/secrets"
 	"github.com/tailscale/walk"
 	"github.com/tailscale/win"
 )
@@ -18,15 +27,51 @@ type PreferencesTab struct {
 	dnsTunnelCheckBox   *walk.CheckBox
 	primaryDNSEdit      *walk.LineEdit
 	secondaryDNSEdit    *walk.LineEdit
+	logLevelComboBox    *walk.ComboBox
+	logFormatComboBox   *walk.ComboBox
+	componentLevelBoxes map[string]*walk.ComboBox
+	notificationBoxes   map[notifications.Category]*walk.CheckBox
+	proxyModeComboBox   *walk.ComboBox
+	proxyAddressEdit    *walk.LineEdit
+	proxyUsernameEdit   *walk.LineEdit
+	proxyPasswordEdit   *walk.LineEdit
+	proxyBypassEdit     *walk.LineEdit
+	proxyTestButton     *walk.PushButton
+	proxyTestLabel      *walk.Label
+	updateCABundleEdit  *walk.LineEdit
+	updatePACEdit       *walk.LineEdit
+	killSwitchCheckBox  *walk.CheckBox
+	killSwitchLANBox    *walk.CheckBox
+	killSwitchAllowEdit *walk.LineEdit
 	saveButton          *walk.PushButton
 	configManager       *config.ConfigManager
+	secretManager       *secrets.SecretManager
 	window              *PreferencesWindow
 }
 
+var (
+	logLevelNames  = []string{"debug", "info", "warn", "error"}
+	logFormatNames = []string{"text", "json"}
+	// componentLevelNames are offered for each component; "default" follows
+	// the global log level
+	componentLevelNames = []string{"default", "debug", "info", "warn", "error"}
+	componentLabels     = map[string]string{
+		logging.ComponentAPI:     "API Log Level",
+		logging.ComponentAuth:    "Sign-In Log Level",
+		logging.ComponentTunnel:  "Tunnel Log Level",
+		logging.ComponentUpdater: "Updater Log Level",
+		logging.ComponentIPC:     "Service Log Level",
+	}
+	// proxyModeNames are shown for proxyModes
+	proxyModeNames = []string{"System", "None", "HTTP", "SOCKS5"}
+	proxyModes     = []proxy.Mode{proxy.ModeSystem, proxy.ModeNone, proxy.ModeHTTP, proxy.ModeSOCKS5}
+)
+
 // NewPreferencesTab creates a new preferences tab
-func NewPreferencesTab(cm *config.ConfigManager) *PreferencesTab {
+func NewPreferencesTab(cm *config.ConfigManager, sm *secrets.SecretManager) *PreferencesTab {
 	return &PreferencesTab{
 		configManager: cm,
+		secretManager: sm,
 	}
 }
 
@@ -203,6 +248,78 @@ func (pt *PreferencesTab) Create(parent *walk.TabWidget) (*walk.TabPage, error)
 	// Spacer
 	walk.NewHSpacer(secondaryDNSContainer)
 
+	if err := pt.createProxySection(contentContainer, font); err != nil {
+		return nil, err
+	}
+
+	if err := pt.createKillSwitchSection(contentContainer, font); err != nil {
+		return nil, err
+	}
+
+	// Logging section title
+	loggingSectionTitle, err := walk.NewLabel(contentContainer)
+	if err != nil {
+		return nil, err
+	}
+	loggingSectionTitle.SetText("Logging")
+	if font != nil {
+		loggingSectionTitle.SetFont(font)
+	}
+
+	// Log level row
+	if pt.logLevelComboBox, err = pt.newComboBoxRow(contentContainer, "Log Level", logLevelNames, pt.configManager.GetLogLevel()); err != nil {
+		return nil, err
+	}
+
+	// Log format row
+	if pt.logFormatComboBox, err = pt.newComboBoxRow(contentContainer, "Log Format", logFormatNames, pt.configManager.GetLogFormat()); err != nil {
+		return nil, err
+	}
+
+	// One level row per component
+	componentLevels := pt.configManager.GetComponentLogLevels()
+	pt.componentLevelBoxes = make(map[string]*walk.ComboBox, len(logging.Components))
+	for _, component := range logging.Components {
+		level := componentLevels[component]
+		if level == "" {
+			level = componentLevelNames[0]
+		}
+		comboBox, err := pt.newComboBoxRow(contentContainer, componentLabels[component], componentLevelNames, level)
+		if err != nil {
+			return nil, err
+		}
+		pt.componentLevelBoxes[component] = comboBox
+	}
+
+	logDescLabel, err := walk.NewLabel(contentContainer)
+	if err != nil {
+		return nil, err
+	}
+	logDescLabel.SetText("Changes apply immediately to the app and the background service. Components set to default use the log level above. JSON writes one record per line for log collectors.")
+	logDescLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	// Notifications section title
+	notificationsSectionTitle, err := walk.NewLabel(contentContainer)
+	if err != nil {
+		return nil, err
+	}
+	notificationsSectionTitle.SetText("Notifications")
+	if font != nil {
+		notificationsSectionTitle.SetFont(font)
+	}
+
+	// One checkbox per notification category
+	pt.notificationBoxes = make(map[notifications.Category]*walk.CheckBox, len(notifications.Categories))
+	for _, category := range notifications.Categories {
+		checkBox, err := walk.NewCheckBox(contentContainer)
+		if err != nil {
+			return nil, err
+		}
+		checkBox.SetText(category.Description())
+		checkBox.SetChecked(pt.configManager.GetNotificationEnabled(string(category)))
+		pt.notificationBoxes[category] = checkBox
+	}
+
 	// Add spacer to fill remaining space
 	walk.NewVSpacer(contentContainer)
 
@@ -211,6 +328,273 @@ func (pt *PreferencesTab) Create(parent *walk.TabWidget) (*walk.TabPage, error)
 	return pt.tabPage, nil
 }
 
+// createProxySection creates the proxy settings and the button to check them
+func (pt *PreferencesTab) createProxySection(parent walk.Container, font *walk.Font) error {
+	proxySectionTitle, err := walk.NewLabel(parent)
+	if err != nil {
+		return err
+	}
+	proxySectionTitle.SetText("Proxy")
+	if font != nil {
+		proxySectionTitle.SetFont(font)
+	}
+
+	proxyConfig := pt.secretManager.WithProxyPassword(pt.configManager.GetProxy())
+	mode := proxyModeNames[0]
+	for i, m := range proxyModes {
+		if m == proxyConfig.EffectiveMode() {
+			mode = proxyModeNames[i]
+		}
+	}
+	if pt.proxyModeComboBox, err = pt.newComboBoxRow(parent, "Proxy", proxyModeNames, mode); err != nil {
+		return err
+	}
+	if pt.proxyAddressEdit, err = newLineEditRow(parent, "Proxy Address", proxyConfig.Address, "proxy.example.com:8080"); err != nil {
+		return err
+	}
+	if pt.proxyUsernameEdit, err = newLineEditRow(parent, "Proxy User Name", proxyConfig.Username, "Optional"); err != nil {
+		return err
+	}
+	if pt.proxyPasswordEdit, err = newLineEditRow(parent, "Proxy Password", proxyConfig.Password, "Optional"); err != nil {
+		return err
+	}
+	pt.proxyPasswordEdit.SetPasswordMode(true)
+	if pt.proxyBypassEdit, err = newLineEditRow(parent, "Bypass Proxy For", strings.Join(proxyConfig.Bypass, "; "), "*.corp.example.com; <local>"); err != nil {
+		return err
+	}
+	updateSettings := pt.configManager.GetUpdateSettings()
+	if pt.updateCABundleEdit, err = newLineEditRow(parent, "Updates CA Bundle", updateSettings.CABundlePath, "Optional PEM file"); err != nil {
+		return err
+	}
+	if pt.updatePACEdit, err = newLineEditRow(parent, "Updates PAC Script", updateSettings.PACURL, "Optional, replaces the proxy for updates"); err != nil {
+		return err
+	}
+
+	testRow, err := walk.NewComposite(parent)
+	if err != nil {
+		return err
+	}
+	testRowLayout := walk.NewHBoxLayout()
+	testRowLayout.SetMargins(walk.Margins{})
+	testRowLayout.SetSpacing(12)
+	testRow.SetLayout(testRowLayout)
+
+	if pt.proxyTestButton, err = walk.NewPushButton(testRow); err != nil {
+		return err
+	}
+	pt.proxyTestButton.SetText("&Test Connection")
+	pt.proxyTestButton.Clicked().Attach(pt.onTestProxy)
+	if pt.proxyTestLabel, err = walk.NewLabel(testRow); err != nil {
+		return err
+	}
+	walk.NewHSpacer(testRow)
+
+	proxyDescLabel, err := walk.NewLabel(parent)
+	if err != nil {
+		return err
+	}
+	proxyDescLabel.SetText("Used to reach your Pangolin server and to check for updates. The tunnel uses a new proxy the next time it connects. Update checks can also trust the certificates of a CA bundle, or pick their proxy with a PAC script.")
+	proxyDescLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	pt.proxyModeComboBox.CurrentIndexChanged().Attach(pt.updateProxyFields)
+	pt.updateProxyFields()
+	return nil
+}
+
+// createKillSwitchSection creates the kill switch settings
+func (pt *PreferencesTab) createKillSwitchSection(parent walk.Container, font *walk.Font) error {
+	killSwitchSectionTitle, err := walk.NewLabel(parent)
+	if err != nil {
+		return err
+	}
+	killSwitchSectionTitle.SetText("Kill Switch")
+	if font != nil {
+		killSwitchSectionTitle.SetFont(font)
+	}
+
+	settings := pt.configManager.GetKillSwitch()
+	if pt.killSwitchCheckBox, err = walk.NewCheckBox(parent); err != nil {
+		return err
+	}
+	pt.killSwitchCheckBox.SetText("Block traffic outside the tunnel while it is connecting or connected")
+	pt.killSwitchCheckBox.SetChecked(settings.Enabled)
+	if pt.killSwitchLANBox, err = walk.NewCheckBox(parent); err != nil {
+		return err
+	}
+	pt.killSwitchLANBox.SetText("Allow the local network")
+	pt.killSwitchLANBox.SetChecked(settings.AllowLAN)
+	if pt.killSwitchAllowEdit, err = newLineEditRow(parent, "Also Allow", strings.Join(settings.AllowedEndpoints, "; "), "203.0.113.10; 198.51.100.0/24"); err != nil {
+		return err
+	}
+
+	killSwitchDescLabel, err := walk.NewLabel(parent)
+	if err != nil {
+		return err
+	}
+	killSwitchDescLabel.SetText("Your Pangolin server, DHCP and your DNS servers stay reachable so that the tunnel can connect. Changes take effect the next time the tunnel connects.")
+	killSwitchDescLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	pt.killSwitchCheckBox.CheckedChanged().Attach(pt.updateKillSwitchFields)
+	pt.updateKillSwitchFields()
+	return nil
+}
+
+// killSwitchSettings returns the kill switch settings entered
+func (pt *PreferencesTab) killSwitchSettings() killswitch.Settings {
+	return killswitch.Settings{
+		Enabled:          pt.killSwitchCheckBox.Checked(),
+		AllowLAN:         pt.killSwitchLANBox.Checked(),
+		AllowedEndpoints: splitList(pt.killSwitchAllowEdit.Text()),
+	}
+}
+
+// updateKillSwitchFields enables the exceptions only when the kill switch is
+// on
+func (pt *PreferencesTab) updateKillSwitchFields() {
+	enabled := pt.killSwitchCheckBox.Checked()
+	pt.killSwitchLANBox.SetEnabled(enabled)
+	pt.killSwitchAllowEdit.SetEnabled(enabled)
+}
+
+// splitList splits a list separated by semicolons or commas
+func splitList(text string) []string {
+	var entries []string
+	for _, entry := range strings.FieldsFunc(text, func(r rune) bool { return r == ';' || r == ',' }) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// newLineEditRow creates a labeled line edit row
+func newLineEditRow(parent walk.Container, label, value, cueBanner string) (*walk.LineEdit, error) {
+	row, err := walk.NewComposite(parent)
+	if err != nil {
+		return nil, err
+	}
+	rowLayout := walk.NewHBoxLayout()
+	rowLayout.SetMargins(walk.Margins{})
+	rowLayout.SetSpacing(12)
+	row.SetLayout(rowLayout)
+
+	rowLabel, err := walk.NewLabel(row)
+	if err != nil {
+		return nil, err
+	}
+	rowLabel.SetText(label)
+	rowLabel.SetMinMaxSize(walk.Size{Width: 200, Height: 0}, walk.Size{Width: 200, Height: 0})
+
+	lineEdit, err := walk.NewLineEdit(row)
+	if err != nil {
+		return nil, err
+	}
+	lineEdit.SetText(value)
+	lineEdit.SetCueBanner(cueBanner)
+
+	// Spacer
+	walk.NewHSpacer(row)
+
+	return lineEdit, nil
+}
+
+// proxyConfig returns the proxy configuration entered
+func (pt *PreferencesTab) proxyConfig() proxy.Config {
+	proxyConfig := proxy.Config{
+		Mode:     proxyModes[max(pt.proxyModeComboBox.CurrentIndex(), 0)],
+		Address:  strings.TrimSpace(pt.proxyAddressEdit.Text()),
+		Username: strings.TrimSpace(pt.proxyUsernameEdit.Text()),
+		Password: pt.proxyPasswordEdit.Text(),
+	}
+	proxyConfig.Bypass = splitList(pt.proxyBypassEdit.Text())
+	if !proxyConfig.IsExplicit() {
+		return proxy.Config{Mode: proxyConfig.Mode}
+	}
+	return proxyConfig
+}
+
+// updateProxyFields enables the fields of an explicit proxy only when one is
+// selected
+func (pt *PreferencesTab) updateProxyFields() {
+	explicit := pt.proxyConfig().IsExplicit()
+	for _, edit := range []*walk.LineEdit{pt.proxyAddressEdit, pt.proxyUsernameEdit, pt.proxyPasswordEdit, pt.proxyBypassEdit} {
+		edit.SetEnabled(explicit)
+	}
+	pt.proxyTestLabel.SetText("")
+}
+
+// onTestProxy checks that the server of the active account can be reached
+// with the proxy entered, without saving it
+func (pt *PreferencesTab) onTestProxy() {
+	proxyConfig := pt.proxyConfig()
+	if err := proxyConfig.Validate(); err != nil {
+		pt.proxyTestLabel.SetText(err.Error())
+		return
+	}
+	target := config.DefaultHostname
+	if pt.window != nil && pt.window.authManager != nil {
+		target = pt.window.authManager.ServerURL()
+	}
+
+	pt.proxyTestButton.SetEnabled(false)
+	pt.proxyTestLabel.SetText("Connecting...")
+	go func() {
+		err := proxy.Check(context.Background(), proxyConfig, target)
+		walk.App().Synchronize(func() {
+			pt.proxyTestButton.SetEnabled(true)
+			switch {
+			case err == nil:
+				pt.proxyTestLabel.SetText("Connected to " + target)
+			case errors.Is(err, proxy.ErrAuthenticationRequired):
+				pt.proxyTestLabel.SetText("The proxy rejected the user name or password")
+			default:
+				logger.Warn("Proxy check failed: %v", err)
+				pt.proxyTestLabel.SetText("Failed: " + err.Error())
+			}
+		})
+	}()
+}
+
+// newComboBoxRow creates a labeled combo box row with value selected
+func (pt *PreferencesTab) newComboBoxRow(parent walk.Container, label string, values []string, value string) (*walk.ComboBox, error) {
+	row, err := walk.NewComposite(parent)
+	if err != nil {
+		return nil, err
+	}
+	rowLayout := walk.NewHBoxLayout()
+	rowLayout.SetMargins(walk.Margins{})
+	rowLayout.SetSpacing(12)
+	row.SetLayout(rowLayout)
+
+	rowLabel, err := walk.NewLabel(row)
+	if err != nil {
+		return nil, err
+	}
+	rowLabel.SetText(label)
+	rowLabel.SetMinMaxSize(walk.Size{Width: 200, Height: 0}, walk.Size{Width: 200, Height: 0})
+
+	comboBox, err := walk.NewDropDownBox(row)
+	if err != nil {
+		return nil, err
+	}
+	if err := comboBox.SetModel(values); err != nil {
+		return nil, err
+	}
+	index := 0
+	for i, v := range values {
+		if strings.EqualFold(v, value) {
+			index = i
+			break
+		}
+	}
+	comboBox.SetCurrentIndex(index)
+
+	// Spacer
+	walk.NewHSpacer(row)
+
+	return comboBox, nil
+}
+
 // SetWindow sets the parent window reference (called after window creation)
 func (pt *PreferencesTab) SetWindow(window *PreferencesWindow) {
 	pt.window = window
@@ -245,7 +629,7 @@ func (pt *PreferencesTab) Cleanup() {
 	// Nothing to clean up for now
 }
 
-// onSave handles the save button click and saves all DNS settings
+// onSave handles the save button click and saves all DNS and log settings
 func (pt *PreferencesTab) onSave() {
 	// Get current values from UI
 	dnsOverride := pt.dnsOverrideCheckBox.Checked()
@@ -273,24 +657,91 @@ func (pt *PreferencesTab) onSave() {
 		return
 	}
 
-	// Get current config and create a copy to modify
-	cfg := &config.Config{}
+	proxyConfig := pt.proxyConfig()
+	if err := proxyConfig.Validate(); err != nil {
+		var owner walk.Form
+		if pt.window != nil {
+			owner = pt.window
+		}
+		td := walk.NewTaskDialog()
+		_, _ = td.Show(walk.TaskDialogOpts{
+			Owner:         owner,
+			Title:         "Invalid Input",
+			Content:       "The proxy settings cannot be used: " + err.Error(),
+			IconSystem:    walk.TaskDialogSystemIconWarning,
+			CommonButtons: win.TDCBF_OK_BUTTON,
+		})
+		return
+	}
 
-	// Set DNS settings
-	dnsOverrideVal := dnsOverride
-	dnsTunnelVal := dnsTunnel
-	primaryDNSVal := primaryDNS
-	cfg.DNSOverride = &dnsOverrideVal
-	cfg.DNSTunnel = &dnsTunnelVal
-	cfg.PrimaryDNS = &primaryDNSVal
-	if secondaryDNS != "" {
-		cfg.SecondaryDNS = &secondaryDNS
-	} else {
-		cfg.SecondaryDNS = nil
+	updateSettings := config.UpdateSettings{
+		CABundlePath: strings.TrimSpace(pt.updateCABundleEdit.Text()),
+		PACURL:       strings.TrimSpace(pt.updatePACEdit.Text()),
+	}
+	if err := updateSettings.Validate(); err != nil {
+		var owner walk.Form
+		if pt.window != nil {
+			owner = pt.window
+		}
+		td := walk.NewTaskDialog()
+		_, _ = td.Show(walk.TaskDialogOpts{
+			Owner:         owner,
+			Title:         "Invalid Input",
+			Content:       "The update settings cannot be used: " + err.Error(),
+			IconSystem:    walk.TaskDialogSystemIconWarning,
+			CommonButtons: win.TDCBF_OK_BUTTON,
+		})
+		return
+	}
+
+	killSwitch := pt.killSwitchSettings()
+	if err := killSwitch.Validate(); err != nil {
+		var owner walk.Form
+		if pt.window != nil {
+			owner = pt.window
+		}
+		td := walk.NewTaskDialog()
+		_, _ = td.Show(walk.TaskDialogOpts{
+			Owner:         owner,
+			Title:         "Invalid Input",
+			Content:       "The kill switch exceptions cannot be used: " + err.Error(),
+			IconSystem:    walk.TaskDialogSystemIconWarning,
+			CommonButtons: win.TDCBF_OK_BUTTON,
+		})
+		return
+	}
+
+	// Save DNS settings, preserving all other fields
+	success := pt.configManager.SetDNSSettings(dnsOverride, dnsTunnel, primaryDNS, secondaryDNS)
+
+	// Save and apply log settings
+	if success {
+		success = pt.saveLogSettings()
+	}
+
+	// Save and apply proxy settings
+	if success {
+		success = pt.saveProxySettings(proxyConfig)
+	}
+
+	// Save the update settings and have the manager apply them
+	if success {
+		success = pt.saveUpdateSettings(updateSettings)
 	}
 
-	// Save all settings at once
-	success := pt.configManager.Save(cfg)
+	// Save kill switch settings, which the tunnel picks up when it connects
+	if success {
+		success = pt.configManager.SetKillSwitch(killSwitch)
+	}
+
+	// Save notification categories
+	if success {
+		enabled := make(map[string]bool, len(pt.notificationBoxes))
+		for category, checkBox := range pt.notificationBoxes {
+			enabled[string(category)] = checkBox.Checked()
+		}
+		success = pt.configManager.SetNotifications(enabled)
+	}
 
 	if success {
 		// Show system notification for success
@@ -315,3 +766,66 @@ func (pt *PreferencesTab) onSave() {
 		})
 	}
 }
+
+// saveLogSettings persists the log settings, applies them to this process and
+// asks the manager to apply them to the services
+func (pt *PreferencesTab) saveLogSettings() bool {
+	settings := logging.Settings{
+		Level:      logLevelNames[max(pt.logLevelComboBox.CurrentIndex(), 0)],
+		Format:     logFormatNames[max(pt.logFormatComboBox.CurrentIndex(), 0)],
+		Components: pt.configManager.GetComponentLogLevels(),
+	}
+	for component, comboBox := range pt.componentLevelBoxes {
+		if index := comboBox.CurrentIndex(); index > 0 {
+			settings.Components[component] = componentLevelNames[index]
+		} else {
+			delete(settings.Components, component)
+		}
+	}
+	if !pt.configManager.SetLogSettings(settings.Level, settings.Format, settings.Components) {
+		return false
+	}
+	if err := logging.Configure(settings); err != nil {
+		logger.Error("Failed to apply log settings: %v", err)
+		return false
+	}
+	if err := managers.IPCClientSetLogSettings(settings); err != nil {
+		logger.Error("Failed to apply log settings to manager: %v", err)
+		return false
+	}
+	return true
+}
+
+// saveProxySettings persists the proxy settings, the password in the
+// credential store, applies them to this process and asks the manager to
+// apply them to update checks
+func (pt *PreferencesTab) saveProxySettings(proxyConfig proxy.Config) bool {
+	if !pt.configManager.SetProxy(proxyConfig) {
+		return false
+	}
+	if !pt.secretManager.SaveProxyPassword(proxyConfig.Password) {
+		return false
+	}
+	if err := api.SetProxy(proxyConfig); err != nil {
+		logger.Error("Failed to apply proxy settings: %v", err)
+		return false
+	}
+	if err := managers.IPCClientSetProxy(proxyConfig); err != nil {
+		logger.Error("Failed to apply proxy settings to manager: %v", err)
+		return false
+	}
+	return true
+}
+
+// saveUpdateSettings persists the CA bundle and PAC script of update checks
+// and asks the manager to apply them
+func (pt *PreferencesTab) saveUpdateSettings(settings config.UpdateSettings) bool {
+	if !pt.configManager.SetUpdateSettings(settings) {
+		return false
+	}
+	if err := managers.IPCClientSetUpdateSettings(settings); err != nil {
+		logger.Error("Failed to apply update settings to manager: %v", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+//go:build windows
+
+package preferences
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/fosrl/windows/api"
+
+	browser "github.com/pkg/browser"
+	"github.com/tailscale/walk"
+)
+
+// ResourceAction is something the user can do with a resource
+type ResourceAction struct {
+	Text string
+	Run  func() error
+}
+
+// ResourceAddress returns the address of a resource as users type it, with
+// its port if it has one
+func ResourceAddress(r api.SiteResource) string {
+	if port := r.Port(); port != 0 && r.Mode != "cidr" {
+		return net.JoinHostPort(r.Address(), strconv.Itoa(port))
+	}
+	return r.Address()
+}
+
+// ResourceActions returns the actions offered for a resource. Copying the
+// address always comes first; the others depend on what the resource looks
+// like it serves.
+func ResourceActions(r api.SiteResource) []ResourceAction {
+	address := ResourceAddress(r)
+	actions := []ResourceAction{{
+		Text: "Copy Address",
+		Run: func() error {
+			return walk.Clipboard().SetText(address)
+		},
+	}}
+	if r.Mode == "cidr" || r.Address() == "" {
+		return actions
+	}
+
+	host := r.Address()
+	port := r.Port()
+	protocol := strings.ToLower(r.Protocol)
+	if protocol == "udp" {
+		return actions
+	}
+
+	switch port {
+	case 80, 443, 8080, 8443:
+		scheme := "http"
+		if port == 443 || port == 8443 {
+			scheme = "https"
+		}
+		url := fmt.Sprintf("%s://%s", scheme, host)
+		if port != 80 && port != 443 {
+			url = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+		actions = append(actions, ResourceAction{
+			Text: "Open in Browser",
+			Run: func() error {
+				return browser.OpenURL(url)
+			},
+		})
+	case 3389:
+		actions = append(actions, ResourceAction{
+			Text: "Connect with Remote Desktop",
+			Run: func() error {
+				return exec.Command("mstsc.exe", "/v:"+address).Start()
+			},
+		})
+	case 22:
+		actions = append(actions, ResourceAction{
+			Text: "Connect with SSH",
+			Run: func() error {
+				// Open a console window for the built-in OpenSSH client
+				return exec.Command("cmd.exe", "/c", "start", "SSH", "ssh.exe", "-p", strconv.Itoa(port), host).Start()
+			},
+		})
+	}
+	return actions
+}
@@ -0,0 +1,235 @@
+//go:build windows
+
+package preferences
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/fosrl/windows/api"
+	"github.com/fosrl/windows/auth"
+	"github.com/fosrl/windows/events"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/tailscale/walk"
+)
+
+// resourceRow is a row of the resources table
+type resourceRow struct {
+	Name     string
+	Site     string
+	Address  string
+	Port     string
+	Protocol string
+	resource api.SiteResource
+}
+
+// ResourcesTab lists the resources of the selected organization
+type ResourcesTab struct {
+	tabPage     *walk.TabPage
+	authManager *auth.AuthManager
+
+	tableView     *walk.TableView
+	statusLabel   *walk.Label
+	copyButton    *walk.PushButton
+	connectButton *walk.PushButton
+	rows          []*resourceRow
+
+	subscription *events.Subscription[auth.Resources]
+}
+
+// NewResourcesTab creates a new Resources tab
+func NewResourcesTab(am *auth.AuthManager) *ResourcesTab {
+	return &ResourcesTab{authManager: am}
+}
+
+// Create creates the Resources tab UI
+func (rt *ResourcesTab) Create(parent *walk.TabWidget) (*walk.TabPage, error) {
+	var err error
+	if rt.tabPage, err = walk.NewTabPage(); err != nil {
+		return nil, err
+	}
+
+	rt.tabPage.SetTitle("Resources")
+	rt.tabPage.SetLayout(walk.NewVBoxLayout())
+
+	if rt.statusLabel, err = walk.NewLabel(rt.tabPage); err != nil {
+		return nil, err
+	}
+	rt.statusLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	if rt.tableView, err = walk.NewTableView(rt.tabPage); err != nil {
+		return nil, err
+	}
+	rt.tableView.SetAlternatingRowBG(true)
+	rt.tableView.SetLastColumnStretched(true)
+
+	for _, column := range []struct {
+		name  string
+		title string
+		width int
+	}{
+		{"Name", "Name", 180},
+		{"Site", "Site", 140},
+		{"Address", "Address", 180},
+		{"Port", "Port", 60},
+		{"Protocol", "Protocol", 0},
+	} {
+		col := walk.NewTableViewColumn()
+		col.SetName(column.name)
+		col.SetTitle(column.title)
+		if column.width > 0 {
+			col.SetWidth(column.width)
+		}
+		rt.tableView.Columns().Add(col)
+	}
+
+	rt.tableView.SelectedIndexesChanged().Attach(rt.updateButtons)
+	rt.tableView.ItemActivated().Attach(func() {
+		// Double click connects if there is a way to, and copies otherwise
+		actions := rt.selectedActions()
+		if len(actions) > 0 {
+			rt.run(actions[len(actions)-1])
+		}
+	})
+
+	rt.setResources(rt.authManager.Resources())
+	rt.subscription = rt.authManager.ResourceEvents().Subscribe(func(resources auth.Resources) {
+		walk.App().Synchronize(func() {
+			rt.setResources(resources)
+		})
+	})
+	go rt.refresh()
+
+	return rt.tabPage, nil
+}
+
+// AfterAdd is called after the tab page is added to the tab widget
+func (rt *ResourcesTab) AfterAdd() {
+	buttonsContainer, err := walk.NewComposite(rt.tabPage)
+	if err != nil {
+		logger.Error("Failed to create buttons container: %v", err)
+		return
+	}
+	buttonsContainer.SetLayout(walk.NewHBoxLayout())
+	buttonsContainer.Layout().SetMargins(walk.Margins{})
+
+	refreshButton, err := walk.NewPushButton(buttonsContainer)
+	if err != nil {
+		logger.Error("Failed to create refresh button: %v", err)
+		return
+	}
+	refreshButton.SetText("&Refresh")
+	refreshButton.Clicked().Attach(func() {
+		go rt.refresh()
+	})
+
+	walk.NewHSpacer(buttonsContainer)
+
+	if rt.copyButton, err = walk.NewPushButton(buttonsContainer); err != nil {
+		logger.Error("Failed to create copy button: %v", err)
+		return
+	}
+	rt.copyButton.SetText("&Copy Address")
+	rt.copyButton.Clicked().Attach(func() {
+		if actions := rt.selectedActions(); len(actions) > 0 {
+			rt.run(actions[0])
+		}
+	})
+
+	if rt.connectButton, err = walk.NewPushButton(buttonsContainer); err != nil {
+		logger.Error("Failed to create connect button: %v", err)
+		return
+	}
+	rt.connectButton.SetText("C&onnect")
+	rt.connectButton.Clicked().Attach(func() {
+		if actions := rt.selectedActions(); len(actions) > 1 {
+			rt.run(actions[1])
+		}
+	})
+
+	rt.updateButtons()
+}
+
+// Cleanup cleans up resources when the tab is closed
+func (rt *ResourcesTab) Cleanup() {
+	rt.subscription.Unsubscribe()
+}
+
+// refresh fetches the resources; the subscription shows them
+func (rt *ResourcesTab) refresh() {
+	if err := rt.authManager.RefreshResources(); err != nil {
+		logger.Error("Failed to refresh resources: %v", err)
+		walk.App().Synchronize(func() {
+			rt.statusLabel.SetText(fmt.Sprintf("Failed to load resources: %v", err))
+		})
+	}
+}
+
+// setResources shows resources in the table
+func (rt *ResourcesTab) setResources(resources auth.Resources) {
+	rt.rows = make([]*resourceRow, 0, len(resources.Resources))
+	for _, resource := range resources.Resources {
+		row := &resourceRow{
+			Name:     resource.Name,
+			Site:     resource.SiteName,
+			Address:  resource.Address(),
+			Protocol: resource.Protocol,
+			resource: resource,
+		}
+		if port := resource.Port(); port != 0 {
+			row.Port = strconv.Itoa(port)
+		}
+		if resource.Mode == "cidr" {
+			row.Protocol = "Network"
+		}
+		rt.rows = append(rt.rows, row)
+	}
+	if err := rt.tableView.SetModel(rt.rows); err != nil {
+		logger.Error("Failed to show resources: %v", err)
+	}
+
+	switch {
+	case resources.FetchedAt.IsZero():
+		rt.statusLabel.SetText("Resources of the selected organization appear here once they are loaded.")
+	case resources.Unsupported:
+		rt.statusLabel.SetText(fmt.Sprintf("The server cannot list resources. Update the server to see them. %d sites.", len(resources.Sites)))
+	case len(rt.rows) == 0:
+		rt.statusLabel.SetText(fmt.Sprintf("No resources in %d sites. Updated %s.", len(resources.Sites), resources.FetchedAt.Format("15:04")))
+	default:
+		rt.statusLabel.SetText(fmt.Sprintf("%d resources in %d sites. Updated %s.", len(rt.rows), len(resources.Sites), resources.FetchedAt.Format("15:04")))
+	}
+	rt.updateButtons()
+}
+
+// selectedActions returns the actions of the selected resource
+func (rt *ResourcesTab) selectedActions() []ResourceAction {
+	index := rt.tableView.CurrentIndex()
+	if index < 0 || index >= len(rt.rows) {
+		return nil
+	}
+	return ResourceActions(rt.rows[index].resource)
+}
+
+// updateButtons enables the buttons that apply to the selected resource
+func (rt *ResourcesTab) updateButtons() {
+	if rt.copyButton == nil || rt.connectButton == nil {
+		return
+	}
+	actions := rt.selectedActions()
+	rt.copyButton.SetEnabled(len(actions) > 0)
+	rt.connectButton.SetEnabled(len(actions) > 1)
+	if len(actions) > 1 {
+		rt.connectButton.SetText(actions[1].Text)
+	} else {
+		rt.connectButton.SetText("C&onnect")
+	}
+}
+
+// run runs a resource action, reporting failures in the status label
+func (rt *ResourcesTab) run(action ResourceAction) {
+	if err := action.Run(); err != nil {
+		logger.Error("%s failed: %v", action.Text, err)
+		rt.statusLabel.SetText(fmt.Sprintf("%s failed: %v", action.Text, err))
+	}
+}
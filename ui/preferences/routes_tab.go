@@ -0,0 +1,268 @@
+//go:build windows
+
+package preferences
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/fosrl/windows/auth"
+	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/routes"
+	"github.com/fosrl/windows/tunnel"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/tailscale/walk"
+	"github.com/tailscale/win"
+)
+
+// RoutesTab edits the routes included in and excluded from the tunnel, for
+// every organization and for the selected one
+type RoutesTab struct {
+	tabPage       *walk.TabPage
+	tunnelManager *tunnel.Manager
+	configManager *config.ConfigManager
+	authManager   *auth.AuthManager
+	window        *PreferencesWindow
+
+	globalIncludeEdit *walk.LineEdit
+	globalExcludeEdit *walk.LineEdit
+	orgIncludeEdit    *walk.LineEdit
+	orgExcludeEdit    *walk.LineEdit
+	conflictsLabel    *walk.Label
+	saveButton        *walk.PushButton
+}
+
+// NewRoutesTab creates a new Routes tab
+func NewRoutesTab(tm *tunnel.Manager, cm *config.ConfigManager, am *auth.AuthManager) *RoutesTab {
+	return &RoutesTab{
+		tunnelManager: tm,
+		configManager: cm,
+		authManager:   am,
+	}
+}
+
+// Create creates the Routes tab UI
+func (rt *RoutesTab) Create(parent *walk.TabWidget) (*walk.TabPage, error) {
+	var err error
+	if rt.tabPage, err = walk.NewTabPage(); err != nil {
+		return nil, err
+	}
+
+	rt.tabPage.SetTitle("Routes")
+	rt.tabPage.SetLayout(walk.NewVBoxLayout())
+
+	contentContainer, err := walk.NewComposite(rt.tabPage)
+	if err != nil {
+		return nil, err
+	}
+	contentLayout := walk.NewVBoxLayout()
+	contentLayout.SetMargins(walk.Margins{})
+	contentLayout.SetSpacing(16)
+	contentContainer.SetLayout(contentLayout)
+
+	font, _ := walk.NewFont("Segoe UI", 10, walk.FontBold)
+
+	globalSectionTitle, err := walk.NewLabel(contentContainer)
+	if err != nil {
+		return nil, err
+	}
+	globalSectionTitle.SetText("All Organizations")
+	if font != nil {
+		globalSectionTitle.SetFont(font)
+	}
+
+	global := rt.configManager.GetRoutes()
+	if rt.globalIncludeEdit, err = newLineEditRow(contentContainer, "Include", strings.Join(global.Include, "; "), "10.20.0.0/16; 172.16.5.10"); err != nil {
+		return nil, err
+	}
+	if rt.globalExcludeEdit, err = newLineEditRow(contentContainer, "Exclude", strings.Join(global.Exclude, "; "), "192.168.1.0/24"); err != nil {
+		return nil, err
+	}
+
+	orgSectionTitle, err := walk.NewLabel(contentContainer)
+	if err != nil {
+		return nil, err
+	}
+	orgSectionTitle.SetText("Selected Organization")
+	if org := rt.authManager.CurrentOrg(); org != nil {
+		orgSectionTitle.SetText(org.Name)
+	}
+	if font != nil {
+		orgSectionTitle.SetFont(font)
+	}
+
+	orgRoutes := rt.tunnelManager.OrgRoutes()
+	if rt.orgIncludeEdit, err = newLineEditRow(contentContainer, "Include", strings.Join(orgRoutes.Include, "; "), "Adds to all organizations"); err != nil {
+		return nil, err
+	}
+	if rt.orgExcludeEdit, err = newLineEditRow(contentContainer, "Exclude", strings.Join(orgRoutes.Exclude, "; "), "Adds to all organizations"); err != nil {
+		return nil, err
+	}
+	hasOrg := rt.authManager.CurrentOrg() != nil
+	rt.orgIncludeEdit.SetEnabled(hasOrg)
+	rt.orgExcludeEdit.SetEnabled(hasOrg)
+
+	descLabel, err := walk.NewLabel(contentContainer)
+	if err != nil {
+		return nil, err
+	}
+	descLabel.SetText("Included addresses and CIDR prefixes go through the tunnel besides the routes of your sites. Excluded ones stay on your local network or internet connection, even where a site covers them. Changes take effect the next time the tunnel connects.")
+	descLabel.SetTextColor(walk.RGB(100, 100, 100))
+
+	if rt.conflictsLabel, err = walk.NewLabel(contentContainer); err != nil {
+		return nil, err
+	}
+	rt.conflictsLabel.SetTextColor(walk.RGB(180, 90, 0))
+	if plan, err := rt.plan(); err == nil {
+		rt.showConflicts(rt.conflicts(plan))
+	}
+
+	walk.NewVSpacer(contentContainer)
+
+	return rt.tabPage, nil
+}
+
+// SetWindow sets the parent window reference
+func (rt *RoutesTab) SetWindow(window *PreferencesWindow) {
+	rt.window = window
+}
+
+// AfterAdd is called after the tab page is added to the tab widget
+func (rt *RoutesTab) AfterAdd() {
+	buttonsContainer, err := walk.NewComposite(rt.tabPage)
+	if err != nil {
+		logger.Error("Failed to create buttons container: %v", err)
+		return
+	}
+	buttonsContainer.SetLayout(walk.NewHBoxLayout())
+	buttonsContainer.Layout().SetMargins(walk.Margins{})
+
+	walk.NewHSpacer(buttonsContainer)
+
+	if rt.saveButton, err = walk.NewPushButton(buttonsContainer); err != nil {
+		logger.Error("Failed to create save button: %v", err)
+		return
+	}
+	rt.saveButton.SetText("&Save")
+	rt.saveButton.Clicked().Attach(rt.onSave)
+}
+
+// Cleanup cleans up resources when the tab is closed
+func (rt *RoutesTab) Cleanup() {
+}
+
+// settings returns the global and organization routes entered
+func (rt *RoutesTab) settings() (global, org routes.Settings) {
+	global = routes.Settings{Include: splitList(rt.globalIncludeEdit.Text()), Exclude: splitList(rt.globalExcludeEdit.Text())}
+	org = routes.Settings{Include: splitList(rt.orgIncludeEdit.Text()), Exclude: splitList(rt.orgExcludeEdit.Text())}
+	return global, org
+}
+
+// plan resolves the routes entered
+func (rt *RoutesTab) plan() (routes.Plan, error) {
+	global, org := rt.settings()
+	return routes.Combine(global, org)
+}
+
+// conflicts returns the included routes that overlap a local network that
+// is not excluded
+func (rt *RoutesTab) conflicts(plan routes.Plan) []routes.Conflict {
+	locals, err := routes.LocalNetworks(tunnel.InterfaceName)
+	if err != nil {
+		logger.Warn("Failed to list the local networks: %v", err)
+		return nil
+	}
+	var conflicts []routes.Conflict
+	for _, conflict := range routes.Conflicts(plan.Include, locals) {
+		if covered, _ := routes.Covered([]netip.Prefix{conflict.Local.Prefix}, plan.Exclude); len(covered) == 0 {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+// showConflicts lists conflicts under the routes
+func (rt *RoutesTab) showConflicts(conflicts []routes.Conflict) {
+	var lines []string
+	for _, conflict := range conflicts {
+		lines = append(lines, "Included route "+conflict.String())
+	}
+	rt.conflictsLabel.SetText(strings.Join(lines, "\n"))
+}
+
+// onSave validates and saves the routes, asking first if an included route
+// overlaps a local network
+func (rt *RoutesTab) onSave() {
+	var owner walk.Form
+	if rt.window != nil {
+		owner = rt.window
+	}
+
+	global, org := rt.settings()
+	plan, err := routes.Combine(global, org)
+	if err != nil {
+		td := walk.NewTaskDialog()
+		_, _ = td.Show(walk.TaskDialogOpts{
+			Owner:         owner,
+			Title:         "Invalid Input",
+			Content:       "The routes cannot be used: " + err.Error(),
+			IconSystem:    walk.TaskDialogSystemIconWarning,
+			CommonButtons: win.TDCBF_OK_BUTTON,
+		})
+		return
+	}
+
+	conflicts := rt.conflicts(plan)
+	rt.showConflicts(conflicts)
+	if len(conflicts) > 0 {
+		var lines []string
+		for _, conflict := range conflicts {
+			lines = append(lines, conflict.String())
+		}
+		accepted := false
+		td := walk.NewTaskDialog()
+		opts := walk.TaskDialogOpts{
+			Owner:         owner,
+			Title:         "Routes Overlap Local Networks",
+			Content:       fmt.Sprintf("%s\n\nThese addresses may no longer be reached on your local network while the tunnel is connected. Exclude them to keep reaching them locally.\n\nSave anyway?", strings.Join(lines, "\n")),
+			IconSystem:    walk.TaskDialogSystemIconWarning,
+			CommonButtons: win.TDCBF_YES_BUTTON | win.TDCBF_NO_BUTTON,
+			DefaultButton: walk.TaskDialogDefaultButtonNo,
+		}
+		opts.CommonButtonClicked(win.TDCBF_YES_BUTTON).Attach(func() bool {
+			accepted = true
+			return false
+		})
+		td.Show(opts)
+		if !accepted {
+			return
+		}
+	}
+
+	success := rt.configManager.SetRoutes(global)
+	if success && rt.authManager.CurrentOrg() != nil {
+		if err := rt.tunnelManager.SetOrgRoutes(org); err != nil {
+			logger.Error("Failed to save the routes of the organization: %v", err)
+			success = false
+		}
+	}
+
+	if success {
+		if rt.window != nil && rt.window.trayIcon != nil {
+			walk.App().Synchronize(func() {
+				rt.window.trayIcon.ShowInfo("Settings Saved", "Routes have been saved and apply the next time the tunnel connects.")
+			})
+		}
+	} else {
+		td := walk.NewTaskDialog()
+		_, _ = td.Show(walk.TaskDialogOpts{
+			Owner:         owner,
+			Title:         "Save Failed",
+			Content:       "Failed to save routes. Please try again.",
+			IconSystem:    walk.TaskDialogSystemIconError,
+			CommonButtons: win.TDCBF_OK_BUTTON,
+		})
+	}
+}
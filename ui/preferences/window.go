@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/fosrl/windows/auth"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/secrets"
 	"github.com/fosrl/windows/tunnel"
 
 	"github.com/fosrl/newt/logger"
@@ -21,6 +23,8 @@ type PreferencesWindow struct {
 	tabWidget     *walk.TabWidget
 	tunnelManager *tunnel.Manager
 	configManager *config.ConfigManager
+	secretManager *secrets.SecretManager
+	authManager   *auth.AuthManager
 	trayIcon      *walk.NotifyIcon
 	tabs          []Tab
 }
@@ -42,8 +46,9 @@ var (
 )
 
 // ShowPreferencesWindow shows the preferences window (creates if needed, or brings to front).
-// It accepts a tunnel manager to enable OLM status polling, a config manager for settings, and a tray icon for notifications.
-func ShowPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.ConfigManager, trayIcon *walk.NotifyIcon) error {
+// It accepts a tunnel manager to enable OLM status polling, a config manager for settings, a secret manager for the
+// proxy password, an auth manager for the resources of the selected organization, and a tray icon for notifications.
+func ShowPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.ConfigManager, sm *secrets.SecretManager, am *auth.AuthManager, trayIcon *walk.NotifyIcon) error {
 	preferencesWindowMutex.Lock()
 	defer preferencesWindowMutex.Unlock()
 
@@ -61,7 +66,7 @@ func ShowPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.Confi
 	}
 
 	// Create new window
-	pw, err := NewPreferencesWindow(owner, tm, cm, trayIcon)
+	pw, err := NewPreferencesWindow(owner, tm, cm, sm, am, trayIcon)
 	if err != nil {
 		return err
 	}
@@ -88,10 +93,12 @@ func ShowPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.Confi
 }
 
 // NewPreferencesWindow creates a new preferences window with tabs
-func NewPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.ConfigManager, trayIcon *walk.NotifyIcon) (*PreferencesWindow, error) {
+func NewPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.ConfigManager, sm *secrets.SecretManager, am *auth.AuthManager, trayIcon *walk.NotifyIcon) (*PreferencesWindow, error) {
 	pw := &PreferencesWindow{
 		tunnelManager: tm,
 		configManager: cm,
+		secretManager: sm,
+		authManager:   am,
 		trayIcon:      trayIcon,
 		tabs:          make([]Tab, 0),
 	}
@@ -114,8 +121,8 @@ func NewPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.Config
 	}
 
 	// Create and add tabs
-	// Order: Preferences, Status, Logs, About
-	prefsTab := NewPreferencesTab(cm)
+	// Order: Preferences, Status, Resources, Routes, Logs, About
+	prefsTab := NewPreferencesTab(cm, sm)
 	if tabPage, err := prefsTab.Create(pw.tabWidget); err != nil {
 		return nil, fmt.Errorf("failed to create preferences tab: %w", err)
 	} else {
@@ -134,6 +141,27 @@ func NewPreferencesWindow(owner walk.Form, tm *tunnel.Manager, cm *config.Config
 		pw.tabs = append(pw.tabs, olmTab)
 	}
 
+	if am != nil {
+		resourcesTab := NewResourcesTab(am)
+		if tabPage, err := resourcesTab.Create(pw.tabWidget); err != nil {
+			return nil, fmt.Errorf("failed to create resources tab: %w", err)
+		} else {
+			pw.tabWidget.Pages().Add(tabPage)
+			resourcesTab.AfterAdd()
+			pw.tabs = append(pw.tabs, resourcesTab)
+		}
+
+		routesTab := NewRoutesTab(tm, cm, am)
+		if tabPage, err := routesTab.Create(pw.tabWidget); err != nil {
+			return nil, fmt.Errorf("failed to create routes tab: %w", err)
+		} else {
+			routesTab.SetWindow(pw)
+			pw.tabWidget.Pages().Add(tabPage)
+			routesTab.AfterAdd()
+			pw.tabs = append(pw.tabs, routesTab)
+		}
+	}
+
 	logsTab := NewLogsTab()
 	if tabPage, err := logsTab.Create(pw.tabWidget); err != nil {
 		return nil, fmt.Errorf("failed to create logs tab: %w", err)
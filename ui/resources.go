@@ -0,0 +1,127 @@
+//go:build windows
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/fosrl/newt/logger"
+	"github.com/fosrl/windows/auth"
+	"github.com/fosrl/windows/ui/preferences"
+	"github.com/tailscale/walk"
+	"github.com/tailscale/win"
+)
+
+var (
+	resourcesMenu       *walk.Menu
+	resourcesMenuAction *walk.Action
+)
+
+// createResourcesMenu adds the Resources submenu, which lists what the
+// selected organization's clients can reach
+func createResourcesMenu(actions *walk.ActionList) error {
+	var err error
+	resourcesMenu, err = walk.NewMenu()
+	if err != nil {
+		return err
+	}
+	resourcesMenuAction = walk.NewMenuAction(resourcesMenu)
+	resourcesMenuAction.SetText("Resources")
+	resourcesMenuAction.SetVisible(false) // Hidden initially
+	showResources(auth.Resources{})
+	return actions.Add(resourcesMenuAction)
+}
+
+// watchResources keeps the Resources submenu up to date, refreshing the
+// resources whenever another organization is selected
+func watchResources() {
+	if authManager == nil {
+		return
+	}
+	authManager.ResourceEvents().Subscribe(func(resources auth.Resources) {
+		walk.App().Synchronize(func() {
+			showResources(resources)
+		})
+	})
+
+	lastOrgID := ""
+	authManager.StateEvents().Subscribe(func(state auth.State) {
+		if !state.Authenticated || state.OrgID == lastOrgID {
+			return
+		}
+		lastOrgID = state.OrgID
+		walk.App().Synchronize(func() {
+			showResources(auth.Resources{})
+		})
+		refreshResources()
+	})
+}
+
+// refreshResources fetches the resources of the selected organization
+func refreshResources() {
+	if authManager == nil {
+		return
+	}
+	if err := authManager.RefreshResources(); err != nil {
+		logger.Error("Failed to refresh resources: %v", err)
+	}
+}
+
+// showResources rebuilds the Resources submenu
+func showResources(resources auth.Resources) {
+	if resourcesMenu == nil {
+		return
+	}
+	actions := resourcesMenu.Actions()
+	actions.Clear()
+
+	if len(resources.Resources) == 0 {
+		text := "No resources"
+		if resources.FetchedAt.IsZero() {
+			text = "Loading resources..."
+		} else if resources.Unsupported {
+			text = "Not supported by the server"
+		}
+		empty := walk.NewAction()
+		empty.SetText(text)
+		empty.SetEnabled(false)
+		actions.Add(empty)
+	}
+
+	for _, resource := range resources.Resources {
+		submenu, err := walk.NewMenu()
+		if err != nil {
+			logger.Error("Failed to create resource menu: %v", err)
+			continue
+		}
+		for _, resourceAction := range preferences.ResourceActions(resource) {
+			action := walk.NewAction()
+			action.SetText(resourceAction.Text)
+			action.Triggered().Attach(func() {
+				if err := resourceAction.Run(); err != nil {
+					logger.Error("%s failed: %v", resourceAction.Text, err)
+					td := walk.NewTaskDialog()
+					_, _ = td.Show(walk.TaskDialogOpts{
+						Owner:         mainWindow,
+						Title:         resourceAction.Text,
+						Content:       fmt.Sprintf("%s failed: %v", resourceAction.Text, err),
+						IconSystem:    walk.TaskDialogSystemIconError,
+						CommonButtons: win.TDCBF_OK_BUTTON,
+					})
+				}
+			})
+			submenu.Actions().Add(action)
+		}
+		menuAction := walk.NewMenuAction(submenu)
+		menuAction.SetText(fmt.Sprintf("%s (%s)", resource.Name, preferences.ResourceAddress(resource)))
+		actions.Add(menuAction)
+	}
+
+	actions.Add(walk.NewSeparatorAction())
+	refreshAction := walk.NewAction()
+	refreshAction.SetText("Refresh")
+	refreshAction.Triggered().Attach(func() {
+		go refreshResources()
+	})
+	actions.Add(refreshAction)
+}
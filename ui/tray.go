@@ -3,6 +3,7 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
@@ -12,6 +13,7 @@ import (
 	"github.com/fosrl/windows/api"
 	"github.com/fosrl/windows/auth"
 	"github.com/fosrl/windows/config"
+	"github.com/fosrl/windows/events"
 	"github.com/fosrl/windows/managers"
 	"github.com/fosrl/windows/secrets"
 	"github.com/fosrl/windows/tunnel"
@@ -35,6 +37,7 @@ var (
 	startupDialogMutex sync.Mutex
 	updateAction       *walk.Action
 	loadingAction      *walk.Action
+	offlineAction      *walk.Action
 	statusAction       *walk.Action
 	connectAction      *walk.Action
 	orgsMenuAction     *walk.Action
@@ -42,11 +45,15 @@ var (
 	loginAction        *walk.Action
 	logoutAction       *walk.Action
 	addAccountAction   *walk.Action
+	renameAction       *walk.Action
 	moreAction         *walk.Action
 	quitAction         *walk.Action
-	updateFoundCb      *managers.UpdateFoundCallback
-	updateProgressCb   *managers.UpdateProgressCallback
-	managerStoppingCb  *managers.ManagerStoppingCallback
+	updateFoundSub     *events.Subscription[managers.UpdateState]
+	rollbackNotified   managers.UpdateState
+	updateRequired     bool
+	updateProgressSub  *events.Subscription[updater.DownloadProgress]
+	managerStoppingSub *events.Subscription[struct{}]
+	refreshScheduler   *auth.RefreshScheduler
 	isConnected        bool
 	connectMutex       sync.RWMutex
 	isLoggedOut        bool
@@ -56,6 +63,7 @@ var (
 	authManager        *auth.AuthManager
 	configManager      *config.ConfigManager
 	accountManager     *config.AccountManager
+	secretManager      *secrets.SecretManager
 	apiClient          *api.APIClient
 	tunnelManager      *tunnel.Manager
 	orgMenu            *walk.Menu
@@ -149,19 +157,19 @@ func handleMenuOpen() {
 	// Run in background goroutine to avoid blocking menu
 	go func() {
 		// First, try to get the user to verify session is still valid
-		user, err := apiClient.GetUser()
-		if err != nil {
-			// If getting user fails, mark as logged out
-			loggedOutMutex.Lock()
-			isLoggedOut = true
-			loggedOutMutex.Unlock()
-			// Update menu to reflect logged out state
+		if err := authManager.Revalidate(); err != nil {
+			// Only a rejected session logs out. If the server cannot be
+			// reached, the cached account stays and the menu says so.
+			if auth.IsUnauthorized(err) {
+				loggedOutMutex.Lock()
+				isLoggedOut = true
+				loggedOutMutex.Unlock()
+			}
 			updateMenu()
 			return
 		}
 
-		// If successful, update user and clear logged out state
-		authManager.UpdateCurrentUser(user)
+		// If successful, clear logged out state
 		loggedOutMutex.Lock()
 		isLoggedOut = false
 		loggedOutMutex.Unlock()
@@ -169,14 +177,10 @@ func handleMenuOpen() {
 		// Update menu to reflect updated state
 		updateMenu()
 
-		// Refresh organizations in background
-		if authManager.IsAuthenticated() {
-			if err := authManager.RefreshOrganizations(); err != nil {
-				logger.Error("Failed to refresh organizations: %v", err)
-			} else {
-				// Update menu again after orgs refresh
-				updateMenu()
-			}
+		// Refresh organizations in background; the menu is rebuilt if
+		// they changed
+		if refreshScheduler != nil {
+			refreshScheduler.Trigger("menu")
 		}
 	}()
 }
@@ -204,6 +208,13 @@ func setupMenu() error {
 	loadingAction.SetEnabled(false)
 	actions.Add(loadingAction)
 
+	// Create offline action (initially hidden)
+	offlineAction = walk.NewAction()
+	offlineAction.SetText("Offline - showing cached account")
+	offlineAction.SetEnabled(false)
+	offlineAction.SetVisible(false)
+	actions.Add(offlineAction)
+
 	// Create status action
 	statusAction = walk.NewAction()
 	statusAction.SetText("Disconnected")
@@ -241,9 +252,11 @@ func setupMenu() error {
 			if currentState != tunnel.StateStopped && currentState != tunnel.StateStopping {
 				// Disconnect (or cancel connection)
 				logger.Info("Disconnecting...")
+				setUserDisconnect(true)
 				err := tunnelManager.Disconnect()
 				if err != nil {
 					logger.Error("Failed to stop tunnel: %v", err)
+					setUserDisconnect(false)
 					// Show error dialog to user
 					walk.App().Synchronize(func() {
 						var title, message string
@@ -287,14 +300,24 @@ func setupMenu() error {
 							message = err.Error()
 						}
 
-						td := walk.NewTaskDialog()
-						_, _ = td.Show(walk.TaskDialogOpts{
+						opts := walk.TaskDialogOpts{
 							Owner:         mainWindow,
 							Title:         title,
 							Content:       message,
 							IconSystem:    walk.TaskDialogSystemIconError,
 							CommonButtons: win.TDCBF_OK_BUTTON,
+							CustomButtons: []walk.TaskDialogCustomButton{{MainText: "Check Connection"}},
+						}
+						checkConnection := false
+						opts.CustomButtons[0].Clicked().Attach(func() bool {
+							checkConnection = true
+							return false
 						})
+						td := walk.NewTaskDialog()
+						_, _ = td.Show(opts)
+						if checkConnection {
+							runDoctor()
+						}
 					})
 				}
 			}
@@ -328,6 +351,12 @@ func setupMenu() error {
 	orgsMenuAction.SetVisible(false) // Hidden initially
 	actions.Add(orgsMenuAction)
 
+	// Create resources menu
+	if err := createResourcesMenu(actions); err != nil {
+		logger.Error("Failed to create resources menu: %v", err)
+		return err
+	}
+
 	// Separator before login
 	actions.Add(walk.NewSeparatorAction())
 
@@ -335,7 +364,7 @@ func setupMenu() error {
 	loginAction = walk.NewAction()
 	loginAction.SetText("Login to account")
 	loginAction.Triggered().Attach(func() {
-		ShowLoginDialog(mainWindow, authManager, configManager, accountManager, apiClient, tunnelManager)
+		ShowLoginDialog(mainWindow, authManager, configManager, accountManager, apiClient, tunnelManager, nil)
 		// Update menu after dialog closes (login may have succeeded)
 		time.Sleep(100 * time.Millisecond) // Small delay to let auth state update
 		updateMenu()
@@ -433,6 +462,8 @@ func setupMenu() error {
 				logger.Info("Update available")
 				// Trigger the update
 				triggerUpdate(mainWindow)
+			case managers.UpdateStateRolledBack, managers.UpdateStateRollbackFailed:
+				showRollbackNotification(updateState)
 			case managers.UpdateStateUpdatesDisabledUnofficialBuild:
 				walk.App().Synchronize(func() {
 					td := walk.NewTaskDialog()
@@ -467,7 +498,7 @@ func setupMenu() error {
 	preferencesAction.Triggered().Attach(func() {
 		go func() {
 			walk.App().Synchronize(func() {
-				if err := preferences.ShowPreferencesWindow(mainWindow, tunnelManager, configManager, trayIcon); err != nil {
+				if err := preferences.ShowPreferencesWindow(mainWindow, tunnelManager, configManager, secretManager, authManager, trayIcon); err != nil {
 					logger.Error("Failed to show preferences window: %v", err)
 					td := walk.NewTaskDialog()
 					_, _ = td.Show(walk.TaskDialogOpts{
@@ -483,6 +514,18 @@ func setupMenu() error {
 	})
 	moreMenu.Actions().Add(preferencesAction)
 
+	// Export Diagnostics action
+	diagnosticsAction := walk.NewAction()
+	diagnosticsAction.SetText("Export Diagnostics...")
+	diagnosticsAction.Triggered().Attach(exportDiagnostics)
+	moreMenu.Actions().Add(diagnosticsAction)
+
+	// Connection Checks action
+	doctorAction := walk.NewAction()
+	doctorAction.SetText("Check Connection...")
+	doctorAction.Triggered().Attach(runDoctor)
+	moreMenu.Actions().Add(doctorAction)
+
 	moreAction = walk.NewMenuAction(moreMenu)
 	moreAction.SetText("More")
 	actions.Add(moreAction)
@@ -589,6 +632,9 @@ func updateMenu() {
 		// Show full auth section if: authenticated and not logged out
 		showAuthSection := isAuthenticated && !isLoggedOutLocal && !isInitializing
 
+		if offlineAction != nil {
+			offlineAction.SetVisible(showAuthSection && authManager.IsOffline())
+		}
 		if statusAction != nil {
 			statusAction.SetVisible(showAuthSection)
 		}
@@ -598,6 +644,9 @@ func updateMenu() {
 		if orgsMenuAction != nil {
 			orgsMenuAction.SetVisible(showAuthSection)
 		}
+		if resourcesMenuAction != nil {
+			resourcesMenuAction.SetVisible(showAuthSection)
+		}
 
 		// Update tunnel state and organizations only when fully authenticated
 		if showAuthSection {
@@ -667,8 +716,9 @@ func updateAccountMenu() {
 		return
 	}
 
-	accounts := accountManager.Accounts
+	accounts := accountManager.List()
 	currentAccount, _ := accountManager.ActiveAccount()
+	labels := config.DisplayLabels(accounts)
 
 	var state tunnel.State
 	if tunnelManager != nil {
@@ -713,7 +763,7 @@ func updateAccountMenu() {
 	}
 
 	for accountID, action := range accountActions {
-		if _, ok := accountManager.Accounts[accountID]; !ok {
+		if _, ok := labels[accountID]; !ok {
 			actions.Remove(action)
 			delete(accountActions, accountID)
 		}
@@ -740,34 +790,31 @@ func updateAccountMenu() {
 		}
 	}
 
-	// Figure out whether to display the hostname
-	// for a particular account email by if there
-	// are more than 1 accounts with the same email.
-	emailCounts := map[string]int{}
-	for _, account := range accounts {
-		emailCounts[account.Email]++
-	}
-
-	// Update or add orgs
-	for _, account := range accounts {
+	// Update or add accounts. New ones are inserted at the top, so going
+	// backwards keeps them sorted.
+	for i := len(accounts) - 1; i >= 0; i-- {
+		account := accounts[i]
 		action, exists := accountActions[account.UserID]
 		if !exists {
 			// Create new action
 			action = walk.NewAction()
-
-			var accountText string
-			if emailCounts[account.Email] > 1 {
-				accountText = fmt.Sprintf("%s (%s)", account.Email, account.Hostname)
-			} else {
-				accountText = account.Email
-			}
-
-			action.SetText(accountText)
 			action.SetCheckable(true)
 
+			accountID := account.UserID
 			action.Triggered().Attach(func() {
 				go func() {
-					account := account
+					account, ok := accountManager.Account(accountID)
+					if !ok {
+						updateMenu()
+						return
+					}
+
+					// An expired account is signed in to again, without
+					// touching the tunnel of the current one
+					if authManager.NeedsReauthentication(accountID) {
+						reauthenticateAccount(account)
+						return
+					}
 
 					// Shut down tunnel here. Switching users requires the tunnel must go
 					// down.
@@ -790,7 +837,12 @@ func updateAccountMenu() {
 
 					// After shutting down the tunnel, switch accounts in the auth manager.
 					if err := authManager.SwitchAccount(account.UserID); err != nil {
-						logger.Error("Failed to select organization: %v", err)
+						var authErr *auth.AuthError
+						if errors.As(err, &authErr) && authErr.Type == auth.AuthErrorSessionExpired {
+							reauthenticateAccount(account)
+							return
+						}
+						logger.Error("Failed to switch account: %v", err)
 						// Show error dialog to user
 						walk.App().Synchronize(func() {
 							td := walk.NewTaskDialog()
@@ -813,17 +865,14 @@ func updateAccountMenu() {
 
 			// Insert after separator (index 2: count label at 0, separator at 1)
 			actions.Insert(2, action)
-		} else {
-			// Update existing action
-			var accountText string
-			if emailCounts[account.Email] > 1 {
-				accountText = fmt.Sprintf("%s (%s)", account.Email, account.Hostname)
-			} else {
-				accountText = account.Email
-			}
-			action.SetText(accountText)
 		}
 
+		accountText := labels[account.UserID]
+		if authManager != nil && authManager.NeedsReauthentication(account.UserID) {
+			accountText += " - Sign In Again"
+		}
+		action.SetText(accountText)
+
 		// Update checked state
 		action.SetChecked(currentAccount != nil && account.UserID == currentAccount.UserID)
 		action.SetEnabled(!shouldDisable)
@@ -837,7 +886,7 @@ func updateAccountMenu() {
 			go func() {
 				walk.App().Synchronize(func() {
 					// Show login dialog
-					ShowLoginDialog(mainWindow, authManager, configManager, accountManager, apiClient, tunnelManager)
+					ShowLoginDialog(mainWindow, authManager, configManager, accountManager, apiClient, tunnelManager, nil)
 					// Small delay to allow state to update
 					time.Sleep(100 * time.Millisecond)
 					updateMenu()
@@ -848,6 +897,27 @@ func updateAccountMenu() {
 	}
 	addAccountAction.SetVisible(true)
 
+	if renameAction == nil {
+		renameAction = walk.NewAction()
+		renameAction.SetText("Rename Account...")
+		renameAction.Triggered().Attach(func() {
+			current, err := accountManager.ActiveAccount()
+			if err != nil {
+				return
+			}
+			label, ok := showRenameAccountDialog(mainWindow, *current)
+			if !ok {
+				return
+			}
+			if err := authManager.RenameAccount(current.UserID, label); err != nil {
+				logger.Error("Failed to rename account: %v", err)
+			}
+			updateMenu()
+		})
+		actions.Add(renameAction)
+	}
+	renameAction.SetVisible(currentAccount != nil)
+
 	// Create logout action
 	if logoutAction == nil {
 		logoutAction = walk.NewAction()
@@ -886,11 +956,7 @@ func updateAccountMenu() {
 	// Update accounts menu action text
 	accountMenuActionText := "Select Account"
 	if currentAccount != nil {
-		if emailCounts[currentAccount.Email] > 1 {
-			accountMenuActionText = fmt.Sprintf("%s (%s)", currentAccount.Email, currentAccount.Hostname)
-		} else {
-			accountMenuActionText = currentAccount.Email
-		}
+		accountMenuActionText = labels[currentAccount.UserID]
 	}
 	accountMenuAction.SetText(accountMenuActionText)
 	accountMenuAction.SetVisible(len(accounts) > 0)
@@ -1004,39 +1070,27 @@ func updateOrganizations() {
 				org := org
 
 				go func() {
-					if err := authManager.SelectOrganization(&org); err != nil {
-						logger.Error("Failed to select organization: %v", err)
+					if err := tunnelManager.SwitchOrganization(&org); err != nil {
+						logger.Error("Failed to switch organization: %v", err)
 						// Show error dialog to user
 						walk.App().Synchronize(func() {
+							title := "Organization Selection Failed"
+							message := fmt.Sprintf("Failed to select organization: %v", err)
+							if connErr, ok := err.(*tunnel.ConnectionError); ok {
+								title = connErr.Title
+								message = connErr.Message
+							}
 							td := walk.NewTaskDialog()
 							_, _ = td.Show(walk.TaskDialogOpts{
 								Owner:         mainWindow,
-								Title:         "Organization Selection Failed",
-								Content:       fmt.Sprintf("Failed to select organization: %v", err),
+								Title:         title,
+								Content:       message,
 								IconSystem:    walk.TaskDialogSystemIconError,
 								CommonButtons: win.TDCBF_OK_BUTTON,
 							})
 						})
-					} else {
-						updateMenu()
-
-						if tunnelManager.IsConnected() {
-							if err := tunnelManager.SwitchOLMOrg(org.Id); err != nil {
-								logger.Error("Failed to switch tunnel organization: %v", err)
-								// Show error dialog to user
-								walk.App().Synchronize(func() {
-									td := walk.NewTaskDialog()
-									_, _ = td.Show(walk.TaskDialogOpts{
-										Owner:         mainWindow,
-										Title:         "Tunnel Organization Switch Failed",
-										Content:       fmt.Sprintf("Failed to switch tunnel organization: %v", err),
-										IconSystem:    walk.TaskDialogSystemIconError,
-										CommonButtons: win.TDCBF_OK_BUTTON,
-									})
-								})
-							}
-						}
 					}
+					updateMenu()
 				}()
 			})
 			orgActions[org.Id] = action
@@ -1081,7 +1135,34 @@ func updateLoginAction() {
 		loginAction.SetText("Login to Account")
 	}
 
-	loginAction.SetVisible(len(accountManager.Accounts) == 0)
+	loginAction.SetVisible(len(accountManager.List()) == 0)
+}
+
+// reauthenticateAccount offers to sign in again to an account whose session
+// expired. Signing in replaces the account's session in place and makes it
+// the active account.
+func reauthenticateAccount(account config.Account) {
+	walk.App().Synchronize(func() {
+		td := walk.NewTaskDialog()
+		result, err := td.Show(walk.TaskDialogOpts{
+			Owner:         mainWindow,
+			Title:         "Sign In Again",
+			Instruction:   "The session of this account has expired",
+			Content:       fmt.Sprintf("Sign in to %s on %s again to use it.", account.DisplayName(), account.Hostname),
+			IconSystem:    walk.TaskDialogSystemIconInformation,
+			CommonButtons: win.TDCBF_OK_BUTTON | win.TDCBF_CANCEL_BUTTON,
+		})
+		if err != nil || result.Canceled {
+			return
+		}
+
+		// The tunnel of the current account goes down with it
+		if err := managers.IPCClientStopTunnel(); err != nil {
+			logger.Error("Failed to stop tunnel before signing in again: %v", err)
+		}
+		ShowLoginDialog(mainWindow, authManager, configManager, accountManager, apiClient, tunnelManager, &account)
+		updateMenu()
+	})
 }
 
 func SetupTray(
@@ -1098,11 +1179,15 @@ func SetupTray(
 	configManager = cm
 	apiClient = ac
 	accountManager = accm
+	secretManager = sm
 
 	// Initialize tunnel manager with IPC adapter
 	ipcAdapter := managers.NewIPCAdapter()
 	tunnelManager = tunnel.NewManager(am, cm, accm, sm, ipcAdapter)
 
+	// Notifications are shown through the tray icon once it exists
+	setupNotifications()
+
 	// Create NotifyIcon
 	ni, err := walk.NewNotifyIcon()
 	if err != nil {
@@ -1165,9 +1250,11 @@ func SetupTray(
 
 	ni.SetVisible(true)
 
-	// Register for update notifications from manager (if connected via IPC)
-	// These callbacks will be called when the manager finds updates or makes progress
-	updateFoundCb = managers.IPCClientRegisterUpdateFound(func(updateState managers.UpdateState) {
+	// Subscribe to update notifications from manager (if connected via IPC)
+	// These are published when the manager finds updates or makes progress
+	updateFoundSub = managers.UpdateFoundEvents.Subscribe(func(updateState managers.UpdateState) {
+		showRollbackNotification(updateState)
+		notifyUpdateState(updateState)
 		if updateState == managers.UpdateStateFoundUpdate {
 			updateMutex.Lock()
 			hasUpdate = true
@@ -1181,15 +1268,15 @@ func SetupTray(
 		}
 	})
 
-	// Register for manager stopping notification
-	managerStoppingCb = managers.IPCClientRegisterManagerStopping(func() {
+	// Subscribe to manager stopping notification
+	managerStoppingSub = managers.ManagerStoppingEvents.Subscribe(func(struct{}) {
 		logger.Info("Manager service is stopping, exiting UI")
 		walk.App().Synchronize(func() {
 			walk.App().Exit(0)
 		})
 	})
 
-	updateProgressCb = managers.IPCClientRegisterUpdateProgress(func(dp updater.DownloadProgress) {
+	updateProgressSub = managers.UpdateProgressEvents.Subscribe(func(dp updater.DownloadProgress) {
 		if dp.Error != nil {
 			logger.Error("Update error: %v", dp.Error)
 			walk.App().Synchronize(func() {
@@ -1241,6 +1328,9 @@ func SetupTray(
 	go func() {
 		// Check immediately first (in case update was already found)
 		updateState, err := managers.IPCClientUpdateState()
+		if err == nil {
+			showRollbackNotification(updateState)
+		}
 		if err == nil && updateState == managers.UpdateStateFoundUpdate {
 			updateMutex.Lock()
 			hasUpdate = true
@@ -1278,13 +1368,19 @@ func SetupTray(
 		}
 	}()
 
-	// Register for tunnel state change notifications via tunnel manager
-	tunnelManager.RegisterStateChangeCallback(func(state tunnel.State) {
+	// Subscribe to tunnel state change notifications via tunnel manager
+	tunnelManager.StateEvents().Subscribe(func(state tunnel.State) {
 		logger.Info("Tunnel state changed: %s", state.String())
 		tunnelStateMutex.Lock()
 		currentTunnelState = managers.TunnelState(state)
 		tunnelStateMutex.Unlock()
 
+		notifyTunnelState(state)
+		if state == tunnel.StateRunning {
+			// Access to resources may depend on being connected
+			go refreshResources()
+		}
+
 		walk.App().Synchronize(func() {
 			// Update connection state
 			switch state {
@@ -1309,80 +1405,67 @@ func SetupTray(
 		})
 	})
 
-	// Monitor auth state changes to rebuild menu
-	go func() {
-		// Initial state
-		lastAuthState := authManager != nil && authManager.IsAuthenticated()
-		lastInitializing := authManager != nil && authManager.IsInitializing()
-
-		for {
-			time.Sleep(500 * time.Millisecond)
-			if authManager == nil {
-				continue
-			}
-
-			currentAuthState := authManager.IsAuthenticated()
-			currentInitializing := authManager.IsInitializing()
+	watchResources()
 
-			if currentAuthState != lastAuthState || currentInitializing != lastInitializing {
-				lastAuthState = currentAuthState
-				lastInitializing = currentInitializing
-				updateMenu()
+	// Rebuild the menu when the auth state changes
+	if authManager != nil {
+		authManager.StateEvents().Subscribe(func(state auth.State) {
+			updateMenu()
+			if state.UpdateRequired {
+				go promptRequiredUpdate(state.RequiredVersion)
 			}
-		}
-	}()
-
-	// Background refresh loop - DISABLED for now
-	/*
-		go func() {
-			// Initial delay before first refresh (with jitter)
-			initialJitter := time.Duration(rand.Intn(7000)) * time.Millisecond
-			time.Sleep(initialJitter)
-
-			for {
-				if authManager == nil {
-					time.Sleep(180 * time.Second)
-					continue
-				}
-
-				// Only refresh if authenticated
-				if authManager.IsAuthenticated() {
-					// Get OLM ID
-					olmId, found := authManager.GetOlmId()
-					if found && olmId != "" {
-						// Refresh from MyDevice
-						err := authManager.RefreshFromMyDevice(olmId)
-						if err != nil {
-							logger.Error("Failed to refresh from MyDevice: %v", err)
-						} else {
-							// Update menu to reflect updated orgs
-							updateMenu()
-						}
-					}
-				}
-
-				// Check if unauthenticated after refresh (refresh might result in logout)
-				if !authManager.IsAuthenticated() {
-					// If unauthenticated, stop tunnel
-					if tunnelManager != nil && tunnelManager.IsConnected() {
-						logger.Info("User is unauthenticated, stopping tunnel")
-						if err := tunnelManager.Disconnect(); err != nil {
-							logger.Error("Failed to stop tunnel after authentication loss: %v", err)
-						}
-					}
-				}
+		}, events.WithoutReplay())
+	}
 
-				baseInterval := 180 * time.Second
-				jitterRange := 15 * time.Second
-				jitter := time.Duration(rand.Intn(int(2*jitterRange))) - jitterRange
-				time.Sleep(baseInterval + jitter)
-			}
-		}()
-	*/
+	// Refresh the organizations and device info in the background, and
+	// right away when the network changes or the machine resumes
+	if authManager != nil {
+		refreshScheduler = auth.NewRefreshScheduler(authManager, nil, 0, 0)
+		refreshScheduler.Start()
+		managers.SystemEvents.Subscribe(func(event managers.SystemEvent) {
+			refreshScheduler.Trigger(event.String())
+		})
+		authManager.OrgEvents().Subscribe(func(auth.OrgChange) {
+			updateMenu()
+		})
+	}
 
 	return nil
 }
 
+// showRollbackNotification tells the user that the last update failed its
+// post-install health check.
+func showRollbackNotification(updateState managers.UpdateState) {
+	var title, message string
+	switch updateState {
+	case managers.UpdateStateRolledBack:
+		title = "Update Rolled Back"
+		message = fmt.Sprintf("The last update failed to start correctly, so Pangolin %s was restored.", version.Number)
+	case managers.UpdateStateRollbackFailed:
+		title = "Update Problem"
+		message = "The last update failed to start correctly and could not be rolled back. Please reinstall Pangolin."
+	default:
+		return
+	}
+	updateMutex.Lock()
+	if rollbackNotified == updateState {
+		updateMutex.Unlock()
+		return
+	}
+	rollbackNotified = updateState
+	updateMutex.Unlock()
+	walk.App().Synchronize(func() {
+		if trayIcon == nil {
+			return
+		}
+		if updateState == managers.UpdateStateRollbackFailed {
+			trayIcon.ShowError(title, message)
+		} else {
+			trayIcon.ShowWarning(title, message)
+		}
+	})
+}
+
 // triggerUpdate asks the user for confirmation and then triggers the update via manager
 func triggerUpdate(mw *walk.MainWindow) {
 	userAcceptedChan := make(chan bool, 1)
@@ -1421,8 +1504,60 @@ func triggerUpdate(mw *walk.MainWindow) {
 		logger.Info("User declined update")
 		return
 	}
+	startUpdate(mw)
+}
+
+// promptRequiredUpdate asks the user to update after the server refused this
+// version of the client. It asks once per run.
+func promptRequiredUpdate(requiredVersion string) {
+	updateMutex.Lock()
+	if updateRequired {
+		updateMutex.Unlock()
+		return
+	}
+	updateRequired = true
+	available := hasUpdate
+	updateMutex.Unlock()
+
+	required := "a newer version of Pangolin"
+	if requiredVersion != "" {
+		required = fmt.Sprintf("Pangolin %s or later", requiredVersion)
+	}
+	content := fmt.Sprintf("The server requires %s. Pangolin %s cannot work with it until it is updated.", required, version.Number)
+	logger.Warn("The server requires %s", required)
+
+	acceptedChan := make(chan bool, 1)
+	walk.App().Synchronize(func() {
+		accepted := false
+		td := walk.NewTaskDialog()
+		opts := walk.TaskDialogOpts{
+			Owner:       mainWindow,
+			Title:       "Update Required",
+			Instruction: "Pangolin needs to be updated",
+			IconSystem:  walk.TaskDialogSystemIconWarning,
+		}
+		if available {
+			opts.Content = content + "\n\nWould you like to download and install the update now?"
+			opts.CommonButtons = win.TDCBF_YES_BUTTON | win.TDCBF_NO_BUTTON
+			opts.DefaultButton = walk.TaskDialogDefaultButtonYes
+			opts.CommonButtonClicked(win.TDCBF_YES_BUTTON).Attach(func() bool {
+				accepted = true
+				return false
+			})
+		} else {
+			opts.Content = content + "\n\nNo update is available yet. Contact your administrator, or install the latest version from pangolin.net."
+			opts.CommonButtons = win.TDCBF_OK_BUTTON
+		}
+		_, _ = td.Show(opts)
+		acceptedChan <- accepted
+	})
+	if <-acceptedChan {
+		startUpdate(mainWindow)
+	}
+}
 
-	// Trigger update via manager IPC
+// startUpdate triggers the update via the manager
+func startUpdate(mw *walk.MainWindow) {
 	logger.Info("Starting update download via manager...")
 	err := managers.IPCClientUpdate()
 	if err != nil {
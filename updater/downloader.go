@@ -3,62 +3,40 @@
 package updater
 
 import (
-	"crypto/hmac"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
-	"net/url"
-	"strconv"
-	"strings"
 	"sync/atomic"
 	"time"
 
-	"golang.org/x/crypto/blake2b"
 	"golang.org/x/sys/windows"
 
-	"github.com/fosrl/newt/logger"
 	"github.com/fosrl/windows/elevate"
-	"github.com/fosrl/windows/updater/winhttp"
 	"github.com/fosrl/windows/version"
 )
 
-type DownloadProgress struct {
-	Activity        string
-	BytesDownloaded uint64
-	BytesTotal      uint64
-	Error           error
-	Complete        bool
-}
-
-type progressHashWatcher struct {
-	dp        *DownloadProgress
-	c         chan DownloadProgress
-	hashState hash.Hash
-}
-
-func (pm *progressHashWatcher) Write(p []byte) (int, error) {
-	bytes := len(p)
-	pm.dp.BytesDownloaded += uint64(bytes)
-	pm.c <- *pm.dp
-	pm.hashState.Write(p)
-	return bytes, nil
-}
-
-type UpdateFound struct {
-	name             string
-	hash             [blake2b.Size256]byte
-	downloadLocation string // Can be empty (use default), a relative path, or a full URL
-}
-
-// Name returns the filename of the update MSI
-func (u *UpdateFound) Name() string {
-	return u.name
+func officialUpdateSource() updateSource {
+	scheme := "http"
+	if updateServerUseHttps {
+		scheme = "https"
+	}
+	return updateSource{
+		manifestURL:    fmt.Sprintf("%s://%s:%d%s", scheme, updateServerHost, updateServerPort, latestVersionPath),
+		publicKey:      releasePublicKeyBase64,
+		arch:           version.Arch(),
+		currentVersion: version.Number,
+	}
 }
 
 func CheckForUpdate() (updateFound *UpdateFound, err error) {
 	logger.Info("Updater: CheckForUpdate() called")
-	updateFound, _, _, err = checkForUpdate(false)
+	fetcher, err := NewFetcher(currentFetcherConfig())
+	if err != nil {
+		logger.Error("Updater: Failed to create fetcher: %v", err)
+		return nil, err
+	}
+	defer fetcher.Close()
+	updateFound, err = checkForUpdate(fetcher)
 	if err != nil {
 		logger.Error("Updater: CheckForUpdate failed: %v", err)
 	} else if updateFound == nil {
@@ -69,8 +47,8 @@ func CheckForUpdate() (updateFound *UpdateFound, err error) {
 	return
 }
 
-func checkForUpdate(keepSession bool) (*UpdateFound, *winhttp.Session, *winhttp.Connection, error) {
-	logger.Info("Updater: checkForUpdate() started (keepSession=%v)", keepSession)
+func checkForUpdate(fetcher Fetcher) (*UpdateFound, error) {
+	logger.Info("Updater: checkForUpdate() started")
 	logger.Info("Updater: Current version: %s, Architecture: %s", version.Number, version.Arch())
 
 	// // Allow bypassing official version check for development/testing
@@ -83,86 +61,30 @@ func checkForUpdate(keepSession bool) (*UpdateFound, *winhttp.Session, *winhttp.
 	// 	if !devMode {
 	// 		err := errors.New("Build is not official, so updates are disabled")
 	// 		logger.Error("Updater: %v", err)
-	// 		return nil, nil, nil, err
+	// 		return nil, err
 	// 	}
 	// 	logger.Info("Updater: Development mode enabled - allowing updates on unsigned build")
 	// }
 
-	logger.Info("Updater: Creating WinHTTP session with User-Agent: %s", version.UserAgent())
-	session, err := winhttp.NewSession(version.UserAgent())
-	if err != nil {
-		logger.Error("Updater: Failed to create WinHTTP session: %v", err)
-		return nil, nil, nil, err
-	}
-	logger.Info("Updater: WinHTTP session created successfully")
-	defer func() {
-		if err != nil || !keepSession {
-			logger.Info("Updater: Closing WinHTTP session")
-			session.Close()
-		}
-	}()
-
-	logger.Info("Updater: Connecting to update server: %s:%d (HTTPS=%v)", updateServerHost, updateServerPort, updateServerUseHttps)
-	connection, err := session.Connect(updateServerHost, updateServerPort, updateServerUseHttps)
-	if err != nil {
-		logger.Error("Updater: Failed to connect to update server: %v", err)
-		return nil, nil, nil, err
-	}
-	logger.Info("Updater: Connected to update server successfully")
-	defer func() {
-		if err != nil || !keepSession {
-			logger.Info("Updater: Closing connection")
-			connection.Close()
-		}
-	}()
-
-	logger.Info("Updater: Fetching manifest from: %s", latestVersionPath)
-	response, err := connection.Get(latestVersionPath, true)
-	if err != nil {
-		logger.Error("Updater: Failed to fetch manifest: %v", err)
-		return nil, nil, nil, err
-	}
-	defer response.Close()
-	logger.Info("Updater: Manifest response received")
-
-	var fileList [1024 * 512] /* 512 KiB */ byte
-	bytesRead, err := response.Read(fileList[:])
-	if err != nil && (err != io.EOF || bytesRead == 0) {
-		logger.Error("Updater: Failed to read manifest data: %v (bytesRead=%d)", err, bytesRead)
-		return nil, nil, nil, err
-	}
-	logger.Info("Updater: Read %d bytes from manifest", bytesRead)
-
-	logger.Info("Updater: Parsing manifest file list")
-	files, err := readFileList(fileList[:bytesRead])
+	updateFound, err := checkForUpdateFrom(fetcher, officialUpdateSource())
 	if err != nil {
-		logger.Error("Updater: Failed to parse manifest: %v", err)
-		return nil, nil, nil, err
-	}
-	logger.Info("Updater: Manifest parsed successfully, found %d files", len(files))
-
-	logger.Info("Updater: Searching for update candidate")
-	updateFound, err := findCandidate(files)
-	if err != nil {
-		logger.Error("Updater: Error finding candidate: %v", err)
-		return nil, nil, nil, err
+		return nil, err
 	}
 	if updateFound == nil {
 		logger.Info("Updater: No update candidate found")
 	} else {
 		logger.Info("Updater: Update candidate found: %s", updateFound.name)
 	}
-
-	if keepSession {
-		logger.Info("Updater: Keeping session and connection open")
-		return updateFound, session, connection, nil
-	}
-	return updateFound, nil, nil, nil
+	return updateFound, nil
 }
 
 var updateInProgress = uint32(0)
 
-func DownloadVerifyAndExecute(userToken uintptr) (progress chan DownloadProgress) {
+// DownloadVerifyAndExecute downloads, verifies and installs the available
+// update. Before msiexec runs, a rollback record is written so the next
+// manager start can verify the update and reinstall the current version if
+// it is broken.
+func DownloadVerifyAndExecute(userToken uintptr, opts UpdateOptions) (progress chan DownloadProgress) {
 	progress = make(chan DownloadProgress, 128)
 	progress <- DownloadProgress{Activity: "Initializing"}
 
@@ -177,14 +99,19 @@ func DownloadVerifyAndExecute(userToken uintptr) (progress chan DownloadProgress
 
 		progress <- DownloadProgress{Activity: "Checking for update"}
 		logger.Info("Updater: Checking for update...")
-		update, session, connection, err := checkForUpdate(true)
+		fetcher, err := NewFetcher(currentFetcherConfig())
+		if err != nil {
+			logger.Error("Updater: Failed to create fetcher: %v", err)
+			progress <- DownloadProgress{Error: err}
+			return
+		}
+		defer fetcher.Close()
+		update, err := checkForUpdate(fetcher)
 		if err != nil {
 			logger.Error("Updater: Update check failed: %v", err)
 			progress <- DownloadProgress{Error: err}
 			return
 		}
-		defer connection.Close()
-		defer session.Close()
 		if update == nil {
 			logger.Error("Updater: No update was found")
 			progress <- DownloadProgress{Error: errors.New("No update was found")}
@@ -209,155 +136,48 @@ func DownloadVerifyAndExecute(userToken uintptr) (progress chan DownloadProgress
 			}
 		}()
 
-		dp := DownloadProgress{Activity: "Downloading update"}
-		progress <- dp
-
-		var response *winhttp.Response
-		var downloadConnection *winhttp.Connection
-		var downloadSession *winhttp.Session
+		src := officialUpdateSource()
+		previousMSI, previousMSIHash := retainPreviousPackage(fetcher, src, update, progress)
 
-		// Get download location from manifest (required)
-		downloadLocation := update.downloadLocation
-		if downloadLocation == "" {
-			logger.Error("Updater: Download location not specified in manifest for file: %s", update.name)
-			progress <- DownloadProgress{Error: errors.New("download location not specified in manifest")}
-			return
-		}
-
-		// Check if downloadLocation is a full URL (http:// or https://)
-		if strings.HasPrefix(downloadLocation, "http://") || strings.HasPrefix(downloadLocation, "https://") {
-			// Full URL - download from external source
-			logger.Info("Updater: Downloading MSI from external URL: %s", downloadLocation)
-
-			// Parse the URL to extract host, port, and path
-			parsedURL, err := url.Parse(downloadLocation)
-			if err != nil {
-				logger.Error("Updater: Failed to parse download URL: %v", err)
-				progress <- DownloadProgress{Error: fmt.Errorf("invalid download URL: %w", err)}
-				return
-			}
-
-			// Determine if HTTPS
-			isHTTPS := parsedURL.Scheme == "https"
-			if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-				logger.Error("Updater: Unsupported URL scheme: %s", parsedURL.Scheme)
-				progress <- DownloadProgress{Error: fmt.Errorf("unsupported URL scheme: %s", parsedURL.Scheme)}
-				return
-			}
-
-			// Extract host and port
-			host := parsedURL.Hostname()
-			if host == "" {
-				logger.Error("Updater: Missing host in download URL")
-				progress <- DownloadProgress{Error: errors.New("missing host in download URL")}
-				return
-			}
-
-			portStr := parsedURL.Port()
-			var port uint16
-			if portStr == "" {
-				// Use default port based on scheme
-				if isHTTPS {
-					port = 443
-				} else {
-					port = 80
-				}
-			} else {
-				portNum, err := strconv.ParseUint(portStr, 10, 16)
-				if err != nil {
-					logger.Error("Updater: Invalid port in download URL: %v", err)
-					progress <- DownloadProgress{Error: fmt.Errorf("invalid port in download URL: %w", err)}
-					return
-				}
-				port = uint16(portNum)
-			}
-
-			// Build the path (include query and fragment if present)
-			downloadPath := parsedURL.Path
-			if parsedURL.RawQuery != "" {
-				downloadPath += "?" + parsedURL.RawQuery
-			}
-			if parsedURL.Fragment != "" {
-				downloadPath += "#" + parsedURL.Fragment
-			}
-			if downloadPath == "" {
-				downloadPath = "/"
-			}
-
-			logger.Info("Updater: Connecting to external download server: %s:%d (HTTPS=%v)", host, port, isHTTPS)
-
-			// Create a new session for the external download
-			downloadSession, err = winhttp.NewSession(version.UserAgent())
-			if err != nil {
-				logger.Error("Updater: Failed to create WinHTTP session for external download: %v", err)
-				progress <- DownloadProgress{Error: err}
-				return
-			}
-			defer downloadSession.Close()
-
-			// Connect to the external host
-			downloadConnection, err = downloadSession.Connect(host, port, isHTTPS)
-			if err != nil {
-				logger.Error("Updater: Failed to connect to external download server: %v", err)
-				progress <- DownloadProgress{Error: err}
-				return
-			}
-			defer downloadConnection.Close()
-
-			logger.Info("Updater: Downloading MSI from path: %s", downloadPath)
-			response, err = downloadConnection.Get(downloadPath, false)
-			if err != nil {
-				logger.Error("Updater: Failed to download MSI from external URL: %v", err)
-				progress <- DownloadProgress{Error: err}
-				return
-			}
-		} else {
-			// Relative path - download from update server
-			logger.Info("Updater: Downloading MSI from update server: %s", downloadLocation)
-			response, err = connection.Get(downloadLocation, false)
-			if err != nil {
-				logger.Error("Updater: Failed to download MSI: %v", err)
-				progress <- DownloadProgress{Error: err}
-				return
-			}
-		}
-		defer response.Close()
-		logger.Info("Updater: MSI download response received")
-
-		length, err := response.Length()
-		if err == nil {
-			logger.Info("Updater: MSI file size: %d bytes", length)
-			dp.BytesTotal = length
-			progress <- dp
+		// Keep a copy of the new package so it can serve as the rollback
+		// source for the next update.
+		var dst io.Writer = file
+		retained, err := createRetainedPackage(update.name)
+		if err != nil {
+			logger.Warn("Updater: Unable to retain update package: %v", err)
 		} else {
-			logger.Warn("Updater: Could not determine MSI file size: %v", err)
+			dst = io.MultiWriter(file, retained)
 		}
-
-		logger.Info("Updater: Initializing BLAKE2b-256 hasher for verification")
-		hasher, err := blake2b.New256(nil)
+		err = downloadAndVerify(fetcher, src, update, dst, progress)
 		if err != nil {
-			logger.Error("Updater: Failed to create hasher: %v", err)
+			if retained != nil {
+				retained.discard()
+			}
 			progress <- DownloadProgress{Error: err}
 			return
 		}
-		pm := &progressHashWatcher{&dp, progress, hasher}
-		logger.Info("Updater: Starting download (max 100 MiB)")
-		bytesWritten, err := io.Copy(file, io.TeeReader(io.LimitReader(response, 1024*1024*100 /* 100 MiB */), pm))
-		if err != nil {
-			logger.Error("Updater: Download failed: %v (bytes written: %d)", err, bytesWritten)
-			progress <- DownloadProgress{Error: err}
-			return
+		keep := []string{previousMSI}
+		if retained != nil {
+			if err := retained.commit(); err != nil {
+				logger.Warn("Updater: Unable to retain update package: %v", err)
+			} else {
+				keep = append(keep, retained.path)
+			}
 		}
-		logger.Info("Updater: Download completed: %d bytes written", bytesWritten)
-
-		calculatedHash := hasher.Sum(nil)
-		logger.Info("Updater: Verifying hash - calculated: %x, expected: %x", calculatedHash, update.hash)
-		if !hmac.Equal(calculatedHash, update.hash[:]) {
-			logger.Error("Updater: Hash verification failed!")
-			progress <- DownloadProgress{Error: errors.New("The downloaded update has the wrong hash")}
-			return
+		pruneRetainedPackages(keep...)
+
+		record := &RollbackRecord{
+			Phase:           RollbackPhasePending,
+			PreviousVersion: version.Number,
+			PreviousMSI:     previousMSI,
+			PreviousMSIHash: previousMSIHash,
+			TargetVersion:   update.version,
+			TunnelName:      opts.TunnelName,
+			RecordedAt:      time.Now(),
+		}
+		if err := SaveRollbackRecord(record); err != nil {
+			logger.Warn("Updater: Failed to write rollback record: %v", err)
 		}
-		logger.Info("Updater: Hash verification passed")
 
 		// // Skip authenticode verification in development mode
 		// devMode := os.Getenv("PANGOLIN_ALLOW_DEV_UPDATES") == "1"
@@ -379,6 +199,7 @@ func DownloadVerifyAndExecute(userToken uintptr) (progress chan DownloadProgress
 		err = runMsi(file, userToken)
 		if err != nil {
 			logger.Error("Updater: MSI installation failed: %v", err)
+			ClearRollbackRecord()
 			progress <- DownloadProgress{Error: err}
 			return
 		}
@@ -0,0 +1,122 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fosrl/windows/proxy"
+)
+
+// Fetcher performs the HTTP GET requests needed by the update pipeline.
+// The production implementation is backed by WinHTTP; HTTPFetcher uses
+// net/http and works on any platform.
+type Fetcher interface {
+	// Get requests the absolute URL. When refresh is set, intermediate caches
+	// are bypassed. Non-2xx responses are returned as a *StatusError.
+	Get(url string, refresh bool) (FetchResponse, error)
+	// Close releases any sessions or connections held by the fetcher.
+	Close() error
+}
+
+// FetchResponse is the body of a successful Fetcher request.
+type FetchResponse interface {
+	io.ReadCloser
+	// Length returns the Content-Length of the response, if known.
+	Length() (uint64, error)
+}
+
+// ProxyMode selects how a fetcher reaches the update server.
+type ProxyMode int
+
+const (
+	// ProxyModeSystem uses the proxy configured for the machine.
+	ProxyModeSystem ProxyMode = iota
+	// ProxyModeNone connects directly.
+	ProxyModeNone
+	// ProxyModeExplicit uses ProxyConfig.URL.
+	ProxyModeExplicit
+	// ProxyModePAC evaluates the script at ProxyConfig.PACURL per request.
+	ProxyModePAC
+)
+
+func (m ProxyMode) String() string {
+	switch m {
+	case ProxyModeSystem:
+		return "system"
+	case ProxyModeNone:
+		return "none"
+	case ProxyModeExplicit:
+		return "explicit"
+	case ProxyModePAC:
+		return "pac"
+	default:
+		return fmt.Sprintf("ProxyMode(%d)", int(m))
+	}
+}
+
+// ProxyConfig is the corporate proxy configuration for a fetcher.
+type ProxyConfig struct {
+	Mode ProxyMode
+	// URL is the explicit proxy, e.g. "http://proxy.corp:8080".
+	URL string
+	// Bypass lists hosts that skip the explicit proxy. Entries may be exact
+	// host names, domain suffixes (".corp" or "*.corp"), or "<local>" for
+	// host names without a dot.
+	Bypass []string
+	// PACURL is the location of the proxy auto-config script.
+	PACURL string
+}
+
+// ProxyConfigFrom returns the fetcher proxy configuration for the proxy
+// configuration of the app.
+func ProxyConfigFrom(cfg proxy.Config) (ProxyConfig, error) {
+	switch cfg.EffectiveMode() {
+	case proxy.ModeSystem:
+		return ProxyConfig{Mode: ProxyModeSystem}, nil
+	case proxy.ModeNone:
+		return ProxyConfig{Mode: ProxyModeNone}, nil
+	}
+	proxyURL, err := cfg.URL()
+	if err != nil {
+		return ProxyConfig{}, err
+	}
+	return ProxyConfig{
+		Mode:   ProxyModeExplicit,
+		URL:    proxyURL.String(),
+		Bypass: append([]string(nil), cfg.Bypass...),
+	}, nil
+}
+
+// needsNetHTTP reports whether the proxy is one WinHTTP cannot use: a SOCKS5
+// or HTTPS proxy, or one that needs credentials.
+func (cfg ProxyConfig) needsNetHTTP() bool {
+	if cfg.Mode != ProxyModeExplicit {
+		return false
+	}
+	proxyURL, err := parseProxyURL(cfg.URL)
+	return err == nil && (proxyURL.Scheme != "http" || proxyURL.User != nil)
+}
+
+// FetcherConfig configures a Fetcher.
+type FetcherConfig struct {
+	UserAgent string
+	Proxy     ProxyConfig
+	// CABundlePath is an optional PEM file with additional trusted roots,
+	// for networks that intercept TLS.
+	CABundlePath string
+	// Timeout bounds a whole request, including reading the body. Zero means
+	// no timeout.
+	Timeout time.Duration
+}
+
+// StatusError is returned by a Fetcher when the server answers with a
+// non-2xx status code.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: unexpected HTTP status %d", e.URL, e.StatusCode)
+}
@@ -0,0 +1,187 @@
+package updater
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/fosrl/windows/proxy"
+)
+
+// HTTPFetcher is a Fetcher backed by net/http.
+type HTTPFetcher struct {
+	client    *http.Client
+	userAgent string
+}
+
+// proxyResolver returns the proxy list selected by a PAC script for a URL,
+// in WinHTTP notation, or an empty string for a direct connection.
+type proxyResolver func(rawURL string) (string, error)
+
+// NewHTTPFetcher creates a net/http based fetcher. ProxyModePAC is only
+// available through NewFetcher, which can evaluate PAC scripts.
+func NewHTTPFetcher(cfg FetcherConfig) (*HTTPFetcher, error) {
+	return newHTTPFetcher(cfg, nil)
+}
+
+func newHTTPFetcher(cfg FetcherConfig, resolve proxyResolver) (*HTTPFetcher, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch cfg.Proxy.Mode {
+	case ProxyModeSystem:
+		transport.Proxy = proxy.FromSystem
+	case ProxyModeNone:
+		transport.Proxy = nil
+	case ProxyModeExplicit:
+		proxyURL, err := parseProxyURL(cfg.Proxy.URL)
+		if err != nil {
+			return nil, err
+		}
+		bypass := cfg.Proxy.Bypass
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if proxy.Bypassed(req.URL.Hostname(), bypass) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	case ProxyModePAC:
+		if resolve == nil {
+			return nil, errors.New("PAC proxy configuration is not supported by this fetcher")
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxy, err := resolve(req.URL.String())
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate PAC script: %w", err)
+			}
+			if proxy == "" {
+				return nil, nil
+			}
+			return parseProxyURL(firstProxy(proxy, req.URL.Scheme))
+		}
+	default:
+		return nil, fmt.Errorf("unknown proxy mode: %v", cfg.Proxy.Mode)
+	}
+
+	if cfg.CABundlePath != "" {
+		pool, err := loadCABundle(cfg.CABundlePath)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &HTTPFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		userAgent: cfg.UserAgent,
+	}, nil
+}
+
+// Get implements Fetcher.
+func (f *HTTPFetcher) Get(rawURL string, refresh bool) (FetchResponse, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	if refresh {
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("Pragma", "no-cache")
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &StatusError{URL: rawURL, StatusCode: resp.StatusCode}
+	}
+	return &httpFetchResponse{resp}, nil
+}
+
+// Close implements Fetcher.
+func (f *HTTPFetcher) Close() error {
+	f.client.CloseIdleConnections()
+	return nil
+}
+
+type httpFetchResponse struct {
+	resp *http.Response
+}
+
+func (r *httpFetchResponse) Read(p []byte) (int, error) {
+	return r.resp.Body.Read(p)
+}
+
+func (r *httpFetchResponse) Close() error {
+	return r.resp.Body.Close()
+}
+
+func (r *httpFetchResponse) Length() (uint64, error) {
+	if r.resp.ContentLength < 0 {
+		return 0, errors.New("response has no Content-Length")
+	}
+	return uint64(r.resp.ContentLength), nil
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, errors.New("proxy URL is empty")
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL: missing host in %q", proxy)
+	}
+	return proxyURL, nil
+}
+
+// firstProxy picks the proxy to use for scheme out of a WinHTTP style proxy
+// list such as "proxy1:8080;proxy2:8080" or "http=p:80;https=p:443".
+func firstProxy(list, scheme string) string {
+	var fallback string
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == ' ' }) {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			if strings.EqualFold(key, scheme) {
+				return value
+			}
+			continue
+		}
+		if fallback == "" {
+			fallback = entry
+		}
+	}
+	return fallback
+}
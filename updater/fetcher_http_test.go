@@ -0,0 +1,175 @@
+package updater
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fetch(t *testing.T, cfg FetcherConfig, rawURL string) (string, error) {
+	t.Helper()
+	fetcher, err := NewHTTPFetcher(cfg)
+	if err != nil {
+		t.Fatalf("NewHTTPFetcher: %v", err)
+	}
+	defer fetcher.Close()
+	resp, err := fetcher.Get(rawURL, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+	body, err := io.ReadAll(resp)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if length, err := resp.Length(); err != nil || length != uint64(len(body)) {
+		t.Errorf("Length() = %d, %v; want %d", length, err, len(body))
+	}
+	return string(body), nil
+}
+
+func TestHTTPFetcherGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, r.Header.Get("User-Agent")+" "+r.Header.Get("Cache-Control"))
+	}))
+	defer server.Close()
+
+	fetcher, err := NewHTTPFetcher(FetcherConfig{UserAgent: "pangolin-test", Proxy: ProxyConfig{Mode: ProxyModeNone}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fetcher.Close()
+
+	resp, err := fetcher.Get(server.URL+"/latest", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp)
+	resp.Close()
+	if string(body) != "pangolin-test no-cache" {
+		t.Errorf("body = %q, want the user agent and a refresh header", body)
+	}
+
+	_, err = fetcher.Get(server.URL+"/missing", false)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Get of a missing file = %v, want a 404 StatusError", err)
+	}
+}
+
+func TestHTTPFetcherCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "signed")
+	}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fetch(t, FetcherConfig{Proxy: ProxyConfig{Mode: ProxyModeNone}}, server.URL); err == nil {
+		t.Error("Get succeeded without the CA bundle")
+	}
+	body, err := fetch(t, FetcherConfig{Proxy: ProxyConfig{Mode: ProxyModeNone}, CABundlePath: bundle}, server.URL)
+	if err != nil || body != "signed" {
+		t.Errorf("Get with the CA bundle = %q, %v", body, err)
+	}
+
+	if _, err := NewHTTPFetcher(FetcherConfig{CABundlePath: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("NewHTTPFetcher accepted a missing CA bundle")
+	}
+}
+
+func TestHTTPFetcherExplicitProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer target.Close()
+
+	// The proxy stand-in answers for every host, which only a proxy is asked
+	// to do with an absolute request URL
+	var proxied []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		io.WriteString(w, "proxied")
+	}))
+	defer proxyServer.Close()
+
+	cfg := FetcherConfig{Proxy: ProxyConfig{
+		Mode:   ProxyModeExplicit,
+		URL:    strings.TrimPrefix(proxyServer.URL, "http://"),
+		Bypass: []string{"127.0.0.1"},
+	}}
+
+	body, err := fetch(t, cfg, "http://updates.example.com/latest")
+	if err != nil || body != "proxied" {
+		t.Errorf("Get through the proxy = %q, %v", body, err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://updates.example.com/latest" {
+		t.Errorf("the proxy saw %q", proxied)
+	}
+
+	body, err = fetch(t, cfg, target.URL)
+	if err != nil || body != "direct" {
+		t.Errorf("Get of a bypassed host = %q, %v", body, err)
+	}
+	if len(proxied) != 1 {
+		t.Errorf("a bypassed host went through the proxy: %q", proxied)
+	}
+}
+
+func TestHTTPFetcherPACNeedsResolver(t *testing.T) {
+	if _, err := NewHTTPFetcher(FetcherConfig{Proxy: ProxyConfig{Mode: ProxyModePAC, PACURL: "http://wpad/wpad.dat"}}); err == nil {
+		t.Error("NewHTTPFetcher accepted a PAC script it cannot evaluate")
+	}
+
+	var asked string
+	fetcher, err := newHTTPFetcher(FetcherConfig{Proxy: ProxyConfig{Mode: ProxyModePAC}}, func(rawURL string) (string, error) {
+		asked = rawURL
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fetcher.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	resp, err := fetcher.Get(server.URL+"/latest", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	if asked != server.URL+"/latest" {
+		t.Errorf("the PAC script was asked for %q", asked)
+	}
+}
+
+func TestFirstProxy(t *testing.T) {
+	tests := []struct {
+		list, scheme, want string
+	}{
+		{"proxy:8080", "https", "proxy:8080"},
+		{"proxy1:8080;proxy2:8080", "https", "proxy1:8080"},
+		{"http=p:80;https=p:443", "https", "p:443"},
+		{"http=p:80", "https", ""},
+		{"https=p:443 fallback:3128", "http", "fallback:3128"},
+	}
+	for _, tt := range tests {
+		if got := firstProxy(tt.list, tt.scheme); got != tt.want {
+			t.Errorf("firstProxy(%q, %q) = %q, want %q", tt.list, tt.scheme, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fosrl/windows/updater/winhttp"
+	"github.com/fosrl/windows/version"
+)
+
+var (
+	fetcherConfigMu sync.Mutex
+	fetcherConfig   FetcherConfig
+)
+
+// SetFetcherConfig replaces the configuration used for subsequent update
+// checks and downloads.
+func SetFetcherConfig(cfg FetcherConfig) {
+	fetcherConfigMu.Lock()
+	defer fetcherConfigMu.Unlock()
+	fetcherConfig = cfg
+}
+
+// UpdateFetcherConfig changes the configuration used for subsequent update
+// checks and downloads through update, keeping the fields it leaves alone.
+func UpdateFetcherConfig(update func(cfg *FetcherConfig)) {
+	fetcherConfigMu.Lock()
+	defer fetcherConfigMu.Unlock()
+	update(&fetcherConfig)
+}
+
+func currentFetcherConfig() FetcherConfig {
+	fetcherConfigMu.Lock()
+	defer fetcherConfigMu.Unlock()
+	cfg := fetcherConfig
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = version.UserAgent()
+	}
+	return cfg
+}
+
+// NewFetcher creates the production fetcher for cfg. WinHTTP is used unless
+// a custom CA bundle is configured, since WinHTTP only trusts the system
+// store, or the proxy is one WinHTTP cannot use; in that case net/http is
+// used, with PAC scripts still evaluated by WinHTTP.
+func NewFetcher(cfg FetcherConfig) (Fetcher, error) {
+	proxy, err := winhttpProxyConfig(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CABundlePath == "" && !cfg.Proxy.needsNetHTTP() {
+		logger.Info("Updater: Creating WinHTTP session with User-Agent: %s (proxy: %v)", cfg.UserAgent, cfg.Proxy.Mode)
+		session, err := winhttp.NewSessionWithProxy(cfg.UserAgent, proxy)
+		if err != nil {
+			return nil, err
+		}
+		return &winhttpFetcher{
+			session:     session,
+			connections: make(map[string]*winhttp.Connection),
+		}, nil
+	}
+
+	logger.Info("Updater: Custom CA bundle or proxy configured, using net/http transport (proxy: %v)", cfg.Proxy.Mode)
+	if cfg.Proxy.Mode != ProxyModePAC {
+		return newHTTPFetcher(cfg, nil)
+	}
+	session, err := winhttp.NewSessionWithProxy(cfg.UserAgent, proxy)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := newHTTPFetcher(cfg, session.ProxyForURL)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &pacHTTPFetcher{HTTPFetcher: fetcher, session: session}, nil
+}
+
+func winhttpProxyConfig(cfg ProxyConfig) (*winhttp.ProxyConfig, error) {
+	switch cfg.Mode {
+	case ProxyModeSystem:
+		return nil, nil
+	case ProxyModeNone:
+		return &winhttp.ProxyConfig{Direct: true}, nil
+	case ProxyModeExplicit:
+		proxyURL, err := parseProxyURL(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &winhttp.ProxyConfig{
+			Server: proxyURL.Host,
+			Bypass: strings.Join(cfg.Bypass, ";"),
+		}, nil
+	case ProxyModePAC:
+		if cfg.PACURL == "" {
+			return nil, fmt.Errorf("PAC proxy mode requires a PAC URL")
+		}
+		return &winhttp.ProxyConfig{AutoConfigURL: cfg.PACURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown proxy mode: %v", cfg.Mode)
+	}
+}
+
+type winhttpFetcher struct {
+	mu          sync.Mutex
+	session     *winhttp.Session
+	connections map[string]*winhttp.Connection
+}
+
+func (f *winhttpFetcher) connection(host string, port uint16, https bool) (*winhttp.Connection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fmt.Sprintf("%s:%d:%v", host, port, https)
+	if connection, ok := f.connections[key]; ok {
+		return connection, nil
+	}
+	logger.Info("Updater: Connecting to %s:%d (HTTPS=%v)", host, port, https)
+	connection, err := f.session.Connect(host, port, https)
+	if err != nil {
+		return nil, err
+	}
+	f.connections[key] = connection
+	return connection, nil
+}
+
+// Get implements Fetcher.
+func (f *winhttpFetcher) Get(rawURL string, refresh bool) (FetchResponse, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	var https bool
+	var port uint16
+	switch parsedURL.Scheme {
+	case "https":
+		https, port = true, 443
+	case "http":
+		port = 80
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme: %s", parsedURL.Scheme)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, fmt.Errorf("missing host in URL: %s", rawURL)
+	}
+	if portStr := parsedURL.Port(); portStr != "" {
+		portNum, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in URL: %w", err)
+		}
+		port = uint16(portNum)
+	}
+	path := parsedURL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if parsedURL.RawQuery != "" {
+		path += "?" + parsedURL.RawQuery
+	}
+
+	connection, err := f.connection(parsedURL.Hostname(), port, https)
+	if err != nil {
+		return nil, err
+	}
+	response, err := connection.Get(path, refresh)
+	if err != nil {
+		return nil, err
+	}
+	status, err := response.StatusCode()
+	if err != nil {
+		response.Close()
+		return nil, err
+	}
+	if status < 200 || status > 299 {
+		response.Close()
+		return nil, &StatusError{URL: rawURL, StatusCode: status}
+	}
+	return response, nil
+}
+
+// Close implements Fetcher.
+func (f *winhttpFetcher) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, connection := range f.connections {
+		connection.Close()
+		delete(f.connections, key)
+	}
+	return f.session.Close()
+}
+
+type pacHTTPFetcher struct {
+	*HTTPFetcher
+	session *winhttp.Session
+}
+
+// Close implements Fetcher.
+func (f *pacHTTPFetcher) Close() error {
+	f.HTTPFetcher.Close()
+	return f.session.Close()
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package updater
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateFetcherConfigKeepsOtherFields(t *testing.T) {
+	defer SetFetcherConfig(currentFetcherConfig())
+
+	SetFetcherConfig(FetcherConfig{UserAgent: "pangolin-test", Timeout: time.Minute, CABundlePath: `C:\ca.pem`})
+	UpdateFetcherConfig(func(cfg *FetcherConfig) {
+		cfg.Proxy = ProxyConfig{Mode: ProxyModePAC, PACURL: "http://wpad/wpad.dat"}
+	})
+
+	cfg := currentFetcherConfig()
+	if cfg.UserAgent != "pangolin-test" || cfg.Timeout != time.Minute || cfg.CABundlePath != `C:\ca.pem` {
+		t.Errorf("UpdateFetcherConfig lost fields it does not set: %+v", cfg)
+	}
+	if cfg.Proxy.Mode != ProxyModePAC || cfg.Proxy.PACURL != "http://wpad/wpad.dat" {
+		t.Errorf("proxy = %+v, want the PAC script", cfg.Proxy)
+	}
+}
@@ -0,0 +1,7 @@
+package updater
+
+import "github.com/fosrl/windows/logging"
+
+// logger is the updater component logger; it shadows the newt logger package so
+// that every message from this package is attributed to the component.
+var logger = logging.Component(logging.ComponentUpdater)
@@ -11,10 +11,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"unsafe"
 
-	"github.com/fosrl/newt/logger"
 	"golang.org/x/sys/windows"
 )
 
@@ -48,6 +48,12 @@ func (t *tempFile) Delete() error {
 
 func runMsi(msi *tempFile, userToken uintptr) error {
 	logger.Info("Updater: runMsi() called with userToken: %v", userToken)
+	return runMsiPath(msi.ExclusivePath(), userToken)
+}
+
+// runMsiPath installs the MSI at msiPath, passing properties such as
+// "NAME=value" to msiexec.
+func runMsiPath(msiPath string, userToken uintptr, properties ...string) error {
 
 	logger.Info("Updater: Getting system directory")
 	system32, err := windows.GetSystemDirectory()
@@ -65,7 +71,6 @@ func runMsi(msi *tempFile, userToken uintptr) error {
 	}
 	defer devNull.Close()
 
-	msiPath := msi.ExclusivePath()
 	logger.Info("Updater: MSI path: %s", msiPath)
 	logger.Info("Updater: MSI directory: %s", filepath.Dir(msiPath))
 	logger.Info("Updater: MSI filename: %s", filepath.Base(msiPath))
@@ -79,9 +84,10 @@ func runMsi(msi *tempFile, userToken uintptr) error {
 	}
 	msiexec := filepath.Join(system32, "msiexec.exe")
 	logger.Info("Updater: msiexec path: %s", msiexec)
-	logger.Info("Updater: Starting msiexec with args: /qb!- /i %s", filepath.Base(msiPath))
+	args := append([]string{"/qb!-", "/i", filepath.Base(msiPath)}, properties...)
+	logger.Info("Updater: Starting msiexec with args: %s", strings.Join(args, " "))
 
-	proc, err := os.StartProcess(msiexec, []string{msiexec, "/qb!-", "/i", filepath.Base(msiPath)}, attr)
+	proc, err := os.StartProcess(msiexec, append([]string{msiexec}, args...), attr)
 	if err != nil {
 		logger.Error("Updater: Failed to start msiexec process: %v", err)
 		return fmt.Errorf("failed to start msiexec: %w", err)
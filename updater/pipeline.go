@@ -0,0 +1,191 @@
+package updater
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// maxManifestSize bounds the signed file list.
+	maxManifestSize = 1024 * 512 // 512 KiB
+	// maxUpdateSize bounds the downloaded MSI.
+	maxUpdateSize = 1024 * 1024 * 100 // 100 MiB
+)
+
+type DownloadProgress struct {
+	Activity        string
+	BytesDownloaded uint64
+	BytesTotal      uint64
+	Error           error
+	Complete        bool
+}
+
+type progressHashWatcher struct {
+	dp        *DownloadProgress
+	c         chan DownloadProgress
+	hashState hash.Hash
+}
+
+func (pm *progressHashWatcher) Write(p []byte) (int, error) {
+	bytes := len(p)
+	pm.dp.BytesDownloaded += uint64(bytes)
+	pm.c <- *pm.dp
+	pm.hashState.Write(p)
+	return bytes, nil
+}
+
+type UpdateFound struct {
+	name             string
+	version          string
+	hash             [blake2b.Size256]byte
+	downloadLocation string       // Can be empty (use default), a relative path, or a full URL
+	previous         *UpdateFound // The MSI of the running version, if still listed in the manifest
+}
+
+// Name returns the filename of the update MSI
+func (u *UpdateFound) Name() string {
+	return u.name
+}
+
+// Version returns the version of the update
+func (u *UpdateFound) Version() string {
+	return u.version
+}
+
+// updateSource describes where the pipeline looks for updates and what it
+// compares them against.
+type updateSource struct {
+	manifestURL    string
+	publicKey      string
+	arch           string
+	currentVersion string
+}
+
+// checkForUpdateFrom downloads and verifies the signed manifest and returns
+// the update candidate for src, or nil if we are current.
+func checkForUpdateFrom(fetcher Fetcher, src updateSource) (*UpdateFound, error) {
+	logger.Info("Updater: Fetching manifest from: %s", src.manifestURL)
+	response, err := fetcher.Get(src.manifestURL, true)
+	if err != nil {
+		logger.Error("Updater: Failed to fetch manifest: %v", err)
+		return nil, err
+	}
+	defer response.Close()
+
+	manifest, err := io.ReadAll(io.LimitReader(response, maxManifestSize+1))
+	if err != nil {
+		logger.Error("Updater: Failed to read manifest data: %v", err)
+		return nil, err
+	}
+	if len(manifest) > maxManifestSize {
+		return nil, errors.New("Manifest is too large")
+	}
+	logger.Info("Updater: Read %d bytes from manifest", len(manifest))
+
+	files, err := readFileList(manifest, src.publicKey)
+	if err != nil {
+		logger.Error("Updater: Failed to parse manifest: %v", err)
+		return nil, err
+	}
+	logger.Info("Updater: Manifest parsed successfully, found %d files", len(files))
+
+	updateFound, err := findCandidate(files, src.arch, src.currentVersion)
+	if err != nil {
+		logger.Error("Updater: Error finding candidate: %v", err)
+		return nil, err
+	}
+	if updateFound != nil {
+		// Remember the package of the running version so it can be reinstalled
+		// if the update fails its post-install health check.
+		currentName := fmt.Sprintf(msiArchPrefix, src.arch) + src.currentVersion + msiSuffix
+		if entry, ok := files[currentName]; ok {
+			updateFound.previous = &UpdateFound{
+				name:             currentName,
+				version:          src.currentVersion,
+				hash:             entry.hash,
+				downloadLocation: entry.downloadLocation,
+			}
+		}
+	}
+	return updateFound, nil
+}
+
+// downloadURL resolves the manifest's download location for update against
+// the manifest URL, so relative paths are served by the update server.
+func (u *UpdateFound) downloadURL(manifestURL string) (string, error) {
+	if u.downloadLocation == "" {
+		return "", errors.New("download location not specified in manifest")
+	}
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid manifest URL: %w", err)
+	}
+	location, err := url.Parse(u.downloadLocation)
+	if err != nil {
+		return "", fmt.Errorf("invalid download URL: %w", err)
+	}
+	resolved := base.ResolveReference(location)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", fmt.Errorf("unsupported URL scheme: %s", resolved.Scheme)
+	}
+	return resolved.String(), nil
+}
+
+// downloadAndVerify streams update into dst, reporting progress, and fails
+// unless the BLAKE2b-256 hash matches the signed manifest.
+func downloadAndVerify(fetcher Fetcher, src updateSource, update *UpdateFound, dst io.Writer, progress chan DownloadProgress) error {
+	downloadURL, err := update.downloadURL(src.manifestURL)
+	if err != nil {
+		logger.Error("Updater: %v (file: %s)", err, update.name)
+		return err
+	}
+
+	dp := DownloadProgress{Activity: "Downloading update"}
+	progress <- dp
+
+	logger.Info("Updater: Downloading MSI from: %s", downloadURL)
+	response, err := fetcher.Get(downloadURL, false)
+	if err != nil {
+		logger.Error("Updater: Failed to download MSI: %v", err)
+		return err
+	}
+	defer response.Close()
+
+	length, err := response.Length()
+	if err == nil {
+		logger.Info("Updater: MSI file size: %d bytes", length)
+		dp.BytesTotal = length
+		progress <- dp
+	} else {
+		logger.Warn("Updater: Could not determine MSI file size: %v", err)
+	}
+
+	hasher, err := blake2b.New256(nil)
+	if err != nil {
+		logger.Error("Updater: Failed to create hasher: %v", err)
+		return err
+	}
+	pm := &progressHashWatcher{&dp, progress, hasher}
+	logger.Info("Updater: Starting download (max 100 MiB)")
+	bytesWritten, err := io.Copy(dst, io.TeeReader(io.LimitReader(response, maxUpdateSize), pm))
+	if err != nil {
+		logger.Error("Updater: Download failed: %v (bytes written: %d)", err, bytesWritten)
+		return err
+	}
+	logger.Info("Updater: Download completed: %d bytes written", bytesWritten)
+
+	calculatedHash := hasher.Sum(nil)
+	logger.Info("Updater: Verifying hash - calculated: %x, expected: %x", calculatedHash, update.hash)
+	if !hmac.Equal(calculatedHash, update.hash[:]) {
+		logger.Error("Updater: Hash verification failed!")
+		return errors.New("The downloaded update has the wrong hash")
+	}
+	logger.Info("Updater: Hash verification passed")
+	return nil
+}
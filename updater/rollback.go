@@ -0,0 +1,303 @@
+//go:build windows
+
+package updater
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/fosrl/windows/config"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/sys/windows"
+)
+
+// RollbackPhase is the progress of an update that may need to be undone.
+type RollbackPhase string
+
+const (
+	// RollbackPhasePending means the update was handed to msiexec and the new
+	// version has not passed its health check yet.
+	RollbackPhasePending RollbackPhase = "pending"
+	// RollbackPhaseRollingBack means the health check failed and the previous
+	// package is being reinstalled.
+	RollbackPhaseRollingBack RollbackPhase = "rolling-back"
+	// RollbackPhaseRolledBack means the previous version is running again.
+	// The record is kept so the failed version is not offered again.
+	RollbackPhaseRolledBack RollbackPhase = "rolled-back"
+)
+
+// RollbackRecord is written before an update is installed and describes how
+// to get back to the version it replaces.
+type RollbackRecord struct {
+	Phase           RollbackPhase `json:"phase"`
+	PreviousVersion string        `json:"previousVersion"`
+	PreviousMSI     string        `json:"previousMsi,omitempty"`
+	PreviousMSIHash string        `json:"previousMsiHash,omitempty"`
+	TargetVersion   string        `json:"targetVersion"`
+	// TunnelName is the tunnel that was connected when the update started; the
+	// health check reconnects it if set.
+	TunnelName string    `json:"tunnelName,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+	// FailureReason describes the failed health check once rolling back.
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// UpdateOptions carries manager state that is recorded alongside an update.
+type UpdateOptions struct {
+	// TunnelName is the currently connected tunnel, if any.
+	TunnelName string
+}
+
+const rollbackRecordName = "rollback.json"
+
+// rollbackProperty lets the package of the previous version replace the
+// newer one, which the installer refuses otherwise.
+const rollbackProperty = "PANGOLIN_ROLLBACK=1"
+
+// packagesDir holds the verified MSIs of the running and previous versions.
+func packagesDir() string {
+	return filepath.Join(config.GetProgramDataDir(), "Updates")
+}
+
+func rollbackRecordPath() string {
+	return filepath.Join(packagesDir(), rollbackRecordName)
+}
+
+// ensurePackagesDir creates the packages directory so that only SYSTEM can
+// write to it; its contents are later installed as SYSTEM.
+func ensurePackagesDir() error {
+	dir := packagesDir()
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	sd, err := windows.SecurityDescriptorFromString("O:SYD:PAI(A;OICI;FA;;;SY)(A;OICI;FR;;;BA)")
+	if err != nil {
+		return err
+	}
+	sa := &windows.SecurityAttributes{
+		Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+		SecurityDescriptor: sd,
+	}
+	dir16, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return err
+	}
+	err = windows.CreateDirectory(dir16, sa)
+	if err != nil && !errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		return err
+	}
+	return nil
+}
+
+// LoadRollbackRecord returns the pending rollback record, or nil if there is
+// none.
+func LoadRollbackRecord() (*RollbackRecord, error) {
+	data, err := os.ReadFile(rollbackRecordPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var record RollbackRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse rollback record: %w", err)
+	}
+	return &record, nil
+}
+
+// SaveRollbackRecord persists record.
+func SaveRollbackRecord(record *RollbackRecord) error {
+	if err := ensurePackagesDir(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := rollbackRecordPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, rollbackRecordPath())
+}
+
+// ClearRollbackRecord removes the rollback record, if any.
+func ClearRollbackRecord() error {
+	err := os.Remove(rollbackRecordPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SkippedVersion returns the version that failed its health check and was
+// rolled back, so it is not offered again.
+func SkippedVersion() string {
+	record, err := LoadRollbackRecord()
+	if err != nil || record == nil || record.Phase != RollbackPhaseRolledBack {
+		return ""
+	}
+	return record.TargetVersion
+}
+
+// Rollback reinstalls the previous package recorded in record. It must run
+// as SYSTEM; the manager service is restarted by the installer.
+func Rollback(record *RollbackRecord, reason string) error {
+	if record.PreviousMSI == "" {
+		return errors.New("no package of the previous version was retained")
+	}
+	logger.Warn("Updater: Rolling back from %s to %s: %s", record.TargetVersion, record.PreviousVersion, reason)
+
+	sum, err := hashFile(record.PreviousMSI)
+	if err != nil {
+		return fmt.Errorf("failed to read previous package: %w", err)
+	}
+	expected, err := hex.DecodeString(record.PreviousMSIHash)
+	if err != nil || !hmac.Equal(sum, expected) {
+		return errors.New("previous package does not match its recorded hash")
+	}
+
+	record.Phase = RollbackPhaseRollingBack
+	record.FailureReason = reason
+	if err := SaveRollbackRecord(record); err != nil {
+		return err
+	}
+	// The previous package only replaces a newer version when asked to
+	err = runMsiPath(record.PreviousMSI, 0, rollbackProperty)
+	if err != nil {
+		// msiexec did not take over; the failed version keeps running.
+		record.Phase = RollbackPhasePending
+		SaveRollbackRecord(record)
+		return err
+	}
+	return nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hasher, err := blake2b.New256(nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// retainedPackage is a verified copy of an MSI kept in packagesDir.
+type retainedPackage struct {
+	file *os.File
+	path string
+}
+
+func createRetainedPackage(name string) (*retainedPackage, error) {
+	if err := ensurePackagesDir(); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(packagesDir(), name)
+	file, err := os.Create(path + ".partial")
+	if err != nil {
+		return nil, err
+	}
+	return &retainedPackage{file: file, path: path}, nil
+}
+
+func (p *retainedPackage) Write(b []byte) (int, error) {
+	return p.file.Write(b)
+}
+
+// commit keeps the package after its hash has been verified.
+func (p *retainedPackage) commit() error {
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(p.file.Name(), p.path)
+}
+
+func (p *retainedPackage) discard() {
+	p.file.Close()
+	os.Remove(p.file.Name())
+}
+
+// retainPreviousPackage makes sure a verified MSI of the running version is
+// available for rollback, downloading it if it was not kept from the last
+// update. It returns the path and hash of the package, or an empty path if
+// none is available.
+func retainPreviousPackage(fetcher Fetcher, src updateSource, update *UpdateFound, progress chan DownloadProgress) (string, string) {
+	name := fmt.Sprintf(msiArchPrefix, src.arch) + src.currentVersion + msiSuffix
+	path := filepath.Join(packagesDir(), name)
+	if update.previous != nil {
+		if sum, err := hashFile(path); err == nil && hmac.Equal(sum, update.previous.hash[:]) {
+			logger.Info("Updater: Using retained package for rollback: %s", path)
+			return path, hex.EncodeToString(sum)
+		}
+	} else if sum, err := hashFile(path); err == nil {
+		logger.Info("Updater: Using retained package for rollback: %s", path)
+		return path, hex.EncodeToString(sum)
+	}
+	if update.previous == nil {
+		logger.Warn("Updater: Version %s is not listed in the manifest, rollback will not be possible", src.currentVersion)
+		return "", ""
+	}
+
+	progress <- DownloadProgress{Activity: "Downloading current version for rollback"}
+	retained, err := createRetainedPackage(name)
+	if err != nil {
+		logger.Warn("Updater: Unable to retain package for rollback: %v", err)
+		return "", ""
+	}
+	if err := downloadAndVerify(fetcher, src, update.previous, retained, progress); err != nil {
+		retained.discard()
+		logger.Warn("Updater: Unable to download package for rollback: %v", err)
+		return "", ""
+	}
+	if err := retained.commit(); err != nil {
+		logger.Warn("Updater: Unable to retain package for rollback: %v", err)
+		return "", ""
+	}
+	return path, hex.EncodeToString(update.previous.hash[:])
+}
+
+// pruneRetainedPackages removes retained MSIs other than keep.
+func pruneRetainedPackages(keep ...string) {
+	entries, err := os.ReadDir(packagesDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, msiSuffix) && !strings.HasSuffix(name, msiSuffix+".partial") {
+			continue
+		}
+		path := filepath.Join(packagesDir(), name)
+		kept := false
+		for _, k := range keep {
+			if strings.EqualFold(k, path) {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			logger.Info("Updater: Removing old retained package: %s", name)
+			os.Remove(path)
+		}
+	}
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package updater
 
 import (
@@ -10,7 +8,6 @@ import (
 	"errors"
 	"strings"
 
-	"github.com/fosrl/newt/logger"
 	"golang.org/x/crypto/blake2b"
 )
 
@@ -28,11 +25,13 @@ type fileEntry struct {
 
 type fileList map[string]fileEntry
 
-func readFileList(input []byte) (fileList, error) {
+// readFileList verifies input against publicKeyBase64 and parses the signed
+// list of file hashes.
+func readFileList(input []byte, publicKeyBase64 string) (fileList, error) {
 	logger.Info("Updater: Parsing signed file list (input size: %d bytes)", len(input))
 
 	logger.Info("Updater: Decoding public key from base64")
-	publicKeyBytes, err := base64.StdEncoding.DecodeString(releasePublicKeyBase64)
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(publicKeyBase64)
 	if err != nil || len(publicKeyBytes) != ed25519.PublicKeySize+10 || publicKeyBytes[0] != 'E' || publicKeyBytes[1] != 'd' {
 		logger.Error("Updater: Invalid public key - decode error: %v, length: %d", err, len(publicKeyBytes))
 		return nil, errors.New("Invalid public key")
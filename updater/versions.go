@@ -1,5 +1,3 @@
-//go:build windows
-
 package updater
 
 import (
@@ -7,15 +5,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-
-	"github.com/fosrl/newt/logger"
-	"github.com/fosrl/windows/version"
 )
 
-func versionNewerThanUs(candidate string) (bool, error) {
-	logger.Info("Updater: Comparing versions - candidate: %s, current: %s", candidate, version.Number)
+func versionNewerThan(candidate, current string) (bool, error) {
+	logger.Info("Updater: Comparing versions - candidate: %s, current: %s", candidate, current)
 	candidateParts := strings.Split(candidate, ".")
-	ourParts := strings.Split(version.Number, ".")
+	ourParts := strings.Split(current, ".")
 	logger.Info("Updater: Candidate parts: %v, Current parts: %v", candidateParts, ourParts)
 
 	if len(candidateParts) == 0 || len(ourParts) == 0 {
@@ -61,11 +56,12 @@ func versionNewerThanUs(candidate string) (bool, error) {
 	return false, nil
 }
 
-func findCandidate(candidates fileList) (*UpdateFound, error) {
-	prefix := fmt.Sprintf(msiArchPrefix, version.Arch())
+// findCandidate returns the newest-than-currentVersion MSI for arch listed in
+// candidates, or nil if there is none.
+func findCandidate(candidates fileList, arch, currentVersion string) (*UpdateFound, error) {
+	prefix := fmt.Sprintf(msiArchPrefix, arch)
 	suffix := msiSuffix
-	currentVersion := version.Number
-	logger.Info("Updater: findCandidate() - Current version: %s, Architecture: %s", currentVersion, version.Arch())
+	logger.Info("Updater: findCandidate() - Current version: %s, Architecture: %s", currentVersion, arch)
 	logger.Info("Updater: Looking for files matching prefix: %s, suffix: %s", prefix, suffix)
 	logger.Info("Updater: Total files in manifest: %d", len(candidates))
 
@@ -91,7 +87,7 @@ func findCandidate(candidates fileList) (*UpdateFound, error) {
 			}
 
 			logger.Info("Updater: Comparing candidate version %s with current version %s", candidateVersion, currentVersion)
-			newer, err := versionNewerThanUs(candidateVersion)
+			newer, err := versionNewerThan(candidateVersion, currentVersion)
 			if err != nil {
 				logger.Error("Updater: Version comparison error: %v", err)
 				return nil, fmt.Errorf("error comparing version %s: %w", candidateVersion, err)
@@ -102,6 +98,7 @@ func findCandidate(candidates fileList) (*UpdateFound, error) {
 				logger.Info("Updater: ✓ Update candidate found: %s (hash: %x, location: %s)", name, entry.hash, entry.downloadLocation)
 				return &UpdateFound{
 					name:             name,
+					version:          candidateVersion,
 					hash:             entry.hash,
 					downloadLocation: entry.downloadLocation,
 				}, nil
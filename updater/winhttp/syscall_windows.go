@@ -25,6 +25,16 @@ const (
 	_WINHTTP_FLAG_REFRESH              = _WINHTTP_FLAG_BYPASS_PROXY_CACHE
 
 	_WINHTTP_QUERY_CONTENT_LENGTH = 5
+	_WINHTTP_QUERY_STATUS_CODE    = 19
+	_WINHTTP_QUERY_FLAG_NUMBER    = 0x20000000
+
+	_WINHTTP_AUTOPROXY_AUTO_DETECT = 0x00000001
+	_WINHTTP_AUTOPROXY_CONFIG_URL  = 0x00000002
+
+	_WINHTTP_AUTO_DETECT_TYPE_DHCP  = 0x00000001
+	_WINHTTP_AUTO_DETECT_TYPE_DNS_A = 0x00000002
+
+	_WINHTTP_OPTION_PROXY = 38
 
 	_WINHTTP_OPTION_ENABLE_HTTP_PROTOCOL = 133
 	_WINHTTP_OPTION_SECURE_PROTOCOLS     = 84
@@ -37,6 +47,28 @@ const (
 	_WINHTTP_ERROR_LAST = _WINHTTP_ERROR_BASE + 190
 )
 
+type _WINHTTP_AUTOPROXY_OPTIONS struct {
+	flags                 uint32
+	autoDetectFlags       uint32
+	autoConfigUrl         *uint16
+	reserved1             uintptr
+	reserved2             uint32
+	autoLogonIfChallenged int32
+}
+
+type _WINHTTP_PROXY_INFO struct {
+	accessType  uint32
+	proxy       *uint16
+	proxyBypass *uint16
+}
+
+type _WINHTTP_CURRENT_USER_IE_PROXY_CONFIG struct {
+	autoDetect    int32
+	autoConfigUrl *uint16
+	proxy         *uint16
+	proxyBypass   *uint16
+}
+
 type _URL_COMPONENTS struct {
 	structSize      uint32
 	scheme          *uint16
@@ -64,4 +96,6 @@ type _URL_COMPONENTS struct {
 //sys	winHttpQueryHeaders(requestHandle _HINTERNET, infoLevel uint32, name *uint16, buffer unsafe.Pointer, bufferLen *uint32, index *uint32) (err error) = winhttp.WinHttpQueryHeaders
 //sys	winHttpReadData(requestHandle _HINTERNET, buffer *byte, bufferSize uint32, bytesRead *uint32) (err error) = winhttp.WinHttpReadData
 //sys	winHttpSetOption(sessionOrRequestHandle _HINTERNET, option uint32, buffer unsafe.Pointer, bufferLen uint32) (err error) = winhttp.WinHttpSetOption
-
+//sys	winHttpGetProxyForUrl(sessionHandle _HINTERNET, url *uint16, autoProxyOptions *_WINHTTP_AUTOPROXY_OPTIONS, proxyInfo *_WINHTTP_PROXY_INFO) (err error) = winhttp.WinHttpGetProxyForUrl
+//sys	winHttpGetIEProxyConfigForCurrentUser(proxyConfig *_WINHTTP_CURRENT_USER_IE_PROXY_CONFIG) (err error) = winhttp.WinHttpGetIEProxyConfigForCurrentUser
+//sys	globalFree(mem uintptr) (ret uintptr, err error) [failretval!=0] = kernel32.GlobalFree
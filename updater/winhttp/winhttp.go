@@ -20,15 +20,32 @@ var (
 )
 
 type Session struct {
-	handle _HINTERNET
+	handle        _HINTERNET
+	autoConfigURL string
 }
 
 type Connection struct {
 	handle  _HINTERNET
 	session *Session
+	server  string
+	port    uint16
 	https   bool
 }
 
+// ProxyConfig selects how a session reaches the network. The zero value uses
+// the system (automatic) proxy configuration.
+type ProxyConfig struct {
+	// Direct disables any proxy.
+	Direct bool
+	// Server is an explicit proxy in WinHTTP notation, e.g. "proxy:8080" or
+	// "http=proxy:8080;https=proxy:8443".
+	Server string
+	// Bypass is a semicolon separated list of hosts that skip Server.
+	Bypass string
+	// AutoConfigURL is the location of a PAC script evaluated per request.
+	AutoConfigURL string
+}
+
 type Response struct {
 	handle     _HINTERNET
 	connection *Connection
@@ -57,6 +74,12 @@ func isWin8DotZeroOrBelow() bool {
 }
 
 func NewSession(userAgent string) (session *Session, err error) {
+	return NewSessionWithProxy(userAgent, nil)
+}
+
+// NewSessionWithProxy opens a session using the given proxy configuration.
+// A nil proxy behaves like NewSession.
+func NewSessionWithProxy(userAgent string, proxy *ProxyConfig) (session *Session, err error) {
 	session = new(Session)
 	defer convertError(&err)
 	defer func() {
@@ -73,7 +96,30 @@ func NewSession(userAgent string) (session *Session, err error) {
 	if isWin7() {
 		proxyFlag = _WINHTTP_ACCESS_TYPE_DEFAULT_PROXY
 	}
-	session.handle, err = winHttpOpen(userAgent16, proxyFlag, nil, nil, 0)
+	var proxy16, bypass16 *uint16
+	if proxy != nil {
+		switch {
+		case proxy.Direct:
+			proxyFlag = _WINHTTP_ACCESS_TYPE_NO_PROXY
+		case proxy.Server != "":
+			proxyFlag = _WINHTTP_ACCESS_TYPE_NAMED_PROXY
+			proxy16, err = windows.UTF16PtrFromString(proxy.Server)
+			if err != nil {
+				return
+			}
+			if proxy.Bypass != "" {
+				bypass16, err = windows.UTF16PtrFromString(proxy.Bypass)
+				if err != nil {
+					return
+				}
+			}
+		case proxy.AutoConfigURL != "":
+			// The PAC script is consulted per request, see applyAutoProxy.
+			proxyFlag = _WINHTTP_ACCESS_TYPE_NO_PROXY
+			session.autoConfigURL = proxy.AutoConfigURL
+		}
+	}
+	session.handle, err = winHttpOpen(userAgent16, proxyFlag, proxy16, bypass16, 0)
 	if err != nil {
 		return
 	}
@@ -120,6 +166,8 @@ func (session *Session) Connect(server string, port uint16, https bool) (connect
 	if err != nil {
 		return
 	}
+	connection.server = server
+	connection.port = port
 	connection.https = https
 
 	runtime.SetFinalizer(connection, func(connection *Connection) {
@@ -165,6 +213,12 @@ func (connection *Connection) Get(path string, refresh bool) (response *Response
 	if err != nil {
 		return
 	}
+	if connection.session.autoConfigURL != "" {
+		err = connection.applyAutoProxy(response.handle, path)
+		if err != nil {
+			return
+		}
+	}
 	err = winHttpSendRequest(response.handle, nil, 0, nil, 0, 0, 0)
 	if err != nil {
 		return
@@ -180,6 +234,134 @@ func (connection *Connection) Get(path string, refresh bool) (response *Response
 	return
 }
 
+func (connection *Connection) url(path string) string {
+	scheme := "http"
+	if connection.https {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, connection.server, connection.port, path)
+}
+
+func (connection *Connection) applyAutoProxy(request _HINTERNET, path string) error {
+	proxy, err := connection.session.ProxyForURL(connection.url(path))
+	if err != nil {
+		return err
+	}
+	if proxy == "" {
+		return nil
+	}
+	proxy16, err := windows.UTF16PtrFromString(proxy)
+	if err != nil {
+		return err
+	}
+	info := _WINHTTP_PROXY_INFO{
+		accessType: _WINHTTP_ACCESS_TYPE_NAMED_PROXY,
+		proxy:      proxy16,
+	}
+	return winHttpSetOption(request, _WINHTTP_OPTION_PROXY, unsafe.Pointer(&info), uint32(unsafe.Sizeof(info)))
+}
+
+// ProxyForURL evaluates the session's PAC script for url and returns the
+// proxy list it selects, or an empty string for a direct connection.
+func (session *Session) ProxyForURL(url string) (proxy string, err error) {
+	if session.autoConfigURL == "" {
+		return "", nil
+	}
+	return session.AutoProxyForURL(url, false, session.autoConfigURL)
+}
+
+// AutoProxyForURL runs the automatic proxy configuration for url: the PAC
+// script at autoConfigURL, if any, or else the one found by Web Proxy
+// Auto-Discovery if autoDetect is set. It returns the proxy list selected,
+// or an empty string for a direct connection.
+func (session *Session) AutoProxyForURL(url string, autoDetect bool, autoConfigURL string) (proxy string, err error) {
+	defer convertError(&err)
+	url16, err := windows.UTF16PtrFromString(url)
+	if err != nil {
+		return
+	}
+	options := _WINHTTP_AUTOPROXY_OPTIONS{autoLogonIfChallenged: 1}
+	if autoConfigURL != "" {
+		options.flags |= _WINHTTP_AUTOPROXY_CONFIG_URL
+		options.autoConfigUrl, err = windows.UTF16PtrFromString(autoConfigURL)
+		if err != nil {
+			return
+		}
+	}
+	if autoDetect {
+		options.flags |= _WINHTTP_AUTOPROXY_AUTO_DETECT
+		options.autoDetectFlags = _WINHTTP_AUTO_DETECT_TYPE_DHCP | _WINHTTP_AUTO_DETECT_TYPE_DNS_A
+	}
+	if options.flags == 0 {
+		return "", nil
+	}
+	var info _WINHTTP_PROXY_INFO
+	err = winHttpGetProxyForUrl(session.handle, url16, &options, &info)
+	if err != nil {
+		return
+	}
+	if info.proxy != nil {
+		proxy = windows.UTF16PtrToString(info.proxy)
+		globalFree(uintptr(unsafe.Pointer(info.proxy)))
+	}
+	if info.proxyBypass != nil {
+		globalFree(uintptr(unsafe.Pointer(info.proxyBypass)))
+	}
+	if info.accessType != _WINHTTP_ACCESS_TYPE_NAMED_PROXY {
+		proxy = ""
+	}
+	return
+}
+
+// UserProxyConfig is the proxy configuration of the current user, as set in
+// the proxy settings of Windows.
+type UserProxyConfig struct {
+	// AutoDetect looks for a PAC script with Web Proxy Auto-Discovery.
+	AutoDetect bool
+	// AutoConfigURL is the location of a PAC script.
+	AutoConfigURL string
+	// Proxy is the manual proxy in WinHTTP notation.
+	Proxy string
+	// Bypass lists the hosts that skip Proxy, separated by semicolons.
+	Bypass string
+}
+
+// CurrentUserProxyConfig returns the proxy configuration of the current user.
+func CurrentUserProxyConfig() (config UserProxyConfig, err error) {
+	defer convertError(&err)
+	var ie _WINHTTP_CURRENT_USER_IE_PROXY_CONFIG
+	err = winHttpGetIEProxyConfigForCurrentUser(&ie)
+	if err != nil {
+		return
+	}
+	take := func(s *uint16) string {
+		if s == nil {
+			return ""
+		}
+		defer globalFree(uintptr(unsafe.Pointer(s)))
+		return windows.UTF16PtrToString(s)
+	}
+	config = UserProxyConfig{
+		AutoDetect:    ie.autoDetect != 0,
+		AutoConfigURL: take(ie.autoConfigUrl),
+		Proxy:         take(ie.proxy),
+		Bypass:        take(ie.proxyBypass),
+	}
+	return
+}
+
+// StatusCode returns the HTTP status code of the response.
+func (response *Response) StatusCode() (code int, err error) {
+	defer convertError(&err)
+	var status uint32
+	statusLen := uint32(unsafe.Sizeof(status))
+	err = winHttpQueryHeaders(response.handle, _WINHTTP_QUERY_STATUS_CODE|_WINHTTP_QUERY_FLAG_NUMBER, nil, unsafe.Pointer(&status), &statusLen, nil)
+	if err != nil {
+		return
+	}
+	return int(status), nil
+}
+
 func (response *Response) Length() (length uint64, err error) {
 	defer convertError(&err)
 	numBuf := make([]uint16, 22)
@@ -5,6 +5,8 @@ package winhttp
 import (
 	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/windows"
 )
 
 var _ unsafe.Pointer
@@ -36,8 +38,13 @@ func errnoErr(e syscall.Errno) error {
 }
 
 var (
+	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+
+	procGlobalFree           = modkernel32.NewProc("GlobalFree")
 	procWinHttpCloseHandle   = modwinhttp.NewProc("WinHttpCloseHandle")
 	procWinHttpConnect       = modwinhttp.NewProc("WinHttpConnect")
+	procWinHttpGetIEProxyConfigForCurrentUser = modwinhttp.NewProc("WinHttpGetIEProxyConfigForCurrentUser")
+	procWinHttpGetProxyForUrl = modwinhttp.NewProc("WinHttpGetProxyForUrl")
 	procWinHttpOpen          = modwinhttp.NewProc("WinHttpOpen")
 	procWinHttpOpenRequest   = modwinhttp.NewProc("WinHttpOpenRequest")
 	procWinHttpQueryHeaders = modwinhttp.NewProc("WinHttpQueryHeaders")
@@ -47,6 +54,15 @@ var (
 	procWinHttpSetOption     = modwinhttp.NewProc("WinHttpSetOption")
 )
 
+func globalFree(mem uintptr) (ret uintptr, err error) {
+	r0, _, e1 := syscall.Syscall(procGlobalFree.Addr(), 1, uintptr(mem), 0, 0)
+	ret = uintptr(r0)
+	if ret != 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
 func winHttpCloseHandle(handle _HINTERNET) (err error) {
 	r1, _, e1 := syscall.Syscall(procWinHttpCloseHandle.Addr(), 1, uintptr(handle), 0, 0)
 	if r1 == 0 {
@@ -64,6 +80,22 @@ func winHttpConnect(sessionHandle _HINTERNET, serverName *uint16, serverPort uin
 	return
 }
 
+func winHttpGetIEProxyConfigForCurrentUser(proxyConfig *_WINHTTP_CURRENT_USER_IE_PROXY_CONFIG) (err error) {
+	r1, _, e1 := syscall.Syscall(procWinHttpGetIEProxyConfigForCurrentUser.Addr(), 1, uintptr(unsafe.Pointer(proxyConfig)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func winHttpGetProxyForUrl(sessionHandle _HINTERNET, url *uint16, autoProxyOptions *_WINHTTP_AUTOPROXY_OPTIONS, proxyInfo *_WINHTTP_PROXY_INFO) (err error) {
+	r1, _, e1 := syscall.Syscall6(procWinHttpGetProxyForUrl.Addr(), 4, uintptr(sessionHandle), uintptr(unsafe.Pointer(url)), uintptr(unsafe.Pointer(autoProxyOptions)), uintptr(unsafe.Pointer(proxyInfo)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
 func winHttpOpen(userAgent *uint16, accessType uint32, proxy *uint16, proxyBypass *uint16, flags uint32) (sessionHandle _HINTERNET, err error) {
 	r0, _, e1 := syscall.Syscall6(procWinHttpOpen.Addr(), 5, uintptr(unsafe.Pointer(userAgent)), uintptr(accessType), uintptr(unsafe.Pointer(proxy)), uintptr(unsafe.Pointer(proxyBypass)), uintptr(flags), 0)
 	sessionHandle = _HINTERNET(r0)